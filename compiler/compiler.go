@@ -7,6 +7,7 @@
 //   - Input/output configuration mapping
 //   - Processor chain construction
 //   - Metrics integration with NATS
+//   - Trace context propagation and OTLP export
 //   - Field type and validation mapping
 //
 // The package uses a Fragment builder pattern to construct YAML configurations
@@ -16,6 +17,7 @@ package compiler
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	// Import custom NATS components for registration
@@ -46,7 +48,9 @@ func metricsAPIPrefix(namespace string) string {
 // any transformers into the appropriate Wombat input/output/processor configuration.
 //
 // The function also configures metrics publishing to NATS if the runtime provides
-// the necessary connection details.
+// the necessary connection details, and exports traces to an OTLP collector when
+// one has been configured through the environment (see TracingFromEnv). Use
+// CompileWithContext to configure tracing with the runtime instead (see WithTracing).
 //
 // Parameters:
 //   - rt: Runtime configuration containing component definitions and NATS connection details
@@ -59,7 +63,54 @@ func Compile(rt *runtime.Runtime, steps model.Steps) (string, error) {
 	return CompileWithContext(context.Background(), rt, steps)
 }
 
+// CompileWithContext behaves like Compile, using the correlation ID of the context for
+// logging. See CompileSteps for details.
 func CompileWithContext(ctx context.Context, rt *runtime.Runtime, steps model.Steps) (string, error) {
+	return CompileSteps(ctx, rt, FromModel(steps))
+}
+
+// CompileSteps transforms the steps of a connector into a Wombat YAML configuration,
+// including the step types specific to this runtime (see ConnectorSteps). See
+// CompileStepsWithReport for details.
+func CompileSteps(ctx context.Context, rt *runtime.Runtime, steps ConnectorSteps) (string, error) {
+	report, err := CompileStepsWithReport(ctx, rt, steps)
+	if err != nil {
+		return "", err
+	}
+	return report.Config, nil
+}
+
+// CompilationReport is the outcome of a successful compilation.
+type CompilationReport struct {
+	// Config is the complete Wombat YAML configuration
+	Config string
+	// Defaulted lists the fields whose default was filled in from the component
+	// specifications, located in the steps, e.g. source.config.interval
+	Defaulted []string
+	// Warnings lists the problems which did not stop the compilation, like source
+	// or sink types missing from the component specifications. Wombat still
+	// reports these when the configuration is validated.
+	Warnings []Issue
+}
+
+// CompileStepsWithReport transforms the steps of a connector into a Wombat YAML
+// configuration, including the step types specific to this runtime (see ConnectorSteps).
+//
+// Source and sink configurations are checked against the component specifications
+// embedded in the compiler, or those added to the context (see WithSpecs), before
+// compilation and the defaults of omitted optional fields are filled in (see
+// Specs.ApplyDefaults). Source and sink types missing from the specifications are
+// reported as warnings and their configurations are passed to Wombat unchecked.
+//
+// Parameters:
+//   - ctx: Context carrying the correlation ID and, optionally, overriding component specifications
+//   - rt: Runtime configuration containing component definitions and NATS connection details
+//   - steps: The steps to compile
+//
+// Returns:
+//   - A report holding the complete Wombat configuration, the defaulted fields and the warnings
+//   - An error if the specification is invalid or compilation fails
+func CompileStepsWithReport(ctx context.Context, rt *runtime.Runtime, steps ConnectorSteps) (*CompilationReport, error) {
 	start := time.Now()
 	logger := utils.LoggerWithCorrelation(ctx)
 	logger.Debug().
@@ -70,12 +121,57 @@ func CompileWithContext(ctx context.Context, rt *runtime.Runtime, steps model.St
 
 	// Determine connector type for metrics
 	connectorType := "unknown"
-	if steps.Producer != nil && steps.Source != nil {
+	if steps.Producer != nil && (steps.Source != nil || len(steps.Sources) > 0) {
 		connectorType = "inlet"
-	} else if steps.Consumer != nil && steps.Sink != nil {
+	} else if steps.Consumer != nil && (steps.Sink != nil || len(steps.Sinks) > 0) {
 		connectorType = "outlet"
 	}
 
+	// Check the source and sink configurations before handing them to Wombat, so
+	// problems are reported against the Connect specification of the component
+	specs, err := specsFor(ctx)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to load component specifications")
+		RecordCompilationMetrics(start, false, connectorType)
+		return nil, NewCompilationError("validation", "steps", "failed to load the component specifications", err)
+	}
+
+	issues := specs.Check(model.Steps{Source: steps.Source, Sink: steps.Sink})
+	issues = append(issues, specs.CheckSources(steps.Sources)...)
+	issues = append(issues, specs.CheckSinks(steps.Sinks)...)
+
+	var warnings []Issue
+	issues = slices.DeleteFunc(issues, func(issue Issue) bool {
+		if issue.Code != CodeUnknownComponent {
+			return false
+		}
+		warnings = append(warnings, issue)
+		return true
+	})
+	for _, w := range warnings {
+		logger.Warn().Str("path", w.Path).Msg(w.Message)
+	}
+
+	if len(issues) > 0 {
+		logger.Error().Int("issues", len(issues)).Msg("Configuration does not match the component specifications")
+		RecordCompilationMetrics(start, false, connectorType)
+		return nil, NewValidationError("steps", "configuration does not match the component specifications", nil).
+			WithCode(CodeInvalidConfiguration).
+			WithIssues(issues...)
+	}
+
+	defaultedSteps, defaulted := specs.ApplyDefaults(model.Steps{Source: steps.Source, Sink: steps.Sink})
+	steps.Source, steps.Sink = defaultedSteps.Source, defaultedSteps.Sink
+
+	var defaultedSources, defaultedSinks []string
+	steps.Sources, defaultedSources = specs.ApplySourcesDefaults(steps.Sources)
+	steps.Sinks, defaultedSinks = specs.ApplySinksDefaults(steps.Sinks)
+	defaulted = append(defaulted, defaultedSources...)
+	defaulted = append(defaulted, defaultedSinks...)
+	if len(defaulted) > 0 {
+		logger.Debug().Strs("defaulted", defaulted).Msg("Applied component defaults")
+	}
+
 	mainCfg := Frag()
 
 	if rt.NatsUrl != "" && rt.Namespace != "" && rt.Instance != "" {
@@ -105,33 +201,124 @@ func CompileWithContext(ctx context.Context, rt *runtime.Runtime, steps model.St
 				Fragment("nats", natsCfg))
 	}
 
-	var err error
-	if steps.Producer != nil && steps.Source != nil {
+	var processor, buffer Fragment
+	if steps.Transformer != nil {
+		transformer, aggregate := splitAggregate(*steps.Transformer)
+		processor, err = compileTransformer(rt, transformer)
+		if err == nil && aggregate != nil {
+			buffer, err = compileAggregateTransformer(rt, aggregate)
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to compile transformer")
+			RecordCompilationMetrics(start, false, connectorType)
+			return nil, NewCompilationError("processors", "transformer", "failed to compile transformer", err).
+				WithCode(CodeInvalidTransformer)
+		}
+	}
+
+	var input, output Fragment
+	if steps.Producer != nil && steps.Source != nil && len(steps.Sources) > 0 {
+		logger.Error().Msg("Invalid steps configuration: both source and sources are set")
+		RecordCompilationMetrics(start, false, connectorType)
+		return nil, NewCompilationError("validation", "steps", "invalid steps configuration: source and sources are mutually exclusive", nil).
+			WithCode(CodeInvalidSteps)
+	} else if steps.Producer != nil && len(steps.Sources) > 0 {
+		logger.Debug().Int("sources", len(steps.Sources)).Msg("Compiling multi-source inlet connector (sources -> producer)")
+		producer, err := compileRoutedProducer(*steps.Producer)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to compile producer")
+			RecordCompilationMetrics(start, false, connectorType)
+			return nil, NewCompilationError("output", "producer", "failed to compile producer", err).
+				WithCode(CodeInvalidProducer)
+		}
+
+		sources, err := compileSources(rt, steps.Sources, processor)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to compile sources")
+			RecordCompilationMetrics(start, false, connectorType)
+			return nil, NewCompilationError("input", "sources", "failed to compile sources", err).
+				WithCode(CodeInvalidSource)
+		}
+
+		input = sources
+		output = producer
+	} else if steps.Producer != nil && steps.Source != nil {
 		logger.Debug().Msg("Compiling inlet connector (source -> producer)")
-		producer, err := compileProducer(*steps.Producer)
+		producer, err := compileRoutedProducer(*steps.Producer)
 		if err != nil {
 			logger.Error().Err(err).Msg("Failed to compile producer")
 			RecordCompilationMetrics(start, false, connectorType)
-			return "", NewCompilationError("output", "producer", "failed to compile producer", err)
+			return nil, NewCompilationError("output", "producer", "failed to compile producer", err).
+				WithCode(CodeInvalidProducer)
+		}
+
+		input = compileSource(*steps.Source, processor)
+		output = producer
+	} else if steps.Consumer != nil && steps.Sink != nil && len(steps.Sinks) > 0 {
+		logger.Error().Msg("Invalid steps configuration: both sink and sinks are set")
+		RecordCompilationMetrics(start, false, connectorType)
+		return nil, NewCompilationError("validation", "steps", "invalid steps configuration: sink and sinks are mutually exclusive", nil).
+			WithCode(CodeInvalidSteps)
+	} else if steps.Consumer != nil && len(steps.Sinks) > 0 {
+		logger.Debug().Int("sinks", len(steps.Sinks)).Msg("Compiling fan-out outlet connector (consumer -> sinks)")
+		consumer, err := compileConsumerInput(*steps.Consumer, processor)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to compile consumer")
+			RecordCompilationMetrics(start, false, connectorType)
+			return nil, NewCompilationError("input", "consumer", "failed to compile consumer", err).
+				WithCode(CodeInvalidConsumer)
+		}
+
+		sinks, err := compileSinks(rt, steps.Sinks)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to compile sinks")
+			RecordCompilationMetrics(start, false, connectorType)
+			return nil, NewCompilationError("output", "sinks", "failed to compile sinks", err).
+				WithCode(CodeInvalidSink)
 		}
 
-		mainCfg.Fragment("input", compileSource(*steps.Source, steps.Transformer))
-		mainCfg.Fragment("output", producer)
+		input = consumer
+		output = sinks
 	} else if steps.Consumer != nil && steps.Sink != nil {
 		logger.Debug().Msg("Compiling outlet connector (consumer -> sink)")
-		consumer, err := compileConsumer(*steps.Consumer, steps.Transformer)
+		consumer, err := compileConsumerInput(*steps.Consumer, processor)
 		if err != nil {
 			logger.Error().Err(err).Msg("Failed to compile consumer")
 			RecordCompilationMetrics(start, false, connectorType)
-			return "", NewCompilationError("input", "consumer", "failed to compile consumer", err)
+			return nil, NewCompilationError("input", "consumer", "failed to compile consumer", err).
+				WithCode(CodeInvalidConsumer)
 		}
 
-		mainCfg.Fragment("input", consumer)
-		mainCfg.Fragment("output", compileSink(*steps.Sink))
+		input = consumer
+		output = compileSink(*steps.Sink)
 	} else {
 		logger.Error().Msg("Invalid steps configuration: missing required components")
 		RecordCompilationMetrics(start, false, connectorType)
-		return "", NewCompilationError("validation", "steps", "invalid steps configuration: missing required components", nil)
+		return nil, NewCompilationError("validation", "steps", "invalid steps configuration: missing required components", nil).
+			WithCode(CodeInvalidSteps)
+	}
+
+	output = rejectErrored(input, output)
+	output = releaseDeduped(input, output)
+
+	if tracing := tracingFor(ctx); tracing != nil {
+		logger.Debug().
+			Str("endpoint", tracing.Endpoint).
+			Str("protocol", tracing.Protocol).
+			Msg("Configuring OTLP tracing")
+
+		propagateTraceContext(input, output)
+		mainCfg.Fragment("tracer", compileTracer(rt, *tracing))
+	}
+
+	mainCfg.Fragment("input", input)
+	mainCfg.Fragment("output", output)
+	if buffer != nil {
+		mainCfg.Fragment("buffer", buffer)
+	}
+
+	if rateLimits := hoistRateLimits(mainCfg); len(rateLimits) > 0 {
+		mainCfg.Fragments("rate_limit_resources", rateLimits...)
 	}
 
 	logger.Debug().Msg("Marshaling configuration to YAML")
@@ -139,10 +326,11 @@ func CompileWithContext(ctx context.Context, rt *runtime.Runtime, steps model.St
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to marshal configuration")
 		RecordCompilationMetrics(start, false, connectorType)
-		return "", NewCompilationError("marshal", "yaml", "failed to marshal configuration", err)
+		return nil, NewCompilationError("marshal", "yaml", "failed to marshal configuration", err).
+			WithCode(CodeMarshalFailed)
 	}
 
 	RecordCompilationMetrics(start, true, connectorType)
 	logger.Debug().Int("config_length", len(b)).Msg("Compilation completed successfully")
-	return string(b), nil
+	return &CompilationReport{Config: string(b), Defaulted: defaulted, Warnings: warnings}, nil
 }
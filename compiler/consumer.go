@@ -2,10 +2,19 @@ package compiler
 
 import (
 	"fmt"
+	"slices"
+	"time"
 
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
 	"github.com/synadia-io/connect/model"
 )
 
+// ClaimCheckFailedMetric is the name of the counter incremented for every message whose offloaded payload could not be restored
+const ClaimCheckFailedMetric = "claim_check_failed"
+
+// ClaimCheckMissingMetric is the name of the counter incremented for every message dropped because its offloaded payload no longer exists
+const ClaimCheckMissingMetric = "claim_check_missing"
+
 // compileConsumer transforms a Connect consumer specification into a Wombat input configuration.
 // A consumer reads from NATS (core, stream, or key-value) and processes messages.
 //
@@ -14,12 +23,12 @@ import (
 //
 // Parameters:
 //   - m: The consumer step containing the NATS configuration
-//   - t: Optional transformer step for message processing
+//   - t: Optional compiled transformer for message processing
 //
 // Returns:
 //   - A Fragment containing the Wombat input configuration
 //   - An error if validation fails or multiple consumer types are specified
-func compileConsumer(m model.ConsumerStep, t *model.TransformerStep) (Fragment, error) {
+func compileConsumer(m model.ConsumerStep, t Fragment) (Fragment, error) {
 	types := 0
 	var result Fragment
 	if m.Core != nil {
@@ -33,7 +42,10 @@ func compileConsumer(m model.ConsumerStep, t *model.TransformerStep) (Fragment,
 	}
 
 	if m.Kv != nil {
-		result = compileKvConsumer(m)
+		var err error
+		if result, err = compileKvConsumer(m.Nats, ConsumerKv{Bucket: m.Kv.Bucket, Key: m.Kv.Key}); err != nil {
+			return nil, err
+		}
 		types++
 	}
 
@@ -42,7 +54,7 @@ func compileConsumer(m model.ConsumerStep, t *model.TransformerStep) (Fragment,
 	}
 
 	if t != nil {
-		result.Fragments("processors", compileTransformer(*t))
+		result.Fragments("processors", t)
 	}
 
 	return result, nil
@@ -64,9 +76,231 @@ func compileStreamConsumer(m model.ConsumerStep) Fragment {
 
 }
 
-func compileKvConsumer(m model.ConsumerStep) Fragment {
-	return Frag().
-		Fragment("nats_kv", natsBaseFragment(m.Nats).
-			String("bucket", m.Kv.Bucket).
-			String("key", m.Kv.Key))
+// compileStreamPullConsumer creates a Wombat configuration reading a stream subject through a
+// pull consumer, with the fetch settings of the consumer.
+func compileStreamPullConsumer(nats model.NatsConfig, stream ConsumerStream) (Fragment, error) {
+	pull := stream.Pull
+	if pull.Batch < 0 {
+		return nil, fmt.Errorf("invalid stream pull batch %d", pull.Batch)
+	}
+	if pull.MaxBytes < 0 {
+		return nil, fmt.Errorf("invalid stream pull max bytes %d", pull.MaxBytes)
+	}
+	if pull.Fetchers < 0 {
+		return nil, fmt.Errorf("invalid stream pull fetchers %d", pull.Fetchers)
+	}
+
+	expiry := 30 * time.Second
+	if pull.Expiry != "" {
+		var err error
+		if expiry, err = time.ParseDuration(pull.Expiry); err != nil || expiry < time.Second {
+			return nil, fmt.Errorf("invalid stream pull expiry %q, expected at least 1s", pull.Expiry)
+		}
+	}
+	if pull.Heartbeat != "" {
+		if d, err := time.ParseDuration(pull.Heartbeat); err != nil || d <= 0 || d > expiry/2 {
+			return nil, fmt.Errorf("invalid stream pull heartbeat %q, expected at most half the expiry", pull.Heartbeat)
+		}
+	}
+
+	input := natsBaseFragment(nats).
+		String("subject", stream.Subject)
+	for field, value := range map[string]int{
+		"batch":     pull.Batch,
+		"max_bytes": pull.MaxBytes,
+		"fetchers":  pull.Fetchers,
+	} {
+		if value > 0 {
+			input.Int(field, value)
+		}
+	}
+	for field, value := range map[string]string{
+		"durable":   pull.Durable,
+		"expiry":    pull.Expiry,
+		"heartbeat": pull.Heartbeat,
+	} {
+		if value != "" {
+			input.String(field, value)
+		}
+	}
+
+	return Frag().Fragment("nats_jetstream_pull", input), nil
+}
+
+// kvDeliveries are the entries a kv consumer can deliver when the connector starts
+var kvDeliveries = []string{"snapshot", "history", "updates"}
+
+// kvMetadataMapping sets the kv_bucket, kv_key, kv_revision, kv_operation and kv_created metadata
+// of the entries read by the nats_kv input from its nats_kv_* metadata, like nats_kv_watch does.
+const kvMetadataMapping = `meta kv_bucket = @nats_kv_bucket
+meta kv_key = @nats_kv_key
+meta kv_revision = @nats_kv_revision.string()
+meta kv_operation = match @nats_kv_operation {
+  "KeyValueDeleteOp" => "delete"
+  "KeyValuePurgeOp" => "purge"
+  _ => "put"
+}
+meta kv_created = @nats_kv_created.ts_format()`
+
+// compileKvConsumer creates a Wombat configuration watching the keys of a NATS KV bucket. The
+// nats_kv input delivers the latest value of every key, or with the history every value kept by
+// the bucket, before the updates. Only delivering the updates requires the nats_kv_watch input,
+// which keeps no position: the entries written while it reconnects or the connector is stopped
+// are lost.
+func compileKvConsumer(nats model.NatsConfig, kv ConsumerKv) (Fragment, error) {
+	if kv.Deliver != "" && !slices.Contains(kvDeliveries, kv.Deliver) {
+		return nil, fmt.Errorf("unknown kv delivery %q, expected one of %v", kv.Deliver, kvDeliveries)
+	}
+
+	input := natsBaseFragment(nats).
+		String("bucket", kv.Bucket).
+		String("key", kv.Key)
+	if kv.IgnoreDeletes {
+		input.Bool("ignore_deletes", true)
+	}
+
+	if kv.Deliver == "updates" {
+		return Frag().Fragment("nats_kv_watch", input), nil
+	}
+	if kv.Deliver == "history" {
+		input.Bool("include_history", true)
+	}
+
+	return Frag().Fragment("nats_kv", input), nil
+}
+
+// compileObjectStoreConsumer creates a Wombat configuration reading the objects of a NATS
+// object store bucket as they are put or updated, broken into messages by the scanner if any.
+func compileObjectStoreConsumer(c Consumer) (Fragment, error) {
+	if c.ObjectStore.Bucket == "" {
+		return nil, fmt.Errorf("an object store consumer requires a bucket")
+	}
+
+	input := natsBaseFragment(c.Nats).
+		String("bucket", c.ObjectStore.Bucket)
+	if c.ObjectStore.UpdatesOnly {
+		input.Bool("updates_only", true)
+	}
+	if len(c.ObjectStore.Scanner) > 0 {
+		input.Fragment("scanner", c.ObjectStore.Scanner)
+	}
+
+	return Frag().Fragment("nats_object_store", input), nil
+}
+
+// compileServiceConsumer creates a Wombat configuration reading the requests of a NATS micro
+// service endpoint, which are replied to once their message is written.
+func compileServiceConsumer(c Consumer) (Fragment, error) {
+	if c.Service.Name == "" {
+		return nil, fmt.Errorf("a service consumer requires a name")
+	}
+	if c.Service.Endpoint == "" {
+		return nil, fmt.Errorf("a service consumer requires an endpoint")
+	}
+
+	input := natsBaseFragment(c.Nats).
+		String("name", c.Service.Name).
+		String("endpoint", c.Service.Endpoint)
+	for field, value := range map[string]string{
+		"version":     c.Service.Version,
+		"description": c.Service.Description,
+		"subject":     c.Service.Subject,
+		"queue_group": c.Service.QueueGroup,
+	} {
+		if value != "" {
+			input.String(field, value)
+		}
+	}
+
+	return Frag().Fragment("nats_micro", input), nil
+}
+
+// compileConsumerSource compiles the source of a consumer like compileConsumer, along with the
+// options of its stream, kv, object store or service source.
+func compileConsumerSource(c Consumer, t Fragment) (Fragment, error) {
+	pull := c.Stream != nil && c.Stream.Pull != nil
+	if !pull && c.ObjectStore == nil && c.Kv == nil && c.Service == nil {
+		return compileConsumer(c.step(), t)
+	}
+
+	types := 0
+	for _, set := range []bool{c.Core != nil, c.Stream != nil, c.Kv != nil, c.ObjectStore != nil, c.Service != nil} {
+		if set {
+			types++
+		}
+	}
+	if types != 1 {
+		return nil, fmt.Errorf("exactly one consumer type (core, stream, kv, object_store, service) must be defined")
+	}
+
+	var result Fragment
+	var err error
+	switch {
+	case c.Stream != nil:
+		result, err = compileStreamPullConsumer(c.Nats, *c.Stream)
+	case c.Kv != nil:
+		result, err = compileKvConsumer(c.Nats, *c.Kv)
+	case c.ObjectStore != nil:
+		result, err = compileObjectStoreConsumer(c)
+	default:
+		result, err = compileServiceConsumer(c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		result.Fragments("processors", t)
+	}
+
+	return result, nil
+}
+
+// compileConsumerInput creates the Wombat input configuration of a consumer like
+// compileConsumerSource, setting the standard metadata of the entries read by a kv consumer
+// (see kvMetadataMapping), restoring the payloads offloaded to an object store when the consumer
+// has a claim check, then applying its header policy, ahead of the transformer. The messages
+// whose payload no longer exists in the object store, for example because its TTL expired, are
+// dropped and increment the ClaimCheckMissingMetric counter, since delivering them again would
+// not restore them. The other messages whose payload cannot be restored, for example while the
+// object store cannot be reached, are logged with the reason of the failure and increment the
+// ClaimCheckFailedMetric counter, but stay errored so that the output rejects them and the
+// consumer delivers them again. The
+// messages of a service replying with the message are added as the synchronous response of
+// their request after the transformer.
+func compileConsumerInput(c Consumer, t Fragment) (Fragment, error) {
+	headers, err := compileHeaderPolicy(c.Headers)
+	if err != nil {
+		return nil, err
+	}
+	reply := c.Service != nil && c.Service.Reply
+	kvMetadata := c.Kv != nil && c.Kv.Deliver != "updates"
+	if !c.ClaimCheck && len(headers) == 0 && !reply && !kvMetadata {
+		return compileConsumerSource(c, t)
+	}
+
+	result, err := compileConsumerSource(c, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var processors []Fragment
+	if kvMetadata {
+		processors = append(processors, Frag().String("mutation", kvMetadataMapping))
+	}
+	if c.ClaimCheck {
+		processors = append(processors,
+			Frag().Fragment("nats_object_rehydrate", natsBaseFragment(c.Nats)),
+			dropErroredIf(fmt.Sprintf("errored() && error().or(\"\").has_prefix(%q)", nats.MissingPayloadError),
+				"Dropping message whose payload no longer exists", ClaimCheckMissingMetric),
+			logErrored("Rejecting message whose payload could not be restored", ClaimCheckFailedMetric))
+	}
+	processors = append(processors, headers...)
+	if t != nil {
+		processors = append(processors, t)
+	}
+	if reply {
+		processors = append(processors, Frag().Fragment("sync_response", Frag()))
+	}
+
+	return result.Fragments("processors", processors...), nil
 }
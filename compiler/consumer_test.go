@@ -1,8 +1,10 @@
 package compiler
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
 	. "github.com/synadia-io/connect/builders"
 	"github.com/synadia-io/connect/model"
 )
@@ -55,6 +57,69 @@ func TestCompileStreamConsumer(t *testing.T) {
 				String("subject", "foo")),
 		},
 	)
+
+	nats := ncb.Build()
+
+	t.Run("should render a stream consumer with its pull settings", func(t *testing.T) {
+		res, err := compileConsumerSource(Consumer{Nats: nats, Stream: &ConsumerStream{
+			Subject: "orders.>",
+			Pull: &StreamPull{
+				Durable:   "orders",
+				Batch:     500,
+				MaxBytes:  1 << 20,
+				Expiry:    "5s",
+				Heartbeat: "1s",
+				Fetchers:  4,
+			},
+		}}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().Fragment("nats_jetstream_pull", Frag().
+			Strings("urls", DefaultNatsUrl).
+			String("subject", "orders.>").
+			String("durable", "orders").
+			Int("batch", 500).
+			Int("max_bytes", 1<<20).
+			String("expiry", "5s").
+			String("heartbeat", "1s").
+			Int("fetchers", 4))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should render a pull consumer with the default settings", func(t *testing.T) {
+		res, err := compileConsumerSource(Consumer{Nats: nats, Stream: &ConsumerStream{Subject: "orders.>", Pull: &StreamPull{}}}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().Fragment("nats_jetstream_pull", Frag().
+			Strings("urls", DefaultNatsUrl).
+			String("subject", "orders.>"))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	for name, pull := range map[string]StreamPull{
+		"a negative batch":                   {Batch: -1},
+		"a negative max bytes":               {MaxBytes: -1},
+		"negative fetchers":                  {Fetchers: -1},
+		"an expiry below a second":           {Expiry: "500ms"},
+		"an invalid expiry":                  {Expiry: "soon"},
+		"a heartbeat above half the expiry":  {Expiry: "2s", Heartbeat: "2s"},
+		"a heartbeat above the default half": {Heartbeat: "20s"},
+	} {
+		t.Run("should fail with "+name, func(t *testing.T) {
+			_, err := compileConsumerSource(Consumer{Nats: nats, Stream: &ConsumerStream{Subject: "orders.>", Pull: &pull}}, nil)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
 }
 
 func TestCompileKvConsumer(t *testing.T) {
@@ -68,15 +133,127 @@ func TestCompileKvConsumer(t *testing.T) {
 				String("key", "bar")),
 		},
 	)
+
+	nats := ncb.Build()
+
+	t.Run("should render a kv consumer delivering the history without the deletes", func(t *testing.T) {
+		res, err := compileConsumerSource(Consumer{Nats: nats, Kv: &ConsumerKv{
+			Bucket:        "foo",
+			Key:           "bar.>",
+			Deliver:       "history",
+			IgnoreDeletes: true,
+		}}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().Fragment("nats_kv", Frag().
+			Strings("urls", DefaultNatsUrl).
+			String("bucket", "foo").
+			String("key", "bar.>").
+			Bool("include_history", true).
+			Bool("ignore_deletes", true))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should watch the updates of a kv consumer only delivering the updates", func(t *testing.T) {
+		res, err := compileConsumerSource(Consumer{Nats: nats, Kv: &ConsumerKv{Bucket: "foo", Key: "bar", Deliver: "updates"}}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().Fragment("nats_kv_watch", Frag().
+			Strings("urls", DefaultNatsUrl).
+			String("bucket", "foo").
+			String("key", "bar"))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should set the standard metadata of the entries read by a kv consumer", func(t *testing.T) {
+		res, err := compileConsumerInput(Consumer{Nats: nats, Kv: &ConsumerKv{Bucket: "foo", Key: "bar"}}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().Fragment("nats_kv", Frag().
+			Strings("urls", DefaultNatsUrl).
+			String("bucket", "foo").
+			String("key", "bar")).
+			Fragments("processors", Frag().String("mutation", kvMetadataMapping))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should fail with an unknown delivery", func(t *testing.T) {
+		_, err := compileConsumerSource(Consumer{Nats: nats, Kv: &ConsumerKv{Bucket: "foo", Key: "bar", Deliver: "latest"}}, nil)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("should fail with both a kv and an object store", func(t *testing.T) {
+		_, err := compileConsumerSource(Consumer{
+			Nats:        nats,
+			Kv:          &ConsumerKv{Bucket: "foo", Key: "bar"},
+			ObjectStore: &ConsumerObjectStore{Bucket: "reports"},
+		}, nil)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestCompileObjectStoreConsumer(t *testing.T) {
+	nats := ncb.Build()
+
+	t.Run("should render an object store consumer with its scanner", func(t *testing.T) {
+		res, err := compileConsumerSource(Consumer{Nats: nats, ObjectStore: &ConsumerObjectStore{
+			Bucket:      "reports",
+			UpdatesOnly: true,
+			Scanner:     map[string]any{"lines": map[string]any{}},
+		}}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().Fragment("nats_object_store", Frag().
+			Strings("urls", DefaultNatsUrl).
+			String("bucket", "reports").
+			Bool("updates_only", true).
+			Fragment("scanner", Frag().Fragment("lines", Frag())))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should error if the object store is invalid or not the only source", func(t *testing.T) {
+		core := ConsumerStepCore("foo").Build()
+		for _, c := range []Consumer{
+			{Nats: nats, ObjectStore: &ConsumerObjectStore{}},
+			{Nats: nats, Core: &core, ObjectStore: &ConsumerObjectStore{Bucket: "reports"}},
+		} {
+			if _, err := compileConsumerSource(c, nil); err == nil {
+				t.Errorf("expected error for %+v, got nil", c)
+			}
+		}
+	})
 }
 
 func runConsumerStepTests(t *testing.T, tests ...consumerStepTest) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var tf *model.TransformerStep
+			var tf Fragment
 			if tt.transformer != nil {
-				tr := tt.transformer.Build()
-				tf = &tr
+				var err error
+				tf, err = compileTransformer(nil, transformerFromModel(tt.transformer.Build()))
+				if err != nil {
+					t.Fatalf("failed to compile transformer: %v", err)
+				}
 			}
 
 			res, err := compileConsumer(tt.step.Build(), tf)
@@ -90,3 +267,96 @@ func runConsumerStepTests(t *testing.T, tests ...consumerStepTest) {
 		})
 	}
 }
+
+func TestCompileClaimCheckedConsumer(t *testing.T) {
+	step := ConsumerStep(ncb).Core(ConsumerStepCore("foo")).Build()
+	transformer := Frag().String("mapping", "root = this")
+	rehydrate := Frag().Fragment("nats_object_rehydrate", Frag().
+		Strings("urls", DefaultNatsUrl))
+
+	t.Run("should restore payloads ahead of the transformer", func(t *testing.T) {
+		res, err := compileConsumerInput(Consumer{Core: step.Core, Nats: step.Nats, ClaimCheck: true}, transformer)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().
+			Fragment("nats", Frag().
+				Strings("urls", DefaultNatsUrl).
+				String("subject", "foo")).
+			Fragments("processors",
+				rehydrate,
+				dropErroredIf(fmt.Sprintf("errored() && error().or(\"\").has_prefix(%q)", nats.MissingPayloadError),
+					"Dropping message whose payload no longer exists", ClaimCheckMissingMetric),
+				logErrored("Rejecting message whose payload could not be restored", ClaimCheckFailedMetric),
+				transformer)
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should reject the messages whose payload could not be restored", func(t *testing.T) {
+		input, err := compileConsumerInput(Consumer{Core: step.Core, Nats: step.Nats, ClaimCheck: true}, transformer)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		sink := Frag().Fragment("stdout", Frag())
+		exp := Frag().Fragment("reject_errored", Frag().Fragment("stdout", Frag()))
+		if res := rejectErrored(input, sink); !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should render the consumer alone without a claim check", func(t *testing.T) {
+		res, err := compileConsumerInput(Consumer{Core: step.Core, Nats: step.Nats}, transformer)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp, _ := compileConsumer(step, transformer)
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+}
+
+func TestCompileServiceConsumer(t *testing.T) {
+	nats := ncb.Build()
+
+	t.Run("should render a service consumer replying with the transformed message", func(t *testing.T) {
+		transformer := Frag().String("mapping", "root = this")
+		res, err := compileConsumerInput(Consumer{Nats: nats, Service: &ConsumerService{
+			Name:     "orders",
+			Endpoint: "store",
+			Subject:  "orders.store",
+			Reply:    true,
+		}}, transformer)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().
+			Fragment("nats_micro", Frag().
+				Strings("urls", DefaultNatsUrl).
+				String("name", "orders").
+				String("endpoint", "store").
+				String("subject", "orders.store")).
+			Fragments("processors", transformer, Frag().Fragment("sync_response", Frag()))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should error if the service is invalid or not the only consumer type", func(t *testing.T) {
+		for _, c := range []Consumer{
+			{Nats: nats, Service: &ConsumerService{Endpoint: "store"}},
+			{Nats: nats, Service: &ConsumerService{Name: "orders"}},
+			{Nats: nats, Service: &ConsumerService{Name: "orders", Endpoint: "store"}, Core: &model.ConsumerStepCore{Subject: "foo"}},
+		} {
+			if _, err := compileConsumerInput(c, nil); err == nil {
+				t.Errorf("expected error for %+v, got nil", c)
+			}
+		}
+	})
+}
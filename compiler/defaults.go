@@ -0,0 +1,170 @@
+package compiler
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/synadia-io/connect/model"
+)
+
+// ApplyDefaults fills in the defaults declared by the component specifications for
+// the optional fields omitted from the source and sink configurations, so the
+// compiled configuration matches the documented behavior of the component rather
+// than the defaults of Wombat. Nested fields are only defaulted when their parent
+// object is part of the configuration. Defaults that do not match the type of their
+// field, or of fields the wrapped Wombat component does not know, are skipped.
+//
+// Parameters:
+//   - steps: The Connect model steps to apply the defaults to, which are left unmodified
+//
+// Returns:
+//   - A copy of the steps with the defaults applied
+//   - The paths of the fields which were defaulted, e.g. source.config.interval
+func (s *Specs) ApplyDefaults(steps model.Steps) (model.Steps, []string) {
+	var defaulted []string
+
+	if steps.Source != nil {
+		if c, ok := s.sources[steps.Source.Type]; ok {
+			source := *steps.Source
+			source.Config = cloneConfig(source.Config)
+			defaulted = append(defaulted, applyDefaults([]string{"source", "config"}, topLevelFields(c), source.Config, wombatFields("input", source.Type))...)
+			steps.Source = &source
+		}
+	}
+
+	if steps.Sink != nil {
+		if c, ok := s.sinks[steps.Sink.Type]; ok {
+			sink := *steps.Sink
+			sink.Config = cloneConfig(sink.Config)
+			defaulted = append(defaulted, applyDefaults([]string{"sink", "config"}, topLevelFields(c), sink.Config, wombatFields("output", sink.Type))...)
+			steps.Sink = &sink
+		}
+	}
+
+	return steps, defaulted
+}
+
+// ApplySourcesDefaults fills in the defaults of the sources of a multi-source inlet, like
+// ApplyDefaults does for a single source.
+//
+// Parameters:
+//   - sources: The sources to apply the defaults to, which are left unmodified
+//
+// Returns:
+//   - A copy of the sources with the defaults applied
+//   - The paths of the fields which were defaulted, e.g. sources.0.config.interval
+func (s *Specs) ApplySourcesDefaults(sources []MergedSource) ([]MergedSource, []string) {
+	var defaulted []string
+
+	result := slices.Clone(sources)
+	for i, source := range result {
+		if c, ok := s.sources[source.Type]; ok {
+			source.Config = cloneConfig(source.Config)
+			defaulted = append(defaulted, applyDefaults([]string{"sources", strconv.Itoa(i), "config"}, topLevelFields(c), source.Config, wombatFields("input", source.Type))...)
+			result[i] = source
+		}
+	}
+
+	return result, defaulted
+}
+
+// ApplySinksDefaults fills in the defaults of the sinks of a fan-out outlet, like
+// ApplyDefaults does for a single sink.
+//
+// Parameters:
+//   - sinks: The sinks to apply the defaults to, which are left unmodified
+//
+// Returns:
+//   - A copy of the sinks with the defaults applied
+//   - The paths of the fields which were defaulted, e.g. sinks.0.config.max_in_flight
+func (s *Specs) ApplySinksDefaults(sinks []FanOutSink) ([]FanOutSink, []string) {
+	var defaulted []string
+
+	result := slices.Clone(sinks)
+	for i, sink := range result {
+		if c, ok := s.sinks[sink.Type]; ok {
+			sink.Config = cloneConfig(sink.Config)
+			defaulted = append(defaulted, applyDefaults([]string{"sinks", strconv.Itoa(i), "config"}, topLevelFields(c), sink.Config, wombatFields("output", sink.Type))...)
+			result[i] = sink
+		}
+	}
+
+	return result, defaulted
+}
+
+func applyDefaults(path []string, fields map[string]*model.ComponentField, cfg map[string]any, wombat []wombatField) []string {
+	var defaulted []string
+
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		f := fields[k]
+		p := append(slices.Clone(path), k)
+
+		wf, known := findWombatField(wombat, k)
+		if !known {
+			continue
+		}
+
+		value, ok := cfg[k]
+		if ok {
+			// only single objects are descended into, lists and maps are taken as-is
+			if obj, isObj := value.(map[string]any); isObj && f.Type == model.ComponentFieldTypeObject &&
+				f.Kind != model.ComponentFieldKindList && f.Kind != model.ComponentFieldKindMap && len(f.Fields) > 0 {
+				defaulted = append(defaulted, applyDefaults(p, fieldsOf(f.Fields), obj, wf.Children)...)
+			}
+			continue
+		}
+
+		if f.Default == nil || !validDefault(f) {
+			continue
+		}
+
+		cfg[k] = cloneValue(f.Default)
+		defaulted = append(defaulted, strings.Join(p, "."))
+	}
+
+	return defaulted
+}
+
+// validDefault checks whether the default of a field is a valid value for the field.
+func validDefault(f *model.ComponentField) bool {
+	chk := &specCheck{}
+	chk.field(nil, f, f.Default, nil)
+	return len(chk.issues) == 0
+}
+
+// topLevelFields indexes the fields of a component by their key in its configuration.
+func topLevelFields(c *model.Component) map[string]*model.ComponentField {
+	fields := make([]*model.ComponentField, len(c.Fields))
+	for i := range c.Fields {
+		fields[i] = &c.Fields[i]
+	}
+	return fieldsOf(fields)
+}
+
+// cloneConfig deep copies the configuration of a source or sink.
+func cloneConfig(cfg map[string]any) map[string]any {
+	return cloneValue(cfg).(map[string]any)
+}
+
+// cloneValue deep copies the maps and lists of a configuration value, so defaults and
+// configurations are never shared.
+func cloneValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, item := range v {
+			result[k] = cloneValue(item)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = cloneValue(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
@@ -0,0 +1,111 @@
+package compiler_test
+
+import (
+	"context"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/model"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = Describe("Component Defaults", func() {
+	var specs *compiler.Specs
+
+	BeforeEach(func() {
+		var err error
+		specs, err = compiler.LoadSpecs(os.DirFS("../.connect"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should fill in the defaults of omitted optional fields", func() {
+		steps := Steps().
+			Source(SourceStep("generate").SetString("mapping", "root = \"hello world\"")).
+			Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+			Build()
+
+		result, defaulted := specs.ApplyDefaults(steps)
+		Expect(defaulted).To(ConsistOf(
+			"source.config.auto_replay_nacks",
+			"source.config.batch_size",
+			"source.config.count",
+			"source.config.interval",
+		))
+		Expect(result.Source.Config).To(HaveKeyWithValue("interval", "1s"))
+		Expect(result.Source.Config).To(HaveKeyWithValue("auto_replay_nacks", true))
+
+		By("leaving the original steps untouched")
+		Expect(steps.Source.Config).NotTo(HaveKey("interval"))
+	})
+
+	It("should not override configured values", func() {
+		steps := Steps().
+			Source(test.GenerateSource().SetString("interval", "5s")).
+			Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+			Build()
+
+		result, defaulted := specs.ApplyDefaults(steps)
+		Expect(defaulted).NotTo(ContainElements("source.config.interval", "source.config.count"))
+		Expect(result.Source.Config).To(HaveKeyWithValue("interval", "5s"))
+		Expect(result.Source.Config).To(HaveKeyWithValue("count", 5))
+	})
+
+	It("should only default nested fields of configured objects", func() {
+		steps := model.Steps{
+			Source: &model.SourceStep{
+				Type: "http_client",
+				Config: model.SourceStepConfig{
+					"url": "http://localhost:8080",
+					"tls": map[string]any{"enabled": true},
+				},
+			},
+		}
+
+		result, defaulted := specs.ApplyDefaults(steps)
+		Expect(defaulted).To(ContainElement("source.config.tls.skip_cert_verify"))
+		Expect(defaulted).NotTo(ContainElement(HavePrefix("source.config.oauth.")))
+		Expect(result.Source.Config["tls"]).To(HaveKeyWithValue("enabled", true))
+		Expect(result.Source.Config["tls"]).To(HaveKeyWithValue("skip_cert_verify", false))
+	})
+
+	It("should compile the defaults into the artifact", func() {
+		steps := Steps().
+			Consumer(ConsumerStep(test.UnauthenticatedNatsConfig()).Core(ConsumerStepCore("foo.bar"))).
+			Sink(SinkStep("nats_kv").
+				SetStrings("urls", "nats://localhost:4222").
+				SetString("bucket", "my-bucket").
+				SetString("key", "my-key")).
+			Build()
+
+		ctx := compiler.WithSpecs(context.Background(), specs)
+		artifact, err := compiler.CompileWithContext(ctx, test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		var cfg map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &cfg)).To(Succeed())
+		Expect(cfg["output"]).To(HaveKeyWithValue("nats_kv", HaveKeyWithValue("max_in_flight", 1024)))
+	})
+
+	It("should report the defaulted fields alongside the artifact", func() {
+		steps := Steps().
+			Source(SourceStep("generate").SetString("mapping", "root = \"hello world\"").SetString("interval", "5s")).
+			Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+			Build()
+
+		report, err := compiler.CompileStepsWithReport(context.Background(), test.Runtime(), compiler.FromModel(steps))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Defaulted).To(ConsistOf(
+			"source.config.auto_replay_nacks",
+			"source.config.batch_size",
+			"source.config.count",
+		))
+
+		artifact, err := compiler.CompileWithContext(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Config).To(Equal(artifact))
+	})
+})
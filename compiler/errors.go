@@ -47,8 +47,65 @@ var (
 	)
 )
 
+// ErrorCode is a stable, machine-readable identifier of an error condition.
+// Codes are part of the contract with user interfaces and must not change once released.
+type ErrorCode string
+
+const (
+	// CodeUnknown is used for errors that do not carry a more specific code
+	CodeUnknown ErrorCode = "unknown"
+
+	// CodeInvalidSteps indicates the steps do not describe an inlet or an outlet
+	CodeInvalidSteps ErrorCode = "invalid_steps"
+	// CodeInvalidProducer indicates the producer step could not be compiled
+	CodeInvalidProducer ErrorCode = "invalid_producer"
+	// CodeInvalidConsumer indicates the consumer step could not be compiled
+	CodeInvalidConsumer ErrorCode = "invalid_consumer"
+	// CodeInvalidSource indicates the sources of a multi-source inlet could not be compiled
+	CodeInvalidSource ErrorCode = "invalid_source"
+	// CodeInvalidSink indicates the sinks of a fan-out outlet could not be compiled
+	CodeInvalidSink ErrorCode = "invalid_sink"
+	// CodeInvalidTransformer indicates the transformer step could not be compiled
+	CodeInvalidTransformer ErrorCode = "invalid_transformer"
+	// CodeMarshalFailed indicates the compiled configuration could not be serialized
+	CodeMarshalFailed ErrorCode = "marshal_failed"
+
+	// CodeInvalidConfiguration indicates the compiled configuration was rejected by Wombat
+	CodeInvalidConfiguration ErrorCode = "invalid_configuration"
+	// CodeUnknownField indicates a field that is not supported by the component
+	CodeUnknownField ErrorCode = "unknown_field"
+	// CodeIgnoredField indicates an option of the wrapped Wombat component that is not exposed by Connect
+	CodeIgnoredField ErrorCode = "ignored_field"
+	// CodeMissingField indicates a required field without a value
+	CodeMissingField ErrorCode = "missing_field"
+	// CodeInvalidOption indicates a value that is not one of the allowed options
+	CodeInvalidOption ErrorCode = "invalid_option"
+	// CodeInvalidValue indicates a value that does not match the pattern or range allowed for a field
+	CodeInvalidValue ErrorCode = "invalid_value"
+	// CodeInvalidType indicates a value of the wrong type
+	CodeInvalidType ErrorCode = "invalid_type"
+	// CodeUnknownComponent indicates a source, sink or processor type that does not exist
+	CodeUnknownComponent ErrorCode = "unknown_component"
+	// CodeInvalidBloblang indicates a mapping or interpolation that does not parse
+	CodeInvalidBloblang ErrorCode = "invalid_bloblang"
+	// CodeDeprecatedField indicates a field that is deprecated and should no longer be used
+	CodeDeprecatedField ErrorCode = "deprecated_field"
+	// CodeMissingEnvVar indicates a reference to an environment variable that is not set
+	CodeMissingEnvVar ErrorCode = "missing_env_var"
+	// CodeInvalidYAML indicates a configuration that could not be read
+	CodeInvalidYAML ErrorCode = "invalid_yaml"
+
+	// CodeStreamFailed indicates the data stream stopped with an error
+	CodeStreamFailed ErrorCode = "stream_failed"
+	// CodeHTTPServerFailed indicates the HTTP server for health and metrics stopped with an error
+	CodeHTTPServerFailed ErrorCode = "http_server_failed"
+	// CodeEventsUnavailable indicates lifecycle events could not be published
+	CodeEventsUnavailable ErrorCode = "events_unavailable"
+)
+
 // CompilationError represents an error that occurred during compilation
 type CompilationError struct {
+	Code    ErrorCode
 	Phase   string
 	Step    string
 	Message string
@@ -66,10 +123,17 @@ func (e *CompilationError) Unwrap() error {
 	return e.Err
 }
 
+// WithCode sets the error code of the CompilationError
+func (e *CompilationError) WithCode(code ErrorCode) *CompilationError {
+	e.Code = code
+	return e
+}
+
 // NewCompilationError creates a new CompilationError and records metrics
 func NewCompilationError(phase, step, message string, err error) *CompilationError {
 	compilationErrors.WithLabelValues("compilation", phase, step).Inc()
 	return &CompilationError{
+		Code:    CodeUnknown,
 		Phase:   phase,
 		Step:    step,
 		Message: message,
@@ -79,9 +143,13 @@ func NewCompilationError(phase, step, message string, err error) *CompilationErr
 
 // ValidationError represents an error that occurred during validation
 type ValidationError struct {
+	Code      ErrorCode
 	Component string
 	Message   string
 	Err       error
+
+	// Issues locates the individual problems found during validation, if known
+	Issues []Issue
 }
 
 func (e *ValidationError) Error() string {
@@ -95,10 +163,23 @@ func (e *ValidationError) Unwrap() error {
 	return e.Err
 }
 
+// WithCode sets the error code of the ValidationError
+func (e *ValidationError) WithCode(code ErrorCode) *ValidationError {
+	e.Code = code
+	return e
+}
+
+// WithIssues adds the individual problems found during validation to the ValidationError
+func (e *ValidationError) WithIssues(issues ...Issue) *ValidationError {
+	e.Issues = append(e.Issues, issues...)
+	return e
+}
+
 // NewValidationError creates a new ValidationError and records metrics
 func NewValidationError(component, message string, err error) *ValidationError {
 	validationErrors.WithLabelValues("validation", component).Inc()
 	return &ValidationError{
+		Code:      CodeUnknown,
 		Component: component,
 		Message:   message,
 		Err:       err,
@@ -107,6 +188,7 @@ func NewValidationError(component, message string, err error) *ValidationError {
 
 // RuntimeError represents an error that occurred during runtime
 type RuntimeError struct {
+	Code      ErrorCode
 	Component string
 	Message   string
 	Err       error
@@ -123,10 +205,17 @@ func (e *RuntimeError) Unwrap() error {
 	return e.Err
 }
 
+// WithCode sets the error code of the RuntimeError
+func (e *RuntimeError) WithCode(code ErrorCode) *RuntimeError {
+	e.Code = code
+	return e
+}
+
 // NewRuntimeError creates a new RuntimeError and records metrics
 func NewRuntimeError(component, message string, err error) *RuntimeError {
 	runtimeErrors.WithLabelValues("runtime", component).Inc()
 	return &RuntimeError{
+		Code:      CodeUnknown,
 		Component: component,
 		Message:   message,
 		Err:       err,
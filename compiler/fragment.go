@@ -91,6 +91,13 @@ func (f Fragment) IntP(key string, value *int) Fragment {
 	return f
 }
 
+// Float adds a floating point value to the configuration.
+// Used for ratios, factors, and other non-integer numeric options.
+func (f Fragment) Float(key string, value float64) Fragment {
+	f[key] = value
+	return f
+}
+
 // Bool adds a boolean value to the configuration.
 // Used for flags and boolean configuration options.
 func (f Fragment) Bool(key string, value bool) Fragment {
@@ -0,0 +1,85 @@
+package compiler
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// compileHeaderPolicy creates the processors applying a header policy to the metadata of the
+// messages, a mutation filtering, renaming and setting the headers followed by the mapping of
+// the policy, if any. A nil policy compiles to no processors.
+//
+// Parameters:
+//   - h: The header policy of a producer or consumer
+//
+// Returns:
+//   - The processors applying the policy
+//   - An error if an include or exclude pattern is not a valid regular expression
+func compileHeaderPolicy(h *HeaderPolicy) ([]Fragment, error) {
+	if h == nil {
+		return nil, nil
+	}
+
+	include, err := headerPatterns(h.Include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header include pattern: %w", err)
+	}
+	exclude, err := headerPatterns(h.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header exclude pattern: %w", err)
+	}
+
+	var conditions []string
+	if include != "" {
+		conditions = append(conditions, "("+include+")")
+	}
+	if exclude != "" {
+		conditions = append(conditions, "!("+exclude+")")
+	}
+
+	var headers strings.Builder
+	headers.WriteString("@")
+	if len(conditions) > 0 {
+		fmt.Fprintf(&headers, ".filter(kv -> %s)", strings.Join(conditions, " && "))
+	}
+	if len(h.Rename) > 0 {
+		headers.WriteString(".map_each_key(k -> match k {\n")
+		for _, from := range slices.Sorted(maps.Keys(h.Rename)) {
+			fmt.Fprintf(&headers, "  %q => %q,\n", from, h.Rename[from])
+		}
+		headers.WriteString("  _ => k,\n})")
+	}
+	if len(h.Static) > 0 {
+		var static []string
+		for _, name := range slices.Sorted(maps.Keys(h.Static)) {
+			static = append(static, fmt.Sprintf("%q: %q", name, h.Static[name]))
+		}
+		fmt.Fprintf(&headers, ".assign({%s})", strings.Join(static, ", "))
+	}
+
+	var result []Fragment
+	if headers.String() != "@" {
+		result = append(result, Frag().String("mutation", "meta = "+headers.String()))
+	}
+	if strings.TrimSpace(h.Mapping) != "" {
+		result = append(result, Frag().String("mutation", h.Mapping))
+	}
+
+	return result, nil
+}
+
+// headerPatterns returns a Bloblang query matching the key of a metadata entry against any of
+// the given regular expressions, or an empty string when there are none.
+func headerPatterns(patterns []string) (string, error) {
+	var matches []string
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return "", err
+		}
+		matches = append(matches, fmt.Sprintf("kv.key.re_match(%q)", p))
+	}
+	return strings.Join(matches, " || "), nil
+}
@@ -0,0 +1,153 @@
+package compiler
+
+import (
+	"testing"
+
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/model"
+)
+
+func TestCompileHeaderPolicy(t *testing.T) {
+	t.Run("should compile no processors without a policy", func(t *testing.T) {
+		res, err := compileHeaderPolicy(nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(res) != 0 {
+			t.Errorf("expected no processors, got %v", res)
+		}
+	})
+
+	t.Run("should filter, rename and set the headers before the mapping", func(t *testing.T) {
+		res, err := compileHeaderPolicy(&HeaderPolicy{
+			Include: []string{"^app_", "^traceparent$"},
+			Exclude: []string{"secret"},
+			Rename:  map[string]string{"app_tenant": "tenant", "app_id": "id"},
+			Static:  map[string]string{"source": "orders"},
+			Mapping: "meta tenant = @tenant.uppercase()",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := []Fragment{
+			Frag().String("mutation", `meta = @.filter(kv -> (kv.key.re_match("^app_") || kv.key.re_match("^traceparent$")) && !(kv.key.re_match("secret"))).map_each_key(k -> match k {
+  "app_id" => "id",
+  "app_tenant" => "tenant",
+  _ => k,
+}).assign({"source": "orders"})`),
+			Frag().String("mutation", "meta tenant = @tenant.uppercase()"),
+		}
+		if len(res) != len(exp) {
+			t.Fatalf("expected %d processors, got %v", len(exp), res)
+		}
+		for i := range exp {
+			if !res[i].EqualsMap(exp[i]) {
+				t.Errorf("expected %v, got %v", exp[i], res[i])
+			}
+		}
+	})
+
+	t.Run("should only compile the mapping when there is nothing else", func(t *testing.T) {
+		res, err := compileHeaderPolicy(&HeaderPolicy{Mapping: "meta = @.without(\"kafka_key\")"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(res) != 1 || !res[0].EqualsMap(Frag().String("mutation", "meta = @.without(\"kafka_key\")")) {
+			t.Errorf("expected the mapping only, got %v", res)
+		}
+	})
+
+	t.Run("should fail with an invalid pattern", func(t *testing.T) {
+		if _, err := compileHeaderPolicy(&HeaderPolicy{Exclude: []string{"("}}); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestCompileProducerHeaders(t *testing.T) {
+	nats := ncb.Build()
+	headers := &HeaderPolicy{Static: map[string]string{"source": "orders"}}
+	policy := Frag().String("mutation", `meta = @.assign({"source": "orders"})`)
+
+	t.Run("should apply the policy to the output of the producer", func(t *testing.T) {
+		res, err := compileRoutedProducer(Producer{
+			Nats:    nats,
+			Core:    &model.ProducerStepCore{Subject: "foo"},
+			Threads: 1,
+			Headers: headers,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := compileCoreProducer(ProducerStep(ncb).Core(ProducerStepCore("foo")).Build()).
+			Fragments("processors", policy)
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should apply the policy before the claim check", func(t *testing.T) {
+		res, err := compileRoutedProducer(Producer{
+			Nats:       nats,
+			Core:       &model.ProducerStepCore{Subject: "foo"},
+			Threads:    1,
+			Headers:    headers,
+			ClaimCheck: &ClaimCheck{Bucket: "payloads"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().
+			Fragment("reject_errored", compileCoreProducer(ProducerStep(ncb).Core(ProducerStepCore("foo")).Build())).
+			Fragments("processors", policy,
+				Frag().Fragment("nats_object_offload", natsBaseFragment(nats).String("bucket", "payloads")))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+}
+
+func TestCompileConsumerHeaders(t *testing.T) {
+	nats := ncb.Build()
+
+	t.Run("should apply the policy after the claim check and before the transformer", func(t *testing.T) {
+		transformer := Frag().String("mapping", "root = this")
+		res, err := compileConsumerInput(Consumer{
+			Nats:       nats,
+			Core:       &model.ConsumerStepCore{Subject: "foo"},
+			ClaimCheck: true,
+			Headers:    &HeaderPolicy{Exclude: []string{"^Nats-"}},
+		}, transformer)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		processors, _ := res["processors"].([]Fragment)
+		if len(processors) != 5 {
+			t.Fatalf("expected 5 processors, got %v", processors)
+		}
+		if _, ok := processors[0]["nats_object_rehydrate"]; !ok {
+			t.Errorf("expected the payloads to be restored first, got %v", processors[0])
+		}
+		if exp := Frag().String("mutation", `meta = @.filter(kv -> !(kv.key.re_match("^Nats-")))`); !processors[3].EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, processors[3])
+		}
+		if !processors[4].EqualsMap(transformer) {
+			t.Errorf("expected the transformer last, got %v", processors[4])
+		}
+	})
+
+	t.Run("should fail with an invalid pattern", func(t *testing.T) {
+		_, err := compileConsumerInput(Consumer{
+			Nats:    nats,
+			Core:    &model.ConsumerStepCore{Subject: "foo"},
+			Headers: &HeaderPolicy{Include: []string{"["}},
+		}, nil)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
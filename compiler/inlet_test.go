@@ -53,3 +53,22 @@ var _ = Describe("Inlet", func() {
 		})
 	})
 })
+
+var _ = Describe("Inlet with a kv producer applying operations", func() {
+	It("should generate a valid wombat artifact", func() {
+		steps := compiler.FromModel(Steps().
+			Source(test.GenerateSource()).
+			Producer(ProducerStep(NatsConfig().Url(DefaultNatsUrl)).Kv(ProducerStepKv("view", `${! json("id") }`))).
+			Build())
+		steps.Producer.Kv.Operation = `${! meta("op") }`
+		steps.Producer.Kv.Revision = `${! meta("kv_revision") }`
+		steps.Producer.Kv.TTL = "1h"
+
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(artifact).To(ContainSubstring("nats_kv_write"))
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+	})
+})
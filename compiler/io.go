@@ -1,7 +1,11 @@
 package compiler
 
 import (
+	"fmt"
+	"strconv"
+
 	"github.com/synadia-io/connect/model"
+	"github.com/synadia-io/connect/runtime"
 )
 
 // compileSource transforms a Connect source specification into a Wombat input configuration.
@@ -12,20 +16,87 @@ import (
 //
 // Parameters:
 //   - m: The source step containing the type and configuration
-//   - t: Optional transformer step for processing source messages
+//   - t: Optional compiled transformer for processing source messages
 //
 // Returns a Fragment containing the Wombat input configuration.
-func compileSource(m model.SourceStep, t *model.TransformerStep) Fragment {
+func compileSource(m model.SourceStep, t Fragment) Fragment {
 	result := Frag().
 		Map(m.Type, m.Config)
 
 	if t != nil {
-		result.Fragments("processors", compileTransformer(*t))
+		result.Fragments("processors", t)
 	}
 
 	return result
 }
 
+// SourceMetadataKey is the metadata key holding the name of the source a message of a
+// multi-source inlet was read from, which is written to NATS as a header
+const SourceMetadataKey = "Connect-Source"
+
+// compileSources creates a Wombat input configuration merging the messages of all the sources
+// of a multi-source inlet, using a broker input. Every message is tagged with the name of its
+// source and processed by the transformer of its source, followed by the transformer shared
+// by all sources, if provided.
+//
+// Parameters:
+//   - rt: Runtime configuration holding the NATS connection details of the schema registry
+//   - sources: The sources of the inlet
+//   - t: Optional compiled transformer for processing the messages of all sources
+//
+// Returns:
+//   - A Fragment containing the Wombat input configuration
+//   - An error if a source has no type, shares its name with another source or has an invalid transformer
+func compileSources(rt *runtime.Runtime, sources []MergedSource, t Fragment) (Fragment, error) {
+	names := map[string]int{}
+	inputs := make([]Fragment, 0, len(sources))
+	for i, s := range sources {
+		if s.Type == "" {
+			return nil, fmt.Errorf("source %d: a source requires a type", i)
+		}
+
+		name := sourceName(i, s)
+		if j, ok := names[name]; ok {
+			return nil, fmt.Errorf("source %d: name %q is already used by source %d", i, name, j)
+		}
+		names[name] = i
+
+		procs := []Fragment{
+			Frag().String("mutation", fmt.Sprintf("meta %q = %q", SourceMetadataKey, name)),
+		}
+
+		if s.Transformer != nil {
+			p, err := compileTransformer(rt, *s.Transformer)
+			if err != nil {
+				return nil, fmt.Errorf("source %d: transformer: %w", i, err)
+			}
+			if p != nil {
+				procs = append(procs, p)
+			}
+		}
+
+		inputs = append(inputs, compileSource(s.step(), nil).Fragments("processors", procs...))
+	}
+
+	result := Frag().
+		Fragment("broker", Frag().
+			Fragments("inputs", inputs...))
+
+	if t != nil {
+		result.Fragments("processors", t)
+	}
+
+	return result, nil
+}
+
+// sourceName returns the name identifying a source of a multi-source inlet.
+func sourceName(i int, source MergedSource) string {
+	if source.Name != "" {
+		return source.Name
+	}
+	return source.Type + "_" + strconv.Itoa(i)
+}
+
 // compileSink transforms a Connect sink specification into a Wombat output configuration.
 // Sinks write messages to external systems (files, databases, APIs, etc.).
 //
@@ -39,3 +110,104 @@ func compileSource(m model.SourceStep, t *model.TransformerStep) Fragment {
 func compileSink(m model.SinkStep) Fragment {
 	return Frag().Map(m.Type, m.Config)
 }
+
+// compileSinks creates a Wombat output configuration writing every message to all the sinks of
+// a fan-out outlet, using a broker output with the fan_out pattern. The broker only acknowledges
+// a message once all its outputs have written it, and keeps retrying the outputs which failed.
+//
+// Each sink is wrapped according to its options, from the inside out: a single output broker
+// batching its messages, a retry output, and for best effort sinks a drop_on output dropping
+// the messages which could not be written. A rate limited sink throttles the messages before
+// they reach its wrappers.
+//
+// Parameters:
+//   - rt: Runtime configuration holding the NATS connection details of distributed rate limits
+//   - sinks: The sinks of the outlet
+//
+// Returns:
+//   - A Fragment containing the Wombat output configuration
+//   - An error if a sink has no type, an unknown delivery guarantee or an invalid rate limit
+func compileSinks(rt *runtime.Runtime, sinks []FanOutSink) (Fragment, error) {
+	outputs := make([]Fragment, 0, len(sinks))
+	for i, s := range sinks {
+		if s.Type == "" {
+			return nil, fmt.Errorf("sink %d: a sink requires a type", i)
+		}
+
+		output := compileSink(s.step())
+
+		if b := s.Batching; b != nil {
+			output = Frag().
+				Fragment("broker", Frag().
+					Fragments("outputs", output).
+					Fragment("batching", Frag().
+						Int("count", b.Count).
+						Int("byte_size", b.ByteSize).
+						String("period", b.Period)))
+		}
+
+		if r := s.Retry; r != nil {
+			backoff := Frag()
+			if r.InitialInterval != "" {
+				backoff.String("initial_interval", r.InitialInterval)
+			}
+			if r.MaxInterval != "" {
+				backoff.String("max_interval", r.MaxInterval)
+			}
+			if r.MaxElapsedTime != "" {
+				backoff.String("max_elapsed_time", r.MaxElapsedTime)
+			}
+
+			retry := Frag().
+				Int("max_retries", r.MaxRetries).
+				Fragment("output", output)
+			if len(backoff) > 0 {
+				retry.Fragment("backoff", backoff)
+			}
+
+			output = Frag().Fragment("retry", retry)
+		}
+
+		switch s.Delivery {
+		case "", SinkDeliveryRequired:
+		case SinkDeliveryBestEffort:
+			output = Frag().
+				Fragment("drop_on", Frag().
+					Bool("error", true).
+					Fragment("output", output))
+		default:
+			return nil, fmt.Errorf("sink %d: unknown delivery guarantee %q, expected %s or %s", i, s.Delivery, SinkDeliveryRequired, SinkDeliveryBestEffort)
+		}
+
+		if s.RateLimit != nil {
+			rl, err := compileRateLimit(rt, s.RateLimit)
+			if err != nil {
+				return nil, fmt.Errorf("sink %d: %w", i, err)
+			}
+			output.Fragments("processors", rl)
+		}
+
+		outputs = append(outputs, output)
+	}
+
+	return Frag().
+		Fragment("broker", Frag().
+			String("pattern", "fan_out").
+			Fragments("outputs", outputs...)), nil
+}
+
+// sinkOutputPath returns the path of the output of a sink within the output compiled by
+// compileSinks, leading through the wrappers of its options.
+func sinkOutputPath(i int, sink FanOutSink) []string {
+	path := []string{"broker", "outputs", strconv.Itoa(i)}
+	if sink.Delivery == SinkDeliveryBestEffort {
+		path = append(path, "drop_on", "output")
+	}
+	if sink.Retry != nil {
+		path = append(path, "retry", "output")
+	}
+	if sink.Batching != nil {
+		path = append(path, "broker", "outputs", "0")
+	}
+	return path
+}
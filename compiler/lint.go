@@ -0,0 +1,356 @@
+package compiler
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"gopkg.in/yaml.v3"
+)
+
+// natsStepKinds maps the compiled NATS components to the producer/consumer type they originate from
+var natsStepKinds = map[string]string{
+	"nats":                "core",
+	"nats_jetstream":      "stream",
+	"nats_jetstream_pull": "stream",
+	"nats_kv":             "kv",
+	"nats_kv_watch":       "kv",
+	"nats_kv_write":       "kv",
+	"nats_micro":          "service",
+	"nats_object_store":   "object_store",
+}
+
+// producerProcessorSteps maps the processors compiled into the output of a producer to the option they originate from
+var producerProcessorSteps = map[string]string{
+	"mutation":            "producer.headers",
+	"nats_object_offload": "producer.claim_check",
+	"nats_request":        "producer.request",
+}
+
+// natsConnectionFields maps the compiled NATS connection fields to the NatsConfig they originate from
+var natsConnectionFields = map[string]string{
+	"urls":                "nats.url",
+	"auth":                "nats",
+	"auth.user_jwt":       "nats.jwt",
+	"auth.user_nkey_seed": "nats.seed",
+	"max_in_flight":       "threads",
+}
+
+// Issue is a single problem found in a compiled configuration, located in the
+// Connect specification it was compiled from.
+type Issue struct {
+	// Code identifies the kind of problem
+	Code ErrorCode `json:"code"`
+	// Path is the location of the problem in the connector specification, e.g. source.config.url
+	Path string `json:"path,omitempty"`
+	// ConfigPath is the location of the problem in the compiled Wombat configuration
+	ConfigPath string `json:"config_path,omitempty"`
+	// Line is the line of the problem in the compiled Wombat configuration
+	Line int `json:"line,omitempty"`
+	// Column is the column of the problem in the compiled Wombat configuration
+	Column int `json:"column,omitempty"`
+	// Message describes the problem
+	Message string `json:"message"`
+}
+
+// LintIssues maps the lint errors Wombat reported for a compiled artifact back to
+// the steps the artifact was compiled from.
+//
+// Parameters:
+//   - err: The error returned while validating the artifact
+//   - artifact: The compiled YAML configuration
+//   - steps: The steps the artifact was compiled from
+//
+// Returns the issues found in err, or nil if err does not hold any lint errors.
+func LintIssues(err error, artifact string, steps ConnectorSteps) []Issue {
+	var lints service.LintError
+	if !errors.As(err, &lints) {
+		var lint service.Lint
+		if !errors.As(err, &lint) {
+			return nil
+		}
+		lints = service.LintError{lint}
+	}
+
+	var root yaml.Node
+	_ = yaml.Unmarshal([]byte(artifact), &root)
+
+	result := make([]Issue, 0, len(lints))
+	for _, l := range lints {
+		configPath := locate(&root, l.Line)
+
+		result = append(result, Issue{
+			Code:       lintCode(l.Type),
+			Path:       stepPath(configPath, steps),
+			ConfigPath: strings.Join(configPath, "."),
+			Line:       l.Line,
+			Column:     l.Column,
+			Message:    l.What,
+		})
+	}
+
+	return result
+}
+
+// lintCode maps a Wombat lint type to the matching error code.
+func lintCode(t service.LintType) ErrorCode {
+	switch t {
+	case service.LintUnknown, service.LintShouldOmit:
+		return CodeUnknownField
+	case service.LintMissing:
+		return CodeMissingField
+	case service.LintInvalidOption:
+		return CodeInvalidOption
+	case service.LintExpectedArray, service.LintExpectedObject, service.LintExpectedScalar:
+		return CodeInvalidType
+	case service.LintComponentMissing, service.LintComponentNotFound:
+		return CodeUnknownComponent
+	case service.LintBadBloblang:
+		return CodeInvalidBloblang
+	case service.LintDeprecated:
+		return CodeDeprecatedField
+	case service.LintMissingEnvVar:
+		return CodeMissingEnvVar
+	case service.LintFailedRead:
+		return CodeInvalidYAML
+	default:
+		return CodeInvalidConfiguration
+	}
+}
+
+// locate finds the deepest node of a YAML document at the given line and returns
+// the keys and indexes leading up to it. Wombat does not report meaningful columns
+// for most lints, so nodes are matched by line only.
+func locate(node *yaml.Node, line int) []string {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) > 0 {
+			return locate(node.Content[0], line)
+		}
+	case yaml.MappingNode:
+		for i := len(node.Content) - 2; i >= 0; i -= 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Line > line {
+				continue
+			}
+
+			// a lint on the first line of a nested value refers to the value as a whole
+			if key.Line != line && value.Line == line && value.Kind != yaml.ScalarNode {
+				return []string{key.Value}
+			}
+
+			return append([]string{key.Value}, locate(value, line)...)
+		}
+	case yaml.SequenceNode:
+		for i := len(node.Content) - 1; i >= 0; i-- {
+			if node.Content[i].Line > line {
+				continue
+			}
+
+			return append([]string{strconv.Itoa(i)}, locate(node.Content[i], line)...)
+		}
+	}
+
+	return nil
+}
+
+// stepPath translates a path within the compiled configuration to the location
+// in the connector specification it was compiled from.
+func stepPath(path []string, steps ConnectorSteps) string {
+	if len(path) == 0 {
+		return ""
+	}
+
+	switch path[0] {
+	case "input":
+		if len(path) > 1 && path[1] == "processors" {
+			return "transformer"
+		}
+		if steps.Source != nil {
+			return componentPath("source", path[1:])
+		}
+		if len(steps.Sources) > 0 {
+			return sourcesPath(path[1:], steps.Sources)
+		}
+		if steps.Consumer != nil {
+			return natsPath("consumer", path[1:])
+		}
+	case "output":
+		path = unwrapOutputPath(path[1:])
+		if steps.Producer != nil {
+			return producerPath(path, *steps.Producer)
+		}
+		if steps.Sink != nil {
+			return componentPath("sink", path)
+		}
+		if len(steps.Sinks) > 0 {
+			return sinksPath(path, steps.Sinks)
+		}
+	case "metrics", "tracer":
+		return "runtime"
+	}
+
+	return ""
+}
+
+// unwrapOutputPath strips the nats_dedupe_release and reject_errored outputs the compiler wraps
+// around an output from a path within it, leaving the path within the wrapped output.
+func unwrapOutputPath(path []string) []string {
+	if len(path) > 1 && path[0] == "nats_dedupe_release" && path[1] == "output" {
+		path = path[2:]
+	}
+	if len(path) > 0 && path[0] == "reject_errored" {
+		path = path[1:]
+	}
+
+	return path
+}
+
+// componentPath locates a path within a compiled source or sink in its step.
+func componentPath(step string, path []string) string {
+	if len(path) <= 1 {
+		return step + ".type"
+	}
+
+	return strings.Join(append([]string{step, "config"}, path[1:]...), ".")
+}
+
+// sourcesPath locates a path within the compiled sources of a multi-source inlet in their step.
+func sourcesPath(path []string, sources []MergedSource) string {
+	if len(path) < 3 || path[0] != "broker" || path[1] != "inputs" {
+		return "sources"
+	}
+
+	i, err := strconv.Atoi(path[2])
+	if err != nil || i < 0 || i >= len(sources) {
+		return "sources"
+	}
+
+	step := "sources." + strconv.Itoa(i)
+	if len(path) > 3 && path[3] == "processors" {
+		return step + ".transformer"
+	}
+
+	return componentPath(step, path[3:])
+}
+
+// sinksPath locates a path within the compiled sinks of a fan-out outlet in their step,
+// following the wrappers of the options of a sink back to the option or the sink.
+func sinksPath(path []string, sinks []FanOutSink) string {
+	if len(path) < 3 || path[0] != "broker" || path[1] != "outputs" {
+		return "sinks"
+	}
+
+	i, err := strconv.Atoi(path[2])
+	if err != nil || i < 0 || i >= len(sinks) {
+		return "sinks"
+	}
+
+	step := "sinks." + strconv.Itoa(i)
+	output := sinkOutputPath(i, sinks[i])
+	for n, key := range output[3:] {
+		if len(path) <= 3+n || path[3+n] != key {
+			return step + "." + sinkOption(path[3+n:])
+		}
+	}
+
+	return componentPath(step, path[len(output):])
+}
+
+// sinkOption returns the option of a fan-out sink compiled to the given wrapper.
+func sinkOption(path []string) string {
+	if len(path) == 0 {
+		return "type"
+	}
+
+	switch path[0] {
+	case "drop_on":
+		return "delivery"
+	case "retry":
+		return "retry"
+	case "broker":
+		return "batching"
+	}
+
+	return "type"
+}
+
+// producerPath locates a path within a compiled producer in its step, following the
+// cases of a routing switch output back to their route or the default destination, and
+// the offloading of a claim check back to the claim check.
+func producerPath(path []string, producer Producer) string {
+	if len(path) > 0 && path[0] == "processors" {
+		return producerProcessorPath(path[1:], producer)
+	}
+	if len(path) < 4 || path[0] != "switch" || path[1] != "cases" {
+		return natsPath("producer", path)
+	}
+
+	i, err := strconv.Atoi(path[2])
+	if err != nil || i < 0 || i >= len(producer.Routes) {
+		return natsPath("producer", path[4:])
+	}
+
+	route := "producer.routes." + strconv.Itoa(i)
+	switch {
+	case path[3] == "check":
+		return route + ".condition"
+	case path[3] != "output":
+		return route
+	}
+
+	// the routes share the NATS connection of the producer
+	if len(path) > 5 {
+		if _, ok := natsConnectionFields[strings.Join(path[5:], ".")]; ok {
+			return natsPath("producer", path[4:])
+		}
+	}
+
+	return natsPath(route, path[4:])
+}
+
+// producerProcessorPath locates a path within the processors compiled into the output of a
+// producer in the option they originate from. A lint on the processors as a whole, such as a
+// mapping which does not parse, is located in the first option of the producer compiling to them.
+func producerProcessorPath(path []string, producer Producer) string {
+	if len(path) > 1 {
+		if step, ok := producerProcessorSteps[path[1]]; ok {
+			return step
+		}
+	}
+
+	switch {
+	case producer.Headers != nil:
+		return "producer.headers"
+	case producer.ClaimCheck != nil:
+		return "producer.claim_check"
+	case producer.Request != nil:
+		return "producer.request"
+	}
+	return "producer"
+}
+
+// natsPath locates a path within a compiled NATS component in its producer or consumer step.
+func natsPath(step string, path []string) string {
+	if len(path) <= 1 {
+		return step
+	}
+
+	kind, ok := natsStepKinds[path[0]]
+	if !ok {
+		return step
+	}
+
+	field := strings.Join(path[1:], ".")
+	if mapped, ok := natsConnectionFields[field]; ok {
+		return step + "." + mapped
+	}
+
+	// the fetch settings of a stream consumer are compiled from its pull options
+	if path[0] == "nats_jetstream_pull" && field != "subject" {
+		field = "pull." + field
+	}
+
+	return strings.Join([]string{step, kind, field}, ".")
+}
@@ -2,6 +2,9 @@ package compiler
 
 import (
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/synadia-io/connect/model"
 )
@@ -75,3 +78,238 @@ func compileKvProducer(m model.ProducerStep) Fragment {
 			String("key", m.Kv.Key).
 			Int("max_in_flight", m.Threads))
 }
+
+// kvOperations are the operations of a kv producer
+var kvOperations = []string{"put", "create", "update", "delete", "purge"}
+
+// compileKvWriteProducer creates a Wombat configuration applying the operation of a kv producer
+// to the key of each message. Only the operations, revisions and TTLs which are not interpolated
+// are checked, the others being resolved for each message.
+func compileKvWriteProducer(m model.ProducerStep, kv *ProducerKv) (Fragment, error) {
+	if kv.Operation != "" && !strings.Contains(kv.Operation, "${!") && !slices.Contains(kvOperations, kv.Operation) {
+		return nil, fmt.Errorf("invalid kv operation %q, expected one of %s", kv.Operation, strings.Join(kvOperations, ", "))
+	}
+	if kv.Operation == "update" && kv.Revision == "" {
+		return nil, fmt.Errorf("the update kv operation requires a revision")
+	}
+	if kv.TTL != "" && !strings.Contains(kv.TTL, "${!") {
+		if _, err := time.ParseDuration(kv.TTL); err != nil {
+			return nil, fmt.Errorf("invalid kv ttl %q: %w", kv.TTL, err)
+		}
+	}
+	if kv.OnConflict != "" && kv.OnConflict != "reject" && kv.OnConflict != "drop" {
+		return nil, fmt.Errorf("invalid kv on_conflict %q, expected reject or drop", kv.OnConflict)
+	}
+
+	output := natsBaseFragment(m.Nats).
+		String("bucket", kv.Bucket).
+		String("key", kv.Key).
+		Int("max_in_flight", m.Threads)
+	for field, value := range map[string]string{
+		"operation":   kv.Operation,
+		"revision":    kv.Revision,
+		"ttl":         kv.TTL,
+		"on_conflict": kv.OnConflict,
+	} {
+		if value != "" {
+			output.String(field, value)
+		}
+	}
+
+	return Frag().Fragment("nats_kv_write", output), nil
+}
+
+// compileObjectStoreProducer creates a Wombat configuration writing each message as an object
+// of a NATS object store bucket, carrying the metadata of the message.
+func compileObjectStoreProducer(m model.ProducerStep, o *ProducerObjectStore) (Fragment, error) {
+	if o.Bucket == "" {
+		return nil, fmt.Errorf("an object store producer requires a bucket")
+	}
+	if o.Name == "" {
+		return nil, fmt.Errorf("an object store producer requires an object name")
+	}
+
+	return Frag().
+		Fragment("nats_object_store", natsBaseFragment(m.Nats).
+			String("bucket", o.Bucket).
+			String("name", o.Name).
+			Int("max_in_flight", m.Threads).
+			Fragment("metadata", Frag().
+				Strings("include_patterns", ".*"))), nil
+}
+
+// compileDestination compiles the destination of a producer or route like compileProducer,
+// or to an object store or a kv producer with operations when one is given.
+func compileDestination(m model.ProducerStep, kv *ProducerKv, o *ProducerObjectStore) (Fragment, error) {
+	switch {
+	case o != nil:
+		if m.Core != nil || m.Stream != nil || m.Kv != nil {
+			return nil, fmt.Errorf("exactly one producer type (core, stream, kv, object_store) must be defined")
+		}
+		return compileObjectStoreProducer(m, o)
+	case kv.operations():
+		if m.Core != nil || m.Stream != nil {
+			return nil, fmt.Errorf("exactly one producer type (core, stream, kv, object_store) must be defined")
+		}
+		return compileKvWriteProducer(m, kv)
+	}
+
+	return compileProducer(m)
+}
+
+// compileRoutedProducer creates a Wombat output configuration for a producer which may route
+// messages to several NATS destinations. Without routes it compiles to the single output of
+// compileProducer. With routes it compiles to a switch output holding a case per route and a
+// final case for the default destination, if any.
+//
+// In fan-out mode every case continues to the next one, so a message is written to all the
+// routes it matches, and the default case only takes the messages matching none of them.
+//
+// With a header policy, the metadata of the messages is mapped to the headers written to every
+// destination, the policy being applied before the claim check so that its reference is kept.
+//
+// With a claim check, the payloads over the threshold are offloaded to the object store before
+// reaching any destination. The messages whose payload cannot be offloaded are rejected, so
+// that the source retries them like the messages which cannot be published.
+//
+// Parameters:
+//   - m: The producer holding the routes and the NATS connection they share
+//
+// Returns:
+//   - A Fragment containing the Wombat output configuration
+//   - An error if a route has no condition or does not define exactly one destination, or
+//     the header policy or claim check is invalid
+func compileRoutedProducer(m Producer) (Fragment, error) {
+	if m.Request != nil {
+		return compileRequestProducer(m)
+	}
+
+	output, err := compileRoutes(m)
+	if err != nil {
+		return nil, err
+	}
+
+	processors, err := compileHeaderPolicy(m.Headers)
+	if err != nil {
+		return nil, err
+	}
+	if m.ClaimCheck == nil {
+		if len(processors) > 0 {
+			output.Fragments("processors", processors...)
+		}
+		return output, nil
+	}
+
+	if m.ClaimCheck.Bucket == "" {
+		return nil, fmt.Errorf("a claim check requires a bucket")
+	}
+	if m.ClaimCheck.Threshold < 0 {
+		return nil, fmt.Errorf("invalid claim check threshold %d", m.ClaimCheck.Threshold)
+	}
+	if m.ClaimCheck.TTL != "" {
+		if _, err := time.ParseDuration(m.ClaimCheck.TTL); err != nil {
+			return nil, fmt.Errorf("invalid claim check ttl %q: %w", m.ClaimCheck.TTL, err)
+		}
+	}
+
+	offload := natsBaseFragment(m.Nats).
+		String("bucket", m.ClaimCheck.Bucket)
+	if m.ClaimCheck.Threshold > 0 {
+		offload.Int("threshold", m.ClaimCheck.Threshold)
+	}
+	if m.ClaimCheck.TTL != "" {
+		offload.String("ttl", m.ClaimCheck.TTL)
+	}
+
+	processors = append(processors, Frag().Fragment("nats_object_offload", offload))
+	return Frag().
+		Fragment("reject_errored", output).
+		Fragments("processors", processors...), nil
+}
+
+// compileRequestProducer creates a Wombat output configuration sending each message as a NATS
+// request, after applying the header policy of the producer, and returning the reply to the
+// source as its synchronous response. The messages whose request fails, for example because no
+// service replied in time, are rejected so that the source reports the failure.
+func compileRequestProducer(m Producer) (Fragment, error) {
+	if m.Core != nil || m.Stream != nil || m.Kv != nil || m.ObjectStore != nil || len(m.Routes) > 0 {
+		return nil, fmt.Errorf("a request producer cannot have other destinations or routes")
+	}
+	if m.ClaimCheck != nil {
+		return nil, fmt.Errorf("a request producer cannot have a claim check")
+	}
+	if m.Request.Subject == "" {
+		return nil, fmt.Errorf("a request producer requires a subject")
+	}
+
+	request := natsBaseFragment(m.Nats).
+		String("subject", m.Request.Subject)
+	if m.Request.Timeout != "" {
+		if _, err := time.ParseDuration(m.Request.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid request timeout %q: %w", m.Request.Timeout, err)
+		}
+		request.String("timeout", m.Request.Timeout)
+	}
+	request.Fragment("metadata", Frag().
+		Strings("include_patterns", ".*"))
+
+	processors, err := compileHeaderPolicy(m.Headers)
+	if err != nil {
+		return nil, err
+	}
+	processors = append(processors, Frag().Fragment("nats_request", request))
+
+	return Frag().
+		Fragment("reject_errored", Frag().
+			Fragment("sync_response", Frag())).
+		Fragments("processors", processors...), nil
+}
+
+// compileRoutes creates the output of compileRoutedProducer, writing to the routes and default
+// destination of the producer.
+func compileRoutes(m Producer) (Fragment, error) {
+	if len(m.Routes) == 0 {
+		return compileDestination(m.step(), m.Kv, m.ObjectStore)
+	}
+
+	var cases []Fragment
+	var conditions []string
+	for i, r := range m.Routes {
+		if strings.TrimSpace(r.Condition) == "" {
+			return nil, fmt.Errorf("route %d: a route requires a condition", i)
+		}
+
+		output, err := compileDestination(r.step(m), r.Kv, r.ObjectStore)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+
+		c := Frag().
+			String("check", r.Condition).
+			Fragment("output", output)
+		if m.FanOut {
+			c.Bool("continue", true)
+		}
+
+		cases = append(cases, c)
+		conditions = append(conditions, fmt.Sprintf("!(%s)", r.Condition))
+	}
+
+	if m.Core != nil || m.Stream != nil || m.Kv != nil || m.ObjectStore != nil {
+		output, err := compileDestination(m.step(), m.Kv, m.ObjectStore)
+		if err != nil {
+			return nil, fmt.Errorf("default route: %w", err)
+		}
+
+		c := Frag().Fragment("output", output)
+		if m.FanOut {
+			c.String("check", strings.Join(conditions, " && "))
+		}
+
+		cases = append(cases, c)
+	}
+
+	return Frag().
+		Fragment("switch", Frag().
+			Fragments("cases", cases...)), nil
+}
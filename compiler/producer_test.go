@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/model"
 )
 
 type producerStepTest struct {
@@ -81,3 +82,271 @@ func runProducerStepTests(t *testing.T, tests ...producerStepTest) {
 		})
 	}
 }
+
+func TestCompileRoutedProducer(t *testing.T) {
+	nats := ncb.Build()
+	subject := func(s string) *model.ProducerStepCore {
+		c := ProducerStepCore(s).Build()
+		return &c
+	}
+	core := func(s string) Fragment {
+		return Frag().Fragment("nats", Frag().
+			Strings("urls", DefaultNatsUrl).
+			String("subject", s).
+			Int("max_in_flight", 1).
+			Fragment("metadata", Frag().
+				Strings("include_patterns", ".*")))
+	}
+
+	t.Run("should render a single output without routes", func(t *testing.T) {
+		res, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1, Core: subject("foo")})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !res.EqualsMap(core("foo")) {
+			t.Errorf("expected %v, got %v", core("foo"), res)
+		}
+	})
+
+	t.Run("should render a switch output with a default route", func(t *testing.T) {
+		res, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1,
+			Core: subject("other"),
+			Routes: []ProducerRoute{
+				{Condition: `this.kind == "a"`, Core: subject("a")},
+				{Condition: `this.kind == "b"`, Core: subject("b")},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().Fragment("switch", Frag().Fragments("cases",
+			Frag().String("check", `this.kind == "a"`).Fragment("output", core("a")),
+			Frag().String("check", `this.kind == "b"`).Fragment("output", core("b")),
+			Frag().Fragment("output", core("other"))))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should continue to every matching route in fan-out mode", func(t *testing.T) {
+		res, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1, FanOut: true,
+			Core: subject("other"),
+			Routes: []ProducerRoute{
+				{Condition: `this.kind == "a"`, Core: subject("a")},
+				{Condition: `this.urgent`, Core: subject("urgent")},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().Fragment("switch", Frag().Fragments("cases",
+			Frag().String("check", `this.kind == "a"`).Fragment("output", core("a")).Bool("continue", true),
+			Frag().String("check", `this.urgent`).Fragment("output", core("urgent")).Bool("continue", true),
+			Frag().Fragment("output", core("other")).String("check", `!(this.kind == "a") && !(this.urgent)`)))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should error if a route has no condition", func(t *testing.T) {
+		_, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1,
+			Routes: []ProducerRoute{{Core: subject("a")}},
+		})
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("should error if a route has no destination", func(t *testing.T) {
+		_, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1,
+			Routes: []ProducerRoute{{Condition: "true"}},
+		})
+		if err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+
+	t.Run("should render a kv output applying the operation of the messages", func(t *testing.T) {
+		res, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1,
+			Kv: &ProducerKv{
+				Bucket:     "view",
+				Key:        `${! json("id") }`,
+				Operation:  `${! if json("operationType") == "delete" { "delete" } else { "put" } }`,
+				TTL:        "24h",
+				OnConflict: "drop",
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().Fragment("nats_kv_write", Frag().
+			Strings("urls", DefaultNatsUrl).
+			String("bucket", "view").
+			String("key", `${! json("id") }`).
+			Int("max_in_flight", 1).
+			String("operation", `${! if json("operationType") == "delete" { "delete" } else { "put" } }`).
+			String("ttl", "24h").
+			String("on_conflict", "drop"))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should render a plain kv output without operation", func(t *testing.T) {
+		res, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1, Kv: &ProducerKv{Bucket: "view", Key: "k"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := compileKvProducer(model.ProducerStep{Nats: nats, Threads: 1, Kv: &model.ProducerStepKv{Bucket: "view", Key: "k"}})
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should error if the kv operation is invalid", func(t *testing.T) {
+		for _, kv := range []ProducerKv{
+			{Bucket: "view", Key: "k", Operation: "upsert"},
+			{Bucket: "view", Key: "k", Operation: "update"},
+			{Bucket: "view", Key: "k", TTL: "a day"},
+			{Bucket: "view", Key: "k", OnConflict: "ignore"},
+		} {
+			if _, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1, Kv: &kv}); err == nil {
+				t.Errorf("expected error for %+v, got nil", kv)
+			}
+		}
+	})
+
+	t.Run("should render an object store output", func(t *testing.T) {
+		res, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1,
+			ObjectStore: &ProducerObjectStore{Bucket: "reports", Name: `${! meta("path") }`},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().Fragment("nats_object_store", Frag().
+			Strings("urls", DefaultNatsUrl).
+			String("bucket", "reports").
+			String("name", `${! meta("path") }`).
+			Int("max_in_flight", 1).
+			Fragment("metadata", Frag().
+				Strings("include_patterns", ".*")))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should route to an object store", func(t *testing.T) {
+		res, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1,
+			Core: subject("other"),
+			Routes: []ProducerRoute{
+				{Condition: `this.large`, ObjectStore: &ProducerObjectStore{Bucket: "large", Name: `${! uuid_v4() }`}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().Fragment("switch", Frag().Fragments("cases",
+			Frag().String("check", `this.large`).Fragment("output", Frag().Fragment("nats_object_store", Frag().
+				Strings("urls", DefaultNatsUrl).
+				String("bucket", "large").
+				String("name", `${! uuid_v4() }`).
+				Int("max_in_flight", 1).
+				Fragment("metadata", Frag().
+					Strings("include_patterns", ".*")))),
+			Frag().Fragment("output", core("other"))))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should error if the object store is invalid or not the only destination", func(t *testing.T) {
+		for _, p := range []Producer{
+			{Nats: nats, Threads: 1, ObjectStore: &ProducerObjectStore{Name: "a"}},
+			{Nats: nats, Threads: 1, ObjectStore: &ProducerObjectStore{Bucket: "a"}},
+			{Nats: nats, Threads: 1, Core: subject("foo"), ObjectStore: &ProducerObjectStore{Bucket: "a", Name: "a"}},
+		} {
+			if _, err := compileRoutedProducer(p); err == nil {
+				t.Errorf("expected error for %+v, got nil", p)
+			}
+		}
+	})
+
+	t.Run("should offload payloads ahead of the output with a claim check", func(t *testing.T) {
+		res, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1, Core: subject("foo"),
+			ClaimCheck: &ClaimCheck{Bucket: "payloads", Threshold: 1024, TTL: "24h"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().
+			Fragment("reject_errored", core("foo")).
+			Fragments("processors", Frag().Fragment("nats_object_offload", Frag().
+				Strings("urls", DefaultNatsUrl).
+				String("bucket", "payloads").
+				Int("threshold", 1024).
+				String("ttl", "24h")))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should error if the claim check is invalid", func(t *testing.T) {
+		for _, cc := range []ClaimCheck{
+			{},
+			{Bucket: "payloads", Threshold: -1},
+			{Bucket: "payloads", TTL: "a day"},
+		} {
+			_, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1, Core: subject("foo"), ClaimCheck: &cc})
+			if err == nil {
+				t.Errorf("expected error for %+v, got nil", cc)
+			}
+		}
+	})
+
+	t.Run("should send the messages as requests returning the replies to the source", func(t *testing.T) {
+		res, err := compileRoutedProducer(Producer{Nats: nats, Threads: 1,
+			Request: &ProducerRequest{Subject: "svc.echo", Timeout: "2s"},
+			Headers: &HeaderPolicy{Exclude: []string{"^http_"}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		exp := Frag().
+			Fragment("reject_errored", Frag().
+				Fragment("sync_response", Frag())).
+			Fragments("processors",
+				Frag().String("mutation", `meta = @.filter(kv -> !(kv.key.re_match("^http_")))`),
+				Frag().Fragment("nats_request", Frag().
+					Strings("urls", DefaultNatsUrl).
+					String("subject", "svc.echo").
+					String("timeout", "2s").
+					Fragment("metadata", Frag().
+						Strings("include_patterns", ".*"))))
+		if !res.EqualsMap(exp) {
+			t.Errorf("expected %v, got %v", exp, res)
+		}
+	})
+
+	t.Run("should error if the request is invalid or not the only destination", func(t *testing.T) {
+		for _, p := range []Producer{
+			{Nats: nats, Request: &ProducerRequest{}},
+			{Nats: nats, Request: &ProducerRequest{Subject: "svc.echo", Timeout: "soon"}},
+			{Nats: nats, Request: &ProducerRequest{Subject: "svc.echo"}, Core: subject("foo")},
+			{Nats: nats, Request: &ProducerRequest{Subject: "svc.echo"}, Routes: []ProducerRoute{{Condition: "true", Core: subject("foo")}}},
+			{Nats: nats, Request: &ProducerRequest{Subject: "svc.echo"}, ClaimCheck: &ClaimCheck{Bucket: "payloads"}},
+		} {
+			if _, err := compileRoutedProducer(p); err == nil {
+				t.Errorf("expected error for %+v, got nil", p)
+			}
+		}
+	})
+}
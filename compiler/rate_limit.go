@@ -0,0 +1,128 @@
+package compiler
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/synadia-io/connect/runtime"
+)
+
+// rateLimitResourceLabel is the prefix of the labels of the rate limits, numbered in the order they are found
+const rateLimitResourceLabel = "rate_limit_"
+
+// invalidRateLimitKeyChars matches the characters which cannot be used in the key of a distributed rate limit
+var invalidRateLimitKeyChars = regexp.MustCompile(`[^-_a-zA-Z0-9]`)
+
+// compileRateLimit creates a Wombat rate_limit processor throttling the messages to the budget
+// of the rate limit. A distributed rate limit shares its budget through a NATS KV bucket, keyed
+// by the namespace and connector of the runtime so that all the instances of the connector
+// count against the same budget. An instance reserves a batch of messages of the budget from
+// the bucket at once, rather than reading and updating the bucket for every message.
+//
+// The definition of the rate limit is held in place of the name of its resource until
+// hoistRateLimits moves it to the rate_limit_resources of the configuration.
+//
+// Parameters:
+//   - rt: Runtime configuration holding the NATS connection details of a distributed rate limit
+//   - rl: The rate limit
+//
+// Returns:
+//   - A Fragment containing the Wombat processor configuration
+//   - An error if the budget of the rate limit is invalid
+func compileRateLimit(rt *runtime.Runtime, rl *RateLimit) (Fragment, error) {
+	if rl.Count <= 0 {
+		return nil, fmt.Errorf("a rate limit requires a positive count")
+	}
+
+	interval := rl.Interval
+	if interval == "" {
+		interval = "1s"
+	}
+	if d, err := time.ParseDuration(interval); err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid rate limit interval %q", rl.Interval)
+	}
+	if rl.Batch < 0 {
+		return nil, fmt.Errorf("the batch of a rate limit cannot be negative")
+	}
+	if rl.Batch > 0 && rl.Bucket == "" {
+		return nil, fmt.Errorf("only a distributed rate limit reserves its budget in batches")
+	}
+
+	budget := Frag().
+		Int("count", rl.Count).
+		String("interval", interval)
+
+	var def Fragment
+	if rl.Bucket == "" {
+		def = Frag().Fragment("local", budget)
+	} else {
+		if rt == nil || rt.NatsUrl == "" {
+			return nil, fmt.Errorf("a distributed rate limit requires the NATS connection of the runtime")
+		}
+
+		limit := runtimeNatsFragment(rt).
+			String("bucket", rl.Bucket)
+		if key := rateLimitKey(rt); key != "" {
+			limit.String("key", key)
+		}
+		maps.Copy(limit, budget)
+		if rl.Batch > 0 {
+			limit.Int("batch", rl.Batch)
+		}
+
+		def = Frag().Fragment("nats_kv", limit)
+	}
+
+	return Frag().Fragment("rate_limit", Frag().Fragment("resource", def)), nil
+}
+
+// rateLimitKey returns the key identifying the budget of the distributed rate limits of the
+// connector, made of its namespace and name.
+func rateLimitKey(rt *runtime.Runtime) string {
+	var parts []string
+	for _, p := range []string{rt.Namespace, rt.Connector} {
+		if p != "" {
+			parts = append(parts, invalidRateLimitKeyChars.ReplaceAllString(p, "_"))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// hoistRateLimits moves the definitions of the rate limits compiled by compileRateLimit to
+// rate limit resources, labelled in the order the rate limits are found in the configuration,
+// and points the rate_limit processors to their resource.
+//
+// Returns:
+//   - The rate limit resources, to be set as the rate_limit_resources of the configuration
+func hoistRateLimits(cfg Fragment) []Fragment {
+	var resources []Fragment
+
+	var walk func(f Fragment)
+	walk = func(f Fragment) {
+		if rl, ok := f["rate_limit"].(Fragment); ok {
+			if def, ok := rl["resource"].(Fragment); ok {
+				label := fmt.Sprintf("%s%d", rateLimitResourceLabel, len(resources))
+				resources = append(resources, def.String("label", label))
+				rl.String("resource", label)
+			}
+		}
+
+		for _, key := range slices.Sorted(maps.Keys(f)) {
+			switch v := f[key].(type) {
+			case Fragment:
+				walk(v)
+			case []Fragment:
+				for _, c := range v {
+					walk(c)
+				}
+			}
+		}
+	}
+	walk(cfg)
+
+	return resources
+}
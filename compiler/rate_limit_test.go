@@ -0,0 +1,177 @@
+package compiler_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/runtime"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = Describe("Compiling rate limits", func() {
+	compile := func(rt *runtime.Runtime, steps compiler.ConnectorSteps) *gabs.Container {
+		artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoLogr.Info(artifact)
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		return gabs.Wrap(m)
+	}
+
+	When("a transformer throttles an inlet", func() {
+		var steps compiler.ConnectorSteps
+
+		BeforeEach(func() {
+			steps = compiler.FromModel(Steps().
+				Source(SourceStep("stdin")).
+				Producer(ProducerStep(NatsConfig().Url(DefaultNatsUrl)).Core(ProducerStepCore("foo.bar"))).
+				Build())
+
+			steps.Transformer = &compiler.Transformer{
+				RateLimit: &compiler.RateLimit{Count: 10},
+			}
+		})
+
+		It("should compile a local rate limit resource", func() {
+			am := compile(test.Runtime(), steps)
+
+			Expect(am.Path("input.processors.0.rate_limit.resource").Data()).To(Equal("rate_limit_0"))
+			Expect(am.Path("rate_limit_resources.0.label").Data()).To(Equal("rate_limit_0"))
+			Expect(am.Path("rate_limit_resources.0.local.count").Data()).To(Equal(10))
+			Expect(am.Path("rate_limit_resources.0.local.interval").Data()).To(Equal("1s"))
+		})
+
+		It("should share the budget of a distributed rate limit between the instances of the connector", func() {
+			steps.Transformer.RateLimit.Interval = "1m"
+			steps.Transformer.RateLimit.Bucket = "limits"
+
+			am := compile(test.Runtime(runtime.WithNatsUrl(DefaultNatsUrl)), steps)
+
+			limit := am.Path("rate_limit_resources.0.nats_kv")
+			Expect(limit.Path("urls").Data()).To(Equal([]any{DefaultNatsUrl}))
+			Expect(limit.Path("bucket").Data()).To(Equal("limits"))
+			Expect(limit.Path("key").Data()).To(Equal("MY_NAMESPACE.MY_CONNECTOR"))
+			Expect(limit.Path("count").Data()).To(Equal(10))
+			Expect(limit.Path("interval").Data()).To(Equal("1m"))
+			Expect(limit.Exists("batch")).To(BeFalse())
+		})
+
+		It("should reserve the budget of a distributed rate limit in batches", func() {
+			steps.Transformer.RateLimit.Bucket = "limits"
+			steps.Transformer.RateLimit.Batch = 5
+
+			am := compile(test.Runtime(runtime.WithNatsUrl(DefaultNatsUrl)), steps)
+
+			Expect(am.Path("rate_limit_resources.0.nats_kv.batch").Data()).To(Equal(5))
+		})
+
+		It("should throttle the messages", func() {
+			steps.Transformer.RateLimit = &compiler.RateLimit{Count: 1, Interval: "200ms"}
+
+			artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+			Expect(err).NotTo(HaveOccurred())
+
+			var m map[string]any
+			Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+			resources, err := yaml.Marshal(map[string]any{"rate_limit_resources": m["rate_limit_resources"]})
+			Expect(err).NotTo(HaveOccurred())
+			processor, err := yaml.Marshal(gabs.Wrap(m).Path("input.processors.0").Data())
+			Expect(err).NotTo(HaveOccurred())
+
+			sb := service.NewStreamBuilder()
+			Expect(sb.AddResourcesYAML(string(resources))).To(Succeed())
+			Expect(sb.AddProcessorYAML(string(processor))).To(Succeed())
+
+			produce, err := sb.AddProducerFunc()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sb.AddConsumerFunc(func(context.Context, *service.Message) error { return nil })).To(Succeed())
+
+			stream, err := sb.Build()
+			Expect(err).NotTo(HaveOccurred())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() { _ = stream.Run(ctx) }()
+
+			start := time.Now()
+			for range 4 {
+				Expect(produce(ctx, service.NewMessage([]byte("{}")))).To(Succeed())
+			}
+			Expect(time.Since(start)).To(BeNumerically(">=", 500*time.Millisecond))
+
+			Expect(stream.Stop(ctx)).To(Succeed())
+		})
+
+		DescribeTable("should reject invalid rate limits",
+			func(rl compiler.RateLimit, rt *runtime.Runtime) {
+				steps.Transformer.RateLimit = &rl
+
+				_, err := compiler.CompileSteps(context.Background(), rt, steps)
+				Expect(err).To(HaveOccurred())
+				Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidTransformer))
+			},
+			Entry("no count", compiler.RateLimit{}, test.Runtime()),
+			Entry("invalid interval", compiler.RateLimit{Count: 1, Interval: "often"}, test.Runtime()),
+			Entry("negative interval", compiler.RateLimit{Count: 1, Interval: "-1s"}, test.Runtime()),
+			Entry("distributed without NATS connection", compiler.RateLimit{Count: 1, Bucket: "limits"}, test.Runtime()),
+			Entry("negative batch", compiler.RateLimit{Count: 1, Bucket: "limits", Batch: -1}, test.Runtime(runtime.WithNatsUrl(DefaultNatsUrl))),
+			Entry("local with a batch", compiler.RateLimit{Count: 1, Batch: 1}, test.Runtime()),
+		)
+	})
+
+	When("sinks of a fan-out outlet are throttled", func() {
+		var steps compiler.ConnectorSteps
+
+		BeforeEach(func() {
+			steps = compiler.FromModel(Steps().
+				Consumer(ConsumerStep(test.UnauthenticatedNatsConfig()).Core(ConsumerStepCore("foo.bar"))).
+				Build())
+
+			steps.Transformer = &compiler.Transformer{
+				RateLimit: &compiler.RateLimit{Count: 100},
+			}
+			steps.Sinks = []compiler.FanOutSink{
+				{Type: "stdout", RateLimit: &compiler.RateLimit{Count: 5, Interval: "1s"}},
+				{Type: "drop"},
+				{
+					Type:      "drop",
+					Delivery:  compiler.SinkDeliveryBestEffort,
+					RateLimit: &compiler.RateLimit{Count: 2, Interval: "1m"},
+				},
+			}
+		})
+
+		It("should give every rate limit its own resource", func() {
+			am := compile(test.Runtime(), steps)
+
+			Expect(am.Path("input.processors.0.rate_limit.resource").Data()).To(Equal("rate_limit_0"))
+			Expect(am.Path("output.broker.outputs.0.processors.0.rate_limit.resource").Data()).To(Equal("rate_limit_1"))
+			Expect(am.Exists("output", "broker", "outputs", "1", "processors")).To(BeFalse())
+			Expect(am.Path("output.broker.outputs.2.processors.0.rate_limit.resource").Data()).To(Equal("rate_limit_2"))
+			Expect(am.Exists("output", "broker", "outputs", "2", "drop_on")).To(BeTrue())
+
+			Expect(am.Path("rate_limit_resources.0.local.count").Data()).To(Equal(100))
+			Expect(am.Path("rate_limit_resources.1.local.count").Data()).To(Equal(5))
+			Expect(am.Path("rate_limit_resources.2.local.count").Data()).To(Equal(2))
+		})
+
+		It("should reject invalid rate limits", func() {
+			steps.Sinks[1].RateLimit = &compiler.RateLimit{Count: -1}
+
+			_, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+			Expect(err).To(MatchError(ContainSubstring("sink 1")))
+			Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidSink))
+		})
+	})
+})
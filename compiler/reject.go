@@ -0,0 +1,72 @@
+package compiler
+
+import "slices"
+
+// retriedProcessors are the processors whose failures are not the fault of the message, such as
+// a bucket which cannot be reached. They leave the messages errored, to be rejected by the output
+// and delivered again by the input.
+var retriedProcessors = []string{
+	"nats_kv_lookup",
+	"schema_encode",
+	"schema_decode",
+	"compress",
+	"nats_object_rehydrate",
+	"field_decrypt",
+}
+
+// rejectErrored wraps the output in a reject_errored output when the input or output holds one of
+// the retriedProcessors, so that the messages they leave errored are rejected rather than written.
+// The processors of the output are kept on the wrapping output, and an output already rejecting
+// the errored messages is returned as is.
+func rejectErrored(input Fragment, output Fragment) Fragment {
+	if _, ok := output["reject_errored"]; ok {
+		return output
+	}
+
+	if !holdsProcessor(input, retriedProcessors...) && !holdsProcessor(output, retriedProcessors...) {
+		return output
+	}
+
+	result := Frag()
+	if procs, ok := output["processors"].([]Fragment); ok {
+		delete(output, "processors")
+		result.Fragments("processors", procs...)
+	}
+
+	return result.Fragment("reject_errored", output)
+}
+
+// releaseDeduped wraps the output in a nats_dedupe_release output when the input holds a
+// nats_dedupe processor, so that the keys recorded for the messages the output fails to write or
+// rejects are released, and their redelivery is not dropped as a duplicate.
+func releaseDeduped(input Fragment, output Fragment) Fragment {
+	if !holdsProcessor(input, "nats_dedupe") {
+		return output
+	}
+
+	return Frag().Fragment("nats_dedupe_release", Frag().Fragment("output", output))
+}
+
+// holdsProcessor reports whether one of the named processors is found in the fragment.
+func holdsProcessor(f Fragment, names ...string) bool {
+	for _, name := range names {
+		if _, ok := f[name]; ok {
+			return true
+		}
+	}
+
+	for _, value := range f {
+		switch v := value.(type) {
+		case Fragment:
+			if holdsProcessor(v, names...) {
+				return true
+			}
+		case []Fragment:
+			if slices.ContainsFunc(v, func(f Fragment) bool { return holdsProcessor(f, names...) }) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,90 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Error classes, identifying the stage of the workload an error originates from
+const (
+	CompilationErrorClass = "compilation"
+	ValidationErrorClass  = "validation"
+	RuntimeErrorClass     = "runtime"
+	UnknownErrorClass     = "unknown"
+)
+
+// ErrorReport is a machine-readable description of an error, allowing user
+// interfaces to point users at the exact step and field that is wrong.
+type ErrorReport struct {
+	// Class is the stage the error originates from: compilation, validation, runtime or unknown
+	Class string `json:"class"`
+	// Code is the stable identifier of the error condition
+	Code ErrorCode `json:"code"`
+	// Message is the human readable description of the error
+	Message string `json:"message"`
+	// Phase is the compilation phase in which the error occurred, if any
+	Phase string `json:"phase,omitempty"`
+	// Step is the step that failed to compile, if any
+	Step string `json:"step,omitempty"`
+	// Component is the component that failed validation or at runtime, if any
+	Component string `json:"component,omitempty"`
+	// Cause is the message of the underlying error, if any
+	Cause string `json:"cause,omitempty"`
+	// Issues locates the individual problems found during validation
+	Issues []Issue `json:"issues,omitempty"`
+}
+
+// NewErrorReport creates an ErrorReport describing the given error, using the
+// first CompilationError, ValidationError or RuntimeError found in its chain.
+func NewErrorReport(err error) *ErrorReport {
+	var compilationErr *CompilationError
+	var validationErr *ValidationError
+	var runtimeErr *RuntimeError
+
+	switch {
+	case errors.As(err, &compilationErr):
+		return &ErrorReport{
+			Class:   CompilationErrorClass,
+			Code:    compilationErr.Code,
+			Message: compilationErr.Message,
+			Phase:   compilationErr.Phase,
+			Step:    compilationErr.Step,
+			Cause:   causeOf(compilationErr.Err),
+		}
+	case errors.As(err, &validationErr):
+		return &ErrorReport{
+			Class:     ValidationErrorClass,
+			Code:      validationErr.Code,
+			Message:   validationErr.Message,
+			Component: validationErr.Component,
+			Cause:     causeOf(validationErr.Err),
+			Issues:    validationErr.Issues,
+		}
+	case errors.As(err, &runtimeErr):
+		return &ErrorReport{
+			Class:     RuntimeErrorClass,
+			Code:      runtimeErr.Code,
+			Message:   runtimeErr.Message,
+			Component: runtimeErr.Component,
+			Cause:     causeOf(runtimeErr.Err),
+		}
+	default:
+		return &ErrorReport{
+			Class:   UnknownErrorClass,
+			Code:    CodeUnknown,
+			Message: err.Error(),
+		}
+	}
+}
+
+// JSON renders the ErrorReport as a JSON document.
+func (r *ErrorReport) JSON() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func causeOf(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
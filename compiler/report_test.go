@@ -0,0 +1,184 @@
+package compiler_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/model"
+	"github.com/synadia-io/connect/runtime"
+)
+
+var _ = Describe("Error Reports", func() {
+	validate := func(steps model.Steps) []compiler.Issue {
+		artifact, err := compiler.Compile(test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = compiler.Validate(context.Background(), test.Runtime(), artifact, nil)
+		Expect(err).To(HaveOccurred())
+
+		return compiler.LintIssues(err, artifact, compiler.FromModel(steps))
+	}
+
+	check := func(steps model.Steps) []compiler.Issue {
+		_, err := compiler.Compile(test.Runtime(), steps)
+		Expect(err).To(HaveOccurred())
+
+		var vErr *compiler.ValidationError
+		Expect(errors.As(err, &vErr)).To(BeTrue())
+		return vErr.Issues
+	}
+
+	When("a source has an unknown field", func() {
+		It("should locate the field in the source config", func() {
+			issues := check(Steps().
+				Source(test.GenerateSource().SetString("not_a_field", "value")).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+				Build())
+
+			Expect(issues).To(ContainElement(SatisfyAll(
+				HaveField("Code", compiler.CodeUnknownField),
+				HaveField("Path", "source.config.not_a_field"),
+				HaveField("ConfigPath", "input.generate.not_a_field"),
+			)))
+		})
+	})
+
+	When("a source type does not exist", func() {
+		It("should point at the source type", func() {
+			issues := validate(Steps().
+				Source(test.InvalidSource()).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+				Build())
+
+			Expect(issues).NotTo(BeEmpty())
+			Expect(issues[0].Code).To(Equal(compiler.CodeUnknownComponent))
+			Expect(issues[0].Path).To(Equal("source.type"))
+		})
+	})
+
+	When("a sink has a field of the wrong type", func() {
+		It("should locate the field in the sink config", func() {
+			issues := validate(Steps().
+				Consumer(ConsumerStep(test.UnauthenticatedNatsConfig()).Core(ConsumerStepCore("foo.bar"))).
+				Sink(SinkStep("stdout").SetStrings("codec", "lines", "delim")).
+				Build())
+
+			Expect(issues).To(ContainElement(SatisfyAll(
+				HaveField("Code", compiler.CodeInvalidType),
+				HaveField("Path", "sink.config.codec"),
+			)))
+		})
+	})
+
+	When("the sink of a deduplicating outlet has a field of the wrong type", func() {
+		It("should locate the field through the outputs wrapping the sink", func() {
+			steps := compiler.FromModel(Steps().
+				Consumer(ConsumerStep(test.UnauthenticatedNatsConfig()).Core(ConsumerStepCore("foo.bar"))).
+				Sink(SinkStep("stdout").SetStrings("codec", "lines", "delim")).
+				Build())
+			steps.Transformer = &compiler.Transformer{
+				Dedupe: &compiler.DedupeTransformer{Key: "this.id", Bucket: "seen"},
+			}
+			rt := test.Runtime(runtime.WithNatsUrl(DefaultNatsUrl))
+
+			artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = compiler.Validate(context.Background(), rt, artifact, nil)
+			Expect(err).To(HaveOccurred())
+
+			Expect(compiler.LintIssues(err, artifact, steps)).To(ContainElement(SatisfyAll(
+				HaveField("Code", compiler.CodeInvalidType),
+				HaveField("Path", "sink.config.codec"),
+				HaveField("ConfigPath", "output.nats_dedupe_release.output.stdout.codec"),
+			)))
+		})
+	})
+
+	When("a mapping transformer does not parse", func() {
+		It("should point at the transformer", func() {
+			issues := validate(Steps().
+				Source(test.GenerateSource()).
+				Transformer(TransformerStep().Mapping(MappingTransformerStep("root = ("))).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+				Build())
+
+			Expect(issues).To(ContainElement(SatisfyAll(
+				HaveField("Code", compiler.CodeInvalidBloblang),
+				HaveField("Path", "transformer"),
+			)))
+		})
+	})
+
+	When("the header mapping of a producer does not parse", func() {
+		It("should point at the header policy", func() {
+			steps := compiler.FromModel(Steps().
+				Source(test.GenerateSource()).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+				Build())
+			steps.Producer.Headers = &compiler.HeaderPolicy{Mapping: "meta = ("}
+
+			artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = compiler.Validate(context.Background(), test.Runtime(), artifact, nil)
+			Expect(err).To(HaveOccurred())
+
+			Expect(compiler.LintIssues(err, artifact, steps)).To(ContainElement(SatisfyAll(
+				HaveField("Code", compiler.CodeInvalidBloblang),
+				HaveField("Path", "producer.headers"),
+			)))
+		})
+	})
+
+	It("should render validation errors including their issues", func() {
+		cause := errors.New("lint errors")
+		err := fmt.Errorf("launch failed: %w", compiler.NewValidationError("configuration", "failed to validate and create stream", cause).
+			WithCode(compiler.CodeInvalidConfiguration).
+			WithIssues(compiler.Issue{Code: compiler.CodeUnknownField, Path: "source.config.foo", Message: "field foo not recognised"}))
+
+		b, jErr := compiler.NewErrorReport(err).JSON()
+		Expect(jErr).NotTo(HaveOccurred())
+
+		var m map[string]any
+		Expect(json.Unmarshal(b, &m)).To(Succeed())
+		Expect(m["class"]).To(Equal("validation"))
+		Expect(m["code"]).To(Equal("invalid_configuration"))
+		Expect(m["component"]).To(Equal("configuration"))
+		Expect(m["cause"]).To(Equal("lint errors"))
+		Expect(m["issues"]).To(HaveLen(1))
+		Expect(m["issues"].([]any)[0]).To(HaveKeyWithValue("path", "source.config.foo"))
+	})
+
+	It("should render compilation errors with their phase and step", func() {
+		inlet := Steps().
+			Source(test.GenerateSource()).
+			Producer(ProducerStep(test.UnauthenticatedNatsConfig())).
+			Build()
+
+		_, err := compiler.Compile(test.Runtime(), inlet)
+		Expect(err).To(HaveOccurred())
+
+		report := compiler.NewErrorReport(err)
+		Expect(report.Class).To(Equal(compiler.CompilationErrorClass))
+		Expect(report.Code).To(Equal(compiler.CodeInvalidProducer))
+		Expect(report.Phase).To(Equal("output"))
+		Expect(report.Step).To(Equal("producer"))
+	})
+
+	It("should render runtime errors and unknown errors", func() {
+		report := compiler.NewErrorReport(compiler.NewRuntimeError("stream", "stream execution failed", nil).WithCode(compiler.CodeStreamFailed))
+		Expect(report.Class).To(Equal(compiler.RuntimeErrorClass))
+		Expect(report.Code).To(Equal(compiler.CodeStreamFailed))
+
+		report = compiler.NewErrorReport(errors.New("unexpected"))
+		Expect(report.Class).To(Equal(compiler.UnknownErrorClass))
+		Expect(report.Code).To(Equal(compiler.CodeUnknown))
+		Expect(report.Message).To(Equal("unexpected"))
+	})
+})
@@ -0,0 +1,119 @@
+package compiler_test
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/Jeffail/gabs/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = Describe("Compiling a fan-out outlet", func() {
+	var steps compiler.ConnectorSteps
+
+	BeforeEach(func() {
+		steps = compiler.FromModel(Steps().
+			Consumer(ConsumerStep(test.UnauthenticatedNatsConfig()).Core(ConsumerStepCore("foo.bar"))).
+			Build())
+
+		steps.Sinks = []compiler.FanOutSink{
+			{Type: "stdout"},
+			{
+				Type:     "drop",
+				Delivery: compiler.SinkDeliveryBestEffort,
+				Retry:    &compiler.SinkRetry{MaxRetries: 3, InitialInterval: "100ms"},
+				Batching: &compiler.SinkBatching{Count: 10, Period: "1s"},
+			},
+		}
+	})
+
+	It("should generate a valid wombat artifact", func() {
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoLogr.Info(artifact)
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		am := gabs.Wrap(m)
+
+		Expect(am.Path("output.broker.pattern").Data()).To(Equal("fan_out"))
+		Expect(am.Exists("output", "broker", "outputs", "0", "stdout")).To(BeTrue())
+
+		bestEffort := am.Path("output.broker.outputs.1.drop_on")
+		Expect(bestEffort.Path("error").Data()).To(BeTrue())
+		Expect(bestEffort.Path("output.retry.max_retries").Data()).To(Equal(3))
+		Expect(bestEffort.Path("output.retry.backoff.initial_interval").Data()).To(Equal("100ms"))
+		Expect(bestEffort.Path("output.retry.output.broker.batching.count").Data()).To(Equal(10))
+		Expect(bestEffort.Path("output.retry.output.broker.batching.period").Data()).To(Equal("1s"))
+		Expect(bestEffort.Exists("output", "retry", "output", "broker", "outputs", "0", "drop")).To(BeTrue())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+		_, err = sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject a sink alongside the sinks", func() {
+		sink := SinkStep("stdout").Build()
+		steps.Sink = &sink
+
+		_, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).To(HaveOccurred())
+		Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidSteps))
+	})
+
+	It("should reject unknown delivery guarantees", func() {
+		steps.Sinks[0].Delivery = "at_most_once"
+
+		_, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).To(HaveOccurred())
+		Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidSink))
+	})
+
+	It("should locate lint errors in the sink they originate from", func() {
+		steps.Sinks[1] = compiler.FanOutSink{
+			Type:     "stdout",
+			Config:   map[string]any{"codec": []string{"lines", "delim"}},
+			Delivery: compiler.SinkDeliveryBestEffort,
+			Retry:    &compiler.SinkRetry{},
+		}
+
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = compiler.Validate(context.Background(), test.Runtime(), artifact, nil)
+		Expect(err).To(HaveOccurred())
+
+		Expect(compiler.LintIssues(err, artifact, steps)).To(ContainElement(SatisfyAll(
+			HaveField("Code", compiler.CodeInvalidType),
+			HaveField("Path", "sinks.1.config.codec"),
+		)))
+	})
+
+	It("should check the sinks against their specifications", func() {
+		specs, err := compiler.LoadSpecs(os.DirFS("../.connect"))
+		Expect(err).NotTo(HaveOccurred())
+
+		steps.Sinks = []compiler.FanOutSink{
+			{Type: "redis_pubsub", Config: map[string]any{"not_a_field": "value"}, Retry: &compiler.SinkRetry{}},
+		}
+
+		_, err = compiler.CompileSteps(compiler.WithSpecs(context.Background(), specs), test.Runtime(), steps)
+		Expect(err).To(HaveOccurred())
+
+		var vErr *compiler.ValidationError
+		Expect(errors.As(err, &vErr)).To(BeTrue())
+		Expect(vErr.Issues).To(ContainElement(SatisfyAll(
+			HaveField("Code", compiler.CodeUnknownField),
+			HaveField("Path", "sinks.0.config.not_a_field"),
+			HaveField("ConfigPath", "output.broker.outputs.0.retry.output.redis_pubsub.not_a_field"),
+		)))
+	})
+})
@@ -0,0 +1,114 @@
+package compiler_test
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/Jeffail/gabs/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/model"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = Describe("Compiling a multi-source inlet", func() {
+	var steps compiler.ConnectorSteps
+
+	BeforeEach(func() {
+		steps = compiler.FromModel(Steps().
+			Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+			Build())
+
+		steps.Sources = []compiler.MergedSource{
+			{Type: "generate", Name: "ticks", Config: map[string]any{"mapping": `root = "tick"`, "interval": "1s"}},
+			{
+				Type:   "generate",
+				Config: map[string]any{"mapping": `root = "tock"`, "interval": "1s"},
+				Transformer: &compiler.Transformer{
+					Mapping: &model.MappingTransformerStep{Sourcecode: "root = content().uppercase()"},
+				},
+			},
+		}
+	})
+
+	It("should generate a valid wombat artifact", func() {
+		steps.Transformer = &compiler.Transformer{
+			Mapping: &model.MappingTransformerStep{Sourcecode: "root = this"},
+		}
+
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoLogr.Info(artifact)
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		am := gabs.Wrap(m)
+
+		Expect(am.Path("input.broker.inputs.0.generate.mapping").Data()).To(Equal(`root = "tick"`))
+		Expect(am.Path("input.broker.inputs.0.processors.0.mutation").Data()).To(Equal(`meta "Connect-Source" = "ticks"`))
+		Expect(am.Path("input.broker.inputs.1.processors.0.mutation").Data()).To(Equal(`meta "Connect-Source" = "generate_1"`))
+		Expect(am.Path("input.broker.inputs.1.processors.1.mapping").Data()).To(Equal("root = content().uppercase()"))
+		Expect(am.Path("input.processors.0.mapping").Data()).To(Equal("root = this"))
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+		_, err = sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject a source alongside the sources", func() {
+		source := test.GenerateSource().Build()
+		steps.Source = &source
+
+		_, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).To(HaveOccurred())
+		Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidSteps))
+	})
+
+	It("should reject sources sharing a name", func() {
+		steps.Sources[1].Name = "ticks"
+
+		_, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).To(HaveOccurred())
+		Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidSource))
+	})
+
+	It("should locate lint errors in the source they originate from", func() {
+		steps.Sources[1].Config["mapping"] = "root = ("
+
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = compiler.Validate(context.Background(), test.Runtime(), artifact, nil)
+		Expect(err).To(HaveOccurred())
+
+		Expect(compiler.LintIssues(err, artifact, steps)).To(ContainElement(SatisfyAll(
+			HaveField("Code", compiler.CodeInvalidBloblang),
+			HaveField("Path", "sources.1.config.mapping"),
+			HaveField("ConfigPath", "input.broker.inputs.1.generate.mapping"),
+		)))
+	})
+
+	It("should check the sources against their specifications", func() {
+		specs, err := compiler.LoadSpecs(os.DirFS("../.connect"))
+		Expect(err).NotTo(HaveOccurred())
+
+		steps.Sources[0].Config["not_a_field"] = "value"
+
+		_, err = compiler.CompileSteps(compiler.WithSpecs(context.Background(), specs), test.Runtime(), steps)
+		Expect(err).To(HaveOccurred())
+
+		var vErr *compiler.ValidationError
+		Expect(errors.As(err, &vErr)).To(BeTrue())
+		Expect(vErr.Issues).To(ContainElement(SatisfyAll(
+			HaveField("Code", compiler.CodeUnknownField),
+			HaveField("Path", "sources.0.config.not_a_field"),
+			HaveField("ConfigPath", "input.broker.inputs.0.generate.not_a_field"),
+		)))
+	})
+})
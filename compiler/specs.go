@@ -0,0 +1,460 @@
+package compiler
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/synadia-io/connect/model"
+	"gopkg.in/yaml.v3"
+)
+
+// SpecsKey is the context key for the component specifications used during compilation
+const SpecsKey contextKey = "component_specs"
+
+type contextKey string
+
+// specFiles holds the Connect specifications of the sources and sinks offered by this runtime,
+// also published as the .connect/sources and .connect/sinks documents
+//
+//go:embed specs/sources/*.yml specs/sinks/*.yml
+var specFiles embed.FS
+
+// EmbeddedSpecs returns the component specifications embedded in the compiler, loading them
+// on first use.
+var EmbeddedSpecs = sync.OnceValues(func() (*Specs, error) {
+	fsys, err := fs.Sub(specFiles, "specs")
+	if err != nil {
+		return nil, err
+	}
+	return LoadSpecs(fsys)
+})
+
+// Specs holds the Connect component specifications (the .connect/sources and
+// .connect/sinks documents) that source and sink configurations are checked against.
+type Specs struct {
+	sources map[string]*model.Component
+	sinks   map[string]*model.Component
+}
+
+// LoadSpecs reads the component specifications from the sources and sinks
+// directories of the given filesystem.
+//
+// Parameters:
+//   - fsys: A filesystem holding the sources/*.yml and sinks/*.yml specifications
+//
+// Returns:
+//   - The loaded specifications, indexed by component name
+//   - An error if a specification could not be read or parsed
+func LoadSpecs(fsys fs.FS) (*Specs, error) {
+	sources, err := loadComponents(fsys, "sources")
+	if err != nil {
+		return nil, err
+	}
+
+	sinks, err := loadComponents(fsys, "sinks")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Specs{sources: sources, sinks: sinks}, nil
+}
+
+func loadComponents(fsys fs.FS, dir string) (map[string]*model.Component, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.yml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s specs: %w", dir, err)
+	}
+
+	result := make(map[string]*model.Component, len(files))
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spec %s: %w", file, err)
+		}
+
+		var c model.Component
+		if err := yaml.Unmarshal(b, &c); err != nil {
+			return nil, fmt.Errorf("failed to parse spec %s: %w", file, err)
+		}
+
+		result[c.Name] = &c
+	}
+
+	return result, nil
+}
+
+// Source returns the specification of the source with the given name.
+func (s *Specs) Source(name string) (*model.Component, bool) {
+	c, ok := s.sources[name]
+	return c, ok
+}
+
+// Sink returns the specification of the sink with the given name.
+func (s *Specs) Sink(name string) (*model.Component, bool) {
+	c, ok := s.sinks[name]
+	return c, ok
+}
+
+// Check validates the source and sink configurations of the given steps against
+// their specifications. Unknown fields, values of the wrong type, values violating
+// the constraints of a field, missing required fields and options of the wrapped
+// Wombat component that are deprecated or not exposed by Connect are all reported.
+//
+// Returns the issues found, or nil if the configurations match their specifications.
+func (s *Specs) Check(steps model.Steps) []Issue {
+	var result []Issue
+
+	if steps.Source != nil {
+		result = append(result, s.check("source", "input", s.sources, steps.Source.Type, steps.Source.Config)...)
+	}
+
+	if steps.Sink != nil {
+		result = append(result, s.check("sink", "output", s.sinks, steps.Sink.Type, steps.Sink.Config)...)
+	}
+
+	return result
+}
+
+// CheckSources validates the configurations of the sources of a multi-source inlet against
+// their specifications, like Check does for a single source.
+//
+// Returns the issues found, or nil if the configurations match their specifications.
+func (s *Specs) CheckSources(sources []MergedSource) []Issue {
+	var result []Issue
+
+	for i, source := range sources {
+		step := "sources." + strconv.Itoa(i)
+		result = append(result, s.check(step, "input.broker.inputs."+strconv.Itoa(i), s.sources, source.Type, source.Config)...)
+	}
+
+	return result
+}
+
+// CheckSinks validates the configurations of the sinks of a fan-out outlet against their
+// specifications, like Check does for a single sink.
+//
+// Returns the issues found, or nil if the configurations match their specifications.
+func (s *Specs) CheckSinks(sinks []FanOutSink) []Issue {
+	var result []Issue
+
+	for i, sink := range sinks {
+		step := "sinks." + strconv.Itoa(i)
+		section := strings.Join(append([]string{"output"}, sinkOutputPath(i, sink)...), ".")
+		result = append(result, s.check(step, section, s.sinks, sink.Type, sink.Config)...)
+	}
+
+	return result
+}
+
+func (s *Specs) check(step, section string, components map[string]*model.Component, typ string, cfg map[string]any) []Issue {
+	c, ok := components[typ]
+	if !ok {
+		return []Issue{{
+			Code:       CodeUnknownComponent,
+			Path:       step + ".type",
+			ConfigPath: section,
+			Message:    fmt.Sprintf("%s %s has no specification, its configuration is not checked", step, typ),
+		}}
+	}
+
+	chk := &specCheck{step: step, config: section + "." + typ}
+	chk.object(nil, topLevelFields(c), cfg, wombatFields(section, typ))
+
+	return chk.issues
+}
+
+// wombatField is the part of the Wombat field documentation needed to classify
+// options that are not part of a Connect specification.
+type wombatField struct {
+	Name         string        `json:"name"`
+	IsDeprecated bool          `json:"is_deprecated"`
+	IsOptional   bool          `json:"is_optional"`
+	Default      any           `json:"default"`
+	Children     []wombatField `json:"children"`
+}
+
+// wombatFields returns the fields of the Wombat input or output with the given name.
+func wombatFields(section, name string) []wombatField {
+	var view *service.ConfigView
+	var ok bool
+	if section == "input" {
+		view, ok = service.GlobalEnvironment().GetInputConfig(name)
+	} else {
+		view, ok = service.GlobalEnvironment().GetOutputConfig(name)
+	}
+	if !ok {
+		return nil
+	}
+
+	b, err := view.FormatJSON()
+	if err != nil {
+		return nil
+	}
+
+	var doc struct {
+		Config wombatField `json:"config"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil
+	}
+
+	return doc.Config.Children
+}
+
+func findWombatField(fields []wombatField, name string) (wombatField, bool) {
+	for _, f := range fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return wombatField{}, false
+}
+
+// fieldsOf indexes the given fields by their key within the parent object. Fields
+// without a path only group other fields and are flattened into the result.
+func fieldsOf(fields []*model.ComponentField) map[string]*model.ComponentField {
+	result := map[string]*model.ComponentField{}
+	for _, f := range fields {
+		if f.Path == nil {
+			for k, v := range fieldsOf(f.Fields) {
+				result[k] = v
+			}
+			continue
+		}
+
+		key := *f.Path
+		if idx := strings.LastIndex(key, "."); idx >= 0 {
+			key = key[idx+1:]
+		}
+		result[strings.TrimSuffix(key, "[]")] = f
+	}
+	return result
+}
+
+// specCheck collects the issues found while checking a single configuration.
+type specCheck struct {
+	step   string
+	config string
+	issues []Issue
+}
+
+// report records an issue for the field at the given path. The message is
+// prefixed with the name of the field.
+func (c *specCheck) report(code ErrorCode, path []string, format string, args ...any) {
+	c.issues = append(c.issues, Issue{
+		Code:       code,
+		Path:       strings.Join(append([]string{c.step, "config"}, path...), "."),
+		ConfigPath: strings.Join(append([]string{c.config}, path...), "."),
+		Message:    fmt.Sprintf("field %s ", strings.Join(path, ".")) + fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *specCheck) object(path []string, fields map[string]*model.ComponentField, cfg map[string]any, wombat []wombatField) {
+	for _, k := range slices.Sorted(maps.Keys(cfg)) {
+		p := append(slices.Clone(path), k)
+		f, ok := fields[k]
+		if !ok {
+			wf, known := findWombatField(wombat, k)
+			switch {
+			case known && wf.IsDeprecated:
+				c.report(CodeDeprecatedField, p, "is deprecated and ignored by the %s", c.step)
+			case known:
+				c.report(CodeIgnoredField, p, "is not supported by the %s", c.step)
+			default:
+				c.report(CodeUnknownField, p, "is not recognised")
+			}
+			continue
+		}
+
+		wf, _ := findWombatField(wombat, k)
+		c.field(p, f, cfg[k], wf.Children)
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		if _, ok := cfg[k]; ok || !isRequired(fields[k]) {
+			continue
+		}
+
+		// some fields are only required in combination with others, which is left to Wombat
+		if wf, known := findWombatField(wombat, k); known && (wf.IsOptional || wf.Default != nil) {
+			continue
+		}
+		c.report(CodeMissingField, append(slices.Clone(path), k), "is required")
+	}
+}
+
+func isRequired(f *model.ComponentField) bool {
+	return (f.Optional == nil || !*f.Optional) && f.Default == nil
+}
+
+func (c *specCheck) field(path []string, f *model.ComponentField, value any, wombat []wombatField) {
+	switch f.Kind {
+	case model.ComponentFieldKindList:
+		items, ok := asList(value)
+		if !ok {
+			c.report(CodeInvalidType, path, "expects a list")
+			return
+		}
+		for i, item := range items {
+			c.value(append(slices.Clone(path), strconv.Itoa(i)), f, item, wombat)
+		}
+	case model.ComponentFieldKindMap:
+		entries, ok := asMap(value)
+		if !ok {
+			c.report(CodeInvalidType, path, "expects a map")
+			return
+		}
+		for _, k := range slices.Sorted(maps.Keys(entries)) {
+			c.value(append(slices.Clone(path), k), f, entries[k], wombat)
+		}
+	default:
+		c.value(path, f, value, wombat)
+	}
+}
+
+func (c *specCheck) value(path []string, f *model.ComponentField, value any, wombat []wombatField) {
+	if s, ok := value.(string); ok && strings.Contains(s, "${") {
+		// environment variables are only resolved by Wombat
+		return
+	}
+
+	switch f.Type {
+	case model.ComponentFieldTypeObject, model.ComponentFieldTypeScanner:
+		obj, ok := asMap(value)
+		if !ok {
+			c.report(CodeInvalidType, path, "expects an object")
+			return
+		}
+		if f.Type == model.ComponentFieldTypeObject && len(f.Fields) > 0 {
+			c.object(path, fieldsOf(f.Fields), obj, wombat)
+		}
+		return
+	case model.ComponentFieldTypeBool:
+		if _, ok := value.(bool); !ok {
+			c.report(CodeInvalidType, path, "expects a boolean")
+		}
+		return
+	case model.ComponentFieldTypeInt:
+		n, ok := asNumber(value)
+		if !ok || n != float64(int64(n)) {
+			c.report(CodeInvalidType, path, "expects an integer")
+			return
+		}
+		c.constraints(path, f, n, strconv.FormatFloat(n, 'f', -1, 64))
+		return
+	default:
+		s, ok := value.(string)
+		if !ok {
+			c.report(CodeInvalidType, path, "expects a string")
+			return
+		}
+		c.constraints(path, f, 0, s)
+	}
+}
+
+func (c *specCheck) constraints(path []string, f *model.ComponentField, n float64, s string) {
+	for _, con := range f.Constraints {
+		if len(con.Enum) > 0 && !slices.Contains(con.Enum, s) {
+			c.report(CodeInvalidOption, path, "must be one of %s, got %q", strings.Join(con.Enum, ", "), s)
+		}
+
+		if con.Regex != nil {
+			if re, err := regexp.Compile(*con.Regex); err == nil && !re.MatchString(s) {
+				c.report(CodeInvalidValue, path, "must match %s", *con.Regex)
+			}
+		}
+
+		if r := con.Range; r != nil && f.Type == model.ComponentFieldTypeInt {
+			if (r.Gt != nil && n <= *r.Gt) || (r.Gte != nil && n < *r.Gte) ||
+				(r.Lt != nil && n >= *r.Lt) || (r.Lte != nil && n > *r.Lte) {
+				c.report(CodeInvalidValue, path, "is out of range, got %s", s)
+			}
+		}
+	}
+}
+
+// asList converts a list of any element type, e.g. the []string set by the step builders, to a []any.
+func asList(value any) ([]any, bool) {
+	if l, ok := value.([]any); ok {
+		return l, true
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return nil, false
+	}
+
+	result := make([]any, v.Len())
+	for i := range result {
+		result[i] = v.Index(i).Interface()
+	}
+	return result, true
+}
+
+// asMap converts a map with string keys and values of any type to a map[string]any.
+func asMap(value any) (map[string]any, bool) {
+	if m, ok := value.(map[string]any); ok {
+		return m, true
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+
+	result := make(map[string]any, v.Len())
+	for _, k := range v.MapKeys() {
+		result[k.String()] = v.MapIndex(k).Interface()
+	}
+	return result, true
+}
+
+func asNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// WithSpecs adds the component specifications to the context, overriding the embedded
+// specifications the configurations are checked against during compilation
+func WithSpecs(ctx context.Context, specs *Specs) context.Context {
+	return context.WithValue(ctx, SpecsKey, specs)
+}
+
+// SpecsFromContext retrieves the component specifications from the context, or nil if there are none
+func SpecsFromContext(ctx context.Context) *Specs {
+	if s, ok := ctx.Value(SpecsKey).(*Specs); ok {
+		return s
+	}
+	return nil
+}
+
+// specsFor returns the component specifications added to the context, or the embedded
+// specifications when there are none
+func specsFor(ctx context.Context) (*Specs, error) {
+	if s := SpecsFromContext(ctx); s != nil {
+		return s, nil
+	}
+	return EmbeddedSpecs()
+}
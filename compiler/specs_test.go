@@ -0,0 +1,148 @@
+package compiler_test
+
+import (
+	"context"
+	"errors"
+	"testing/fstest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/model"
+)
+
+var _ = Describe("Component Specifications", func() {
+	var specs *compiler.Specs
+
+	BeforeEach(func() {
+		var err error
+		specs, err = compiler.EmbeddedSpecs()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	inlet := func(source *SourceStepBuilder) model.Steps {
+		return Steps().
+			Source(source).
+			Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+			Build()
+	}
+
+	issue := func(code compiler.ErrorCode, path string) OmegaMatcher {
+		return ContainElement(SatisfyAll(
+			HaveField("Code", code),
+			HaveField("Path", path),
+		))
+	}
+
+	It("should load the sources and sinks", func() {
+		_, ok := specs.Source("generate")
+		Expect(ok).To(BeTrue())
+
+		_, ok = specs.Sink("kafka_franz")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should accept a valid configuration", func() {
+		Expect(specs.Check(inlet(test.GenerateSource()))).To(BeEmpty())
+	})
+
+	It("should accept environment variables for any type", func() {
+		Expect(specs.Check(inlet(test.GenerateSource().SetString("count", "${COUNT}")))).To(BeEmpty())
+	})
+
+	It("should report unknown components", func() {
+		Expect(specs.Check(inlet(test.InvalidSource()))).To(issue(compiler.CodeUnknownComponent, "source.type"))
+	})
+
+	It("should report unknown fields", func() {
+		issues := specs.Check(inlet(test.GenerateSource().SetString("not_a_field", "value")))
+		Expect(issues).To(issue(compiler.CodeUnknownField, "source.config.not_a_field"))
+		Expect(issues[0].ConfigPath).To(Equal("input.generate.not_a_field"))
+	})
+
+	It("should report options which are not exposed by Connect", func() {
+		steps := inlet(SourceStep("http_client").
+			SetString("url", "http://localhost:8080").
+			SetString("rate_limit", "my_limit"))
+
+		Expect(specs.Check(steps)).To(issue(compiler.CodeIgnoredField, "source.config.rate_limit"))
+	})
+
+	It("should report deprecated options", func() {
+		steps := inlet(SourceStep("aws_s3").
+			SetString("bucket", "my-bucket").
+			SetString("codec", "lines"))
+
+		Expect(specs.Check(steps)).To(issue(compiler.CodeDeprecatedField, "source.config.codec"))
+	})
+
+	It("should report values of the wrong type", func() {
+		Expect(specs.Check(inlet(test.GenerateSource().SetString("count", "many")))).
+			To(issue(compiler.CodeInvalidType, "source.config.count"))
+	})
+
+	It("should report numbers and booleans given for strings", func() {
+		Expect(specs.Check(inlet(test.GenerateSource().SetInt("interval", 5)))).
+			To(issue(compiler.CodeInvalidType, "source.config.interval"))
+		Expect(specs.Check(inlet(test.GenerateSource().SetBool("interval", true)))).
+			To(issue(compiler.CodeInvalidType, "source.config.interval"))
+	})
+
+	It("should report values which are not one of the options", func() {
+		steps := inlet(SourceStep("http_client").
+			SetString("url", "http://localhost:8080").
+			SetString("dump_request_log_level", "LOUD"))
+
+		Expect(specs.Check(steps)).To(issue(compiler.CodeInvalidOption, "source.config.dump_request_log_level"))
+	})
+
+	It("should report missing required fields", func() {
+		Expect(specs.Check(inlet(SourceStep("generate").SetInt("count", 5)))).
+			To(issue(compiler.CodeMissingField, "source.config.mapping"))
+	})
+
+	It("should check sink configurations", func() {
+		steps := Steps().
+			Consumer(ConsumerStep(test.UnauthenticatedNatsConfig()).Core(ConsumerStepCore("foo.bar"))).
+			Sink(SinkStep("redis_pubsub").SetString("not_a_field", "value")).
+			Build()
+
+		Expect(specs.Check(steps)).To(issue(compiler.CodeUnknownField, "sink.config.not_a_field"))
+	})
+
+	When("compiling with specifications in the context", func() {
+		It("should fail with a validation error listing the issues", func() {
+			ctx := compiler.WithSpecs(context.Background(), specs)
+			_, err := compiler.CompileWithContext(ctx, test.Runtime(), inlet(test.GenerateSource().SetString("not_a_field", "value")))
+			Expect(err).To(HaveOccurred())
+
+			var vErr *compiler.ValidationError
+			Expect(errors.As(err, &vErr)).To(BeTrue())
+			Expect(vErr.Code).To(Equal(compiler.CodeInvalidConfiguration))
+			Expect(vErr.Issues).To(issue(compiler.CodeUnknownField, "source.config.not_a_field"))
+		})
+
+		It("should warn about components missing from the specifications of the context", func() {
+			specs, err := compiler.LoadSpecs(fstest.MapFS{})
+			Expect(err).NotTo(HaveOccurred())
+
+			ctx := compiler.WithSpecs(context.Background(), specs)
+			report, err := compiler.CompileStepsWithReport(ctx, test.Runtime(), compiler.FromModel(inlet(test.GenerateSource())))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Warnings).To(issue(compiler.CodeUnknownComponent, "source.type"))
+		})
+	})
+
+	When("compiling without specifications in the context", func() {
+		It("should check configurations against the embedded specifications", func() {
+			_, err := compiler.CompileWithContext(context.Background(), test.Runtime(), inlet(test.GenerateSource().SetString("not_a_field", "value")))
+			Expect(err).To(HaveOccurred())
+
+			var vErr *compiler.ValidationError
+			Expect(errors.As(err, &vErr)).To(BeTrue())
+			Expect(vErr.Issues).To(issue(compiler.CodeUnknownField, "source.config.not_a_field"))
+		})
+	})
+})
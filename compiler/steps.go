@@ -0,0 +1,647 @@
+package compiler
+
+import (
+	"github.com/synadia-io/connect/model"
+)
+
+// ConnectorSteps are the steps of a connector as understood by this runtime. They extend the
+// Connect model steps with the step types which are specific to this runtime, and are
+// decoded from the same connector configuration. Steps which only use the Connect model
+// can be converted using FromModel.
+type ConnectorSteps struct {
+	// Consumer reads messages from NATS (outlets only)
+	Consumer *Consumer `json:"consumer,omitempty" yaml:"consumer,omitempty"`
+	// Producer writes messages to NATS (inlets only)
+	Producer *Producer `json:"producer,omitempty" yaml:"producer,omitempty"`
+	// Sink writes messages to an external system (outlets only)
+	Sink *model.SinkStep `json:"sink,omitempty" yaml:"sink,omitempty"`
+	// Sinks write every message to several external systems at once (outlets only, instead of Sink)
+	Sinks []FanOutSink `json:"sinks,omitempty" yaml:"sinks,omitempty"`
+	// Source reads messages from an external system (inlets only)
+	Source *model.SourceStep `json:"source,omitempty" yaml:"source,omitempty"`
+	// Sources read messages from several external systems at once (inlets only, instead of Source)
+	Sources []MergedSource `json:"sources,omitempty" yaml:"sources,omitempty"`
+	// Transformer processes the messages between the source or consumer and the producer or sink
+	Transformer *Transformer `json:"transformer,omitempty" yaml:"transformer,omitempty"`
+}
+
+// Transformer extends model.TransformerStep with the transformers specific to this runtime.
+// Exactly one transformer type is expected to be set.
+type Transformer struct {
+	Combine   *model.CombineTransformerStep `json:"combine,omitempty" yaml:"combine,omitempty"`
+	Composite *CompositeTransformer         `json:"composite,omitempty" yaml:"composite,omitempty"`
+	Explode   *model.ExplodeTransformerStep `json:"explode,omitempty" yaml:"explode,omitempty"`
+	Mapping   *model.MappingTransformerStep `json:"mapping,omitempty" yaml:"mapping,omitempty"`
+	Service   *model.ServiceTransformerStep `json:"service,omitempty" yaml:"service,omitempty"`
+
+	// Filter drops the messages which do not match a condition
+	Filter *FilterTransformer `json:"filter,omitempty" yaml:"filter,omitempty"`
+	// Validate drops the messages which do not match a schema
+	Validate *ValidateTransformer `json:"validate,omitempty" yaml:"validate,omitempty"`
+	// Encode encodes the JSON payloads of the messages with a schema from the schema registry
+	Encode *SchemaCodecTransformer `json:"encode,omitempty" yaml:"encode,omitempty"`
+	// Decode decodes the payloads of the messages to JSON with a schema from the schema registry
+	Decode *SchemaCodecTransformer `json:"decode,omitempty" yaml:"decode,omitempty"`
+	// Dedupe drops the messages whose key was already seen within a window
+	Dedupe *DedupeTransformer `json:"dedupe,omitempty" yaml:"dedupe,omitempty"`
+	// Lookup enriches the messages with reference data held in a NATS KV bucket
+	Lookup *LookupTransformer `json:"lookup,omitempty" yaml:"lookup,omitempty"`
+	// Compress compresses the payloads of the messages and records the algorithm in the Content-Encoding header
+	Compress *CompressTransformer `json:"compress,omitempty" yaml:"compress,omitempty"`
+	// Decompress decompresses the payloads of the messages according to their Content-Encoding header
+	Decompress *DecompressTransformer `json:"decompress,omitempty" yaml:"decompress,omitempty"`
+	// Protect masks, hashes or encrypts sensitive payload fields and headers
+	Protect *ProtectTransformer `json:"protect,omitempty" yaml:"protect,omitempty"`
+	// Decrypt decrypts the payload fields and headers encrypted by a protect transformer
+	Decrypt *ProtectTransformer `json:"decrypt,omitempty" yaml:"decrypt,omitempty"`
+	// RateLimit throttles the messages, for example ahead of a service transformer calling a rate limited API
+	RateLimit *RateLimit `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+	// Aggregate aggregates numeric fields of the messages over windows. It can only be the
+	// transformer of the connector, or the last transformer of its composite transformer.
+	Aggregate *AggregateTransformer `json:"aggregate,omitempty" yaml:"aggregate,omitempty"`
+}
+
+// Producer extends model.ProducerStep with content-based routing and object store destinations.
+// Without routes, exactly one of the core, stream, kv or object store destinations is expected
+// to be set. With routes, each message is written to the destination of the first route whose
+// condition it matches, or of every matching route in fan-out mode. The destination of the
+// producer itself then acts as the default route for the messages matching no route, and when
+// it is omitted those messages are dropped.
+type Producer struct {
+	Core        *model.ProducerStepCore   `json:"core,omitempty" yaml:"core,omitempty"`
+	Kv          *ProducerKv               `json:"kv,omitempty" yaml:"kv,omitempty"`
+	Nats        model.NatsConfig          `json:"nats" yaml:"nats"`
+	ObjectStore *ProducerObjectStore      `json:"object_store,omitempty" yaml:"object_store,omitempty"`
+	Stream      *model.ProducerStepStream `json:"stream,omitempty" yaml:"stream,omitempty"`
+	Threads     int                       `json:"threads,omitempty" yaml:"threads,omitempty"`
+
+	// Routes are the conditional destinations of the messages, evaluated in order
+	Routes []ProducerRoute `json:"routes,omitempty" yaml:"routes,omitempty"`
+	// FanOut writes a message to every route it matches instead of only the first one
+	FanOut bool `json:"fan_out,omitempty" yaml:"fan_out,omitempty"`
+	// ClaimCheck offloads the payloads too large for NATS to an object store
+	ClaimCheck *ClaimCheck `json:"claim_check,omitempty" yaml:"claim_check,omitempty"`
+	// Headers selects the metadata written as NATS headers, all of it unless set
+	Headers *HeaderPolicy `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Request sends the messages as NATS requests instead of writing them to a destination
+	Request *ProducerRequest `json:"request,omitempty" yaml:"request,omitempty"`
+}
+
+// ProducerRequest sends each message as a core NATS request and returns the reply to the source
+// as its synchronous response, for sources supporting them like http_server. It replaces the
+// destinations, routes and claim check of the producer.
+type ProducerRequest struct {
+	// Subject is the subject of the NATS service receiving the requests
+	Subject string `json:"subject" yaml:"subject"`
+	// Timeout is how long to wait for each reply, such as 5s, 3s unless set
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// HeaderPolicy maps the metadata of the messages written by a producer to NATS headers, or the
+// NATS headers of the messages read by a consumer to metadata. The keys matching an include
+// pattern and no exclude pattern are kept, then renamed, then the static headers are set, and
+// finally the mapping is applied.
+type HeaderPolicy struct {
+	// Include are the regular expressions of the keys kept, all of them unless set
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+	// Exclude are the regular expressions of the keys removed, even when included
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	// Rename maps the keys kept to their new name
+	Rename map[string]string `json:"rename,omitempty" yaml:"rename,omitempty"`
+	// Static are the headers set on every message, replacing those of the same name
+	Static map[string]string `json:"static,omitempty" yaml:"static,omitempty"`
+	// Mapping is a Bloblang mapping of the headers, such as meta tenant = @tenant.uppercase()
+	Mapping string `json:"mapping,omitempty" yaml:"mapping,omitempty"`
+}
+
+// ClaimCheck offloads the payloads larger than a threshold to a NATS object store reached
+// through the NATS connection of the producer, and publishes a reference to the object in
+// their place, which a consumer with ClaimCheck set replaces by the payload again.
+type ClaimCheck struct {
+	// Bucket is the object store receiving the payloads, created when missing
+	Bucket string `json:"bucket" yaml:"bucket"`
+	// Threshold is the size in bytes above which payloads are offloaded, the max payload of the
+	// NATS servers less 64KiB unless set
+	Threshold int `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+	// TTL is how long the payloads are kept when creating the bucket, such as 24h, forever unless set
+	TTL string `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+}
+
+// ProducerKv extends model.ProducerStepKv with the operation applied to the key of each message.
+// Without operation options every message is put unconditionally.
+type ProducerKv struct {
+	// Bucket is the KV bucket receiving the messages
+	Bucket string `json:"bucket" yaml:"bucket"`
+	// Key is the interpolated key of each message
+	Key string `json:"key" yaml:"key"`
+
+	// Operation is one of put, create, update, delete or purge, or an interpolation resolving to
+	// one of them for each message such as ${! meta("op") }, put unless set
+	Operation string `json:"operation,omitempty" yaml:"operation,omitempty"`
+	// Revision is the interpolated revision the key is expected at, such as ${! meta("kv_revision") },
+	// required by update and optional for delete and purge
+	Revision string `json:"revision,omitempty" yaml:"revision,omitempty"`
+	// TTL is how long the keys written are kept, such as 1h, which may be interpolated. It requires
+	// a bucket with a limit marker TTL.
+	TTL string `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	// OnConflict is reject or drop, what happens to the messages whose create, update, delete or
+	// purge conflicts with the key, reject unless set
+	OnConflict string `json:"on_conflict,omitempty" yaml:"on_conflict,omitempty"`
+}
+
+// step returns the Connect model kv producer writing to the key of the producer, or nil.
+func (k *ProducerKv) step() *model.ProducerStepKv {
+	if k == nil {
+		return nil
+	}
+	return &model.ProducerStepKv{Bucket: k.Bucket, Key: k.Key}
+}
+
+// operations reports whether the kv producer does more than put the messages unconditionally.
+func (k *ProducerKv) operations() bool {
+	return k != nil && (k.Operation != "" || k.Revision != "" || k.TTL != "" || k.OnConflict != "")
+}
+
+// ProducerObjectStore writes each message as an object of a NATS object store bucket.
+type ProducerObjectStore struct {
+	// Bucket is the object store receiving the objects
+	Bucket string `json:"bucket" yaml:"bucket"`
+	// Name is the interpolated name of the object of each message, such as ${! meta("path") }
+	Name string `json:"name" yaml:"name"`
+}
+
+// Consumer extends model.ConsumerStep with the consumer options specific to this runtime.
+// Exactly one of the core, stream, kv or object store sources is expected to be set.
+type Consumer struct {
+	Core        *model.ConsumerStepCore `json:"core,omitempty" yaml:"core,omitempty"`
+	Kv          *ConsumerKv             `json:"kv,omitempty" yaml:"kv,omitempty"`
+	Nats        model.NatsConfig        `json:"nats" yaml:"nats"`
+	ObjectStore *ConsumerObjectStore    `json:"object_store,omitempty" yaml:"object_store,omitempty"`
+	Stream      *ConsumerStream         `json:"stream,omitempty" yaml:"stream,omitempty"`
+
+	// ClaimCheck restores the payloads offloaded to an object store by a producer with a claim check
+	ClaimCheck bool `json:"claim_check,omitempty" yaml:"claim_check,omitempty"`
+	// Headers selects the NATS headers read as metadata, all of them unless set
+	Headers *HeaderPolicy `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Service reads the requests of a NATS micro service endpoint instead of subscribing
+	Service *ConsumerService `json:"service,omitempty" yaml:"service,omitempty"`
+}
+
+// ConsumerService registers a NATS micro service endpoint whose requests are the messages of the
+// consumer. Each request is replied to once its message is written by the sink, with an empty
+// payload or the message itself, or with a micro service error when it fails. The service can
+// be discovered and monitored through the micro framework.
+type ConsumerService struct {
+	// Name is the name of the service
+	Name string `json:"name" yaml:"name"`
+	// Version is the semantic version of the service, 1.0.0 unless set
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Description describes the service
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Endpoint is the name of the endpoint receiving the requests
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Subject is the subject of the endpoint, its name unless set
+	Subject string `json:"subject,omitempty" yaml:"subject,omitempty"`
+	// QueueGroup is the queue group the instances of the service share, q unless set
+	QueueGroup string `json:"queue_group,omitempty" yaml:"queue_group,omitempty"`
+	// Reply replies with the message as it reaches the sink instead of an empty payload
+	Reply bool `json:"reply,omitempty" yaml:"reply,omitempty"`
+}
+
+// ConsumerKv extends model.ConsumerStepKv with the entries delivered by the consumer. Every
+// message carries the bucket, key, revision and operation of its entry in the kv_bucket, kv_key,
+// kv_revision and kv_operation metadata, the operation being put, delete or purge.
+type ConsumerKv struct {
+	// Bucket is the KV bucket to watch
+	Bucket string `json:"bucket" yaml:"bucket"`
+	// Key is the key to watch, which can include wildcards
+	Key string `json:"key" yaml:"key"`
+
+	// Deliver is snapshot, history or updates, whether the latest value of every key, every value
+	// kept by the bucket or none of the entries written before the connector starts are delivered,
+	// snapshot unless set
+	Deliver string `json:"deliver,omitempty" yaml:"deliver,omitempty"`
+	// IgnoreDeletes skips the delete and purge markers, which are otherwise delivered as messages
+	// with an empty payload
+	IgnoreDeletes bool `json:"ignore_deletes,omitempty" yaml:"ignore_deletes,omitempty"`
+}
+
+// step returns the Connect model kv consumer watching the key of the consumer, or nil.
+func (k *ConsumerKv) step() *model.ConsumerStepKv {
+	if k == nil {
+		return nil
+	}
+	return &model.ConsumerStepKv{Bucket: k.Bucket, Key: k.Key}
+}
+
+// ConsumerStream extends model.ConsumerStepStream with the settings of the pull consumer reading
+// the stream, for the outlets whose throughput depends on how messages are fetched.
+type ConsumerStream struct {
+	// Subject is the stream subject to consume, which can include wildcards
+	Subject string `json:"subject" yaml:"subject"`
+
+	// Pull reads the stream through a pull consumer with explicit fetch settings, the consumer
+	// defaults of the runtime applying unless set
+	Pull *StreamPull `json:"pull,omitempty" yaml:"pull,omitempty"`
+}
+
+// step returns the Connect model stream consumer reading the subject of the consumer, or nil.
+func (s *ConsumerStream) step() *model.ConsumerStepStream {
+	if s == nil {
+		return nil
+	}
+	return &model.ConsumerStepStream{Subject: s.Subject}
+}
+
+// StreamPull configures the pull requests of a stream consumer. Each fetcher keeps pull requests
+// of up to Batch messages pending on the consumer, so that messages are buffered ahead of the
+// pipeline.
+type StreamPull struct {
+	// Durable names a durable consumer created or updated when the connector starts, an ephemeral
+	// consumer being created unless set
+	Durable string `json:"durable,omitempty" yaml:"durable,omitempty"`
+	// Batch is the maximum number of messages buffered by each fetcher, 100 unless set
+	Batch int `json:"batch,omitempty" yaml:"batch,omitempty"`
+	// MaxBytes is the maximum size in bytes of a pull request, which must exceed the largest
+	// message, unlimited unless set
+	MaxBytes int `json:"max_bytes,omitempty" yaml:"max_bytes,omitempty"`
+	// Expiry is how long a pull request waits for messages, at least 1s, 30s unless set
+	Expiry string `json:"expiry,omitempty" yaml:"expiry,omitempty"`
+	// Heartbeat is the interval of the heartbeats detecting stalled pull requests, at most half
+	// the expiry, derived from the expiry unless set
+	Heartbeat string `json:"heartbeat,omitempty" yaml:"heartbeat,omitempty"`
+	// Fetchers is the number of fetchers reading from the consumer concurrently, 1 unless set
+	Fetchers int `json:"fetchers,omitempty" yaml:"fetchers,omitempty"`
+}
+
+// ConsumerObjectStore reads the objects of a NATS object store bucket as they are put or updated.
+type ConsumerObjectStore struct {
+	// Bucket is the object store to watch
+	Bucket string `json:"bucket" yaml:"bucket"`
+	// UpdatesOnly skips the objects already in the bucket when the connector starts
+	UpdatesOnly bool `json:"updates_only,omitempty" yaml:"updates_only,omitempty"`
+	// Scanner breaks the content of each object into messages, such as {"lines": {}}, the
+	// whole object being a single message unless set
+	Scanner map[string]any `json:"scanner,omitempty" yaml:"scanner,omitempty"`
+}
+
+// step returns the Connect model consumer step reading from the source of the consumer.
+func (c Consumer) step() model.ConsumerStep {
+	return model.ConsumerStep{Core: c.Core, Kv: c.Kv.step(), Nats: c.Nats, Stream: c.Stream.step()}
+}
+
+// ProducerRoute writes the messages matching a Bloblang condition to its own core subject,
+// stream subject, kv bucket or object store bucket, using the NATS connection of the producer.
+// Exactly one destination is expected to be set.
+type ProducerRoute struct {
+	// Condition is a Bloblang query which must resolve to true for a message to take the route
+	Condition string `json:"condition" yaml:"condition"`
+
+	Core        *model.ProducerStepCore   `json:"core,omitempty" yaml:"core,omitempty"`
+	Kv          *ProducerKv               `json:"kv,omitempty" yaml:"kv,omitempty"`
+	ObjectStore *ProducerObjectStore      `json:"object_store,omitempty" yaml:"object_store,omitempty"`
+	Stream      *model.ProducerStepStream `json:"stream,omitempty" yaml:"stream,omitempty"`
+}
+
+// step returns the Connect model producer step writing to the default destination of the producer.
+func (p Producer) step() model.ProducerStep {
+	return model.ProducerStep{Core: p.Core, Kv: p.Kv.step(), Nats: p.Nats, Stream: p.Stream, Threads: p.Threads}
+}
+
+// step returns the Connect model producer step writing to the destination of the route.
+func (r ProducerRoute) step(p Producer) model.ProducerStep {
+	return model.ProducerStep{Core: r.Core, Kv: r.Kv.step(), Nats: p.Nats, Stream: r.Stream, Threads: p.Threads}
+}
+
+// MergedSource is one of the sources of a multi-source inlet, reading from an external system
+// like model.SourceStep with its own optional transformer. The messages of all sources are
+// merged into the producer, each tagged with the name of its source in the SourceMetadataKey
+// metadata.
+type MergedSource struct {
+	Type   string                 `json:"type" yaml:"type"`
+	Config model.SourceStepConfig `json:"config" yaml:"config"`
+
+	// Name identifies the source in the metadata of its messages, its type and index unless set
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Transformer processes the messages of the source before those of all sources are merged
+	Transformer *Transformer `json:"transformer,omitempty" yaml:"transformer,omitempty"`
+}
+
+// step returns the Connect model source step reading from the external system of the source.
+func (s MergedSource) step() model.SourceStep {
+	return model.SourceStep{Type: s.Type, Config: s.Config}
+}
+
+// SinkDelivery is the delivery guarantee of a sink in a fan-out outlet.
+type SinkDelivery string
+
+const (
+	// SinkDeliveryRequired only acknowledges a message once the sink has written it
+	SinkDeliveryRequired SinkDelivery = "required"
+	// SinkDeliveryBestEffort drops the messages the sink fails to write
+	SinkDeliveryBestEffort SinkDelivery = "best_effort"
+)
+
+// FanOutSink is one of the sinks of a fan-out outlet, writing to an external system like
+// model.SinkStep with its own delivery guarantee, retries and batching. A message consumed
+// by the outlet is acknowledged once every required sink has written it.
+type FanOutSink struct {
+	Type   string               `json:"type" yaml:"type"`
+	Config model.SinkStepConfig `json:"config" yaml:"config"`
+
+	// Delivery is the delivery guarantee of the sink, required unless set otherwise
+	Delivery SinkDelivery `json:"delivery,omitempty" yaml:"delivery,omitempty"`
+	// Retry retries the writes which failed before giving up on them
+	Retry *SinkRetry `json:"retry,omitempty" yaml:"retry,omitempty"`
+	// Batching groups the messages into batches before they are written
+	Batching *SinkBatching `json:"batching,omitempty" yaml:"batching,omitempty"`
+	// RateLimit throttles the messages written to the sink
+	RateLimit *RateLimit `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+}
+
+// SinkRetry controls how the failed writes of a sink are retried. The intervals are
+// durations such as 500ms or 1m.
+type SinkRetry struct {
+	// MaxRetries is the number of retries before a write fails, where 0 retries indefinitely
+	MaxRetries int `json:"max_retries,omitempty" yaml:"max_retries,omitempty"`
+	// InitialInterval is the backoff before the first retry
+	InitialInterval string `json:"initial_interval,omitempty" yaml:"initial_interval,omitempty"`
+	// MaxInterval is the longest backoff between two retries
+	MaxInterval string `json:"max_interval,omitempty" yaml:"max_interval,omitempty"`
+	// MaxElapsedTime is the longest time spent retrying a write
+	MaxElapsedTime string `json:"max_elapsed_time,omitempty" yaml:"max_elapsed_time,omitempty"`
+}
+
+// SinkBatching controls how the messages written by a sink are grouped into batches.
+// A batch is flushed as soon as one of the configured limits is reached.
+type SinkBatching struct {
+	// Count is the number of messages in a batch
+	Count int `json:"count,omitempty" yaml:"count,omitempty"`
+	// ByteSize is the total size of the messages in a batch
+	ByteSize int `json:"byte_size,omitempty" yaml:"byte_size,omitempty"`
+	// Period is the longest time a message waits for its batch to be flushed, e.g. 1s
+	Period string `json:"period,omitempty" yaml:"period,omitempty"`
+}
+
+// step returns the Connect model sink step writing to the external system of the sink.
+func (s FanOutSink) step() model.SinkStep {
+	return model.SinkStep{Type: s.Type, Config: s.Config}
+}
+
+// CompositeTransformer applies a sequence of transformers in order.
+type CompositeTransformer struct {
+	Sequential []Transformer `json:"sequential" yaml:"sequential"`
+}
+
+// FilterTransformer drops the messages which do not match a Bloblang condition
+// and/or do not carry the expected NATS headers. A message is kept only when all
+// criteria hold.
+type FilterTransformer struct {
+	// Condition is a Bloblang query which must resolve to true for a message to be kept
+	Condition string `json:"condition,omitempty" yaml:"condition,omitempty"`
+	// Headers maps the names of NATS headers to the value they must hold for a message to be kept
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+}
+
+// ValidateTransformer checks the payloads of the messages against a JSON Schema or an Avro
+// schema, given inline or fetched from NATS. The schema is fetched and compiled once, when
+// the connector starts. Avro payloads are expected to be binary encoded.
+type ValidateTransformer struct {
+	// Format is the format of the schema, json_schema or avro
+	Format string `json:"format" yaml:"format"`
+	// Schema is the inline schema document, exclusive with Registry
+	Schema string `json:"schema,omitempty" yaml:"schema,omitempty"`
+	// Registry locates the schema in NATS, exclusive with Schema
+	Registry *SchemaRegistry `json:"registry,omitempty" yaml:"registry,omitempty"`
+}
+
+// SchemaRegistry locates a schema stored in a NATS KV bucket or object store, under its
+// name or under name/version when a version is given. Exactly one of the bucket and the
+// object store is expected to be set.
+type SchemaRegistry struct {
+	Nats model.NatsConfig `json:"nats" yaml:"nats"`
+
+	Bucket      string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+	ObjectStore string `json:"object_store,omitempty" yaml:"object_store,omitempty"`
+	Name        string `json:"name" yaml:"name"`
+	Version     string `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+// SchemaCodecTransformer converts the payloads of the messages between JSON and the encoding
+// of a schema stored in the schema registry, a NATS KV bucket or object store reached through
+// the NATS connection of the runtime. Exactly one of the bucket and the object store is
+// expected to be set.
+//
+// Encoded messages carry the subject and version of their schema in the Connect-Schema-Subject
+// and Connect-Schema-Version headers, which the decoder uses to pick the version to decode with.
+type SchemaCodecTransformer struct {
+	// Format is the format of the schema, avro, protobuf or json_schema
+	Format string `json:"format" yaml:"format"`
+	// Subject is the subject of the schema in the registry
+	Subject string `json:"subject" yaml:"subject"`
+	// Version is the version of the schema, the latest version unless set
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Message is the fully qualified name of the Protobuf message, if the definition holds several messages
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+
+	Bucket      string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+	ObjectStore string `json:"object_store,omitempty" yaml:"object_store,omitempty"`
+}
+
+// DedupeTransformer drops the messages whose key was already seen within a window. The seen
+// keys are recorded in a NATS KV bucket reached through the NATS connection of the runtime,
+// so the instances of a connector sharing the bucket deduplicate across each other.
+type DedupeTransformer struct {
+	// Key is a Bloblang query computing the deduplication key of a message
+	Key string `json:"key" yaml:"key"`
+	// Bucket is the KV bucket holding the seen keys, created with the window as its TTL when missing
+	Bucket string `json:"bucket" yaml:"bucket"`
+	// Window is how long a key is remembered, 5m unless set
+	Window string `json:"window,omitempty" yaml:"window,omitempty"`
+}
+
+// LookupTransformer enriches the messages with the value of a NATS KV key derived from the
+// message, read through the NATS connection of the runtime. The value is merged into the
+// payload at Path, or stored in the Metadata key; at most one of them is expected to be set.
+type LookupTransformer struct {
+	// Bucket is the KV bucket holding the reference data
+	Bucket string `json:"bucket" yaml:"bucket"`
+	// Key is a Bloblang query computing the key to look up
+	Key string `json:"key" yaml:"key"`
+	// Path is the dot separated path of the payload receiving the value, the root of the payload if empty
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Metadata is the metadata key receiving the value, instead of the payload
+	Metadata string `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	// CacheTTL is how long looked up values are cached locally, no caching unless set
+	CacheTTL string `json:"cache_ttl,omitempty" yaml:"cache_ttl,omitempty"`
+	// OnMissing is what happens to the messages whose key is missing: keep (the default), drop or fail
+	OnMissing string `json:"on_missing,omitempty" yaml:"on_missing,omitempty"`
+}
+
+// AggregateTransformer aggregates numeric fields of the messages over tumbling, sliding or
+// count windows, emitting one message per window and group in place of the messages of the
+// window. The open windows are lost on restart unless they are checkpointed.
+type AggregateTransformer struct {
+	// Window is the type of the windows: tumbling, sliding or count
+	Window string `json:"window" yaml:"window"`
+	// Size is the length of the tumbling and sliding windows, such as 1m
+	Size string `json:"size,omitempty" yaml:"size,omitempty"`
+	// Slide is the time between the starts of two sliding windows, at most their size
+	Slide string `json:"slide,omitempty" yaml:"slide,omitempty"`
+	// Count is the number of messages of a group closing a count window
+	Count int `json:"count,omitempty" yaml:"count,omitempty"`
+	// GroupBy is a Bloblang query computing the group of a message, all the messages belong to one group unless set
+	GroupBy string `json:"group_by,omitempty" yaml:"group_by,omitempty"`
+	// Fields are the dot separated paths of the numeric fields to aggregate
+	Fields []string `json:"fields" yaml:"fields"`
+	// Aggregates are the aggregates computed for every field among sum, count, min, max, avg and
+	// percentiles such as p95, all but the percentiles unless set
+	Aggregates []string `json:"aggregates,omitempty" yaml:"aggregates,omitempty"`
+	// Checkpoint persists the open windows so that they survive restarts
+	Checkpoint *AggregateCheckpoint `json:"checkpoint,omitempty" yaml:"checkpoint,omitempty"`
+}
+
+// AggregateCheckpoint persists the open windows of an aggregate transformer in a NATS KV bucket
+// reached through the NATS connection of the runtime, under a key made of the namespace,
+// connector and instance of the runtime. The messages are acknowledged once checkpointed.
+type AggregateCheckpoint struct {
+	// Bucket is the KV bucket holding the open windows, created when missing
+	Bucket string `json:"bucket" yaml:"bucket"`
+	// Interval is how often the open windows are written, 1s unless set
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+}
+
+// CompressTransformer compresses the payloads of the messages, for example so that large
+// payloads fit under the max_payload of the NATS servers, and records the algorithm in the
+// Content-Encoding header. Messages already carrying a Content-Encoding header are left as
+// they are.
+type CompressTransformer struct {
+	// Algorithm is the compression algorithm: gzip, zstd, snappy or lz4
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	// Level is the gzip compression level, from 1 (fastest) to 9 (smallest), the default level unless set
+	Level int `json:"level,omitempty" yaml:"level,omitempty"`
+	// MinSize is the size in bytes under which payloads are left uncompressed
+	MinSize int `json:"min_size,omitempty" yaml:"min_size,omitempty"`
+}
+
+// DecompressTransformer decompresses the payloads of the messages whose Content-Encoding header
+// names a supported algorithm, and removes the header. Messages without the header, or naming
+// another encoding, are left as they are.
+type DecompressTransformer struct {
+	// Algorithms are the algorithms decompressed, all the supported ones unless set
+	Algorithms []string `json:"algorithms,omitempty" yaml:"algorithms,omitempty"`
+}
+
+// ProtectTransformer masks, hashes or encrypts sensitive payload fields and headers of the
+// messages, or decrypts them again. Hashing and encryption use keys derived from a secret read
+// from an environment variable of the connector or from a NATS KV key reached through the NATS
+// connection of the runtime.
+//
+// A decrypt transformer decrypts the fields whose action is encrypt, so that it can share the
+// fields of the protect transformer it reverses; the masked and hashed fields are left as they are.
+type ProtectTransformer struct {
+	// Fields are the payload fields and headers to protect
+	Fields []ProtectedField `json:"fields" yaml:"fields"`
+	// Key is where the secret is read
+	Key ProtectionKey `json:"key" yaml:"key"`
+	// Deterministic encrypts equal values to equal values, keeping them joinable at the cost of
+	// revealing which values are equal
+	Deterministic bool `json:"deterministic,omitempty" yaml:"deterministic,omitempty"`
+}
+
+// ProtectedField is a payload field or header protected by a ProtectTransformer. Exactly one
+// of the path and the header is expected to be set.
+type ProtectedField struct {
+	// Path is the dot separated path of the payload field
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Header is the name of the header
+	Header string `json:"header,omitempty" yaml:"header,omitempty"`
+	// Action is how the value is protected: mask, hash or encrypt (the default)
+	Action string `json:"action,omitempty" yaml:"action,omitempty"`
+	// KeepLast is the number of trailing characters left unmasked
+	KeepLast int `json:"keep_last,omitempty" yaml:"keep_last,omitempty"`
+}
+
+// ProtectionKey is where the secret of a ProtectTransformer is read, either an environment
+// variable or a KV bucket and key.
+type ProtectionKey struct {
+	// Env is the environment variable holding the secret
+	Env string `json:"env,omitempty" yaml:"env,omitempty"`
+	// Bucket is the KV bucket holding the secret
+	Bucket string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+	// Key is the KV key holding the secret
+	Key string `json:"key,omitempty" yaml:"key,omitempty"`
+}
+
+// RateLimit throttles messages to Count messages every Interval. Without a Bucket, every
+// instance of the connector has its own budget. With a Bucket, the budget is shared by all the
+// instances of the connector through a NATS KV bucket reached through the NATS connection of
+// the runtime.
+type RateLimit struct {
+	// Count is the number of messages allowed every interval
+	Count int `json:"count" yaml:"count"`
+	// Interval is a duration such as 1s or 1m, 1s unless set
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// Bucket is the KV bucket holding the shared budget, created when missing
+	Bucket string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+	// Batch is the number of messages an instance reserves from the shared budget at once, a tenth of the count unless set
+	Batch int `json:"batch,omitempty" yaml:"batch,omitempty"`
+}
+
+// FromModel converts the Connect model steps to the steps of this runtime.
+func FromModel(steps model.Steps) ConnectorSteps {
+	result := ConnectorSteps{
+		Sink:   steps.Sink,
+		Source: steps.Source,
+	}
+
+	if steps.Consumer != nil {
+		result.Consumer = &Consumer{
+			Core: steps.Consumer.Core,
+			Nats: steps.Consumer.Nats,
+		}
+		if stream := steps.Consumer.Stream; stream != nil {
+			result.Consumer.Stream = &ConsumerStream{Subject: stream.Subject}
+		}
+		if kv := steps.Consumer.Kv; kv != nil {
+			result.Consumer.Kv = &ConsumerKv{Bucket: kv.Bucket, Key: kv.Key}
+		}
+	}
+
+	if steps.Producer != nil {
+		result.Producer = &Producer{
+			Core:    steps.Producer.Core,
+			Nats:    steps.Producer.Nats,
+			Stream:  steps.Producer.Stream,
+			Threads: steps.Producer.Threads,
+		}
+		if kv := steps.Producer.Kv; kv != nil {
+			result.Producer.Kv = &ProducerKv{Bucket: kv.Bucket, Key: kv.Key}
+		}
+	}
+
+	if steps.Transformer != nil {
+		t := transformerFromModel(*steps.Transformer)
+		result.Transformer = &t
+	}
+
+	return result
+}
+
+func transformerFromModel(t model.TransformerStep) Transformer {
+	result := Transformer{
+		Combine: t.Combine,
+		Explode: t.Explode,
+		Mapping: t.Mapping,
+		Service: t.Service,
+	}
+
+	if t.Composite != nil {
+		result.Composite = &CompositeTransformer{}
+		for _, ct := range t.Composite.Sequential {
+			result.Composite.Sequential = append(result.Composite.Sequential, transformerFromModel(ct))
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,191 @@
+package compiler
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/synadia-io/connect/runtime"
+)
+
+// TracingKey is the context key for the tracing configuration used during compilation
+const TracingKey contextKey = "tracing"
+
+const (
+	// TracingEndpointEnvVar holds the address of the OTLP collector traces are exported to.
+	// Tracing is disabled when it is not set.
+	TracingEndpointEnvVar = "CONNECT_TRACING_OTLP_ENDPOINT"
+	// TracingProtocolEnvVar selects the OTLP transport, either "grpc" (default) or "http".
+	TracingProtocolEnvVar = "CONNECT_TRACING_OTLP_PROTOCOL"
+	// TracingSecureEnvVar enables transport security towards the collector when set to true.
+	TracingSecureEnvVar = "CONNECT_TRACING_OTLP_SECURE"
+	// TracingSampleRatioEnvVar sets the ratio of traces to sample, between 0 and 1.
+	TracingSampleRatioEnvVar = "CONNECT_TRACING_SAMPLE_RATIO"
+
+	// tracingServiceName is the service name reported on all spans
+	tracingServiceName = "connect-runtime-wombat"
+
+	// extractTracingMap reads the W3C trace context from the metadata (NATS headers) of consumed messages
+	extractTracingMap = "root = @"
+	// injectTracingMap writes the W3C trace context into the metadata (NATS headers) of produced messages
+	injectTracingMap = "meta = @.merge(this)"
+	// traceparentHeader interpolates the W3C trace context of the span of a message, for the
+	// processors which do not take a tracing map but send interpolated headers
+	traceparentHeader = `${! tracing_span().traceparent.or("") }`
+)
+
+// TracingConfig describes where and how traces are exported.
+type TracingConfig struct {
+	// Endpoint is the address of the OTLP collector
+	Endpoint string
+	// Protocol is the OTLP transport, either "grpc" or "http"
+	Protocol string
+	// Secure enables transport security towards the collector
+	Secure bool
+	// SampleRatio is the ratio of traces to sample. Sampling is disabled when nil.
+	SampleRatio *float64
+}
+
+// TracingFromEnv reads the tracing configuration from the environment.
+// It returns nil if no OTLP endpoint has been configured.
+func TracingFromEnv() *TracingConfig {
+	endpoint := os.Getenv(TracingEndpointEnvVar)
+	if endpoint == "" {
+		return nil
+	}
+
+	result := &TracingConfig{
+		Endpoint: endpoint,
+		Protocol: "grpc",
+	}
+
+	if strings.EqualFold(os.Getenv(TracingProtocolEnvVar), "http") {
+		result.Protocol = "http"
+	}
+
+	if secure, err := strconv.ParseBool(os.Getenv(TracingSecureEnvVar)); err == nil {
+		result.Secure = secure
+	}
+
+	if ratio, err := strconv.ParseFloat(os.Getenv(TracingSampleRatioEnvVar), 64); err == nil && ratio >= 0 && ratio <= 1 {
+		result.SampleRatio = &ratio
+	}
+
+	return result
+}
+
+// WithTracing adds the tracing configuration of the runtime to the context, overriding the
+// configuration read from the environment (see TracingFromEnv). Passing a nil configuration
+// disables tracing.
+func WithTracing(ctx context.Context, cfg *TracingConfig) context.Context {
+	return context.WithValue(ctx, TracingKey, cfg)
+}
+
+// TracingFromContext retrieves the tracing configuration from the context. The boolean
+// reports whether the context holds one, the configuration is nil when tracing is disabled.
+func TracingFromContext(ctx context.Context) (*TracingConfig, bool) {
+	cfg, ok := ctx.Value(TracingKey).(*TracingConfig)
+	return cfg, ok
+}
+
+// tracingFor returns the tracing configuration added to the context, or the one read from
+// the environment when there is none
+func tracingFor(ctx context.Context) *TracingConfig {
+	if cfg, ok := TracingFromContext(ctx); ok {
+		return cfg
+	}
+	return TracingFromEnv()
+}
+
+// compileTracer creates the Wombat tracer configuration exporting spans to an OTLP collector.
+// Every span is tagged with the namespace, connector and instance the workload runs as.
+func compileTracer(rt *runtime.Runtime, cfg TracingConfig) Fragment {
+	collector := Frag().
+		String("address", cfg.Endpoint).
+		Bool("secure", cfg.Secure)
+
+	result := Frag().
+		String("service", tracingServiceName).
+		Fragments(cfg.Protocol, collector).
+		StringMap("tags", map[string]string{
+			AccountMetricHeader:   rt.Namespace,
+			ConnectorMetricHeader: rt.Connector,
+			InstanceMetricHeader:  rt.Instance,
+		})
+
+	if cfg.SampleRatio != nil {
+		result.Fragment("sampling", Frag().
+			Bool("enabled", true).
+			Float("ratio", *cfg.SampleRatio))
+	}
+
+	return Frag().Fragment("open_telemetry_collector", result)
+}
+
+// propagateTraceContext wires W3C trace context propagation through the NATS headers
+// of a compiled input and output. Consumed messages continue the trace found in their
+// headers, produced messages and service requests carry the trace of the current span.
+func propagateTraceContext(input Fragment, output Fragment) {
+	for _, key := range []string{"nats", "nats_jetstream", "nats_jetstream_pull", "nats_micro"} {
+		if f, ok := input[key].(Fragment); ok {
+			f.String("extract_tracing_map", extractTracingMap)
+		}
+	}
+
+	injectTraceContext(output)
+
+	traceServiceRequests(input)
+}
+
+// injectTraceContext puts the trace context into the headers of the messages written by every
+// NATS output found in a compiled output, however deeply it is wrapped, for example by a
+// reject_errored output or in the cases of a routing switch output. The service requests sent
+// by the processors of the output, such as those of a request producer, carry it as well.
+func injectTraceContext(output Fragment) {
+	walkFragments(output, func(f Fragment) {
+		for _, key := range []string{"nats", "nats_jetstream"} {
+			if o, ok := f[key].(Fragment); ok {
+				o.String("inject_tracing_map", injectTracingMap)
+			}
+		}
+	})
+
+	traceServiceRequests(output)
+}
+
+// traceServiceRequests sends the trace context of the message in the headers of the requests
+// of every service call found in the given fragment, through the inject_tracing_map of the
+// nats_request processors and the interpolated headers of the nats_request_reply processors.
+func traceServiceRequests(f Fragment) {
+	walkFragments(f, func(f Fragment) {
+		if r, ok := f["nats_request"].(Fragment); ok {
+			r.String("inject_tracing_map", injectTracingMap)
+		}
+		if r, ok := f["nats_request_reply"].(Fragment); ok {
+			headers, ok := r["headers"].(Fragment)
+			if !ok {
+				headers = Frag()
+				r.Fragment("headers", headers)
+			}
+			headers.String("traceparent", traceparentHeader)
+		}
+	})
+}
+
+// walkFragments calls fn with the given fragment and every fragment nested in it, directly or
+// in a list. Component configurations provided by the user are plain maps and are not visited.
+func walkFragments(f Fragment, fn func(Fragment)) {
+	fn(f)
+
+	for _, v := range f {
+		switch v := v.(type) {
+		case Fragment:
+			walkFragments(v, fn)
+		case []Fragment:
+			for _, item := range v {
+				walkFragments(item, fn)
+			}
+		}
+	}
+}
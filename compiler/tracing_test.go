@@ -0,0 +1,237 @@
+package compiler_test
+
+import (
+	"context"
+	"os"
+
+	"github.com/Jeffail/gabs/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/model"
+	"github.com/synadia-io/connect/runtime"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = Describe("Tracing Configuration", func() {
+	setEnv := func(key, value string) {
+		Expect(os.Setenv(key, value)).To(Succeed())
+		DeferCleanup(os.Unsetenv, key)
+	}
+
+	compileSteps := func(steps compiler.ConnectorSteps) *gabs.Container {
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		return gabs.Wrap(m)
+	}
+
+	compile := func(steps *StepsBuilder) *gabs.Container {
+		return compileSteps(compiler.FromModel(steps.Build()))
+	}
+
+	When("no OTLP endpoint is configured", func() {
+		It("should not configure a tracer", func() {
+			am := compile(Steps().
+				Source(test.GenerateSource()).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())))
+
+			Expect(am.Exists("tracer")).To(BeFalse())
+			Expect(am.Exists("output", "nats", "inject_tracing_map")).To(BeFalse())
+		})
+	})
+
+	When("an OTLP endpoint is configured", func() {
+		BeforeEach(func() {
+			setEnv(compiler.TracingEndpointEnvVar, "localhost:4317")
+		})
+
+		It("should export spans tagged with the workload identity", func() {
+			setEnv(compiler.TracingSampleRatioEnvVar, "0.25")
+
+			am := compile(Steps().
+				Source(test.GenerateSource()).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())))
+
+			Expect(am.Path("tracer.open_telemetry_collector.grpc.0.address").Data()).To(Equal("localhost:4317"))
+			Expect(am.Path("tracer.open_telemetry_collector.tags.account").Data()).To(Equal("MY_NAMESPACE"))
+			Expect(am.Path("tracer.open_telemetry_collector.tags.connector_id").Data()).To(Equal("MY_CONNECTOR"))
+			Expect(am.Path("tracer.open_telemetry_collector.tags.instance_id").Data()).To(Equal("MY_INSTANCE"))
+			Expect(am.Path("tracer.open_telemetry_collector.sampling.enabled").Data()).To(BeTrue())
+			Expect(am.Path("tracer.open_telemetry_collector.sampling.ratio").Data()).To(Equal(0.25))
+		})
+
+		It("should use the http transport when requested", func() {
+			setEnv(compiler.TracingProtocolEnvVar, "http")
+
+			am := compile(Steps().
+				Source(test.GenerateSource()).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())))
+
+			Expect(am.Path("tracer.open_telemetry_collector.http.0.address").Data()).To(Equal("localhost:4317"))
+			Expect(am.Exists("tracer", "open_telemetry_collector", "grpc")).To(BeFalse())
+		})
+
+		It("should inject the trace context into produced messages", func() {
+			am := compile(Steps().
+				Source(test.GenerateSource()).
+				Producer(ProducerStep(test.UnauthenticatedNatsConfig()).Stream(ProducerStepStream("foo.bar"))))
+
+			Expect(am.Path("output.nats_jetstream.inject_tracing_map").Data()).To(Equal("meta = @.merge(this)"))
+		})
+
+		It("should inject the trace context into the messages of a producer with a claim check", func() {
+			inlet := compiler.FromModel(Steps().
+				Source(test.GenerateSource()).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+				Build())
+			inlet.Producer.ClaimCheck = &compiler.ClaimCheck{Bucket: "payloads"}
+
+			am := compileSteps(inlet)
+
+			Expect(am.Exists("output", "reject_errored", "nats")).To(BeTrue())
+			Expect(am.Path("output.reject_errored.nats.inject_tracing_map").Data()).To(Equal("meta = @.merge(this)"))
+		})
+
+		It("should inject the trace context into the messages of a deduplicating producer", func() {
+			inlet := compiler.FromModel(Steps().
+				Source(test.GenerateSource()).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+				Build())
+			inlet.Transformer = &compiler.Transformer{
+				Dedupe: &compiler.DedupeTransformer{Key: "this.id", Bucket: "seen"},
+			}
+
+			artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(runtime.WithNatsUrl(DefaultNatsUrl)), inlet)
+			Expect(err).NotTo(HaveOccurred())
+			var m map[string]any
+			Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+
+			am := gabs.Wrap(m)
+			Expect(am.Path("output.nats_dedupe_release.output.nats.inject_tracing_map").Data()).To(Equal("meta = @.merge(this)"))
+		})
+
+		It("should inject the trace context into the requests of a request producer", func() {
+			inlet := compiler.FromModel(Steps().
+				Source(test.GenerateSource()).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+				Build())
+			inlet.Producer.Core = nil
+			inlet.Producer.Request = &compiler.ProducerRequest{Subject: "svc.echo"}
+
+			am := compileSteps(inlet)
+
+			Expect(am.Path("output.processors.0.nats_request.subject").Data()).To(Equal("svc.echo"))
+			Expect(am.Path("output.processors.0.nats_request.inject_tracing_map").Data()).To(Equal("meta = @.merge(this)"))
+		})
+
+		It("should extract the trace context from consumed messages", func() {
+			am := compile(Steps().
+				Consumer(ConsumerStep(test.UnauthenticatedNatsConfig()).Core(ConsumerStepCore("foo.bar"))).
+				Sink(SinkStep("stdout")))
+
+			Expect(am.Path("input.nats.extract_tracing_map").Data()).To(Equal("root = @"))
+		})
+
+		It("should extract the trace context from messages consumed through a pull consumer", func() {
+			outlet := compiler.FromModel(Steps().
+				Consumer(ConsumerStep(test.UnauthenticatedNatsConfig()).Stream(ConsumerStepStream("foo.bar"))).
+				Sink(SinkStep("stdout")).
+				Build())
+			outlet.Consumer.Stream.Pull = &compiler.StreamPull{}
+
+			am := compileSteps(outlet)
+
+			Expect(am.Path("input.nats_jetstream_pull.extract_tracing_map").Data()).To(Equal("root = @"))
+		})
+
+		It("should extract the trace context from the requests of a service consumer", func() {
+			outlet := compiler.FromModel(Steps().
+				Consumer(ConsumerStep(test.UnauthenticatedNatsConfig()).Core(ConsumerStepCore("foo.bar"))).
+				Sink(SinkStep("stdout")).
+				Build())
+			outlet.Consumer.Core = nil
+			outlet.Consumer.Service = &compiler.ConsumerService{Name: "orders", Endpoint: "create"}
+
+			am := compileSteps(outlet)
+
+			Expect(am.Path("input.nats_micro.extract_tracing_map").Data()).To(Equal("root = @"))
+		})
+
+		It("should propagate the trace context into service requests", func() {
+			am := compile(Steps().
+				Source(SourceStep("stdin")).
+				Transformer(TransformerStep().Service(ServiceTransformerStep("my.service", test.UnauthenticatedNatsConfig()))).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())))
+
+			Expect(am.Path("input.processors.0.nats_request_reply.subject").Data()).To(Equal("my.service"))
+			Expect(am.Path("input.processors.0.nats_request_reply.headers.traceparent").Data()).To(ContainSubstring("tracing_span().traceparent"))
+		})
+
+		It("should inject the trace context into NATS outputs however deeply they are wrapped", func() {
+			inlet := compiler.FromModel(Steps().
+				Source(test.GenerateSource()).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+				Build())
+			inlet.Producer.ClaimCheck = &compiler.ClaimCheck{Bucket: "payloads"}
+			inlet.Producer.Routes = []compiler.ProducerRoute{
+				{Condition: `this.kind == "a"`, Stream: &model.ProducerStepStream{Subject: "a"}},
+			}
+			inlet.Transformer = &compiler.Transformer{
+				Dedupe: &compiler.DedupeTransformer{Key: "this.id", Bucket: "seen"},
+			}
+
+			artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(runtime.WithNatsUrl(DefaultNatsUrl)), inlet)
+			Expect(err).NotTo(HaveOccurred())
+			var m map[string]any
+			Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+
+			am := gabs.Wrap(m)
+			cases := "output.nats_dedupe_release.output.reject_errored.switch.cases"
+			Expect(am.Path(cases + ".0.output.nats_jetstream.inject_tracing_map").Data()).To(Equal("meta = @.merge(this)"))
+			Expect(am.Path(cases + ".1.output.nats.inject_tracing_map").Data()).To(Equal("meta = @.merge(this)"))
+		})
+	})
+
+	When("the runtime configures tracing", func() {
+		compileWith := func(ctx context.Context) *gabs.Container {
+			artifact, err := compiler.CompileWithContext(ctx, test.Runtime(), Steps().
+				Source(test.GenerateSource()).
+				Producer(test.CoreProducer(test.UnauthenticatedNatsConfig())).
+				Build())
+			Expect(err).NotTo(HaveOccurred())
+
+			var m map[string]any
+			Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+			return gabs.Wrap(m)
+		}
+
+		It("should export spans to the endpoint of the runtime", func() {
+			setEnv(compiler.TracingEndpointEnvVar, "localhost:4317")
+
+			am := compileWith(compiler.WithTracing(context.Background(), &compiler.TracingConfig{
+				Endpoint: "collector:4318",
+				Protocol: "http",
+			}))
+
+			Expect(am.Path("tracer.open_telemetry_collector.http.0.address").Data()).To(Equal("collector:4318"))
+			Expect(am.Path("output.nats.inject_tracing_map").Data()).To(Equal("meta = @.merge(this)"))
+		})
+
+		It("should not fall back to the environment when the runtime disables tracing", func() {
+			setEnv(compiler.TracingEndpointEnvVar, "localhost:4317")
+
+			am := compileWith(compiler.WithTracing(context.Background(), nil))
+
+			Expect(am.Exists("tracer")).To(BeFalse())
+		})
+	})
+})
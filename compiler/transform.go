@@ -1,9 +1,41 @@
 package compiler
 
 import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
 	"github.com/synadia-io/connect/model"
+	"github.com/synadia-io/connect/runtime"
 )
 
+// FilterDroppedMetric is the name of the counter incremented for every message dropped by a filter transformer
+const FilterDroppedMetric = "filter_dropped"
+
+// ValidationFailedMetric is the name of the counter incremented for every message dropped by a validate transformer
+const ValidationFailedMetric = "validation_failed"
+
+// LookupFailedMetric is the name of the counter incremented for every message whose lookup failed
+const LookupFailedMetric = "lookup_failed"
+
+// CompressionFailedMetric is the name of the counter incremented for every message a compress or decompress transformer failed
+const CompressionFailedMetric = "compression_failed"
+
+// ContentEncodingHeader is the header holding the compression algorithm of a payload
+const ContentEncodingHeader = "Content-Encoding"
+
+// CompressionAlgorithms are the algorithms supported by the compress and decompress transformers
+var CompressionAlgorithms = []string{"gzip", "zstd", "snappy", "lz4"}
+
+// ProtectFailedMetric is the name of the counter incremented for every message dropped by a protect or decrypt transformer
+const ProtectFailedMetric = "protect_failed"
+
+// SchemaCodecFailedMetric is the name of the counter incremented for every message an encode or decode transformer failed
+const SchemaCodecFailedMetric = "schema_codec_failed"
+
 // compileTransformer transforms a Connect transformer specification into a Wombat processor configuration.
 // Transformers modify messages as they flow through the pipeline.
 //
@@ -13,33 +45,97 @@ import (
 //   - Mapping: Transform messages using Bloblang expressions
 //   - Explode: Split arrays/objects into individual messages
 //   - Combine: Batch multiple messages together
+//   - Filter: Drop messages not matching a condition
+//   - Validate: Drop messages not matching a schema
+//   - Encode: Encode JSON messages with a schema from the schema registry
+//   - Decode: Decode messages to JSON with a schema from the schema registry
+//   - Dedupe: Drop messages whose key was already seen within a window
+//   - Lookup: Enrich messages with reference data held in a NATS KV bucket
+//   - Compress: Compress payloads and set the Content-Encoding header
+//   - Decompress: Decompress payloads according to their Content-Encoding header
+//   - Protect: Mask, hash or encrypt sensitive fields and headers
+//   - Decrypt: Decrypt the fields and headers encrypted by a protect transformer
+//   - RateLimit: Throttle messages, optionally with a budget shared by the instances of the connector
+//
+// Aggregate transformers compile to a buffer rather than a processor, see compileAggregateTransformer.
 //
 // Parameters:
+//   - rt: Runtime configuration holding the NATS connection details of the schema registry, KV buckets and distributed rate limits
 //   - transformer: The transformer step containing the transformation logic
 //
-// Returns a Fragment containing the Wombat processor configuration, or nil if no transformer type is specified.
-func compileTransformer(transformer model.TransformerStep) Fragment {
+// Returns:
+//   - A Fragment containing the Wombat processor configuration, or nil if no transformer type is specified
+//   - An error if the transformer is invalid
+func compileTransformer(rt *runtime.Runtime, transformer Transformer) (Fragment, error) {
 	if transformer.Composite != nil {
-		return compileCompositeTransformer(transformer.Composite)
+		return compileCompositeTransformer(rt, transformer.Composite)
 	}
 
 	if transformer.Service != nil {
-		return compileServiceTransformer(transformer.Service)
+		return compileServiceTransformer(transformer.Service), nil
 	}
 
 	if transformer.Mapping != nil {
-		return compileMappingTransformer(transformer.Mapping)
+		return compileMappingTransformer(transformer.Mapping), nil
 	}
 
 	if transformer.Explode != nil {
-		return compileExplodeTransformer(transformer.Explode)
+		return compileExplodeTransformer(transformer.Explode), nil
 	}
 
 	if transformer.Combine != nil {
-		return compileCombineTransformer(transformer.Combine)
+		return compileCombineTransformer(transformer.Combine), nil
+	}
+
+	if transformer.Filter != nil {
+		return compileFilterTransformer(transformer.Filter)
+	}
+
+	if transformer.Validate != nil {
+		return compileValidateTransformer(transformer.Validate)
+	}
+
+	if transformer.Encode != nil {
+		return compileSchemaCodecTransformer(rt, "schema_encode", transformer.Encode)
+	}
+
+	if transformer.Decode != nil {
+		return compileSchemaCodecTransformer(rt, "schema_decode", transformer.Decode)
+	}
+
+	if transformer.Dedupe != nil {
+		return compileDedupeTransformer(rt, transformer.Dedupe)
+	}
+
+	if transformer.Lookup != nil {
+		return compileLookupTransformer(rt, transformer.Lookup)
 	}
 
-	return nil
+	if transformer.Compress != nil {
+		return compileCompressTransformer(transformer.Compress)
+	}
+
+	if transformer.Decompress != nil {
+		return compileDecompressTransformer(transformer.Decompress)
+	}
+
+	if transformer.Protect != nil {
+		return compileProtectTransformer(rt, transformer.Protect, false)
+	}
+
+	if transformer.Decrypt != nil {
+		return compileProtectTransformer(rt, transformer.Decrypt, true)
+	}
+
+	if transformer.RateLimit != nil {
+		return compileRateLimit(rt, transformer.RateLimit)
+	}
+
+	if transformer.Aggregate != nil {
+		return nil, fmt.Errorf("an aggregate transformer can only be the last transformer of the connector")
+	}
+
+	return nil, nil
 }
 
 // compileServiceTransformer creates a Wombat processor that calls an external NATS service.
@@ -55,13 +151,17 @@ func compileServiceTransformer(t *model.ServiceTransformerStep) Fragment {
 
 // compileCompositeTransformer creates a sequence of processors from multiple transformers.
 // Each transformer in the sequence is applied to the message in order.
-func compileCompositeTransformer(t *model.CompositeTransformerStep) Fragment {
+func compileCompositeTransformer(rt *runtime.Runtime, t *CompositeTransformer) (Fragment, error) {
 	var seq []Fragment
-	for _, ct := range t.Sequential {
-		seq = append(seq, compileTransformer(ct))
+	for i, ct := range t.Sequential {
+		p, err := compileTransformer(rt, ct)
+		if err != nil {
+			return nil, fmt.Errorf("transformer %d of the sequence: %w", i, err)
+		}
+		seq = append(seq, p)
 	}
 
-	return Frag().Fragment("processors", Frag().Fragments("sequence", seq...))
+	return Frag().Fragment("processors", Frag().Fragments("sequence", seq...)), nil
 }
 
 func compileMappingTransformer(t *model.MappingTransformerStep) Fragment {
@@ -90,3 +190,525 @@ func compileCombineTransformer(t *model.CombineTransformerStep) Fragment {
 	return Frag().Fragment("archive", Frag().
 		String("format", string(t.Format)))
 }
+
+// compileFilterTransformer creates a Wombat processor dropping the messages which do not
+// match the condition and headers of the filter. Every dropped message increments the
+// FilterDroppedMetric counter.
+func compileFilterTransformer(t *FilterTransformer) (Fragment, error) {
+	var checks []string
+	if strings.TrimSpace(t.Condition) != "" {
+		checks = append(checks, fmt.Sprintf("(%s)", t.Condition))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(t.Headers)) {
+		checks = append(checks, fmt.Sprintf("metadata(%q) == %q", name, t.Headers[name]))
+	}
+
+	if len(checks) == 0 {
+		return nil, fmt.Errorf("a filter requires a condition or headers to match")
+	}
+
+	return Frag().Fragments("switch", Frag().
+		String("check", fmt.Sprintf("!(%s)", strings.Join(checks, " && "))).
+		Fragments("processors",
+			Frag().Fragment("metric", Frag().
+				String("type", "counter").
+				String("name", FilterDroppedMetric)),
+			Frag().String("mapping", "root = deleted()"))), nil
+}
+
+// compileValidateTransformer creates a Wombat processor checking the payloads against the
+// schema of the transformer. The messages failing the check are logged with the reason
+// of the failure and dropped, and increment the ValidationFailedMetric counter.
+func compileValidateTransformer(t *ValidateTransformer) (Fragment, error) {
+	if t.Format != nats.SchemaFormatJSONSchema && t.Format != nats.SchemaFormatAvro {
+		return nil, fmt.Errorf("unknown schema format %q, expected %s or %s", t.Format, nats.SchemaFormatJSONSchema, nats.SchemaFormatAvro)
+	}
+
+	if (t.Schema == "") == (t.Registry == nil) {
+		return nil, fmt.Errorf("a validate transformer requires either an inline schema or a registry")
+	}
+
+	validate := Frag().String("format", t.Format)
+	if t.Registry != nil {
+		r := t.Registry
+		if (r.Bucket == "") == (r.ObjectStore == "") {
+			return nil, fmt.Errorf("a schema registry requires either a bucket or an object store")
+		}
+		if r.Name == "" {
+			return nil, fmt.Errorf("a schema registry requires the name of the schema")
+		}
+
+		registry := natsBaseFragment(r.Nats).
+			String("name", r.Name)
+		if r.Bucket != "" {
+			registry.String("bucket", r.Bucket)
+		}
+		if r.ObjectStore != "" {
+			registry.String("object_store", r.ObjectStore)
+		}
+		if r.Version != "" {
+			registry.String("version", r.Version)
+		}
+
+		validate.Fragment("registry", registry)
+	} else {
+		validate.String("schema", t.Schema)
+	}
+
+	return Frag().Fragments("processors",
+		Frag().Fragment("schema_validate", validate),
+		dropErrored("Dropping message not matching the schema", ValidationFailedMetric)), nil
+}
+
+// compileSchemaCodecTransformer creates the Wombat processor of an encode or decode transformer,
+// resolving its schema in the registry through the NATS connection of the runtime. The messages
+// which cannot be converted are logged with the reason of the failure and increment the
+// SchemaCodecFailedMetric counter. Those whose payload does not match the schema are dropped,
+// while those failed by the registry, such as while it cannot be reached, stay errored to be
+// delivered again.
+func compileSchemaCodecTransformer(rt *runtime.Runtime, processor string, t *SchemaCodecTransformer) (Fragment, error) {
+	switch t.Format {
+	case nats.SchemaFormatAvro, nats.SchemaFormatProtobuf, nats.SchemaFormatJSONSchema:
+	default:
+		return nil, fmt.Errorf("unknown schema format %q, expected %s, %s or %s", t.Format, nats.SchemaFormatAvro, nats.SchemaFormatProtobuf, nats.SchemaFormatJSONSchema)
+	}
+
+	if t.Subject == "" {
+		return nil, fmt.Errorf("a schema subject is required")
+	}
+
+	if (t.Bucket == "") == (t.ObjectStore == "") {
+		return nil, fmt.Errorf("a schema registry requires either a bucket or an object store")
+	}
+
+	if rt == nil || rt.NatsUrl == "" {
+		return nil, fmt.Errorf("a schema registry requires the NATS connection of the runtime")
+	}
+
+	registry := runtimeNatsFragment(rt)
+	if t.Bucket != "" {
+		registry.String("bucket", t.Bucket)
+	}
+	if t.ObjectStore != "" {
+		registry.String("object_store", t.ObjectStore)
+	}
+
+	codec := Frag().
+		String("format", t.Format).
+		String("subject", t.Subject).
+		Fragment("registry", registry)
+	if t.Version != "" {
+		codec.String("version", t.Version)
+	}
+	if t.Message != "" {
+		codec.String("message", t.Message)
+	}
+
+	return Frag().Fragments("processors",
+		Frag().Fragment(processor, codec),
+		dropErroredIf(fmt.Sprintf("errored() && error().or(\"\").has_prefix(%q)", nats.InvalidPayloadError),
+			"Dropping message not matching the schema", SchemaCodecFailedMetric),
+		logErrored("Rejecting message whose schema could not be resolved", SchemaCodecFailedMetric)), nil
+}
+
+// compileDedupeTransformer creates a Wombat processor dropping the messages whose key is
+// already recorded in the bucket of the transformer, through the NATS connection of the runtime.
+func compileDedupeTransformer(rt *runtime.Runtime, t *DedupeTransformer) (Fragment, error) {
+	if strings.TrimSpace(t.Key) == "" {
+		return nil, fmt.Errorf("a dedupe transformer requires a key")
+	}
+
+	if t.Bucket == "" {
+		return nil, fmt.Errorf("a dedupe transformer requires a bucket")
+	}
+
+	if t.Window != "" {
+		if _, err := time.ParseDuration(t.Window); err != nil {
+			return nil, fmt.Errorf("invalid dedupe window %q: %w", t.Window, err)
+		}
+	}
+
+	if rt == nil || rt.NatsUrl == "" {
+		return nil, fmt.Errorf("a dedupe transformer requires the NATS connection of the runtime")
+	}
+
+	dedupe := runtimeNatsFragment(rt).
+		String("bucket", t.Bucket).
+		String("key", t.Key)
+	if t.Window != "" {
+		dedupe.String("window", t.Window)
+	}
+
+	return Frag().Fragment("nats_dedupe", dedupe), nil
+}
+
+// compileLookupTransformer creates a Wombat processor enriching the messages with values read
+// from the bucket of the transformer, through the NATS connection of the runtime. Only the missing
+// keys are dropped, when OnMissing is drop. The messages whose lookup fails, such as when the
+// bucket cannot be reached or the key is missing and OnMissing is fail, are logged with the reason
+// of the failure and increment the LookupFailedMetric counter, but stay errored so that the output
+// rejects them and the input delivers them again.
+func compileLookupTransformer(rt *runtime.Runtime, t *LookupTransformer) (Fragment, error) {
+	if strings.TrimSpace(t.Key) == "" {
+		return nil, fmt.Errorf("a lookup transformer requires a key")
+	}
+
+	if t.Bucket == "" {
+		return nil, fmt.Errorf("a lookup transformer requires a bucket")
+	}
+
+	if t.Path != "" && t.Metadata != "" {
+		return nil, fmt.Errorf("a lookup transformer requires at most one of a path and a metadata key")
+	}
+
+	if t.CacheTTL != "" {
+		if _, err := time.ParseDuration(t.CacheTTL); err != nil {
+			return nil, fmt.Errorf("invalid lookup cache ttl %q: %w", t.CacheTTL, err)
+		}
+	}
+
+	switch t.OnMissing {
+	case "", nats.LookupMissingKeep, nats.LookupMissingDrop, nats.LookupMissingFail:
+	default:
+		return nil, fmt.Errorf("unknown missing key behavior %q, expected %s, %s or %s", t.OnMissing, nats.LookupMissingKeep, nats.LookupMissingDrop, nats.LookupMissingFail)
+	}
+
+	if rt == nil || rt.NatsUrl == "" {
+		return nil, fmt.Errorf("a lookup transformer requires the NATS connection of the runtime")
+	}
+
+	lookup := runtimeNatsFragment(rt).
+		String("bucket", t.Bucket).
+		String("key", t.Key)
+	if t.Path != "" {
+		lookup.String("path", t.Path)
+	}
+	if t.Metadata != "" {
+		lookup.String("metadata", t.Metadata)
+	}
+	if t.CacheTTL != "" {
+		lookup.String("cache_ttl", t.CacheTTL)
+	}
+	if t.OnMissing != "" {
+		lookup.String("on_missing", t.OnMissing)
+	}
+
+	return Frag().Fragments("processors",
+		Frag().Fragment("nats_kv_lookup", lookup),
+		logErrored("Rejecting message whose lookup failed", LookupFailedMetric)), nil
+}
+
+// compileCompressTransformer creates a Wombat processor compressing the payloads which have no
+// Content-Encoding header yet and are at least MinSize bytes long, and setting the header to the
+// algorithm. A failed compression is not the fault of the message, so the messages which cannot
+// be compressed are logged with the reason of the failure and increment the
+// CompressionFailedMetric counter, but stay errored to be delivered again.
+func compileCompressTransformer(t *CompressTransformer) (Fragment, error) {
+	if !slices.Contains(CompressionAlgorithms, t.Algorithm) {
+		return nil, fmt.Errorf("unknown compression algorithm %q, expected one of %s", t.Algorithm, strings.Join(CompressionAlgorithms, ", "))
+	}
+
+	if t.Level != 0 && (t.Algorithm != "gzip" || t.Level < 1 || t.Level > 9) {
+		return nil, fmt.Errorf("a compression level from 1 to 9 can only be set with gzip")
+	}
+
+	if t.MinSize < 0 {
+		return nil, fmt.Errorf("invalid minimum compressed size %d", t.MinSize)
+	}
+
+	compress := Frag().String("algorithm", t.Algorithm)
+	if t.Level != 0 {
+		compress.Int("level", t.Level)
+	}
+
+	check := fmt.Sprintf("metadata(%q) == null", ContentEncodingHeader)
+	if t.MinSize > 0 {
+		check += fmt.Sprintf(" && content().length() >= %d", t.MinSize)
+	}
+
+	return Frag().Fragments("processors",
+		Frag().Fragments("switch", Frag().
+			String("check", check).
+			Fragments("processors",
+				Frag().Fragment("compress", compress),
+				Frag().String("mutation", fmt.Sprintf("meta %q = %q", ContentEncodingHeader, t.Algorithm)))),
+		logErrored("Rejecting message which could not be compressed", CompressionFailedMetric)), nil
+}
+
+// compileDecompressTransformer creates a Wombat processor decompressing the payloads whose
+// Content-Encoding header names one of the algorithms of the transformer, and removing the
+// header. A payload which cannot be decompressed is corrupt and would fail again when delivered
+// again, so these messages are logged with the reason of the failure, dropped, and increment the
+// CompressionFailedMetric counter.
+func compileDecompressTransformer(t *DecompressTransformer) (Fragment, error) {
+	algorithms := t.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = CompressionAlgorithms
+	}
+
+	var cases []Fragment
+	for _, algorithm := range algorithms {
+		if !slices.Contains(CompressionAlgorithms, algorithm) {
+			return nil, fmt.Errorf("unknown compression algorithm %q, expected one of %s", algorithm, strings.Join(CompressionAlgorithms, ", "))
+		}
+
+		cases = append(cases, Frag().
+			String("check", fmt.Sprintf("metadata(%q) == %q", ContentEncodingHeader, algorithm)).
+			Fragments("processors",
+				Frag().Fragment("decompress", Frag().String("algorithm", algorithm)),
+				Frag().String("mutation", fmt.Sprintf("meta %q = deleted()", ContentEncodingHeader))))
+	}
+
+	return Frag().Fragments("processors",
+		Frag().Fragments("switch", cases...),
+		dropErrored("Dropping message which could not be decompressed", CompressionFailedMetric)), nil
+}
+
+// compileProtectTransformer creates a Wombat field_protect processor, or field_decrypt processor
+// when decrypting. The messages which cannot be processed are logged with the reason of the
+// failure and increment the ProtectFailedMetric counter. They are dropped, but for the values
+// which do not decrypt with the key, for example while the key is being rotated: these messages
+// stay errored so that the output rejects them and the consumer delivers them again.
+func compileProtectTransformer(rt *runtime.Runtime, t *ProtectTransformer, decrypt bool) (Fragment, error) {
+	var fields []Fragment
+	needsKey := decrypt
+	for i, f := range t.Fields {
+		if (f.Path == "") == (f.Header == "") {
+			return nil, fmt.Errorf("field %d requires exactly one of a path and a header", i)
+		}
+
+		action := f.Action
+		switch action {
+		case "":
+			action = nats.ProtectEncrypt
+		case nats.ProtectMask, nats.ProtectHash, nats.ProtectEncrypt:
+		default:
+			return nil, fmt.Errorf("field %d: unknown action %q, expected %s, %s or %s", i, f.Action, nats.ProtectMask, nats.ProtectHash, nats.ProtectEncrypt)
+		}
+
+		// Only the encrypted fields can be decrypted
+		if decrypt && action != nats.ProtectEncrypt {
+			continue
+		}
+
+		field := Frag()
+		if f.Path != "" {
+			field.String("path", f.Path)
+		} else {
+			field.String("header", f.Header)
+		}
+		if !decrypt {
+			field.String("action", action)
+			if f.KeepLast > 0 {
+				field.Int("keep_last", f.KeepLast)
+			}
+		}
+
+		needsKey = needsKey || action != nats.ProtectMask
+		fields = append(fields, field)
+	}
+
+	if len(fields) == 0 {
+		if decrypt {
+			return nil, fmt.Errorf("a decrypt transformer requires at least one encrypted field")
+		}
+		return nil, fmt.Errorf("a protect transformer requires at least one field")
+	}
+
+	processor := Frag()
+	if needsKey {
+		switch {
+		case t.Key.Env != "" && t.Key.Bucket == "" && t.Key.Key == "":
+			processor.Fragment("key", Frag().String("env", t.Key.Env))
+		case t.Key.Env == "" && t.Key.Bucket != "" && t.Key.Key != "":
+			if rt == nil || rt.NatsUrl == "" {
+				return nil, fmt.Errorf("reading the key from a KV bucket requires the NATS connection of the runtime")
+			}
+			processor = runtimeNatsFragment(rt).
+				Fragment("key", Frag().
+					String("bucket", t.Key.Bucket).
+					String("key", t.Key.Key))
+		default:
+			return nil, fmt.Errorf("the key is read from either an environment variable or a KV bucket and key")
+		}
+	}
+
+	processor.Fragments("fields", fields...)
+
+	if decrypt {
+		return Frag().Fragments("processors",
+			Frag().Fragment("field_decrypt", processor),
+			dropErroredIf(fmt.Sprintf("errored() && error().or(\"\").has_prefix(%q)", nats.MalformedCiphertextError),
+				"Dropping message whose fields are not encrypted values", ProtectFailedMetric),
+			logErrored("Rejecting message whose fields could not be decrypted with the key", ProtectFailedMetric)), nil
+	}
+
+	if t.Deterministic {
+		processor.Bool("deterministic", true)
+	}
+
+	return Frag().Fragments("processors",
+		Frag().Fragment("field_protect", processor),
+		dropErrored("Dropping message whose fields could not be protected", ProtectFailedMetric)), nil
+}
+
+// splitAggregate separates the aggregate transformer ending the transformer of the connector,
+// either the transformer itself or the last transformer of its composite transformer, from the
+// transformers preceding it.
+func splitAggregate(t Transformer) (Transformer, *AggregateTransformer) {
+	if t.Aggregate != nil {
+		return Transformer{}, t.Aggregate
+	}
+
+	if t.Composite == nil || len(t.Composite.Sequential) == 0 {
+		return t, nil
+	}
+
+	seq := t.Composite.Sequential
+	last := seq[len(seq)-1]
+	if last.Aggregate == nil {
+		return t, nil
+	}
+
+	switch len(seq) {
+	case 1:
+		return Transformer{}, last.Aggregate
+	case 2:
+		return seq[0], last.Aggregate
+	default:
+		return Transformer{Composite: &CompositeTransformer{Sequential: seq[:len(seq)-1]}}, last.Aggregate
+	}
+}
+
+// compileAggregateTransformer creates a Wombat buffer aggregating the messages over the windows
+// of the transformer. The open windows are checkpointed through the NATS connection of the
+// runtime when the transformer has a checkpoint.
+func compileAggregateTransformer(rt *runtime.Runtime, t *AggregateTransformer) (Fragment, error) {
+	spec := nats.WindowSpec{
+		Type:       t.Window,
+		Count:      t.Count,
+		Fields:     t.Fields,
+		Aggregates: t.Aggregates,
+	}
+
+	var err error
+	if t.Size != "" {
+		if spec.Size, err = time.ParseDuration(t.Size); err != nil {
+			return nil, fmt.Errorf("invalid aggregate window size %q: %w", t.Size, err)
+		}
+	}
+	if t.Slide != "" {
+		if spec.Slide, err = time.ParseDuration(t.Slide); err != nil {
+			return nil, fmt.Errorf("invalid aggregate window slide %q: %w", t.Slide, err)
+		}
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	aggregate := Frag().
+		String("window", t.Window).
+		Strings("fields", t.Fields...)
+	if t.Size != "" {
+		aggregate.String("size", t.Size)
+	}
+	if t.Slide != "" {
+		aggregate.String("slide", t.Slide)
+	}
+	if t.Count > 0 {
+		aggregate.Int("count", t.Count)
+	}
+	if t.GroupBy != "" {
+		aggregate.String("group_by", t.GroupBy)
+	}
+	if len(t.Aggregates) > 0 {
+		aggregate.Strings("aggregates", t.Aggregates...)
+	}
+
+	if t.Checkpoint != nil {
+		if t.Checkpoint.Bucket == "" {
+			return nil, fmt.Errorf("an aggregate checkpoint requires a bucket")
+		}
+		if t.Checkpoint.Interval != "" {
+			if d, err := time.ParseDuration(t.Checkpoint.Interval); err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid aggregate checkpoint interval %q", t.Checkpoint.Interval)
+			}
+		}
+		if rt == nil || rt.NatsUrl == "" {
+			return nil, fmt.Errorf("an aggregate checkpoint requires the NATS connection of the runtime")
+		}
+
+		checkpoint := runtimeNatsFragment(rt).
+			String("bucket", t.Checkpoint.Bucket)
+		if key := aggregateCheckpointKey(rt); key != "" {
+			checkpoint.String("key", key)
+		}
+		if t.Checkpoint.Interval != "" {
+			checkpoint.String("interval", t.Checkpoint.Interval)
+		}
+		aggregate.Fragment("checkpoint", checkpoint)
+	}
+
+	return Frag().Fragment("aggregate_window", aggregate), nil
+}
+
+// aggregateCheckpointKey returns the key holding the open windows of the instance of the
+// connector, made of its namespace, name and instance.
+func aggregateCheckpointKey(rt *runtime.Runtime) string {
+	var parts []string
+	for _, p := range []string{rt.Namespace, rt.Connector, rt.Instance} {
+		if p != "" {
+			parts = append(parts, invalidRateLimitKeyChars.ReplaceAllString(p, "_"))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// runtimeNatsFragment creates the connection fields of the components reaching NATS through
+// the connection of the runtime.
+func runtimeNatsFragment(rt *runtime.Runtime) Fragment {
+	cfg := Frag().Strings("urls", rt.NatsUrl)
+	if rt.NatsJwt != "" && rt.NatsSeed != "" {
+		cfg.Fragment("auth", Frag().
+			String("user_jwt", rt.NatsJwt).
+			String("user_nkey_seed", rt.NatsSeed))
+	}
+	return cfg
+}
+
+// dropErrored creates a Wombat processor logging, counting and dropping the messages flagged
+// as failed by a previous processor. It is only used where the message itself is at fault, as
+// dropping a message failed by an unavailable service would lose it.
+func dropErrored(message, metric string) Fragment {
+	return dropErroredIf("errored()", message, metric)
+}
+
+// dropErroredIf creates a Wombat processor like dropErrored, only dropping the messages matching
+// the check, such as those failed with a given error.
+func dropErroredIf(check, message, metric string) Fragment {
+	return Frag().Fragments("switch", Frag().
+		String("check", check).
+		Fragments("processors",
+			Frag().Fragment("log", Frag().
+				String("level", "WARN").
+				String("message", message+": ${! error() }")),
+			Frag().Fragment("metric", Frag().
+				String("type", "counter").
+				String("name", metric)),
+			Frag().String("mapping", "root = deleted()")))
+}
+
+// logErrored creates a Wombat processor logging and counting the messages flagged as failed by a
+// previous processor, leaving them errored so that the output compiled by rejectErrored rejects them.
+func logErrored(message, metric string) Fragment {
+	return Frag().Fragments("switch", Frag().
+		String("check", "errored()").
+		Fragments("processors",
+			Frag().Fragment("log", Frag().
+				String("level", "WARN").
+				String("message", message+": ${! error() }")),
+			Frag().Fragment("metric", Frag().
+				String("type", "counter").
+				String("name", metric))))
+}
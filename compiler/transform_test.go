@@ -2,6 +2,7 @@ package compiler_test
 
 import (
 	"context"
+	"errors"
 	"strings"
 
 	"github.com/Jeffail/gabs/v2"
@@ -9,9 +10,11 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/redpanda-data/benthos/v4/public/service"
 	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
 	"github.com/synadia-io/connect-runtime-wombat/test"
 	. "github.com/synadia-io/connect/builders"
 	"github.com/synadia-io/connect/model"
+	"github.com/synadia-io/connect/runtime"
 	"gopkg.in/yaml.v3"
 
 	_ "github.com/synadia-io/connect-runtime-wombat/components"
@@ -155,3 +158,807 @@ var _ = Describe("Compiling an inlet", func() {
 		})
 	})
 })
+
+var _ = Describe("Compiling a filter transformer", func() {
+	var steps compiler.ConnectorSteps
+
+	BeforeEach(func() {
+		steps = compiler.FromModel(Steps().
+			Source(SourceStep("stdin")).
+			Producer(ProducerStep(NatsConfig().Url(DefaultNatsUrl)).Core(ProducerStepCore("foo.bar"))).
+			Build())
+
+		steps.Transformer = &compiler.Transformer{
+			Filter: &compiler.FilterTransformer{
+				Condition: `this.level == "error"`,
+				Headers:   map[string]string{"X-Tenant": "acme"},
+			},
+		}
+	})
+
+	It("should generate a valid wombat artifact", func() {
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoLogr.Info(artifact)
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		am := gabs.Wrap(m)
+
+		Expect(am.Path("input.processors.0.switch.0.check").Data()).To(Equal(`!((this.level == "error") && metadata("X-Tenant") == "acme")`))
+		Expect(am.Path("input.processors.0.switch.0.processors.0.metric.type").Data()).To(Equal("counter"))
+		Expect(am.Path("input.processors.0.switch.0.processors.0.metric.name").Data()).To(Equal(compiler.FilterDroppedMetric))
+		Expect(am.Path("input.processors.0.switch.0.processors.1.mapping").Data()).To(Equal("root = deleted()"))
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+		_, err = sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should only keep the messages matching the condition and headers", func() {
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		processor, err := yaml.Marshal(gabs.Wrap(m).Path("input.processors.0").Data())
+		Expect(err).NotTo(HaveOccurred())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.AddProcessorYAML(string(processor))).To(Succeed())
+
+		produce, err := sb.AddProducerFunc()
+		Expect(err).NotTo(HaveOccurred())
+
+		var kept []string
+		Expect(sb.AddConsumerFunc(func(_ context.Context, msg *service.Message) error {
+			b, err := msg.AsBytes()
+			kept = append(kept, string(b))
+			return err
+		})).To(Succeed())
+
+		stream, err := sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = stream.Run(ctx) }()
+
+		send := func(body, tenant string) {
+			msg := service.NewMessage([]byte(body))
+			msg.MetaSetMut("X-Tenant", tenant)
+			Expect(produce(ctx, msg)).To(Succeed())
+		}
+
+		send(`{"level":"error","id":1}`, "acme")
+		send(`{"level":"info","id":2}`, "acme")
+		send(`{"level":"error","id":3}`, "other")
+
+		Expect(stream.Stop(ctx)).To(Succeed())
+		Expect(kept).To(ConsistOf(`{"level":"error","id":1}`))
+	})
+
+	It("should require a condition or headers", func() {
+		steps.Transformer.Filter = &compiler.FilterTransformer{}
+
+		_, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).To(HaveOccurred())
+
+		var cErr *compiler.CompilationError
+		Expect(errors.As(err, &cErr)).To(BeTrue())
+		Expect(cErr.Code).To(Equal(compiler.CodeInvalidTransformer))
+	})
+
+	It("should compile filters within a composite transformer", func() {
+		steps.Transformer = &compiler.Transformer{
+			Composite: &compiler.CompositeTransformer{
+				Sequential: []compiler.Transformer{
+					{Mapping: &model.MappingTransformerStep{Sourcecode: "root = this"}},
+					{Filter: &compiler.FilterTransformer{Condition: "this.keep"}},
+				},
+			},
+		}
+
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		Expect(gabs.Wrap(m).Path("input.processors.0.processors.sequence.1.switch.0.check").Data()).To(Equal("!((this.keep))"))
+	})
+})
+
+var _ = Describe("Compiling a validate transformer", func() {
+	var steps compiler.ConnectorSteps
+
+	BeforeEach(func() {
+		steps = compiler.FromModel(Steps().
+			Source(SourceStep("stdin")).
+			Producer(ProducerStep(NatsConfig().Url(DefaultNatsUrl)).Core(ProducerStepCore("foo.bar"))).
+			Build())
+
+		steps.Transformer = &compiler.Transformer{
+			Validate: &compiler.ValidateTransformer{
+				Format: "json_schema",
+				Schema: `{"type": "object", "required": ["id"]}`,
+			},
+		}
+	})
+
+	It("should generate a valid wombat artifact", func() {
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoLogr.Info(artifact)
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		am := gabs.Wrap(m)
+
+		Expect(am.Path("input.processors.0.processors.0.schema_validate.format").Data()).To(Equal("json_schema"))
+		Expect(am.Path("input.processors.0.processors.1.switch.0.check").Data()).To(Equal("errored()"))
+		Expect(am.Path("input.processors.0.processors.1.switch.0.processors.1.metric.name").Data()).To(Equal(compiler.ValidationFailedMetric))
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+		_, err = sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should drop the messages not matching the schema", func() {
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		processor, err := yaml.Marshal(gabs.Wrap(m).Path("input.processors.0").Data())
+		Expect(err).NotTo(HaveOccurred())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.AddProcessorYAML(string(processor))).To(Succeed())
+
+		produce, err := sb.AddProducerFunc()
+		Expect(err).NotTo(HaveOccurred())
+
+		var kept []string
+		Expect(sb.AddConsumerFunc(func(_ context.Context, msg *service.Message) error {
+			b, err := msg.AsBytes()
+			kept = append(kept, string(b))
+			return err
+		})).To(Succeed())
+
+		stream, err := sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = stream.Run(ctx) }()
+
+		for _, body := range []string{`{"id":1}`, `{"name":"no id"}`, `not json`} {
+			Expect(produce(ctx, service.NewMessage([]byte(body)))).To(Succeed())
+		}
+
+		Expect(stream.Stop(ctx)).To(Succeed())
+		Expect(kept).To(ConsistOf(`{"id":1}`))
+	})
+
+	It("should require exactly one of an inline schema or a registry", func() {
+		steps.Transformer.Validate.Registry = &compiler.SchemaRegistry{Bucket: "schemas", Name: "person"}
+
+		_, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).To(HaveOccurred())
+
+		var cErr *compiler.CompilationError
+		Expect(errors.As(err, &cErr)).To(BeTrue())
+		Expect(cErr.Code).To(Equal(compiler.CodeInvalidTransformer))
+	})
+})
+
+var _ = Describe("Compiling encode and decode transformers", func() {
+	var steps compiler.ConnectorSteps
+	var rt *runtime.Runtime
+
+	BeforeEach(func() {
+		steps = compiler.FromModel(Steps().
+			Source(SourceStep("stdin")).
+			Producer(ProducerStep(NatsConfig().Url(DefaultNatsUrl)).Core(ProducerStepCore("foo.bar"))).
+			Build())
+
+		steps.Transformer = &compiler.Transformer{
+			Encode: &compiler.SchemaCodecTransformer{
+				Format:  "protobuf",
+				Subject: "person",
+				Version: "2",
+				Message: "example.Person",
+				Bucket:  "schemas",
+			},
+		}
+
+		rt = test.Runtime(runtime.WithNatsUrl(DefaultNatsUrl), runtime.WithNatsJwt("JWT"), runtime.WithNatsSeed("SEED"))
+	})
+
+	It("should resolve the schema through the NATS connection of the runtime", func() {
+		artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoLogr.Info(artifact)
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		am := gabs.Wrap(m)
+
+		encode := am.Path("input.processors.0.processors.0.schema_encode")
+		Expect(encode.Path("format").Data()).To(Equal("protobuf"))
+		Expect(encode.Path("subject").Data()).To(Equal("person"))
+		Expect(encode.Path("version").Data()).To(Equal("2"))
+		Expect(encode.Path("message").Data()).To(Equal("example.Person"))
+		Expect(encode.Path("registry.urls").Data()).To(Equal([]any{DefaultNatsUrl}))
+		Expect(encode.Path("registry.auth.user_jwt").Data()).To(Equal("JWT"))
+		Expect(encode.Path("registry.auth.user_nkey_seed").Data()).To(Equal("SEED"))
+		Expect(encode.Path("registry.bucket").Data()).To(Equal("schemas"))
+		Expect(am.Path("input.processors.0.processors.1.switch.0.check").Data()).To(ContainSubstring(nats.InvalidPayloadError))
+		Expect(am.Path("input.processors.0.processors.1.switch.0.processors.1.metric.name").Data()).To(Equal(compiler.SchemaCodecFailedMetric))
+		Expect(am.Path("input.processors.0.processors.1.switch.0.processors.2.mapping").Data()).To(Equal("root = deleted()"))
+
+		// The messages failed by the registry are rejected by the output rather than dropped
+		Expect(am.Path("input.processors.0.processors.2.switch.0.processors").Children()).To(HaveLen(2))
+		Expect(am.Exists("output", "reject_errored")).To(BeTrue())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+	})
+
+	It("should compile a decoder reading from an object store", func() {
+		steps.Transformer = &compiler.Transformer{
+			Decode: &compiler.SchemaCodecTransformer{Format: "avro", Subject: "person", ObjectStore: "schemas"},
+		}
+
+		artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		decode := gabs.Wrap(m).Path("input.processors.0.processors.0.schema_decode")
+		Expect(decode.Path("registry.object_store").Data()).To(Equal("schemas"))
+		Expect(decode.Exists("version")).To(BeFalse())
+		Expect(decode.Exists("registry", "bucket")).To(BeFalse())
+	})
+
+	DescribeTable("should reject invalid transformers",
+		func(update func(t *compiler.SchemaCodecTransformer, rt **runtime.Runtime)) {
+			update(steps.Transformer.Encode, &rt)
+
+			_, err := compiler.CompileSteps(context.Background(), rt, steps)
+			Expect(err).To(HaveOccurred())
+			Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidTransformer))
+		},
+		Entry("unknown format", func(t *compiler.SchemaCodecTransformer, _ **runtime.Runtime) { t.Format = "xml" }),
+		Entry("missing subject", func(t *compiler.SchemaCodecTransformer, _ **runtime.Runtime) { t.Subject = "" }),
+		Entry("bucket and object store", func(t *compiler.SchemaCodecTransformer, _ **runtime.Runtime) { t.ObjectStore = "schemas" }),
+		Entry("no NATS connection", func(_ *compiler.SchemaCodecTransformer, rt **runtime.Runtime) { *rt = test.Runtime() }),
+	)
+})
+
+var _ = Describe("Compiling a dedupe transformer", func() {
+	var steps compiler.ConnectorSteps
+	var rt *runtime.Runtime
+
+	BeforeEach(func() {
+		steps = compiler.FromModel(Steps().
+			Source(SourceStep("stdin")).
+			Producer(ProducerStep(NatsConfig().Url(DefaultNatsUrl)).Core(ProducerStepCore("foo.bar"))).
+			Build())
+
+		steps.Transformer = &compiler.Transformer{
+			Dedupe: &compiler.DedupeTransformer{Key: "this.id", Bucket: "seen", Window: "10m"},
+		}
+
+		rt = test.Runtime(runtime.WithNatsUrl(DefaultNatsUrl))
+	})
+
+	It("should record the seen keys through the NATS connection of the runtime", func() {
+		artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoLogr.Info(artifact)
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		dedupe := gabs.Wrap(m).Path("input.processors.0.nats_dedupe")
+		Expect(dedupe.Path("urls").Data()).To(Equal([]any{DefaultNatsUrl}))
+		Expect(dedupe.Exists("auth")).To(BeFalse())
+		Expect(dedupe.Path("bucket").Data()).To(Equal("seen"))
+		Expect(dedupe.Path("key").Data()).To(Equal("this.id"))
+		Expect(dedupe.Path("window").Data()).To(Equal("10m"))
+		Expect(gabs.Wrap(m).Path("output.nats_dedupe_release.output.nats.subject").Data()).To(Equal("foo.bar"))
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+	})
+
+	DescribeTable("should reject invalid transformers",
+		func(update func(t *compiler.DedupeTransformer, rt **runtime.Runtime)) {
+			update(steps.Transformer.Dedupe, &rt)
+
+			_, err := compiler.CompileSteps(context.Background(), rt, steps)
+			Expect(err).To(HaveOccurred())
+			Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidTransformer))
+		},
+		Entry("missing key", func(t *compiler.DedupeTransformer, _ **runtime.Runtime) { t.Key = " " }),
+		Entry("missing bucket", func(t *compiler.DedupeTransformer, _ **runtime.Runtime) { t.Bucket = "" }),
+		Entry("invalid window", func(t *compiler.DedupeTransformer, _ **runtime.Runtime) { t.Window = "soon" }),
+		Entry("no NATS connection", func(_ *compiler.DedupeTransformer, rt **runtime.Runtime) { *rt = test.Runtime() }),
+	)
+})
+
+var _ = Describe("Compiling a lookup transformer", func() {
+	var steps compiler.ConnectorSteps
+	var rt *runtime.Runtime
+
+	BeforeEach(func() {
+		steps = compiler.FromModel(Steps().
+			Source(SourceStep("stdin")).
+			Producer(ProducerStep(NatsConfig().Url(DefaultNatsUrl)).Core(ProducerStepCore("foo.bar"))).
+			Build())
+
+		steps.Transformer = &compiler.Transformer{
+			Lookup: &compiler.LookupTransformer{
+				Bucket:    "customers",
+				Key:       "this.customer_id",
+				Path:      "customer",
+				CacheTTL:  "30s",
+				OnMissing: "fail",
+			},
+		}
+
+		rt = test.Runtime(runtime.WithNatsUrl(DefaultNatsUrl))
+	})
+
+	It("should read the values through the NATS connection of the runtime", func() {
+		artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoLogr.Info(artifact)
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		am := gabs.Wrap(m)
+
+		lookup := am.Path("input.processors.0.processors.0.nats_kv_lookup")
+		Expect(lookup.Path("urls").Data()).To(Equal([]any{DefaultNatsUrl}))
+		Expect(lookup.Path("bucket").Data()).To(Equal("customers"))
+		Expect(lookup.Path("key").Data()).To(Equal("this.customer_id"))
+		Expect(lookup.Path("path").Data()).To(Equal("customer"))
+		Expect(lookup.Exists("metadata")).To(BeFalse())
+		Expect(lookup.Path("cache_ttl").Data()).To(Equal("30s"))
+		Expect(lookup.Path("on_missing").Data()).To(Equal("fail"))
+		Expect(am.Path("input.processors.0.processors.1.switch.0.processors.1.metric.name").Data()).To(Equal(compiler.LookupFailedMetric))
+		Expect(am.Path("input.processors.0.processors.1.switch.0.processors").Children()).To(HaveLen(2))
+
+		// The failed lookups are rejected by the output rather than dropped
+		Expect(am.Path("output.reject_errored.nats.subject").Data()).To(Equal("foo.bar"))
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+	})
+
+	It("should keep the processors of the producer ahead of the output rejecting failed lookups", func() {
+		steps.Producer.Headers = &compiler.HeaderPolicy{Exclude: []string{"^http_"}}
+
+		artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		am := gabs.Wrap(m)
+
+		Expect(am.Path("output.processors.0.mutation").Data()).To(ContainSubstring("^http_"))
+		Expect(am.Exists("output", "reject_errored", "processors")).To(BeFalse())
+		Expect(am.Path("output.reject_errored.nats.subject").Data()).To(Equal("foo.bar"))
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+	})
+
+	DescribeTable("should reject invalid transformers",
+		func(update func(t *compiler.LookupTransformer, rt **runtime.Runtime)) {
+			update(steps.Transformer.Lookup, &rt)
+
+			_, err := compiler.CompileSteps(context.Background(), rt, steps)
+			Expect(err).To(HaveOccurred())
+			Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidTransformer))
+		},
+		Entry("missing key", func(t *compiler.LookupTransformer, _ **runtime.Runtime) { t.Key = "" }),
+		Entry("missing bucket", func(t *compiler.LookupTransformer, _ **runtime.Runtime) { t.Bucket = "" }),
+		Entry("path and metadata", func(t *compiler.LookupTransformer, _ **runtime.Runtime) { t.Metadata = "customer" }),
+		Entry("invalid cache ttl", func(t *compiler.LookupTransformer, _ **runtime.Runtime) { t.CacheTTL = "forever" }),
+		Entry("unknown missing key behavior", func(t *compiler.LookupTransformer, _ **runtime.Runtime) { t.OnMissing = "ignore" }),
+		Entry("no NATS connection", func(_ *compiler.LookupTransformer, rt **runtime.Runtime) { *rt = test.Runtime() }),
+	)
+})
+
+var _ = Describe("Compiling an aggregate transformer", func() {
+	var steps compiler.ConnectorSteps
+	var rt *runtime.Runtime
+
+	BeforeEach(func() {
+		steps = compiler.FromModel(Steps().
+			Source(SourceStep("stdin")).
+			Producer(ProducerStep(NatsConfig().Url(DefaultNatsUrl)).Core(ProducerStepCore("foo.bar"))).
+			Build())
+
+		steps.Transformer = &compiler.Transformer{
+			Aggregate: &compiler.AggregateTransformer{
+				Window:     "sliding",
+				Size:       "1m",
+				Slide:      "10s",
+				GroupBy:    "this.host",
+				Fields:     []string{"latency"},
+				Aggregates: []string{"avg", "p99"},
+			},
+		}
+
+		rt = test.Runtime(runtime.WithNatsUrl(DefaultNatsUrl))
+	})
+
+	It("should compile to a buffer", func() {
+		artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoLogr.Info(artifact)
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		am := gabs.Wrap(m)
+
+		aggregate := am.Path("buffer.aggregate_window")
+		Expect(aggregate.Path("window").Data()).To(Equal("sliding"))
+		Expect(aggregate.Path("size").Data()).To(Equal("1m"))
+		Expect(aggregate.Path("slide").Data()).To(Equal("10s"))
+		Expect(aggregate.Exists("count")).To(BeFalse())
+		Expect(aggregate.Path("group_by").Data()).To(Equal("this.host"))
+		Expect(aggregate.Path("fields").Data()).To(Equal([]any{"latency"}))
+		Expect(aggregate.Path("aggregates").Data()).To(Equal([]any{"avg", "p99"}))
+		Expect(aggregate.Exists("checkpoint")).To(BeFalse())
+		Expect(am.Exists("input", "processors")).To(BeFalse())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+	})
+
+	It("should apply the transformers preceding the aggregate transformer to the input", func() {
+		aggregate := steps.Transformer.Aggregate
+		steps.Transformer = &compiler.Transformer{
+			Composite: &compiler.CompositeTransformer{Sequential: []compiler.Transformer{
+				{Mapping: &model.MappingTransformerStep{Sourcecode: "root = this.metrics"}},
+				{Aggregate: aggregate},
+			}},
+		}
+
+		artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		am := gabs.Wrap(m)
+		Expect(am.Path("input.processors.0.mapping").Data()).To(Equal("root = this.metrics"))
+		Expect(am.Path("buffer.aggregate_window.window").Data()).To(Equal("sliding"))
+	})
+
+	It("should checkpoint the open windows through the NATS connection of the runtime", func() {
+		steps.Transformer.Aggregate.Checkpoint = &compiler.AggregateCheckpoint{Bucket: "windows", Interval: "5s"}
+
+		artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		checkpoint := gabs.Wrap(m).Path("buffer.aggregate_window.checkpoint")
+		Expect(checkpoint.Path("urls").Data()).To(Equal([]any{DefaultNatsUrl}))
+		Expect(checkpoint.Path("bucket").Data()).To(Equal("windows"))
+		Expect(checkpoint.Path("key").Data()).To(Equal("MY_NAMESPACE.MY_CONNECTOR.MY_INSTANCE"))
+		Expect(checkpoint.Path("interval").Data()).To(Equal("5s"))
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+	})
+
+	It("should reject an aggregate transformer which is not the last transformer", func() {
+		aggregate := steps.Transformer.Aggregate
+		steps.Transformer = &compiler.Transformer{
+			Composite: &compiler.CompositeTransformer{Sequential: []compiler.Transformer{
+				{Aggregate: aggregate},
+				{Mapping: &model.MappingTransformerStep{Sourcecode: "root = this"}},
+			}},
+		}
+
+		_, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).To(HaveOccurred())
+		Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidTransformer))
+	})
+
+	DescribeTable("should reject invalid transformers",
+		func(update func(t *compiler.AggregateTransformer, rt **runtime.Runtime)) {
+			update(steps.Transformer.Aggregate, &rt)
+
+			_, err := compiler.CompileSteps(context.Background(), rt, steps)
+			Expect(err).To(HaveOccurred())
+			Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidTransformer))
+		},
+		Entry("unknown window", func(t *compiler.AggregateTransformer, _ **runtime.Runtime) { t.Window = "session" }),
+		Entry("invalid size", func(t *compiler.AggregateTransformer, _ **runtime.Runtime) { t.Size = "long" }),
+		Entry("slide longer than size", func(t *compiler.AggregateTransformer, _ **runtime.Runtime) { t.Slide = "2m" }),
+		Entry("count window without count", func(t *compiler.AggregateTransformer, _ **runtime.Runtime) { t.Window = "count" }),
+		Entry("missing fields", func(t *compiler.AggregateTransformer, _ **runtime.Runtime) { t.Fields = nil }),
+		Entry("unknown aggregate", func(t *compiler.AggregateTransformer, _ **runtime.Runtime) { t.Aggregates = []string{"median"} }),
+		Entry("checkpoint without bucket", func(t *compiler.AggregateTransformer, _ **runtime.Runtime) {
+			t.Checkpoint = &compiler.AggregateCheckpoint{}
+		}),
+		Entry("invalid checkpoint interval", func(t *compiler.AggregateTransformer, _ **runtime.Runtime) {
+			t.Checkpoint = &compiler.AggregateCheckpoint{Bucket: "windows", Interval: "0s"}
+		}),
+		Entry("checkpoint without NATS connection", func(t *compiler.AggregateTransformer, rt **runtime.Runtime) {
+			t.Checkpoint = &compiler.AggregateCheckpoint{Bucket: "windows"}
+			*rt = test.Runtime()
+		}),
+	)
+})
+
+var _ = Describe("Compiling protect and decrypt transformers", func() {
+	var steps compiler.ConnectorSteps
+	var rt *runtime.Runtime
+	var protect *compiler.ProtectTransformer
+
+	BeforeEach(func() {
+		steps = compiler.FromModel(Steps().
+			Source(SourceStep("stdin")).
+			Producer(ProducerStep(NatsConfig().Url(DefaultNatsUrl)).Core(ProducerStepCore("foo.bar"))).
+			Build())
+
+		protect = &compiler.ProtectTransformer{
+			Fields: []compiler.ProtectedField{
+				{Path: "card.number", Action: "mask", KeepLast: 4},
+				{Path: "email", Action: "hash"},
+				{Path: "ssn"},
+				{Header: "X-User", Action: "encrypt"},
+			},
+			Key:           compiler.ProtectionKey{Env: "PII_KEY"},
+			Deterministic: true,
+		}
+
+		rt = test.Runtime(runtime.WithNatsUrl(DefaultNatsUrl))
+	})
+
+	It("should protect the fields with a key read from the environment", func() {
+		steps.Transformer = &compiler.Transformer{Protect: protect}
+
+		artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoLogr.Info(artifact)
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		am := gabs.Wrap(m)
+
+		p := am.Path("input.processors.0.processors.0.field_protect")
+		Expect(p.Exists("urls")).To(BeFalse())
+		Expect(p.Path("key").Data()).To(Equal(map[string]any{"env": "PII_KEY"}))
+		Expect(p.Path("deterministic").Data()).To(BeTrue())
+		Expect(p.Path("fields").Data()).To(Equal([]any{
+			map[string]any{"path": "card.number", "action": "mask", "keep_last": 4},
+			map[string]any{"path": "email", "action": "hash"},
+			map[string]any{"path": "ssn", "action": "encrypt"},
+			map[string]any{"header": "X-User", "action": "encrypt"},
+		}))
+		Expect(am.Path("input.processors.0.processors.1.switch.0.processors.1.metric.name").Data()).To(Equal(compiler.ProtectFailedMetric))
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+	})
+
+	It("should decrypt the encrypted fields with a key read from a KV bucket", func() {
+		protect.Key = compiler.ProtectionKey{Bucket: "keys", Key: "pii"}
+		steps.Transformer = &compiler.Transformer{Decrypt: protect}
+
+		artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		d := gabs.Wrap(m).Path("input.processors.0.processors.0.field_decrypt")
+		Expect(d.Path("urls").Data()).To(Equal([]any{DefaultNatsUrl}))
+		Expect(d.Path("key").Data()).To(Equal(map[string]any{"bucket": "keys", "key": "pii"}))
+		Expect(d.Exists("deterministic")).To(BeFalse())
+		Expect(d.Path("fields").Data()).To(Equal([]any{
+			map[string]any{"path": "ssn"},
+			map[string]any{"header": "X-User"},
+		}))
+
+		am := gabs.Wrap(m)
+		Expect(am.Path("input.processors.0.processors.1.switch.0.check").Data()).To(ContainSubstring(nats.MalformedCiphertextError))
+		Expect(am.Path("input.processors.0.processors.2.switch.0.processors").Children()).To(HaveLen(2))
+		Expect(am.Exists("output", "reject_errored")).To(BeTrue())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+	})
+
+	It("should mask without a key", func() {
+		steps.Transformer = &compiler.Transformer{Protect: &compiler.ProtectTransformer{
+			Fields: []compiler.ProtectedField{{Path: "name", Action: "mask"}},
+		}}
+
+		artifact, err := compiler.CompileSteps(context.Background(), rt, steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		Expect(gabs.Wrap(m).Exists("input", "processors", "0", "processors", "0", "field_protect", "key")).To(BeFalse())
+	})
+
+	DescribeTable("should reject invalid transformers",
+		func(decrypt bool, update func(t *compiler.ProtectTransformer, rt **runtime.Runtime)) {
+			update(protect, &rt)
+			if decrypt {
+				steps.Transformer = &compiler.Transformer{Decrypt: protect}
+			} else {
+				steps.Transformer = &compiler.Transformer{Protect: protect}
+			}
+
+			_, err := compiler.CompileSteps(context.Background(), rt, steps)
+			Expect(err).To(HaveOccurred())
+			Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidTransformer))
+		},
+		Entry("no fields", false, func(t *compiler.ProtectTransformer, _ **runtime.Runtime) { t.Fields = nil }),
+		Entry("path and header", false, func(t *compiler.ProtectTransformer, _ **runtime.Runtime) { t.Fields[0].Header = "X-Card" }),
+		Entry("unknown action", false, func(t *compiler.ProtectTransformer, _ **runtime.Runtime) { t.Fields[1].Action = "tokenize" }),
+		Entry("no key", false, func(t *compiler.ProtectTransformer, _ **runtime.Runtime) { t.Key = compiler.ProtectionKey{} }),
+		Entry("env and bucket", false, func(t *compiler.ProtectTransformer, _ **runtime.Runtime) { t.Key.Bucket = "keys" }),
+		Entry("bucket without NATS connection", false, func(t *compiler.ProtectTransformer, rt **runtime.Runtime) {
+			t.Key = compiler.ProtectionKey{Bucket: "keys", Key: "pii"}
+			*rt = test.Runtime()
+		}),
+		Entry("no encrypted fields to decrypt", true, func(t *compiler.ProtectTransformer, _ **runtime.Runtime) { t.Fields = t.Fields[:2] }),
+	)
+})
+
+var _ = Describe("Compiling compress and decompress transformers", func() {
+	var steps compiler.ConnectorSteps
+
+	BeforeEach(func() {
+		steps = compiler.FromModel(Steps().
+			Source(SourceStep("stdin")).
+			Producer(ProducerStep(NatsConfig().Url(DefaultNatsUrl)).Core(ProducerStepCore("foo.bar"))).
+			Build())
+	})
+
+	compile := func(t compiler.Transformer) string {
+		steps.Transformer = &t
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+		GinkgoLogr.Info(artifact)
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		processor, err := yaml.Marshal(gabs.Wrap(m).Path("input.processors.0").Data())
+		Expect(err).NotTo(HaveOccurred())
+		return string(processor)
+	}
+
+	// run passes the messages through the processors, returning the messages kept
+	run := func(msgs []*service.Message, processors ...string) []*service.Message {
+		sb := service.NewStreamBuilder()
+		for _, p := range processors {
+			Expect(sb.AddProcessorYAML(p)).To(Succeed())
+		}
+
+		produce, err := sb.AddProducerFunc()
+		Expect(err).NotTo(HaveOccurred())
+
+		var kept []*service.Message
+		Expect(sb.AddConsumerFunc(func(_ context.Context, msg *service.Message) error {
+			kept = append(kept, msg)
+			return nil
+		})).To(Succeed())
+
+		stream, err := sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = stream.Run(ctx) }()
+
+		for _, msg := range msgs {
+			Expect(produce(ctx, msg)).To(Succeed())
+		}
+		Expect(stream.Stop(ctx)).To(Succeed())
+		return kept
+	}
+
+	body := func(msg *service.Message) string {
+		b, err := msg.AsBytes()
+		Expect(err).NotTo(HaveOccurred())
+		return string(b)
+	}
+
+	for _, algorithm := range compiler.CompressionAlgorithms {
+		It("should restore payloads compressed with "+algorithm, func() {
+			compress := compile(compiler.Transformer{Compress: &compiler.CompressTransformer{Algorithm: algorithm}})
+			decompress := compile(compiler.Transformer{Decompress: &compiler.DecompressTransformer{}})
+
+			payload := strings.Repeat(`{"reading": 42}`, 100)
+			compressed := run([]*service.Message{service.NewMessage([]byte(payload))}, compress)
+			Expect(compressed).To(HaveLen(1))
+			Expect(len(body(compressed[0]))).To(BeNumerically("<", len(payload)))
+			encoding, _ := compressed[0].MetaGet(compiler.ContentEncodingHeader)
+			Expect(encoding).To(Equal(algorithm))
+
+			restored := run(compressed, decompress)
+			Expect(restored).To(HaveLen(1))
+			Expect(body(restored[0])).To(Equal(payload))
+			_, ok := restored[0].MetaGet(compiler.ContentEncodingHeader)
+			Expect(ok).To(BeFalse())
+		})
+	}
+
+	It("should only compress the payloads without encoding reaching the minimum size", func() {
+		compress := compile(compiler.Transformer{Compress: &compiler.CompressTransformer{Algorithm: "gzip", Level: 9, MinSize: 10}})
+		Expect(compress).To(ContainSubstring("level: 9"))
+
+		encoded := service.NewMessage([]byte("already compressed"))
+		encoded.MetaSetMut(compiler.ContentEncodingHeader, "br")
+
+		kept := run([]*service.Message{service.NewMessage([]byte("small")), encoded}, compress)
+		Expect(kept).To(HaveLen(2))
+		Expect(body(kept[0])).To(Equal("small"))
+		_, ok := kept[0].MetaGet(compiler.ContentEncodingHeader)
+		Expect(ok).To(BeFalse())
+		Expect(body(kept[1])).To(Equal("already compressed"))
+	})
+
+	It("should drop the payloads which cannot be decompressed and keep the other encodings", func() {
+		decompress := compile(compiler.Transformer{Decompress: &compiler.DecompressTransformer{Algorithms: []string{"gzip"}}})
+
+		corrupt := service.NewMessage([]byte("not gzip"))
+		corrupt.MetaSetMut(compiler.ContentEncodingHeader, "gzip")
+		other := service.NewMessage([]byte("zstd payload"))
+		other.MetaSetMut(compiler.ContentEncodingHeader, "zstd")
+
+		kept := run([]*service.Message{corrupt, other, service.NewMessage([]byte("plain"))}, decompress)
+		Expect(kept).To(HaveLen(2))
+		Expect(body(kept[0])).To(Equal("zstd payload"))
+		Expect(body(kept[1])).To(Equal("plain"))
+	})
+
+	It("should reject the messages which cannot be compressed rather than drop them", func() {
+		compress := compile(compiler.Transformer{Compress: &compiler.CompressTransformer{Algorithm: "gzip"}})
+		Expect(compress).NotTo(ContainSubstring("deleted()"))
+
+		artifact, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+		var m map[string]any
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		Expect(gabs.Wrap(m).Path("output.reject_errored.nats.subject").Data()).To(Equal("foo.bar"))
+
+		compile(compiler.Transformer{Decompress: &compiler.DecompressTransformer{}})
+		artifact, err = compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+		Expect(err).NotTo(HaveOccurred())
+		m = nil
+		Expect(yaml.Unmarshal([]byte(artifact), &m)).To(Succeed())
+		Expect(gabs.Wrap(m).Exists("output", "reject_errored")).To(BeFalse())
+	})
+
+	DescribeTable("should reject invalid transformers",
+		func(t compiler.Transformer) {
+			steps.Transformer = &t
+
+			_, err := compiler.CompileSteps(context.Background(), test.Runtime(), steps)
+			Expect(err).To(HaveOccurred())
+			Expect(compiler.NewErrorReport(err).Code).To(Equal(compiler.CodeInvalidTransformer))
+		},
+		Entry("unknown algorithm", compiler.Transformer{Compress: &compiler.CompressTransformer{Algorithm: "brotli"}}),
+		Entry("level without gzip", compiler.Transformer{Compress: &compiler.CompressTransformer{Algorithm: "zstd", Level: 3}}),
+		Entry("level out of range", compiler.Transformer{Compress: &compiler.CompressTransformer{Algorithm: "gzip", Level: 11}}),
+		Entry("negative minimum size", compiler.Transformer{Compress: &compiler.CompressTransformer{Algorithm: "gzip", MinSize: -1}}),
+		Entry("unknown decompression algorithm", compiler.Transformer{Decompress: &compiler.DecompressTransformer{Algorithms: []string{"brotli"}}}),
+	)
+})
@@ -0,0 +1,457 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	aggregateWindowField     = "window"
+	aggregateSizeField       = "size"
+	aggregateSlideField      = "slide"
+	aggregateCountField      = "count"
+	aggregateGroupByField    = "group_by"
+	aggregateFieldsField     = "fields"
+	aggregateAggregatesField = "aggregates"
+
+	aggregateCheckpointField         = "checkpoint"
+	aggregateCheckpointBucketField   = "bucket"
+	aggregateCheckpointKeyField      = "key"
+	aggregateCheckpointIntervalField = "interval"
+)
+
+// AggregateConfigSpec defines the configuration schema for the aggregate_window buffer.
+var AggregateConfigSpec = service.NewConfigSpec().
+	Beta().
+	Summary("aggregate numeric fields of the messages over time or count windows, per group").
+	Description("Messages are assigned to windows by their arrival time, or closed after a number of messages of a "+
+		"group for count windows. When a window closes, one message is emitted per group, holding the group, the "+
+		"bounds of the window, the number of messages and the aggregates of every field. The values are held in memory "+
+		"until their window closes.\n\n"+
+		"Without a checkpoint, messages are acknowledged as soon as they are buffered and the open windows are lost "+
+		"on restart. With a checkpoint, the open windows are written to a NATS KV key every interval, messages are "+
+		"acknowledged once their window state is written, and the windows are restored on startup.").
+	Fields(
+		service.NewStringEnumField(aggregateWindowField, WindowTumbling, WindowSliding, WindowCount).
+			Description("The type of the windows"),
+		service.NewDurationField(aggregateSizeField).
+			Description("The length of the tumbling and sliding windows").
+			Optional(),
+		service.NewDurationField(aggregateSlideField).
+			Description("The time between the starts of two sliding windows").
+			Optional(),
+		service.NewIntField(aggregateCountField).
+			Description("The number of messages of a group closing a count window").
+			Default(0),
+		service.NewBloblangField(aggregateGroupByField).
+			Description("A Bloblang query computing the group of a message, all the messages belong to one group if unset").
+			Optional(),
+		service.NewStringListField(aggregateFieldsField).
+			Description("The dot separated paths of the numeric fields to aggregate"),
+		service.NewStringListField(aggregateAggregatesField).
+			Description("The aggregates computed for every field, among sum, count, min, max, avg and percentiles such as p95").
+			Default(Aggregates),
+		service.NewObjectField(aggregateCheckpointField,
+			append(connectionFields("The urls of the NATS servers holding the bucket"),
+				service.NewStringField(aggregateCheckpointBucketField).
+					Description("The KV bucket holding the checkpoint, created when it does not exist"),
+				service.NewStringField(aggregateCheckpointKeyField).
+					Description("The key holding the checkpoint, which must be unique to the buffer").
+					Default("aggregate"),
+				service.NewDurationField(aggregateCheckpointIntervalField).
+					Description("How often the open windows are written").
+					Default("1s"),
+			)...,
+		).Description("Where the open windows are checkpointed").Optional(),
+	)
+
+// NewAggregate creates an aggregate_window buffer from the provided configuration, restoring
+// its windows from the checkpoint when one is configured.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the windows, fields, aggregates and checkpoint
+//   - mgr: Resources providing the logger of the buffer
+//
+// Returns:
+//   - A configured Aggregate instance
+//   - An error if the configuration is invalid or the checkpoint could not be restored
+func NewAggregate(conf *service.ParsedConfig, mgr *service.Resources) (*Aggregate, error) {
+	var spec WindowSpec
+	var err error
+
+	if spec.Type, err = conf.FieldString(aggregateWindowField); err != nil {
+		return nil, fmt.Errorf("failed to get window field: %w", err)
+	}
+	if conf.Contains(aggregateSizeField) {
+		if spec.Size, err = conf.FieldDuration(aggregateSizeField); err != nil {
+			return nil, fmt.Errorf("failed to get size field: %w", err)
+		}
+	}
+	if conf.Contains(aggregateSlideField) {
+		if spec.Slide, err = conf.FieldDuration(aggregateSlideField); err != nil {
+			return nil, fmt.Errorf("failed to get slide field: %w", err)
+		}
+	}
+	if spec.Count, err = conf.FieldInt(aggregateCountField); err != nil {
+		return nil, fmt.Errorf("failed to get count field: %w", err)
+	}
+	if spec.Fields, err = conf.FieldStringList(aggregateFieldsField); err != nil {
+		return nil, fmt.Errorf("failed to get fields field: %w", err)
+	}
+	if spec.Aggregates, err = conf.FieldStringList(aggregateAggregatesField); err != nil {
+		return nil, fmt.Errorf("failed to get aggregates field: %w", err)
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	a := &Aggregate{
+		windows:  newWindows(spec),
+		inflight: map[uint64][]byte{},
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		log:      mgr.Logger(),
+	}
+
+	if conf.Contains(aggregateGroupByField) {
+		if a.groupBy, err = conf.FieldBloblang(aggregateGroupByField); err != nil {
+			return nil, fmt.Errorf("failed to get group_by field: %w", err)
+		}
+	}
+
+	if conf.Contains(aggregateCheckpointField) {
+		if err := a.openCheckpoint(conf.Namespace(aggregateCheckpointField)); err != nil {
+			return nil, err
+		}
+
+		a.wg.Add(1)
+		go a.checkpointLoop()
+	}
+
+	return a, nil
+}
+
+// Aggregate is a buffer aggregating the messages into windows, emitting the aggregates of
+// every group of a window once it closes.
+type Aggregate struct {
+	mu       sync.Mutex
+	windows  *windows
+	ready    [][]byte
+	inflight map[uint64][]byte
+	nextID   uint64
+	ended    bool
+	notify   chan struct{}
+
+	groupBy *bloblang.Executor
+	log     *service.Logger
+
+	// The checkpoint, when configured
+	nc       *nats.Conn
+	kv       jetstream.KeyValue
+	key      string
+	interval time.Duration
+	pending  []service.AckFunc
+	dirty    bool
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// aggregateCheckpoint is the state of the buffer written to the checkpoint. The aggregates
+// emitted but not acknowledged yet are part of the ready ones.
+type aggregateCheckpoint struct {
+	Windows *windows `json:"windows"`
+	Ready   [][]byte `json:"ready,omitempty"`
+}
+
+// openCheckpoint connects to the bucket of the checkpoint, creating it when it does not exist,
+// and restores the windows it holds.
+func (a *Aggregate) openCheckpoint(conf *service.ParsedConfig) error {
+	urls, jwt, seed, err := connectionFromConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	bucket, err := conf.FieldString(aggregateCheckpointBucketField)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket field: %w", err)
+	}
+	if a.key, err = conf.FieldString(aggregateCheckpointKeyField); err != nil {
+		return fmt.Errorf("failed to get key field: %w", err)
+	}
+	if !validRateLimitKey.MatchString(a.key) {
+		return fmt.Errorf("invalid checkpoint key %q", a.key)
+	}
+	if a.interval, err = conf.FieldDuration(aggregateCheckpointIntervalField); err != nil {
+		return fmt.Errorf("failed to get interval field: %w", err)
+	}
+	if a.interval <= 0 {
+		return errors.New("the checkpoint interval must be positive")
+	}
+
+	if a.nc, err = connect("Aggregate", urls, jwt, seed); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	js, err := jetstream.New(a.nc)
+	if err != nil {
+		a.nc.Close()
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	a.kv, err = js.KeyValue(ctx, bucket)
+	if errors.Is(err, jetstream.ErrBucketNotFound) {
+		a.kv, err = js.CreateKeyValue(ctx, jetstream.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "Open windows of aggregating connectors",
+		})
+	}
+	if err != nil {
+		a.nc.Close()
+		return fmt.Errorf("failed to open kv bucket %s: %w", bucket, err)
+	}
+
+	entry, err := a.kv.Get(ctx, a.key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		a.nc.Close()
+		return fmt.Errorf("failed to read checkpoint %s: %w", a.key, err)
+	}
+
+	state := aggregateCheckpoint{Windows: a.windows}
+	if err := json.Unmarshal(entry.Value(), &state); err != nil {
+		a.nc.Close()
+		return fmt.Errorf("failed to restore checkpoint %s: %w", a.key, err)
+	}
+	a.ready = state.Ready
+
+	return nil
+}
+
+func (a *Aggregate) WriteBatch(_ context.Context, batch service.MessageBatch, ack service.AckFunc) error {
+	type entry struct {
+		group  string
+		values map[string]float64
+	}
+
+	// The whole batch is read before adding it so that a failing message rejects it untouched
+	entries := make([]entry, 0, len(batch))
+	for _, msg := range batch {
+		var e entry
+		if a.groupBy != nil {
+			res, err := msg.BloblangQuery(a.groupBy)
+			if err != nil {
+				return fmt.Errorf("failed to compute the group: %w", err)
+			}
+			group, err := res.AsBytes()
+			if err != nil {
+				return fmt.Errorf("failed to compute the group: %w", err)
+			}
+			e.group = string(group)
+		}
+
+		e.values = map[string]float64{}
+		if root, err := msg.AsStructured(); err == nil {
+			payload := gabs.Wrap(root)
+			for _, field := range a.windows.spec.Fields {
+				if v, ok := toFloat(payload.Path(field).Data()); ok {
+					e.values[field] = v
+				}
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	now := time.Now()
+	a.mu.Lock()
+	for _, e := range entries {
+		a.ready = append(a.ready, a.windows.add(now, e.group, e.values)...)
+	}
+	a.dirty = true
+	if a.kv != nil {
+		a.pending = append(a.pending, ack)
+	}
+	a.mu.Unlock()
+	a.signal()
+
+	if a.kv == nil {
+		return ack(context.Background(), nil)
+	}
+	return nil
+}
+
+func (a *Aggregate) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	for {
+		a.mu.Lock()
+		if closed := a.windows.close(time.Now(), false); len(closed) > 0 {
+			a.ready = append(a.ready, closed...)
+			a.dirty = true
+		}
+		if a.ended && len(a.ready) == 0 && !a.windows.empty() {
+			a.ready = a.windows.close(time.Now(), true)
+			a.dirty = true
+		}
+
+		if len(a.ready) > 0 {
+			b := a.ready[0]
+			a.ready = a.ready[1:]
+			id := a.nextID
+			a.nextID++
+			a.inflight[id] = b
+			a.mu.Unlock()
+
+			return service.MessageBatch{service.NewMessage(b)}, func(_ context.Context, err error) error {
+				a.mu.Lock()
+				delete(a.inflight, id)
+				if err != nil {
+					a.ready = append([][]byte{b}, a.ready...)
+				}
+				a.dirty = true
+				a.mu.Unlock()
+				a.signal()
+				return nil
+			}, nil
+		}
+
+		if a.ended {
+			a.mu.Unlock()
+			return nil, nil, service.ErrEndOfBuffer
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if next, ok := a.windows.next(); ok {
+			timer = time.NewTimer(time.Until(next))
+			timeout = timer.C
+		}
+		a.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-a.notify:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// signal wakes up ReadBatch when it waits for the next window to close.
+func (a *Aggregate) signal() {
+	select {
+	case a.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (a *Aggregate) EndOfInput() {
+	a.mu.Lock()
+	a.ended = true
+	a.mu.Unlock()
+	a.signal()
+}
+
+// checkpointLoop writes the checkpoint every interval until the buffer is closed.
+func (a *Aggregate) checkpointLoop() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			if err := a.checkpoint(context.Background()); err != nil {
+				a.log.Warnf("Failed to write the aggregation checkpoint, retrying: %v", err)
+			}
+		}
+	}
+}
+
+// checkpoint writes the open windows and the aggregates not acknowledged yet when they changed,
+// then acknowledges the messages they hold.
+func (a *Aggregate) checkpoint(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.dirty {
+		a.mu.Unlock()
+		return nil
+	}
+
+	state := aggregateCheckpoint{Windows: a.windows, Ready: append([][]byte{}, a.ready...)}
+	for _, b := range a.inflight {
+		state.Ready = append(state.Ready, b)
+	}
+	data, err := json.Marshal(state)
+	acks := a.pending
+	a.pending = nil
+	a.dirty = false
+	a.mu.Unlock()
+
+	if err == nil {
+		_, err = a.kv.Put(ctx, a.key, data)
+	}
+	if err != nil {
+		a.mu.Lock()
+		a.pending = append(acks, a.pending...)
+		a.dirty = true
+		a.mu.Unlock()
+		return err
+	}
+
+	for _, ack := range acks {
+		_ = ack(ctx, nil)
+	}
+	return nil
+}
+
+func (a *Aggregate) Close(ctx context.Context) error {
+	if a.kv == nil {
+		return nil
+	}
+
+	close(a.done)
+	a.wg.Wait()
+
+	err := a.checkpoint(ctx)
+	a.nc.Close()
+	return err
+}
+
+// toFloat converts a numeric JSON value to a float.
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
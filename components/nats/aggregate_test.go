@@ -0,0 +1,192 @@
+package nats_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("Aggregate", func() {
+	aggregate := func(yaml string) *nats.Aggregate {
+		conf, err := nats.AggregateConfigSpec.ParseYAML(yaml, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		a, err := nats.NewAggregate(conf, service.MockResources())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(a.Close, context.Background())
+		return a
+	}
+
+	write := func(a *nats.Aggregate, bodies ...string) *atomic.Int32 {
+		var acked atomic.Int32
+		var batch service.MessageBatch
+		for _, body := range bodies {
+			batch = append(batch, service.NewMessage([]byte(body)))
+		}
+
+		Expect(a.WriteBatch(context.Background(), batch, func(_ context.Context, err error) error {
+			Expect(err).NotTo(HaveOccurred())
+			acked.Add(1)
+			return nil
+		})).To(Succeed())
+		return &acked
+	}
+
+	read := func(a *nats.Aggregate) map[string]any {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		batch, ack, err := a.ReadBatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(batch).To(HaveLen(1))
+		Expect(ack(ctx, nil)).To(Succeed())
+
+		b, err := batch[0].AsBytes()
+		Expect(err).NotTo(HaveOccurred())
+		var result map[string]any
+		Expect(json.Unmarshal(b, &result)).To(Succeed())
+		return result
+	}
+
+	It("should aggregate count windows per group", func() {
+		a := aggregate(`
+window: count
+count: 3
+group_by: this.host
+fields: [latency]
+aggregates: [sum, count, min, max, avg, p50]
+`)
+
+		acked := write(a, `{"host": "a", "latency": 30}`, `{"host": "b", "latency": 5}`, `{"host": "a", "latency": 10}`, `{"host": "a", "latency": 20}`)
+		Expect(acked.Load()).To(Equal(int32(1)))
+
+		result := read(a)
+		Expect(result).To(HaveKeyWithValue("group", "a"))
+		Expect(result).To(HaveKeyWithValue("count", 3.0))
+		Expect(result["fields"]).To(Equal(map[string]any{
+			"latency": map[string]any{"sum": 60.0, "count": 3.0, "min": 10.0, "max": 30.0, "avg": 20.0, "p50": 20.0},
+		}))
+
+		a.EndOfInput()
+		result = read(a)
+		Expect(result).To(HaveKeyWithValue("group", "b"))
+		Expect(result).To(HaveKeyWithValue("count", 1.0))
+
+		_, _, err := a.ReadBatch(context.Background())
+		Expect(err).To(MatchError(service.ErrEndOfBuffer))
+	})
+
+	It("should emit tumbling windows once they end", func() {
+		a := aggregate(`
+window: tumbling
+size: 200ms
+fields: [value, missing]
+aggregates: [sum, count]
+`)
+
+		write(a, `{"value": 1}`, `{"value": 2}`, `not json`)
+
+		result := read(a)
+		Expect(result).To(HaveKeyWithValue("group", ""))
+		Expect(result).To(HaveKeyWithValue("count", 3.0))
+		Expect(result["fields"]).To(Equal(map[string]any{
+			"value":   map[string]any{"sum": 3.0, "count": 2.0},
+			"missing": map[string]any{"count": 0.0},
+		}))
+
+		start, err := time.Parse(time.RFC3339Nano, result["window_start"].(string))
+		Expect(err).NotTo(HaveOccurred())
+		end, err := time.Parse(time.RFC3339Nano, result["window_end"].(string))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(end.Sub(start)).To(Equal(200 * time.Millisecond))
+	})
+
+	It("should count a message in every sliding window it falls in", func() {
+		a := aggregate(`
+window: sliding
+size: 1h
+slide: 20m
+fields: [value]
+`)
+
+		write(a, `{"value": 1}`)
+		a.EndOfInput()
+
+		for range 3 {
+			Expect(read(a)).To(HaveKeyWithValue("count", 1.0))
+		}
+		_, _, err := a.ReadBatch(context.Background())
+		Expect(err).To(MatchError(service.ErrEndOfBuffer))
+	})
+
+	DescribeTable("should reject invalid windows",
+		func(yaml string) {
+			conf, err := nats.AggregateConfigSpec.ParseYAML(yaml, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = nats.NewAggregate(conf, service.MockResources())
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("tumbling without size", "window: tumbling\nfields: [v]\n"),
+		Entry("slide longer than size", "window: sliding\nsize: 1s\nslide: 2s\nfields: [v]\n"),
+		Entry("count without count", "window: count\nfields: [v]\n"),
+		Entry("no fields", "window: count\ncount: 2\nfields: []\n"),
+		Entry("unknown aggregate", "window: count\ncount: 2\nfields: [v]\naggregates: [median]\n"),
+	)
+
+	Context("with a checkpoint", func() {
+		var jsSrv *server.Server
+		var yaml string
+
+		BeforeEach(func() {
+			opts := test.DefaultTestOptions
+			opts.Port = -1
+			opts.JetStream = true
+			opts.StoreDir = GinkgoT().TempDir()
+			jsSrv = test.RunServer(&opts)
+			DeferCleanup(jsSrv.Shutdown)
+
+			yaml = fmt.Sprintf(`
+window: tumbling
+size: 1h
+fields: [value]
+aggregates: [sum]
+checkpoint:
+  urls: [%s]
+  bucket: aggregate_%s
+  key: my.connector
+  interval: 50ms
+`, jsSrv.ClientURL(), nuid.Next())
+		})
+
+		It("should acknowledge the messages once checkpointed and restore the windows", func() {
+			conf, err := nats.AggregateConfigSpec.ParseYAML(yaml, nil)
+			Expect(err).NotTo(HaveOccurred())
+			a, err := nats.NewAggregate(conf, service.MockResources())
+			Expect(err).NotTo(HaveOccurred())
+
+			acked := write(a, `{"value": 1}`, `{"value": 2}`)
+			Eventually(acked.Load).Should(Equal(int32(1)))
+			Expect(a.Close(context.Background())).To(Succeed())
+
+			restored := aggregate(yaml)
+			write(restored, `{"value": 3}`)
+			restored.EndOfInput()
+
+			result := read(restored)
+			Expect(result).To(HaveKeyWithValue("count", 3.0))
+			Expect(result["fields"]).To(Equal(map[string]any{"value": map[string]any{"sum": 6.0}}))
+		})
+	})
+})
@@ -0,0 +1,298 @@
+package nats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	// ClaimCheckBucketHeader is the metadata key holding the object store bucket of an offloaded payload
+	ClaimCheckBucketHeader = "Connect-Claim-Check-Bucket"
+	// ClaimCheckObjectHeader is the metadata key holding the object name of an offloaded payload
+	ClaimCheckObjectHeader = "Connect-Claim-Check-Object"
+	// ClaimCheckSizeHeader is the metadata key holding the size in bytes of an offloaded payload
+	ClaimCheckSizeHeader = "Connect-Claim-Check-Size"
+	// ClaimCheckDigestHeader is the metadata key holding the SHA-256 digest of an offloaded payload
+	ClaimCheckDigestHeader = "Connect-Claim-Check-Digest"
+
+	// MissingPayloadError prefixes the errors of the references whose object no longer exists in
+	// the bucket, as opposed to the objects which could not be read
+	MissingPayloadError = "missing payload"
+
+	claimCheckBucketField    = "bucket"
+	claimCheckThresholdField = "threshold"
+	claimCheckTTLField       = "ttl"
+
+	// claimCheckHeadroom is the room left for the headers and the reference under the max payload
+	// of the server when the threshold is not set
+	claimCheckHeadroom = 64 * 1024
+)
+
+// OffloadConfigSpec defines the configuration schema for the nats_object_offload processor.
+var OffloadConfigSpec = service.NewConfigSpec().
+	Beta().
+	Summary("offload large payloads to a NATS object store, replacing them with a reference").
+	Description("Payloads larger than the threshold are written to the bucket under a unique name, and replaced by a "+
+		"JSON reference holding the bucket, object name, size and digest of the payload, which are also set in the "+
+		"Connect-Claim-Check headers. The nats_object_rehydrate processor restores the payload. The bucket is created "+
+		"when it does not exist.").
+	Fields(connectionFields("The urls of the NATS servers holding the bucket")...).
+	Fields(
+		service.NewStringField(claimCheckBucketField).
+			Description("The object store bucket receiving the payloads"),
+		service.NewIntField(claimCheckThresholdField).
+			Description("The size in bytes above which payloads are offloaded, the max payload of the server less 64KiB if 0").
+			Default(0),
+		service.NewDurationField(claimCheckTTLField).
+			Description("How long the payloads are kept when creating the bucket, forever if 0s").
+			Default("0s"),
+	)
+
+// RehydrateConfigSpec defines the configuration schema for the nats_object_rehydrate processor.
+var RehydrateConfigSpec = service.NewConfigSpec().
+	Beta().
+	Summary("restore the payloads offloaded to a NATS object store by nats_object_offload").
+	Description("Messages carrying the Connect-Claim-Check headers have their payload replaced by the object they " +
+		"reference, once its size and digest are checked, and the headers removed. Other messages are left as they are. " +
+		"The errors of the references whose object no longer exists start with \"missing payload\".").
+	Fields(connectionFields("The urls of the NATS servers holding the buckets")...)
+
+// claimCheckReference is the payload replacing an offloaded payload.
+type claimCheckReference struct {
+	Bucket string `json:"bucket"`
+	Object string `json:"object"`
+	Size   uint64 `json:"size"`
+	Digest string `json:"digest"`
+}
+
+// NewOffload creates a nats_object_offload processor from the provided configuration, connecting
+// to NATS and opening or creating its bucket.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the connection, bucket and threshold
+//
+// Returns:
+//   - A configured Offload instance
+//   - An error if the configuration is invalid or the bucket could not be opened
+func NewOffload(conf *service.ParsedConfig) (*Offload, error) {
+	urls, jwt, seed, err := connectionFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Offload{}
+	if o.bucket, err = conf.FieldString(claimCheckBucketField); err != nil {
+		return nil, fmt.Errorf("failed to get bucket field: %w", err)
+	}
+	if o.threshold, err = conf.FieldInt(claimCheckThresholdField); err != nil {
+		return nil, fmt.Errorf("failed to get threshold field: %w", err)
+	}
+	if o.threshold < 0 {
+		return nil, errors.New("the offload threshold cannot be negative")
+	}
+	ttl, err := conf.FieldDuration(claimCheckTTLField)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ttl field: %w", err)
+	}
+
+	if o.nc, err = connect("Offload", urls, jwt, seed); err != nil {
+		return nil, err
+	}
+
+	if o.threshold == 0 {
+		o.threshold = max(int(o.nc.MaxPayload())-claimCheckHeadroom, 1)
+	}
+
+	if o.store, err = openOffloadBucket(context.Background(), o.nc, o.bucket, ttl); err != nil {
+		o.nc.Close()
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// openOffloadBucket opens the object store receiving the payloads, creating it with the TTL
+// when it does not exist yet.
+func openOffloadBucket(ctx context.Context, nc *nats.Conn, bucket string, ttl time.Duration) (jetstream.ObjectStore, error) {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	store, err := js.ObjectStore(ctx, bucket)
+	if errors.Is(err, jetstream.ErrBucketNotFound) {
+		store, err = js.CreateObjectStore(ctx, jetstream.ObjectStoreConfig{
+			Bucket:      bucket,
+			Description: "Payloads offloaded by connectors",
+			TTL:         ttl,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object store %s: %w", bucket, err)
+	}
+
+	return store, nil
+}
+
+// Offload is a processor writing large payloads to a NATS object store and replacing them
+// with a reference.
+type Offload struct {
+	nc        *nats.Conn
+	store     jetstream.ObjectStore
+	bucket    string
+	threshold int
+}
+
+func (o *Offload) Process(ctx context.Context, msg *service.Message) (service.MessageBatch, error) {
+	payload, err := msg.AsBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) <= o.threshold {
+		return service.MessageBatch{msg}, nil
+	}
+
+	info, err := o.store.Put(ctx, jetstream.ObjectMeta{Name: nuid.Next()}, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to offload payload to object store %s: %w", o.bucket, err)
+	}
+
+	ref := claimCheckReference{Bucket: o.bucket, Object: info.Name, Size: info.Size, Digest: info.Digest}
+	b, err := json.Marshal(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.SetBytes(b)
+	msg.MetaSetMut(ClaimCheckBucketHeader, ref.Bucket)
+	msg.MetaSetMut(ClaimCheckObjectHeader, ref.Object)
+	msg.MetaSetMut(ClaimCheckSizeHeader, strconv.FormatUint(ref.Size, 10))
+	msg.MetaSetMut(ClaimCheckDigestHeader, ref.Digest)
+	return service.MessageBatch{msg}, nil
+}
+
+func (o *Offload) Close(_ context.Context) error {
+	o.nc.Close()
+	return nil
+}
+
+// NewRehydrate creates a nats_object_rehydrate processor from the provided configuration,
+// connecting to NATS. The buckets are opened as the messages reference them.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the connection
+//
+// Returns:
+//   - A configured Rehydrate instance
+//   - An error if the configuration is invalid or the connection failed
+func NewRehydrate(conf *service.ParsedConfig) (*Rehydrate, error) {
+	urls, jwt, seed, err := connectionFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	nc, err := connect("Rehydrate", urls, jwt, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	return &Rehydrate{nc: nc, js: js, stores: map[string]jetstream.ObjectStore{}}, nil
+}
+
+// Rehydrate is a processor restoring the payloads offloaded by an Offload processor.
+type Rehydrate struct {
+	nc *nats.Conn
+	js jetstream.JetStream
+
+	mu     sync.Mutex
+	stores map[string]jetstream.ObjectStore
+}
+
+func (r *Rehydrate) Process(ctx context.Context, msg *service.Message) (service.MessageBatch, error) {
+	object, ok := msg.MetaGet(ClaimCheckObjectHeader)
+	if !ok {
+		return service.MessageBatch{msg}, nil
+	}
+
+	bucket, _ := msg.MetaGet(ClaimCheckBucketHeader)
+	size, _ := msg.MetaGet(ClaimCheckSizeHeader)
+	digest, _ := msg.MetaGet(ClaimCheckDigestHeader)
+
+	store, err := r.store(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	// The object store checks the digest of the object while reading it, and the headers
+	// ensure the object is still the one that was offloaded
+	res, err := store.Get(ctx, object)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return nil, fmt.Errorf("%s: offloaded payload %s is not in object store %s", MissingPayloadError, object, bucket)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offloaded payload %s from object store %s: %w", object, bucket, err)
+	}
+	defer res.Close()
+
+	info, err := res.Info()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offloaded payload %s from object store %s: %w", object, bucket, err)
+	}
+	if info.Digest != digest {
+		return nil, fmt.Errorf("offloaded payload %s does not match its digest", object)
+	}
+	payload, err := io.ReadAll(res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offloaded payload %s from object store %s: %w", object, bucket, err)
+	}
+	if strconv.Itoa(len(payload)) != size {
+		return nil, fmt.Errorf("offloaded payload %s is %d bytes long instead of %s", object, len(payload), size)
+	}
+
+	msg.SetBytes(payload)
+	for _, h := range []string{ClaimCheckBucketHeader, ClaimCheckObjectHeader, ClaimCheckSizeHeader, ClaimCheckDigestHeader} {
+		msg.MetaDelete(h)
+	}
+	return service.MessageBatch{msg}, nil
+}
+
+// store returns the object store of a bucket, opening it on first use.
+func (r *Rehydrate) store(ctx context.Context, bucket string) (jetstream.ObjectStore, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if store, ok := r.stores[bucket]; ok {
+		return store, nil
+	}
+
+	store, err := r.js.ObjectStore(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object store %s: %w", bucket, err)
+	}
+	r.stores[bucket] = store
+	return store, nil
+}
+
+func (r *Rehydrate) Close(_ context.Context) error {
+	r.nc.Close()
+	return nil
+}
@@ -0,0 +1,160 @@
+package nats_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("Claim check", func() {
+	var jsSrv *server.Server
+	var js jetstream.JetStream
+	var bucket string
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+		jsSrv = test.RunServer(&opts)
+
+		nc, err := nats2.Connect(jsSrv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			jsSrv.Shutdown()
+		})
+
+		js, err = jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+
+		bucket = "offload_" + nuid.Next()
+	})
+
+	offload := func(extra string) *nats.Offload {
+		conf, err := nats.OffloadConfigSpec.ParseYAML(fmt.Sprintf("urls: [%s]\nbucket: %s\n%s", jsSrv.ClientURL(), bucket, extra), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		o, err := nats.NewOffload(conf)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(o.Close, context.Background())
+		return o
+	}
+
+	rehydrate := func() *nats.Rehydrate {
+		conf, err := nats.RehydrateConfigSpec.ParseYAML(fmt.Sprintf("urls: [%s]\n", jsSrv.ClientURL()), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		r, err := nats.NewRehydrate(conf)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.Close, context.Background())
+		return r
+	}
+
+	process := func(p service.Processor, msg *service.Message) *service.Message {
+		batch, err := p.Process(context.Background(), msg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(batch).To(HaveLen(1))
+		return batch[0]
+	}
+
+	It("should offload payloads over the max payload and restore them", func() {
+		payload := make([]byte, 3*1024*1024)
+		_, err := rand.Read(payload)
+		Expect(err).NotTo(HaveOccurred())
+
+		msg := service.NewMessage(payload)
+		msg.MetaSetMut("X-Origin", "sensor")
+		ref := process(offload(""), msg)
+
+		b, err := ref.AsBytes()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(b)).To(BeNumerically("<", 1024))
+
+		var reference map[string]any
+		Expect(json.Unmarshal(b, &reference)).To(Succeed())
+		Expect(reference).To(HaveKeyWithValue("bucket", bucket))
+		Expect(reference).To(HaveKeyWithValue("size", float64(len(payload))))
+
+		object, _ := ref.MetaGet(nats.ClaimCheckObjectHeader)
+		Expect(object).To(Equal(reference["object"]))
+		size, _ := ref.MetaGet(nats.ClaimCheckSizeHeader)
+		Expect(size).To(Equal(fmt.Sprint(len(payload))))
+		digest, _ := ref.MetaGet(nats.ClaimCheckDigestHeader)
+		Expect(digest).To(HavePrefix("SHA-256="))
+
+		restored := process(rehydrate(), ref)
+		b, err = restored.AsBytes()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(b, payload)).To(BeTrue())
+		_, ok := restored.MetaGet(nats.ClaimCheckObjectHeader)
+		Expect(ok).To(BeFalse())
+		origin, _ := restored.MetaGet("X-Origin")
+		Expect(origin).To(Equal("sensor"))
+	})
+
+	It("should leave the payloads under the threshold and messages without reference alone", func() {
+		msg := process(offload("threshold: 16\n"), service.NewMessage([]byte("small payload")))
+		b, err := msg.AsBytes()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(Equal("small payload"))
+		_, ok := msg.MetaGet(nats.ClaimCheckObjectHeader)
+		Expect(ok).To(BeFalse())
+
+		msg = process(rehydrate(), msg)
+		b, err = msg.AsBytes()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(Equal("small payload"))
+	})
+
+	It("should create the bucket with the ttl", func() {
+		offload("ttl: 1h\n")
+
+		store, err := js.ObjectStore(context.Background(), bucket)
+		Expect(err).NotTo(HaveOccurred())
+		status, err := store.Status(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.TTL()).To(Equal(time.Hour))
+	})
+
+	It("should fail the references which do not match their object", func() {
+		ref := process(offload("threshold: 4\n"), service.NewMessage([]byte("offloaded payload")))
+		r := rehydrate()
+
+		tampered := ref.Copy()
+		tampered.MetaSetMut(nats.ClaimCheckDigestHeader, "SHA-256=invalid")
+		_, err := r.Process(context.Background(), tampered)
+		Expect(err).To(MatchError(ContainSubstring("digest")))
+
+		missing := ref.Copy()
+		missing.MetaSetMut(nats.ClaimCheckObjectHeader, "missing")
+		_, err = r.Process(context.Background(), missing)
+		Expect(err).To(MatchError(HavePrefix(nats.MissingPayloadError)))
+	})
+
+	It("should report the objects which no longer exist as missing payloads", func() {
+		ref := process(offload("threshold: 4\n"), service.NewMessage([]byte("offloaded payload")))
+		object, _ := ref.MetaGet(nats.ClaimCheckObjectHeader)
+
+		store, err := js.ObjectStore(context.Background(), bucket)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Delete(context.Background(), object)).To(Succeed())
+
+		_, err = rehydrate().Process(context.Background(), ref)
+		Expect(err).To(MatchError(HavePrefix(nats.MissingPayloadError)))
+	})
+})
@@ -0,0 +1,153 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// SchemaFormatProtobuf identifies schemas written as Protobuf definitions
+const SchemaFormatProtobuf = "protobuf"
+
+// SchemaCodec converts JSON payloads to the encoding described by a schema and back.
+type SchemaCodec interface {
+	// Encode converts a JSON payload to the encoding of the schema
+	Encode(payload []byte) ([]byte, error)
+	// Decode converts a payload in the encoding of the schema to JSON
+	Decode(payload []byte) ([]byte, error)
+}
+
+// NewSchemaCodec compiles a schema document into a codec.
+//
+// Parameters:
+//   - format: The format of the schema, SchemaFormatAvro, SchemaFormatProtobuf or SchemaFormatJSONSchema
+//   - doc: The schema document
+//   - message: The fully qualified name of the Protobuf message, which may be omitted when the
+//     definition holds a single message
+//
+// Returns:
+//   - The codec
+//   - An error if the schema does not compile
+func NewSchemaCodec(format string, doc []byte, message string) (SchemaCodec, error) {
+	switch format {
+	case SchemaFormatAvro:
+		c, err := goavro.NewCodecForStandardJSONFull(string(doc))
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile Avro schema: %w", err)
+		}
+		return avroCodec{c}, nil
+	case SchemaFormatProtobuf:
+		md, err := compileProtobuf(doc, message)
+		if err != nil {
+			return nil, err
+		}
+		return protobufCodec{md}, nil
+	case SchemaFormatJSONSchema:
+		s, err := compileSchema(format, doc)
+		if err != nil {
+			return nil, err
+		}
+		return jsonSchemaCodec{s}, nil
+	default:
+		return nil, fmt.Errorf("unknown schema format %q, expected %s, %s or %s", format, SchemaFormatAvro, SchemaFormatProtobuf, SchemaFormatJSONSchema)
+	}
+}
+
+// avroCodec converts between JSON and Avro binary encoded payloads.
+type avroCodec struct {
+	codec *goavro.Codec
+}
+
+func (c avroCodec) Encode(payload []byte) ([]byte, error) {
+	native, _, err := c.codec.NativeFromTextual(payload)
+	if err != nil {
+		return nil, fmt.Errorf("payload does not match the schema: %w", err)
+	}
+	return c.codec.BinaryFromNative(nil, native)
+}
+
+func (c avroCodec) Decode(payload []byte) ([]byte, error) {
+	native, rest, err := c.codec.NativeFromBinary(payload)
+	if err != nil {
+		return nil, fmt.Errorf("payload does not match the schema: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("payload does not match the schema: %d trailing bytes", len(rest))
+	}
+	return c.codec.TextualFromNative(nil, native)
+}
+
+// protobufCodec converts between JSON and Protobuf binary encoded payloads.
+type protobufCodec struct {
+	message protoreflect.MessageDescriptor
+}
+
+func (c protobufCodec) Encode(payload []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(c.message)
+	if err := protojson.Unmarshal(payload, msg); err != nil {
+		return nil, fmt.Errorf("payload does not match the schema: %w", err)
+	}
+	return proto.Marshal(msg)
+}
+
+func (c protobufCodec) Decode(payload []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(c.message)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return nil, fmt.Errorf("payload does not match the schema: %w", err)
+	}
+	return protojson.Marshal(msg)
+}
+
+// compileProtobuf compiles a Protobuf definition, which may import the well-known types,
+// and returns the descriptor of the given message.
+func compileProtobuf(doc []byte, message string) (protoreflect.MessageDescriptor, error) {
+	const file = "schema.proto"
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{file: string(doc)}),
+		}),
+	}
+
+	files, err := compiler.Compile(context.Background(), file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile Protobuf schema: %w", err)
+	}
+
+	fd := files[0]
+	if message == "" {
+		if fd.Messages().Len() != 1 {
+			return nil, fmt.Errorf("the Protobuf schema defines %d messages, the message to use must be named", fd.Messages().Len())
+		}
+		return fd.Messages().Get(0), nil
+	}
+
+	d := fd.FindDescriptorByName(protoreflect.FullName(message))
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("the Protobuf schema does not define message %s", message)
+	}
+	return md, nil
+}
+
+// jsonSchemaCodec checks JSON payloads against a JSON Schema, leaving them unchanged.
+type jsonSchemaCodec struct {
+	schema Schema
+}
+
+func (c jsonSchemaCodec) Encode(payload []byte) ([]byte, error) {
+	if err := c.schema.Validate(payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func (c jsonSchemaCodec) Decode(payload []byte) ([]byte, error) {
+	return c.Encode(payload)
+}
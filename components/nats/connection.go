@@ -1 +1,59 @@
 package nats
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	connectionUrlsField = "urls"
+	connectionAuthField = "auth"
+	connectionJwtField  = "user_jwt"
+	connectionSeedField = "user_nkey_seed"
+)
+
+// connectionFields returns the fields configuring the NATS connection of a component.
+func connectionFields(description string) []*service.ConfigField {
+	return []*service.ConfigField{
+		service.NewStringListField(connectionUrlsField).Description(description).Optional(),
+		service.NewObjectField(connectionAuthField,
+			service.NewStringField(connectionJwtField).Description("The user JWT").Optional(),
+			service.NewStringField(connectionSeedField).Description("The user nkey seed").Optional(),
+		).Description("The credentials of the NATS connection").Optional(),
+	}
+}
+
+// connectionFromConfig reads the urls and credentials of the connectionFields.
+func connectionFromConfig(conf *service.ParsedConfig) (urls []string, jwt, seed string, err error) {
+	if conf.Contains(connectionUrlsField) {
+		if urls, err = conf.FieldStringList(connectionUrlsField); err != nil {
+			return nil, "", "", fmt.Errorf("failed to get urls field: %w", err)
+		}
+	}
+
+	if conf.Contains(connectionAuthField) {
+		auth := conf.Namespace(connectionAuthField)
+		jwt, _ = auth.FieldString(connectionJwtField)
+		seed, _ = auth.FieldString(connectionSeedField)
+	}
+
+	return urls, jwt, seed, nil
+}
+
+// connect opens a named connection to the NATS servers at the given urls, authenticating
+// with the user JWT and nkey seed when both are set.
+func connect(name string, urls []string, jwt, seed string) (*nats.Conn, error) {
+	opts := []nats.Option{nats.Name(name)}
+	if jwt != "" && seed != "" {
+		opts = append(opts, nats.UserJWTAndSeed(jwt, seed))
+	}
+
+	nc, err := nats.Connect(strings.Join(urls, ","), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	return nc, nil
+}
@@ -0,0 +1,259 @@
+package nats
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// DedupeDroppedMetric is the name of the counter incremented for every duplicate dropped by the nats_dedupe processor
+const DedupeDroppedMetric = "dedupe_dropped"
+
+const (
+	dedupeBucketField = "bucket"
+	dedupeKeyField    = "key"
+	dedupeWindowField = "window"
+)
+
+// DedupeConfigSpec defines the configuration schema for the nats_dedupe processor.
+var DedupeConfigSpec = service.NewConfigSpec().
+	Beta().
+	Summary("drop the messages whose key was already seen within a window, using a NATS KV bucket as the seen-set").
+	Description("The first message with a given key is recorded in the bucket and kept; the messages with the same key "+
+		"are dropped until the key expires. The bucket is created with the window as its TTL when it does not exist; "+
+		"an existing bucket must have the window as its TTL. The bucket may be shared by several instances of a connector to deduplicate across them. Messages whose key cannot be "+
+		"recorded are kept.\n\n"+
+		"A key is recorded before the message is delivered. Wrap the output in a nats_dedupe_release output to release the "+
+		"keys of the messages it fails to write, so that their redelivery is not dropped as a duplicate.").
+	Fields(connectionFields("The urls of the NATS servers holding the bucket")...).
+	Fields(
+		service.NewStringField(dedupeBucketField).
+			Description("The KV bucket holding the keys seen within the window"),
+		service.NewBloblangField(dedupeKeyField).
+			Description("A Bloblang query computing the deduplication key of a message"),
+		service.NewDurationField(dedupeWindowField).
+			Description("How long a key is remembered, which must be the TTL of the bucket").
+			Default("5m"),
+	)
+
+// NewDedupe creates a nats_dedupe processor from the provided configuration, connecting to
+// NATS and opening or creating its bucket.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the connection, bucket, key and window
+//   - mgr: Resources providing the logger and metrics of the processor
+//
+// Returns:
+//   - A configured Dedupe instance
+//   - An error if the configuration is invalid or the bucket could not be opened
+func NewDedupe(conf *service.ParsedConfig, mgr *service.Resources) (*Dedupe, error) {
+	urls, jwt, seed, err := connectionFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, err := conf.FieldString(dedupeBucketField)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bucket field: %w", err)
+	}
+
+	key, err := conf.FieldBloblang(dedupeKeyField)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key field: %w", err)
+	}
+
+	window, err := conf.FieldDuration(dedupeWindowField)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get window field: %w", err)
+	}
+
+	nc, err := connect("Dedupe", urls, jwt, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := openDedupeBucket(context.Background(), nc, bucket, window)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	return &Dedupe{
+		nc:      nc,
+		kv:      kv,
+		key:     key,
+		log:     mgr.Logger(),
+		dropped: mgr.Metrics().NewCounter(DedupeDroppedMetric),
+	}, nil
+}
+
+// openDedupeBucket opens the bucket of the seen-set, creating it with the window as its TTL
+// when it does not exist yet. An existing bucket whose TTL differs from the window is rejected.
+func openDedupeBucket(ctx context.Context, nc *nats.Conn, bucket string, window time.Duration) (jetstream.KeyValue, error) {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	kv, err := js.KeyValue(ctx, bucket)
+	if errors.Is(err, jetstream.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(ctx, jetstream.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "Keys seen by a deduplicating connector",
+			TTL:         window,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create kv bucket %s: %w", bucket, err)
+		}
+		return kv, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open kv bucket %s: %w", bucket, err)
+	}
+
+	// The keys expire with the TTL of the bucket, so a bucket created for another window
+	// would silently deduplicate over that window instead
+	status, err := kv.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the status of kv bucket %s: %w", bucket, err)
+	}
+	if status.TTL() != window {
+		return nil, fmt.Errorf("kv bucket %s keeps keys for %s, which does not match the window of %s", bucket, status.TTL(), window)
+	}
+
+	return kv, nil
+}
+
+// Dedupe is a processor dropping the messages whose key is already recorded in a NATS KV bucket.
+type Dedupe struct {
+	nc  *nats.Conn
+	kv  jetstream.KeyValue
+	key *bloblang.Executor
+
+	log     *service.Logger
+	dropped *service.MetricCounter
+}
+
+func (d *Dedupe) Process(ctx context.Context, msg *service.Message) (service.MessageBatch, error) {
+	res, err := msg.BloblangQuery(d.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute the deduplication key: %w", err)
+	}
+
+	key, err := res.AsBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute the deduplication key: %w", err)
+	}
+
+	// Keys are hashed since the result of the query may hold characters KV keys do not allow.
+	// Create only succeeds for the first message with a key, which makes the check atomic
+	// across all the instances sharing the bucket.
+	sum := sha256.Sum256(key)
+	recorded := dedupeRecord{kv: d.kv, key: hex.EncodeToString(sum[:])}
+	recorded.revision, err = d.kv.Create(ctx, recorded.key, nil)
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		d.dropped.Incr(1)
+		return nil, nil
+	}
+	if err != nil {
+		d.log.Warnf("Keeping message whose deduplication key could not be recorded: %v", err)
+		return service.MessageBatch{msg}, nil
+	}
+
+	// the record travels with the message, for a nats_dedupe_release output to release it
+	return service.MessageBatch{msg.WithContext(context.WithValue(msg.Context(), dedupeRecordKey{}, recorded))}, nil
+}
+
+func (d *Dedupe) Close(_ context.Context) error {
+	d.nc.Close()
+	return nil
+}
+
+// dedupeRecordKey is the context key of the dedupeRecord of a message kept by a nats_dedupe processor.
+type dedupeRecordKey struct{}
+
+// dedupeRecord is the key a nats_dedupe processor recorded for a message it kept.
+type dedupeRecord struct {
+	kv       jetstream.KeyValue
+	key      string
+	revision uint64
+}
+
+const dedupeReleaseOutputField = "output"
+
+// DedupeReleaseConfigSpec defines the configuration schema for the nats_dedupe_release output.
+var DedupeReleaseConfigSpec = service.NewConfigSpec().
+	Beta().
+	Categories("Utility").
+	Summary("Writes messages to a child output, releasing the deduplication keys of the messages it fails to write.").
+	Description("A nats_dedupe processor records the key of a message before it is delivered. When the child output "+
+		"fails to write a message, the key recorded for it is deleted before the message is rejected, so that its "+
+		"redelivery is kept rather than dropped as a duplicate. Messages without a recorded key are written as is.").
+	Fields(
+		service.NewOutputField(dedupeReleaseOutputField).
+			Description("The output the messages are written to"),
+		service.NewOutputMaxInFlightField(),
+	)
+
+// NewDedupeRelease creates a nats_dedupe_release output from the provided configuration.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the child output
+//   - mgr: Resources providing the logger of the output
+//
+// Returns:
+//   - A configured DedupeRelease instance
+//   - An error if the child output is invalid
+func NewDedupeRelease(conf *service.ParsedConfig, mgr *service.Resources) (*DedupeRelease, error) {
+	output, err := conf.FieldOutput(dedupeReleaseOutputField)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get output field: %w", err)
+	}
+
+	return &DedupeRelease{
+		output: output,
+		log:    mgr.Logger(),
+	}, nil
+}
+
+// DedupeRelease is an output releasing the deduplication keys of the messages its child output
+// fails to write.
+type DedupeRelease struct {
+	output *service.OwnedOutput
+	log    *service.Logger
+}
+
+func (r *DedupeRelease) Connect(_ context.Context) error {
+	// the child output is started up front, since closing a child which never wrote a message
+	// would otherwise wait for it forever
+	return r.output.Prime()
+}
+
+func (r *DedupeRelease) Write(ctx context.Context, msg *service.Message) error {
+	err := r.output.Write(ctx, msg)
+	if err == nil {
+		return nil
+	}
+
+	if recorded, ok := msg.Context().Value(dedupeRecordKey{}).(dedupeRecord); ok {
+		// the key is released even when the write was cancelled, since the message is redelivered either way
+		rerr := recorded.kv.Delete(context.WithoutCancel(ctx), recorded.key, jetstream.LastRevision(recorded.revision))
+		if rerr != nil {
+			r.log.Warnf("Failed to release the deduplication key of a message which could not be written: %v", rerr)
+		}
+	}
+
+	return err
+}
+
+func (r *DedupeRelease) Close(ctx context.Context) error {
+	return r.output.Close(ctx)
+}
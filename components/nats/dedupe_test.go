@@ -0,0 +1,149 @@
+package nats_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("Dedupe", func() {
+	var jsSrv *server.Server
+	var js jetstream.JetStream
+	var bucket string
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+		jsSrv = test.RunServer(&opts)
+
+		nc, err := nats2.Connect(jsSrv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			jsSrv.Shutdown()
+		})
+
+		js, err = jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+
+		bucket = "dedupe_" + nuid.Next()
+	})
+
+	dedupe := func(window string) *nats.Dedupe {
+		conf, err := nats.DedupeConfigSpec.ParseYAML(fmt.Sprintf("urls: [%s]\nbucket: %s\nkey: this.id\nwindow: %s\n", jsSrv.ClientURL(), bucket, window), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		d, err := nats.NewDedupe(conf, service.MockResources())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(d.Close, context.Background())
+		return d
+	}
+
+	kept := func(d *nats.Dedupe, body string) bool {
+		batch, err := d.Process(context.Background(), service.NewMessage([]byte(body)))
+		Expect(err).NotTo(HaveOccurred())
+		return len(batch) == 1
+	}
+
+	It("should drop the messages whose key was already seen", func() {
+		d := dedupe("1m")
+
+		Expect(kept(d, `{"id": "a"}`)).To(BeTrue())
+		Expect(kept(d, `{"id": "b"}`)).To(BeTrue())
+		Expect(kept(d, `{"id": "a", "retry": true}`)).To(BeFalse())
+		Expect(kept(d, `{"id": "https://example.com/a?b=c"}`)).To(BeTrue())
+		Expect(kept(d, `{"id": "https://example.com/a?b=c"}`)).To(BeFalse())
+	})
+
+	It("should create the bucket with the window as its TTL", func() {
+		dedupe("1m")
+
+		kv, err := js.KeyValue(context.Background(), bucket)
+		Expect(err).NotTo(HaveOccurred())
+		status, err := kv.Status(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.TTL()).To(Equal(time.Minute))
+	})
+
+	It("should reject a bucket whose TTL is not the window", func() {
+		_, err := js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: bucket, TTL: time.Hour})
+		Expect(err).NotTo(HaveOccurred())
+
+		conf, err := nats.DedupeConfigSpec.ParseYAML(fmt.Sprintf("urls: [%s]\nbucket: %s\nkey: this.id\nwindow: 1m\n", jsSrv.ClientURL(), bucket), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = nats.NewDedupe(conf, service.MockResources())
+		Expect(err).To(MatchError(ContainSubstring("does not match the window of 1m0s")))
+	})
+
+	It("should share the seen keys between the instances using the bucket", func() {
+		first, second := dedupe("1m"), dedupe("1m")
+
+		Expect(kept(first, `{"id": "a"}`)).To(BeTrue())
+		Expect(kept(second, `{"id": "a"}`)).To(BeFalse())
+		Expect(kept(second, `{"id": "b"}`)).To(BeTrue())
+		Expect(kept(first, `{"id": "b"}`)).To(BeFalse())
+	})
+
+	It("should keep repeats once the window has passed", func() {
+		d := dedupe("1s")
+
+		Expect(kept(d, `{"id": "a"}`)).To(BeTrue())
+		Eventually(func() bool {
+			return kept(d, `{"id": "a"}`)
+		}, 5*time.Second, 250*time.Millisecond).Should(BeTrue())
+	})
+
+	It("should fail messages whose key cannot be computed", func() {
+		d := dedupe("1m")
+
+		_, err := d.Process(context.Background(), service.NewMessage([]byte(`not json`)))
+		Expect(err).To(MatchError(ContainSubstring("failed to compute the deduplication key")))
+	})
+
+	Describe("release", func() {
+		release := func(output string) *nats.DedupeRelease {
+			conf, err := nats.DedupeReleaseConfigSpec.ParseYAML("output:\n  "+output+"\n", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			r, err := nats.NewDedupeRelease(conf, service.MockResources())
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(r.Close, context.Background())
+			return r
+		}
+
+		write := func(d *nats.Dedupe, r *nats.DedupeRelease, body string) error {
+			batch, err := d.Process(context.Background(), service.NewMessage([]byte(body)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(batch).To(HaveLen(1))
+			return r.Write(context.Background(), batch[0])
+		}
+
+		It("should release the key of a message the output fails to write", func() {
+			d := dedupe("1m")
+
+			Expect(write(d, release(`reject: "unavailable"`), `{"id": "a"}`)).To(MatchError(ContainSubstring("unavailable")))
+			Expect(kept(d, `{"id": "a"}`)).To(BeTrue())
+		})
+
+		It("should keep the key of a message the output writes", func() {
+			d := dedupe("1m")
+
+			Expect(write(d, release("drop: {}"), `{"id": "a"}`)).To(Succeed())
+			Expect(kept(d, `{"id": "a"}`)).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,358 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	// JetStreamDeliverAll delivers all the messages kept by the stream
+	JetStreamDeliverAll = "all"
+	// JetStreamDeliverNew only delivers the messages published after the consumer was created
+	JetStreamDeliverNew = "new"
+
+	jsPullStreamField        = "stream"
+	jsPullSubjectField       = "subject"
+	jsPullDurableField       = "durable"
+	jsPullDeliverField       = "deliver"
+	jsPullAckWaitField       = "ack_wait"
+	jsPullMaxAckPendingField = "max_ack_pending"
+	jsPullBatchField         = "batch"
+	jsPullMaxBytesField      = "max_bytes"
+	jsPullExpiryField        = "expiry"
+	jsPullHeartbeatField     = "heartbeat"
+	jsPullFetchersField      = "fetchers"
+)
+
+// JetStreamPullConfigSpec defines the configuration schema for the nats_jetstream_pull input.
+var JetStreamPullConfigSpec = service.NewConfigSpec().
+	Beta().
+	Categories("Services").
+	Summary("Reads messages from a NATS JetStream pull consumer, fetching them in batches.").
+	Description("Each fetcher keeps pull requests of up to batch messages, and up to max_bytes when set, pending "+
+		"on the consumer, so that the messages are buffered ahead of the pipeline. A pull request waits for "+
+		"messages until its expiry, the server sending heartbeats in the meantime so that stalled requests are "+
+		"detected and replaced. Several fetchers share the consumer to read from it concurrently.\n\n"+
+		"Messages are acknowledged once written by the output, and negatively acknowledged when they fail so "+
+		"that the server delivers them again. Each message carries its headers along with the nats_subject, "+
+		"nats_sequence_stream, nats_sequence_consumer, nats_num_delivered, nats_num_pending, nats_domain and "+
+		"nats_timestamp_unix_nano metadata of the nats_jetstream input.").
+	Fields(connectionFields("A list of URLs to connect to")...).
+	Fields(
+		service.NewStringField(jsPullSubjectField).
+			Description("The subject the consumer reads, which can include wildcards").
+			Example("orders.>"),
+		service.NewStringField(jsPullStreamField).
+			Description("The stream holding the subject, looked up from the subject unless set").
+			Optional(),
+		service.NewStringField(jsPullDurableField).
+			Description("The name of a durable consumer, created or updated on connection, an ephemeral consumer being created unless set").
+			Optional(),
+		service.NewStringEnumField(jsPullDeliverField, JetStreamDeliverAll, JetStreamDeliverNew).
+			Description("Which messages a newly created consumer delivers").
+			Default(JetStreamDeliverAll),
+		service.NewDurationField(jsPullAckWaitField).
+			Description("How long the server waits for the acknowledgement of a message before delivering it again").
+			Default("30s"),
+		service.NewIntField(jsPullMaxAckPendingField).
+			Description("The maximum number of messages delivered but not yet acknowledged").
+			Default(1024),
+		service.NewIntField(jsPullBatchField).
+			Description("The maximum number of messages buffered by each fetcher").
+			Default(100),
+		service.NewIntField(jsPullMaxBytesField).
+			Description("The maximum size in bytes of a pull request, which must exceed the largest message, unlimited when 0").
+			Default(0),
+		service.NewDurationField(jsPullExpiryField).
+			Description("How long a pull request waits for messages, at least 1s").
+			Default("30s"),
+		service.NewDurationField(jsPullHeartbeatField).
+			Description("The interval of the heartbeats sent by the server while a pull request waits, at most half the expiry, derived from the expiry unless set").
+			Optional(),
+		service.NewIntField(jsPullFetchersField).
+			Description("The number of fetchers reading from the consumer concurrently").
+			Default(1),
+		service.NewExtractTracingSpanMappingField(),
+	)
+
+// NewJetStreamPull creates a nats_jetstream_pull input from the provided configuration.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the connection, consumer and pull options
+//
+// Returns:
+//   - A configured JetStreamPull instance
+//   - An error if the configuration is invalid
+func NewJetStreamPull(conf *service.ParsedConfig) (*JetStreamPull, error) {
+	p := &JetStreamPull{}
+
+	var err error
+	if p.urls, p.jwt, p.seed, err = connectionFromConfig(conf); err != nil {
+		return nil, err
+	}
+	if p.subject, err = conf.FieldString(jsPullSubjectField); err != nil {
+		return nil, fmt.Errorf("failed to get subject field: %w", err)
+	}
+	if conf.Contains(jsPullStreamField) {
+		if p.stream, err = conf.FieldString(jsPullStreamField); err != nil {
+			return nil, fmt.Errorf("failed to get stream field: %w", err)
+		}
+	}
+	if conf.Contains(jsPullDurableField) {
+		if p.durable, err = conf.FieldString(jsPullDurableField); err != nil {
+			return nil, fmt.Errorf("failed to get durable field: %w", err)
+		}
+	}
+	if p.deliver, err = conf.FieldString(jsPullDeliverField); err != nil {
+		return nil, fmt.Errorf("failed to get deliver field: %w", err)
+	}
+	if p.ackWait, err = conf.FieldDuration(jsPullAckWaitField); err != nil {
+		return nil, fmt.Errorf("failed to get ack_wait field: %w", err)
+	}
+	if p.maxAckPending, err = conf.FieldInt(jsPullMaxAckPendingField); err != nil {
+		return nil, fmt.Errorf("failed to get max_ack_pending field: %w", err)
+	}
+	if p.batch, err = conf.FieldInt(jsPullBatchField); err != nil {
+		return nil, fmt.Errorf("failed to get batch field: %w", err)
+	}
+	if p.maxBytes, err = conf.FieldInt(jsPullMaxBytesField); err != nil {
+		return nil, fmt.Errorf("failed to get max_bytes field: %w", err)
+	}
+	if p.expiry, err = conf.FieldDuration(jsPullExpiryField); err != nil {
+		return nil, fmt.Errorf("failed to get expiry field: %w", err)
+	}
+	if conf.Contains(jsPullHeartbeatField) {
+		if p.heartbeat, err = conf.FieldDuration(jsPullHeartbeatField); err != nil {
+			return nil, fmt.Errorf("failed to get heartbeat field: %w", err)
+		}
+	}
+	if p.fetchers, err = conf.FieldInt(jsPullFetchersField); err != nil {
+		return nil, fmt.Errorf("failed to get fetchers field: %w", err)
+	}
+
+	if p.batch < 1 {
+		return nil, fmt.Errorf("batch must be at least 1, got %d", p.batch)
+	}
+	if p.maxBytes < 0 {
+		return nil, fmt.Errorf("max_bytes must not be negative, got %d", p.maxBytes)
+	}
+	if p.expiry < time.Second {
+		return nil, fmt.Errorf("expiry must be at least 1s, got %v", p.expiry)
+	}
+	if p.heartbeat < 0 || p.heartbeat > p.expiry/2 {
+		return nil, fmt.Errorf("heartbeat must be at most half the expiry of %v, got %v", p.expiry, p.heartbeat)
+	}
+	if p.fetchers < 1 {
+		return nil, fmt.Errorf("fetchers must be at least 1, got %d", p.fetchers)
+	}
+
+	return p, nil
+}
+
+// JetStreamPull is an input reading the messages of a JetStream pull consumer through one or
+// more fetchers, each keeping pull requests pending on the consumer.
+type JetStreamPull struct {
+	urls          []string
+	jwt, seed     string
+	stream        string
+	subject       string
+	durable       string
+	deliver       string
+	ackWait       time.Duration
+	maxAckPending int
+	batch         int
+	maxBytes      int
+	expiry        time.Duration
+	heartbeat     time.Duration
+	fetchers      int
+
+	mu       sync.Mutex
+	nc       *nats.Conn
+	iters    []jetstream.MessagesContext
+	msgs     chan jetstream.Msg
+	failures chan error
+	stopped  chan struct{}
+	wg       sync.WaitGroup
+}
+
+// pullOptions returns the options of the pull requests of each fetcher.
+func (p *JetStreamPull) pullOptions() []jetstream.PullMessagesOpt {
+	opts := []jetstream.PullMessagesOpt{jetstream.PullExpiry(p.expiry)}
+	if p.maxBytes > 0 {
+		opts = append(opts, jetstream.PullMaxMessagesWithBytesLimit(p.batch, p.maxBytes))
+	} else {
+		opts = append(opts, jetstream.PullMaxMessages(p.batch))
+	}
+	if p.heartbeat > 0 {
+		opts = append(opts, jetstream.PullHeartbeat(p.heartbeat))
+	}
+	return opts
+}
+
+func (p *JetStreamPull) Connect(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.nc != nil {
+		return nil
+	}
+
+	nc, err := connect("JetStream Pull", p.urls, p.jwt, p.seed)
+	if err != nil {
+		return err
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	stream := p.stream
+	if stream == "" {
+		if stream, err = js.StreamNameBySubject(ctx, p.subject); err != nil {
+			nc.Close()
+			return fmt.Errorf("failed to find the stream of subject %s: %w", p.subject, err)
+		}
+	}
+
+	config := jetstream.ConsumerConfig{
+		Durable:       p.durable,
+		FilterSubject: p.subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       p.ackWait,
+		MaxAckPending: p.maxAckPending,
+	}
+	if p.deliver == JetStreamDeliverNew {
+		config.DeliverPolicy = jetstream.DeliverNewPolicy
+	}
+	consumer, err := js.CreateOrUpdateConsumer(ctx, stream, config)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to create consumer on stream %s: %w", stream, err)
+	}
+
+	iters := make([]jetstream.MessagesContext, 0, p.fetchers)
+	for range p.fetchers {
+		it, err := consumer.Messages(p.pullOptions()...)
+		if err != nil {
+			for _, it := range iters {
+				it.Stop()
+			}
+			nc.Close()
+			return fmt.Errorf("failed to pull from stream %s: %w", stream, err)
+		}
+		iters = append(iters, it)
+	}
+
+	msgs, failures, stopped := make(chan jetstream.Msg, p.batch), make(chan error, p.fetchers), make(chan struct{})
+	for _, it := range iters {
+		p.wg.Add(1)
+		go p.fetch(it, msgs, failures, stopped)
+	}
+
+	p.nc, p.iters, p.msgs, p.failures, p.stopped = nc, iters, msgs, failures, stopped
+	return nil
+}
+
+// fetch hands the messages of a fetcher to Read until the fetcher stops or fails.
+func (p *JetStreamPull) fetch(it jetstream.MessagesContext, msgs chan<- jetstream.Msg, failures chan<- error, stopped <-chan struct{}) {
+	defer p.wg.Done()
+
+	for {
+		msg, err := it.Next()
+		if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+			return
+		}
+		// the fetcher replaces the pull requests whose heartbeats are missed on its own
+		if errors.Is(err, jetstream.ErrNoHeartbeat) {
+			continue
+		}
+		if err != nil {
+			failures <- err
+			return
+		}
+
+		select {
+		case msgs <- msg:
+		case <-stopped:
+			return
+		}
+	}
+}
+
+func (p *JetStreamPull) Read(ctx context.Context) (*service.Message, service.AckFunc, error) {
+	p.mu.Lock()
+	msgs, failures, stopped := p.msgs, p.failures, p.stopped
+	p.mu.Unlock()
+
+	if msgs == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+
+	var m jetstream.Msg
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	case <-stopped:
+		return nil, nil, service.ErrNotConnected
+	case <-failures:
+		p.disconnect()
+		return nil, nil, service.ErrNotConnected
+	case m = <-msgs:
+	}
+
+	msg := service.NewMessage(m.Data())
+	for key, values := range m.Headers() {
+		if len(values) > 0 {
+			msg.MetaSetMut(key, values[0])
+		}
+	}
+	msg.MetaSetMut("nats_subject", m.Subject())
+	if meta, err := m.Metadata(); err == nil {
+		msg.MetaSetMut("nats_sequence_stream", strconv.FormatUint(meta.Sequence.Stream, 10))
+		msg.MetaSetMut("nats_sequence_consumer", strconv.FormatUint(meta.Sequence.Consumer, 10))
+		msg.MetaSetMut("nats_num_delivered", strconv.FormatUint(meta.NumDelivered, 10))
+		msg.MetaSetMut("nats_num_pending", strconv.FormatUint(meta.NumPending, 10))
+		msg.MetaSetMut("nats_domain", meta.Domain)
+		msg.MetaSetMut("nats_timestamp_unix_nano", strconv.FormatInt(meta.Timestamp.UnixNano(), 10))
+	}
+
+	return msg, func(_ context.Context, err error) error {
+		if err != nil {
+			return m.Nak()
+		}
+		return m.Ack()
+	}, nil
+}
+
+// disconnect stops the fetchers and releases the connection, so that the input connects again.
+func (p *JetStreamPull) disconnect() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped != nil {
+		close(p.stopped)
+	}
+	for _, it := range p.iters {
+		it.Stop()
+	}
+	p.wg.Wait()
+	if p.nc != nil {
+		p.nc.Close()
+	}
+	p.nc, p.iters, p.msgs, p.failures, p.stopped = nil, nil, nil, nil, nil
+}
+
+func (p *JetStreamPull) Close(_ context.Context) error {
+	p.disconnect()
+	return nil
+}
@@ -0,0 +1,185 @@
+package nats_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("JetStream Pull", func() {
+	var jsSrv *server.Server
+	var js jetstream.JetStream
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+		jsSrv = test.RunServer(&opts)
+
+		nc, err := nats2.Connect(jsSrv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			jsSrv.Shutdown()
+		})
+
+		js, err = jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	parse := func(extra string) (*nats.JetStreamPull, error) {
+		yaml := fmt.Sprintf("urls: [%s]\nsubject: orders.>\n%s", jsSrv.ClientURL(), extra)
+		conf, err := nats.JetStreamPullConfigSpec.ParseYAML(yaml, nil)
+		Expect(err).NotTo(HaveOccurred())
+		return nats.NewJetStreamPull(conf)
+	}
+
+	input := func(extra string) *nats.JetStreamPull {
+		p, err := parse(extra)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.Connect(context.Background())).To(Succeed())
+		DeferCleanup(p.Close, context.Background())
+		return p
+	}
+
+	publish := func(subject, payload string) {
+		msg := nats2.NewMsg(subject)
+		msg.Data = []byte(payload)
+		msg.Header.Set("X-Tenant", "acme")
+		_, err := js.PublishMsg(context.Background(), msg)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	read := func(p *nats.JetStreamPull) (*service.Message, service.AckFunc) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		msg, ack, err := p.Read(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		return msg, ack
+	}
+
+	It("should read the messages of the stream with their metadata", func() {
+		publish("orders.eu", "1")
+		p := input("batch: 10\nmax_bytes: 1048576\nexpiry: 2s\nheartbeat: 500ms\n")
+
+		msg, ack := read(p)
+		Expect(msg.AsBytes()).To(Equal([]byte("1")))
+		meta := map[string]string{}
+		Expect(msg.MetaWalk(func(k, v string) error {
+			meta[k] = v
+			return nil
+		})).To(Succeed())
+		Expect(meta).To(HaveKeyWithValue("X-Tenant", "acme"))
+		Expect(meta).To(HaveKeyWithValue("nats_subject", "orders.eu"))
+		Expect(meta).To(HaveKeyWithValue("nats_sequence_stream", "1"))
+		Expect(meta).To(HaveKeyWithValue("nats_num_delivered", "1"))
+		Expect(meta).To(HaveKey("nats_timestamp_unix_nano"))
+		Expect(ack(context.Background(), nil)).To(Succeed())
+	})
+
+	It("should read the messages published after it connected with several fetchers", func() {
+		p := input("durable: orders\nfetchers: 3\nbatch: 2\n")
+		for i := range 10 {
+			publish("orders.eu", fmt.Sprint(i))
+		}
+
+		seen := map[string]bool{}
+		for range 10 {
+			msg, ack := read(p)
+			b, err := msg.AsBytes()
+			Expect(err).NotTo(HaveOccurred())
+			seen[string(b)] = true
+			Expect(ack(context.Background(), nil)).To(Succeed())
+		}
+		Expect(seen).To(HaveLen(10))
+
+		info, err := js.Consumer(context.Background(), "ORDERS", "orders")
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() int {
+			i, err := info.Info(context.Background())
+			if err != nil {
+				return -1
+			}
+			return i.NumAckPending
+		}, 5*time.Second, 50*time.Millisecond).Should(Equal(0))
+	})
+
+	It("should deliver the failed messages again", func() {
+		publish("orders.eu", "1")
+		p := input("")
+
+		_, ack := read(p)
+		Expect(ack(context.Background(), errors.New("failed"))).To(Succeed())
+
+		again, ack := read(p)
+		Expect(again.AsBytes()).To(Equal([]byte("1")))
+		delivered, _ := again.MetaGet("nats_num_delivered")
+		Expect(delivered).To(Equal("2"))
+		Expect(ack(context.Background(), nil)).To(Succeed())
+	})
+
+	It("should only deliver the new messages when configured", func() {
+		publish("orders.eu", "old")
+		p := input("deliver: new\n")
+		publish("orders.eu", "new")
+
+		msg, _ := read(p)
+		Expect(msg.AsBytes()).To(Equal([]byte("new")))
+	})
+
+	It("should continue the trace found in the headers of the messages", func() {
+		propagator := otel.GetTextMapPropagator()
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		DeferCleanup(otel.SetTextMapPropagator, propagator)
+
+		msg := nats2.NewMsg("orders.eu")
+		msg.Data = []byte("1")
+		msg.Header.Set("traceparent", "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01")
+		_, err := js.PublishMsg(context.Background(), msg)
+		Expect(err).NotTo(HaveOccurred())
+
+		traces := make(chan trace.TraceID, 1)
+		sb := service.NewStreamBuilder()
+		Expect(sb.AddInputYAML(fmt.Sprintf("nats_jetstream_pull:\n  urls: [%s]\n  subject: orders.>\n  extract_tracing_map: root = @\n", jsSrv.ClientURL()))).To(Succeed())
+		Expect(sb.AddConsumerFunc(func(_ context.Context, m *service.Message) error {
+			traces <- trace.SpanContextFromContext(m.Context()).TraceID()
+			return nil
+		})).To(Succeed())
+		stream, err := sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		go func() { _ = stream.Run(ctx) }()
+		DeferCleanup(stream.Stop, context.Background())
+
+		var traceID trace.TraceID
+		Eventually(traces, 5*time.Second).Should(Receive(&traceID))
+		Expect(traceID.String()).To(Equal("0102030405060708090a0b0c0d0e0f10"))
+	})
+
+	It("should reject invalid pull settings", func() {
+		for _, extra := range []string{"batch: 0\n", "max_bytes: -1\n", "expiry: 500ms\n", "expiry: 2s\nheartbeat: 2s\n", "fetchers: 0\n"} {
+			_, err := parse(extra)
+			Expect(err).To(HaveOccurred(), extra)
+		}
+	})
+})
@@ -0,0 +1,212 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	// KvBucketMeta is the metadata key holding the bucket of a KV entry
+	KvBucketMeta = "kv_bucket"
+	// KvKeyMeta is the metadata key holding the key of a KV entry
+	KvKeyMeta = "kv_key"
+	// KvRevisionMeta is the metadata key holding the revision of a KV entry
+	KvRevisionMeta = "kv_revision"
+	// KvOperationMeta is the metadata key holding the operation of a KV entry, one of put, delete or purge
+	KvOperationMeta = "kv_operation"
+	// KvCreatedMeta is the metadata key holding the RFC 3339 time a KV entry was written at
+	KvCreatedMeta = "kv_created"
+
+	kvWatchBucketField        = "bucket"
+	kvWatchKeyField           = "key"
+	kvWatchIgnoreDeletesField = "ignore_deletes"
+)
+
+// KvWatchConfigSpec defines the configuration schema for the nats_kv_watch input.
+var KvWatchConfigSpec = service.NewConfigSpec().
+	Beta().
+	Categories("Services").
+	Summary("Watches the keys of a NATS KV bucket, reading only the values written after the input started.").
+	Description("Unlike the nats_kv input, none of the entries written before the watch started are delivered, "+
+		"not even the latest value of every key. The watch keeps no position: the entries written while the input "+
+		"reconnects to NATS, or while the connector is stopped, are never delivered. Delete and purge markers are "+
+		"delivered as messages with an empty payload unless ignore_deletes is set.\n\n"+
+		"Each message carries the bucket, key, revision, operation (put, delete or purge) and creation time of its "+
+		"entry in the kv_bucket, kv_key, kv_revision, kv_operation and kv_created metadata, and in the nats_kv_* "+
+		"metadata of the nats_kv input for compatibility.").
+	Fields(connectionFields("A list of URLs to connect to")...).
+	Fields(
+		service.NewStringField(kvWatchBucketField).
+			Description("The KV bucket to watch").
+			Example("my_kv_bucket"),
+		service.NewStringField(kvWatchKeyField).
+			Description("The keys to watch, which can include wildcards").
+			Default(">"),
+		service.NewBoolField(kvWatchIgnoreDeletesField).
+			Description("Do not deliver the delete and purge markers").
+			Default(false),
+		service.NewAutoRetryNacksToggleField(),
+	)
+
+// kvOperations maps the operations of KV entries to the values of the KvOperationMeta metadata
+var kvOperations = map[jetstream.KeyValueOp]string{
+	jetstream.KeyValuePut:    KvPut,
+	jetstream.KeyValueDelete: KvDelete,
+	jetstream.KeyValuePurge:  KvPurge,
+}
+
+// NewKvWatch creates a nats_kv_watch input from the provided configuration.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the connection, bucket, keys and delete option
+//
+// Returns:
+//   - A configured KvWatch instance
+//   - An error if the configuration is invalid
+func NewKvWatch(conf *service.ParsedConfig) (*KvWatch, error) {
+	w := &KvWatch{}
+
+	var err error
+	if w.urls, w.jwt, w.seed, err = connectionFromConfig(conf); err != nil {
+		return nil, err
+	}
+	if w.bucket, err = conf.FieldString(kvWatchBucketField); err != nil {
+		return nil, fmt.Errorf("failed to get bucket field: %w", err)
+	}
+	if w.key, err = conf.FieldString(kvWatchKeyField); err != nil {
+		return nil, fmt.Errorf("failed to get key field: %w", err)
+	}
+	if w.ignoreDeletes, err = conf.FieldBool(kvWatchIgnoreDeletesField); err != nil {
+		return nil, fmt.Errorf("failed to get ignore_deletes field: %w", err)
+	}
+
+	return w, nil
+}
+
+// KvWatch is an input reading the values of the keys of a NATS KV bucket written after it
+// connected. It keeps no position, so the entries written while it is disconnected are lost.
+type KvWatch struct {
+	urls          []string
+	jwt, seed     string
+	bucket        string
+	key           string
+	ignoreDeletes bool
+
+	mu      sync.Mutex
+	nc      *nats.Conn
+	watcher jetstream.KeyWatcher
+}
+
+func (w *KvWatch) Connect(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.nc != nil {
+		return nil
+	}
+
+	nc, err := connect("KV Watch", w.urls, w.jwt, w.seed)
+	if err != nil {
+		return err
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	kv, err := js.KeyValue(ctx, w.bucket)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to open kv bucket %s: %w", w.bucket, err)
+	}
+
+	opts := []jetstream.WatchOpt{jetstream.UpdatesOnly()}
+	if w.ignoreDeletes {
+		opts = append(opts, jetstream.IgnoreDeletes())
+	}
+
+	// The watch outlives the connection attempt, so it is not bound to its context
+	watcher, err := kv.Watch(context.Background(), w.key, opts...)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to watch kv bucket %s: %w", w.bucket, err)
+	}
+
+	w.nc, w.watcher = nc, watcher
+	return nil
+}
+
+func (w *KvWatch) Read(ctx context.Context) (*service.Message, service.AckFunc, error) {
+	w.mu.Lock()
+	watcher := w.watcher
+	w.mu.Unlock()
+
+	if watcher == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+
+	for {
+		var entry jetstream.KeyValueEntry
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case e, ok := <-watcher.Updates():
+			if !ok {
+				w.disconnect()
+				return nil, nil, service.ErrNotConnected
+			}
+			// a nil entry marks the end of the entries written before the watch started
+			if e == nil {
+				continue
+			}
+			entry = e
+		}
+
+		msg := service.NewMessage(entry.Value())
+		revision := strconv.FormatUint(entry.Revision(), 10)
+		created := entry.Created().Format(time.RFC3339Nano)
+
+		msg.MetaSetMut(KvBucketMeta, entry.Bucket())
+		msg.MetaSetMut(KvKeyMeta, entry.Key())
+		msg.MetaSetMut(KvRevisionMeta, revision)
+		msg.MetaSetMut(KvOperationMeta, kvOperations[entry.Operation()])
+		msg.MetaSetMut(KvCreatedMeta, created)
+
+		msg.MetaSetMut("nats_kv_bucket", entry.Bucket())
+		msg.MetaSetMut("nats_kv_key", entry.Key())
+		msg.MetaSetMut("nats_kv_revision", revision)
+		msg.MetaSetMut("nats_kv_delta", strconv.FormatUint(entry.Delta(), 10))
+		msg.MetaSetMut("nats_kv_operation", entry.Operation().String())
+		msg.MetaSetMut("nats_kv_created", created)
+
+		return msg, func(context.Context, error) error { return nil }, nil
+	}
+}
+
+// disconnect releases the watch and connection, so that the input connects again.
+func (w *KvWatch) disconnect() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.watcher != nil {
+		_ = w.watcher.Stop()
+	}
+	if w.nc != nil {
+		w.nc.Close()
+	}
+	w.nc, w.watcher = nil, nil
+}
+
+func (w *KvWatch) Close(_ context.Context) error {
+	w.disconnect()
+	return nil
+}
@@ -0,0 +1,115 @@
+package nats_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("KV Watch", func() {
+	var jsSrv *server.Server
+	var kv jetstream.KeyValue
+	var bucket string
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+		jsSrv = test.RunServer(&opts)
+
+		nc, err := nats2.Connect(jsSrv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			jsSrv.Shutdown()
+		})
+
+		js, err := jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+
+		bucket = "config_" + nuid.Next()
+		kv, err = js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: bucket, History: 5})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = kv.PutString(context.Background(), "a", "a1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = kv.PutString(context.Background(), "a", "a2")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = kv.PutString(context.Background(), "b", "b1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kv.Delete(context.Background(), "b")).To(Succeed())
+	})
+
+	input := func(extra string) *nats.KvWatch {
+		yaml := fmt.Sprintf("urls: [%s]\nbucket: %s\n%s", jsSrv.ClientURL(), bucket, extra)
+		conf, err := nats.KvWatchConfigSpec.ParseYAML(yaml, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		w, err := nats.NewKvWatch(conf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Connect(context.Background())).To(Succeed())
+		DeferCleanup(w.Close, context.Background())
+		return w
+	}
+
+	read := func(w *nats.KvWatch) *service.Message {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		msg, _, err := w.Read(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		return msg
+	}
+
+	entry := func(msg *service.Message) string {
+		b, err := msg.AsBytes()
+		Expect(err).NotTo(HaveOccurred())
+		key, _ := msg.MetaGet(nats.KvKeyMeta)
+		operation, _ := msg.MetaGet(nats.KvOperationMeta)
+		return key + " " + operation + " " + string(b)
+	}
+
+	It("should only deliver the values written after it started", func() {
+		w := input("")
+
+		_, err := kv.PutString(context.Background(), "c", "c1")
+		Expect(err).NotTo(HaveOccurred())
+		msg := read(w)
+		Expect(entry(msg)).To(Equal("c put c1"))
+
+		meta := map[string]any{}
+		Expect(msg.MetaWalkMut(func(k string, v any) error {
+			meta[k] = v
+			return nil
+		})).To(Succeed())
+		Expect(meta).To(HaveKeyWithValue(nats.KvBucketMeta, bucket))
+		Expect(meta).To(HaveKeyWithValue(nats.KvRevisionMeta, "5"))
+		Expect(meta).To(HaveKeyWithValue("nats_kv_key", "c"))
+		Expect(meta).To(HaveKeyWithValue("nats_kv_operation", "KeyValuePutOp"))
+		Expect(meta).To(HaveKey(nats.KvCreatedMeta))
+
+		Expect(kv.Purge(context.Background(), "a")).To(Succeed())
+		Expect(entry(read(w))).To(Equal("a purge "))
+	})
+
+	It("should not deliver the delete markers when ignoring deletes", func() {
+		w := input("ignore_deletes: true\n")
+
+		Expect(kv.Delete(context.Background(), "a")).To(Succeed())
+		_, err := kv.PutString(context.Background(), "c", "c1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entry(read(w))).To(Equal("c put c1"))
+	})
+})
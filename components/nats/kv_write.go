@@ -0,0 +1,279 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	// KvPut writes the value of the key unconditionally
+	KvPut = "put"
+	// KvCreate writes the value of the key only if the key does not exist or was deleted
+	KvCreate = "create"
+	// KvUpdate writes the value of the key only if its latest revision is the expected revision
+	KvUpdate = "update"
+	// KvDelete deletes the key, keeping its history
+	KvDelete = "delete"
+	// KvPurge deletes the key along with its history
+	KvPurge = "purge"
+
+	// KvConflictReject rejects the messages whose operation conflicts with the key, so that they are retried
+	KvConflictReject = "reject"
+	// KvConflictDrop drops the messages whose operation conflicts with the key
+	KvConflictDrop = "drop"
+
+	// KvConflictMetric is the name of the counter incremented for every message dropped because its operation conflicts with the key
+	KvConflictMetric = "kv_conflict"
+
+	kvWriteBucketField     = "bucket"
+	kvWriteKeyField        = "key"
+	kvWriteOperationField  = "operation"
+	kvWriteRevisionField   = "revision"
+	kvWriteTTLField        = "ttl"
+	kvWriteOnConflictField = "on_conflict"
+)
+
+// KvOperations are the operations of the nats_kv_write output.
+var KvOperations = []string{KvPut, KvCreate, KvUpdate, KvDelete, KvPurge}
+
+// KvWriteConfigSpec defines the configuration schema for the nats_kv_write output.
+var KvWriteConfigSpec = service.NewConfigSpec().
+	Beta().
+	Categories("Services").
+	Summary("Writes messages to a NATS KV bucket with the operation resolved for each message.").
+	Description("The operation is one of put, create, update, delete or purge, and can be derived from the "+
+		"message, for example to delete the keys of change data capture delete events. Create only writes keys "+
+		"which do not exist, and update only writes keys whose latest revision is the given revision, while delete "+
+		"and purge only apply to that revision when one is given. A message conflicting with its key is rejected, "+
+		"or dropped with a log and an increment of the kv_conflict counter.\n\n"+
+		"The TTL expires the keys written by put, create and update, and the delete marker of purge. It requires a "+
+		"bucket with a limit marker TTL.").
+	Fields(connectionFields("A list of URLs to connect to")...).
+	Fields(
+		service.NewStringField(kvWriteBucketField).
+			Description("The KV bucket to write to").
+			Example("my_kv_bucket"),
+		service.NewInterpolatedStringField(kvWriteKeyField).
+			Description("The key of each message").
+			Example(`${! json("id") }`),
+		service.NewInterpolatedStringField(kvWriteOperationField).
+			Description("The operation of each message, one of put, create, update, delete or purge").
+			Example(`${! if json("operationType") == "delete" { "delete" } else { "put" } }`).
+			Default(KvPut),
+		service.NewInterpolatedStringField(kvWriteRevisionField).
+			Description("The revision the key is expected at, required by update").
+			Example(`${! meta("kv_revision") }`).
+			Optional(),
+		service.NewInterpolatedStringField(kvWriteTTLField).
+			Description("How long the keys written are kept, such as 1h").
+			Optional(),
+		service.NewStringEnumField(kvWriteOnConflictField, KvConflictReject, KvConflictDrop).
+			Description("What happens to the messages whose operation conflicts with the key").
+			Default(KvConflictReject),
+		service.NewOutputMaxInFlightField().Default(64),
+	)
+
+// NewKvWrite creates a nats_kv_write output from the provided configuration.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the connection, bucket, key and operation
+//   - mgr: Resources providing the logger and metrics of the output
+//
+// Returns:
+//   - A configured KvWrite instance
+//   - An error if the configuration is invalid
+func NewKvWrite(conf *service.ParsedConfig, mgr *service.Resources) (*KvWrite, error) {
+	w := &KvWrite{
+		log:       mgr.Logger(),
+		conflicts: mgr.Metrics().NewCounter(KvConflictMetric),
+	}
+
+	var err error
+	if w.urls, w.jwt, w.seed, err = connectionFromConfig(conf); err != nil {
+		return nil, err
+	}
+	if w.bucket, err = conf.FieldString(kvWriteBucketField); err != nil {
+		return nil, fmt.Errorf("failed to get bucket field: %w", err)
+	}
+	if w.key, err = conf.FieldInterpolatedString(kvWriteKeyField); err != nil {
+		return nil, fmt.Errorf("failed to get key field: %w", err)
+	}
+	if w.operation, err = conf.FieldInterpolatedString(kvWriteOperationField); err != nil {
+		return nil, fmt.Errorf("failed to get operation field: %w", err)
+	}
+	if conf.Contains(kvWriteRevisionField) {
+		if w.revision, err = conf.FieldInterpolatedString(kvWriteRevisionField); err != nil {
+			return nil, fmt.Errorf("failed to get revision field: %w", err)
+		}
+	}
+	if conf.Contains(kvWriteTTLField) {
+		if w.ttl, err = conf.FieldInterpolatedString(kvWriteTTLField); err != nil {
+			return nil, fmt.Errorf("failed to get ttl field: %w", err)
+		}
+	}
+	if w.onConflict, err = conf.FieldString(kvWriteOnConflictField); err != nil {
+		return nil, fmt.Errorf("failed to get on_conflict field: %w", err)
+	}
+
+	return w, nil
+}
+
+// KvWrite is an output putting, creating, updating, deleting or purging the keys of a NATS KV
+// bucket.
+type KvWrite struct {
+	urls       []string
+	jwt, seed  string
+	bucket     string
+	key        *service.InterpolatedString
+	operation  *service.InterpolatedString
+	revision   *service.InterpolatedString
+	ttl        *service.InterpolatedString
+	onConflict string
+
+	log       *service.Logger
+	conflicts *service.MetricCounter
+
+	mu sync.RWMutex
+	nc *nats.Conn
+	js jetstream.JetStream
+	kv jetstream.KeyValue
+}
+
+func (w *KvWrite) Connect(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.nc != nil {
+		return nil
+	}
+
+	nc, err := connect("KV Write", w.urls, w.jwt, w.seed)
+	if err != nil {
+		return err
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	kv, err := js.KeyValue(ctx, w.bucket)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to open kv bucket %s: %w", w.bucket, err)
+	}
+
+	w.nc, w.js, w.kv = nc, js, kv
+	return nil
+}
+
+func (w *KvWrite) Write(ctx context.Context, msg *service.Message) error {
+	w.mu.RLock()
+	js, kv := w.js, w.kv
+	w.mu.RUnlock()
+
+	if kv == nil {
+		return service.ErrNotConnected
+	}
+
+	key, err := w.key.TryString(msg)
+	if err != nil {
+		return fmt.Errorf("failed to interpolate key: %w", err)
+	}
+	operation, err := w.operation.TryString(msg)
+	if err != nil {
+		return fmt.Errorf("failed to interpolate operation: %w", err)
+	}
+
+	var revision uint64
+	if w.revision != nil {
+		s, err := w.revision.TryString(msg)
+		if err != nil {
+			return fmt.Errorf("failed to interpolate revision: %w", err)
+		}
+		if s != "" && s != "null" {
+			if revision, err = strconv.ParseUint(s, 10, 64); err != nil {
+				return fmt.Errorf("invalid revision %q: %w", s, err)
+			}
+		}
+	}
+
+	var ttl time.Duration
+	if w.ttl != nil {
+		s, err := w.ttl.TryString(msg)
+		if err != nil {
+			return fmt.Errorf("failed to interpolate ttl: %w", err)
+		}
+		if s != "" && s != "null" {
+			if ttl, err = time.ParseDuration(s); err != nil {
+				return fmt.Errorf("invalid ttl %q: %w", s, err)
+			}
+		}
+	}
+
+	payload, err := msg.AsBytes()
+	if err != nil {
+		return err
+	}
+
+	switch operation {
+	case KvPut:
+		if ttl > 0 {
+			_, err = js.Publish(ctx, w.subject(key), payload, jetstream.WithMsgTTL(ttl))
+		} else {
+			_, err = kv.Put(ctx, key, payload)
+		}
+	case KvCreate:
+		_, err = kv.Create(ctx, key, payload, jetstream.KeyTTL(ttl))
+	case KvUpdate:
+		if revision == 0 {
+			return fmt.Errorf("the update of key %s requires a revision", key)
+		}
+		if ttl > 0 {
+			_, err = js.Publish(ctx, w.subject(key), payload, jetstream.WithExpectLastSequencePerSubject(revision), jetstream.WithMsgTTL(ttl))
+		} else {
+			_, err = kv.Update(ctx, key, payload, revision)
+		}
+	case KvDelete:
+		err = kv.Delete(ctx, key, jetstream.LastRevision(revision))
+	case KvPurge:
+		err = kv.Purge(ctx, key, jetstream.LastRevision(revision), jetstream.PurgeTTL(ttl))
+	default:
+		return fmt.Errorf("unknown kv operation %q", operation)
+	}
+
+	if errors.Is(err, jetstream.ErrKeyExists) && w.onConflict == KvConflictDrop {
+		w.log.Warnf("Dropping %s of key %s conflicting with its current revision: %v", operation, key, err)
+		w.conflicts.Incr(1)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s key %s in kv bucket %s: %w", operation, key, w.bucket, err)
+	}
+	return nil
+}
+
+// subject returns the subject of the messages holding the values of a key.
+func (w *KvWrite) subject(key string) string {
+	return "$KV." + w.bucket + "." + key
+}
+
+func (w *KvWrite) Close(_ context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.nc != nil {
+		w.nc.Close()
+	}
+	w.nc, w.js, w.kv = nil, nil, nil
+	return nil
+}
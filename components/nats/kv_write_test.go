@@ -0,0 +1,150 @@
+package nats_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("KV Write", func() {
+	var jsSrv *server.Server
+	var kv jetstream.KeyValue
+	var bucket string
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+		jsSrv = test.RunServer(&opts)
+
+		nc, err := nats2.Connect(jsSrv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			jsSrv.Shutdown()
+		})
+
+		js, err := jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+
+		bucket = "view_" + nuid.Next()
+		kv, err = js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{
+			Bucket:         bucket,
+			History:        5,
+			LimitMarkerTTL: time.Second,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	output := func(extra string) *nats.KvWrite {
+		yaml := fmt.Sprintf("urls: [%s]\nbucket: %s\nkey: ${! json(\"id\") }\n%s", jsSrv.ClientURL(), bucket, extra)
+		conf, err := nats.KvWriteConfigSpec.ParseYAML(yaml, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		w, err := nats.NewKvWrite(conf, service.MockResources())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Connect(context.Background())).To(Succeed())
+		DeferCleanup(w.Close, context.Background())
+		return w
+	}
+
+	write := func(w *nats.KvWrite, payload string, meta ...string) error {
+		msg := service.NewMessage([]byte(payload))
+		for i := 0; i+1 < len(meta); i += 2 {
+			msg.MetaSetMut(meta[i], meta[i+1])
+		}
+		return w.Write(context.Background(), msg)
+	}
+
+	value := func(key string) string {
+		entry, err := kv.Get(context.Background(), key)
+		Expect(err).NotTo(HaveOccurred())
+		return string(entry.Value())
+	}
+
+	It("should put, delete and purge keys according to the operation of the message", func() {
+		w := output("operation: ${! json(\"op\").or(\"put\") }\n")
+
+		Expect(write(w, `{"id": "a", "v": 1}`)).To(Succeed())
+		Expect(write(w, `{"id": "a", "v": 2}`)).To(Succeed())
+		Expect(value("a")).To(Equal(`{"id": "a", "v": 2}`))
+
+		Expect(write(w, `{"id": "a", "op": "delete"}`)).To(Succeed())
+		_, err := kv.Get(context.Background(), "a")
+		Expect(err).To(MatchError(jetstream.ErrKeyNotFound))
+		history, err := kv.History(context.Background(), "a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history).To(HaveLen(3))
+
+		Expect(write(w, `{"id": "a", "op": "purge"}`)).To(Succeed())
+		history, err = kv.History(context.Background(), "a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history).To(HaveLen(1))
+		Expect(history[0].Operation()).To(Equal(jetstream.KeyValuePurge))
+	})
+
+	It("should only create the keys which do not exist", func() {
+		w := output("operation: create\n")
+
+		Expect(write(w, `{"id": "a", "v": 1}`)).To(Succeed())
+		Expect(write(w, `{"id": "a", "v": 2}`)).To(MatchError(ContainSubstring("key exists")))
+		Expect(value("a")).To(Equal(`{"id": "a", "v": 1}`))
+	})
+
+	It("should only update the keys at the revision of the message", func() {
+		revision, err := kv.Put(context.Background(), "a", []byte("initial"))
+		Expect(err).NotTo(HaveOccurred())
+
+		w := output("operation: update\nrevision: ${! meta(\"revision\") }\n")
+
+		Expect(write(w, `{"id": "a", "v": 1}`, "revision", fmt.Sprint(revision))).To(Succeed())
+		Expect(write(w, `{"id": "a", "v": 2}`, "revision", fmt.Sprint(revision))).To(HaveOccurred())
+		Expect(value("a")).To(Equal(`{"id": "a", "v": 1}`))
+
+		Expect(write(w, `{"id": "b"}`)).To(MatchError(ContainSubstring("requires a revision")))
+	})
+
+	It("should drop the messages conflicting with their key when asked to", func() {
+		w := output("operation: create\non_conflict: drop\n")
+
+		Expect(write(w, `{"id": "a", "v": 1}`)).To(Succeed())
+		Expect(write(w, `{"id": "a", "v": 2}`)).To(Succeed())
+		Expect(value("a")).To(Equal(`{"id": "a", "v": 1}`))
+	})
+
+	It("should expire the keys after their ttl", func() {
+		w := output("operation: ${! json(\"op\") }\nttl: ${! json(\"ttl\") }\n")
+
+		Expect(write(w, `{"id": "created", "op": "create", "ttl": "1s"}`)).To(Succeed())
+		Expect(write(w, `{"id": "put", "op": "put", "ttl": "1s"}`)).To(Succeed())
+		Expect(write(w, `{"id": "kept", "op": "put", "ttl": ""}`)).To(Succeed())
+
+		Eventually(func() error {
+			_, err := kv.Get(context.Background(), "created")
+			return err
+		}, 5*time.Second, 100*time.Millisecond).Should(MatchError(jetstream.ErrKeyNotFound))
+		Eventually(func() error {
+			_, err := kv.Get(context.Background(), "put")
+			return err
+		}, 5*time.Second, 100*time.Millisecond).Should(MatchError(jetstream.ErrKeyNotFound))
+		Expect(value("kept")).To(Equal(`{"id": "kept", "op": "put", "ttl": ""}`))
+	})
+
+	It("should fail the messages with an unknown operation", func() {
+		w := output("operation: upsert\n")
+
+		Expect(write(w, `{"id": "a"}`)).To(MatchError(ContainSubstring("unknown kv operation")))
+	})
+})
@@ -0,0 +1,272 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	// LookupMissingKeep keeps the messages whose key is missing unchanged
+	LookupMissingKeep = "keep"
+	// LookupMissingDrop drops the messages whose key is missing
+	LookupMissingDrop = "drop"
+	// LookupMissingFail flags the messages whose key is missing as failed
+	LookupMissingFail = "fail"
+
+	// LookupMissingMetric is the name of the counter incremented for every message whose key is missing
+	LookupMissingMetric = "lookup_missing"
+
+	lookupBucketField    = "bucket"
+	lookupKeyField       = "key"
+	lookupPathField      = "path"
+	lookupMetadataField  = "metadata"
+	lookupCacheTTLField  = "cache_ttl"
+	lookupOnMissingField = "on_missing"
+
+	// lookupCacheMaxEntries bounds the number of keys held by the read-through cache
+	lookupCacheMaxEntries = 10000
+)
+
+// LookupConfigSpec defines the configuration schema for the nats_kv_lookup processor.
+var LookupConfigSpec = service.NewConfigSpec().
+	Beta().
+	Summary("enrich messages with the value of a NATS KV key derived from the message").
+	Description("The value is merged into the payload at the given path, or stored in a metadata key. "+
+		"JSON object values are merged into the object found at the path, other values replace it. "+
+		"Lookups, including the missing keys, are cached locally for the cache TTL. Keys which are not valid "+
+		"in a bucket, such as keys with spaces or wildcards, are handled as missing keys.").
+	Fields(connectionFields("The urls of the NATS servers holding the bucket")...).
+	Fields(
+		service.NewStringField(lookupBucketField).
+			Description("The KV bucket holding the reference data"),
+		service.NewBloblangField(lookupKeyField).
+			Description("A Bloblang query computing the key to look up"),
+		service.NewStringField(lookupPathField).
+			Description("The dot separated path of the payload receiving the value, the root of the payload if empty. Exclusive with metadata.").
+			Optional(),
+		service.NewStringField(lookupMetadataField).
+			Description("The metadata key receiving the value, exclusive with path").
+			Optional(),
+		service.NewDurationField(lookupCacheTTLField).
+			Description("How long looked up values are cached, 0s to disable the cache").
+			Default("0s"),
+		service.NewStringEnumField(lookupOnMissingField, LookupMissingKeep, LookupMissingDrop, LookupMissingFail).
+			Description("What happens to the messages whose key is missing").
+			Default(LookupMissingKeep),
+	)
+
+// NewLookup creates a nats_kv_lookup processor from the provided configuration, connecting to
+// NATS and opening its bucket.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the connection, bucket, key and target of the lookup
+//   - mgr: Resources providing the metrics of the processor
+//
+// Returns:
+//   - A configured Lookup instance
+//   - An error if the configuration is invalid or the bucket could not be opened
+func NewLookup(conf *service.ParsedConfig, mgr *service.Resources) (*Lookup, error) {
+	urls, jwt, seed, err := connectionFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Lookup{
+		cache:   map[string]lookupEntry{},
+		missing: mgr.Metrics().NewCounter(LookupMissingMetric),
+	}
+
+	bucket, err := conf.FieldString(lookupBucketField)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bucket field: %w", err)
+	}
+	if l.key, err = conf.FieldBloblang(lookupKeyField); err != nil {
+		return nil, fmt.Errorf("failed to get key field: %w", err)
+	}
+	if l.ttl, err = conf.FieldDuration(lookupCacheTTLField); err != nil {
+		return nil, fmt.Errorf("failed to get cache_ttl field: %w", err)
+	}
+	if l.onMissing, err = conf.FieldString(lookupOnMissingField); err != nil {
+		return nil, fmt.Errorf("failed to get on_missing field: %w", err)
+	}
+	l.path, _ = conf.FieldString(lookupPathField)
+	l.metadata, _ = conf.FieldString(lookupMetadataField)
+
+	if l.path != "" && l.metadata != "" {
+		return nil, errors.New("at most one of a path and a metadata key can receive the value")
+	}
+
+	if l.nc, err = connect("Lookup", urls, jwt, seed); err != nil {
+		return nil, err
+	}
+
+	js, err := jetstream.New(l.nc)
+	if err != nil {
+		l.nc.Close()
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	if l.kv, err = js.KeyValue(context.Background(), bucket); err != nil {
+		l.nc.Close()
+		return nil, fmt.Errorf("failed to open kv bucket %s: %w", bucket, err)
+	}
+
+	return l, nil
+}
+
+// Lookup is a processor enriching messages with values read from a NATS KV bucket.
+type Lookup struct {
+	nc *nats.Conn
+	kv jetstream.KeyValue
+
+	key       *bloblang.Executor
+	path      string
+	metadata  string
+	onMissing string
+
+	ttl   time.Duration
+	mu    sync.Mutex
+	cache map[string]lookupEntry
+
+	missing *service.MetricCounter
+}
+
+// lookupEntry is a cached lookup, found is false for missing keys.
+type lookupEntry struct {
+	value   []byte
+	found   bool
+	expires time.Time
+}
+
+func (l *Lookup) Process(ctx context.Context, msg *service.Message) (service.MessageBatch, error) {
+	res, err := msg.BloblangQuery(l.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute the lookup key: %w", err)
+	}
+
+	key, err := res.AsBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute the lookup key: %w", err)
+	}
+
+	value, found, err := l.get(ctx, string(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up key %s: %w", key, err)
+	}
+
+	if !found {
+		l.missing.Incr(1)
+		switch l.onMissing {
+		case LookupMissingDrop:
+			return nil, nil
+		case LookupMissingFail:
+			return nil, fmt.Errorf("key %s not found", key)
+		default:
+			return service.MessageBatch{msg}, nil
+		}
+	}
+
+	if l.metadata != "" {
+		msg.MetaSetMut(l.metadata, string(value))
+		return service.MessageBatch{msg}, nil
+	}
+
+	if err := l.merge(msg, value); err != nil {
+		return nil, err
+	}
+	return service.MessageBatch{msg}, nil
+}
+
+// get reads a key from the cache, or from the bucket when it is not cached or has expired.
+// Invalid keys are reported as missing.
+func (l *Lookup) get(ctx context.Context, key string) ([]byte, bool, error) {
+	now := time.Now()
+	if l.ttl > 0 {
+		l.mu.Lock()
+		e, ok := l.cache[key]
+		l.mu.Unlock()
+		if ok && now.Before(e.expires) {
+			return e.value, e.found, nil
+		}
+	}
+
+	// A key which is not valid in a bucket, for example with spaces or wildcards, can never
+	// be found, so only the failures to reach the bucket are worth retrying
+	var value []byte
+	entry, err := l.kv.Get(ctx, key)
+	switch {
+	case errors.Is(err, jetstream.ErrKeyNotFound), errors.Is(err, jetstream.ErrInvalidKey):
+	case err != nil:
+		return nil, false, err
+	default:
+		value = entry.Value()
+	}
+	found := err == nil
+
+	if l.ttl > 0 {
+		l.mu.Lock()
+		if len(l.cache) >= lookupCacheMaxEntries {
+			maps.DeleteFunc(l.cache, func(_ string, e lookupEntry) bool { return now.After(e.expires) })
+			if len(l.cache) >= lookupCacheMaxEntries {
+				clear(l.cache)
+			}
+		}
+		l.cache[key] = lookupEntry{value: value, found: found, expires: now.Add(l.ttl)}
+		l.mu.Unlock()
+	}
+
+	return value, found, nil
+}
+
+// merge sets the value at the path of the payload. A JSON object value is merged into the
+// object found at the path, and any other value replaces it. Values which are not valid JSON
+// are set as strings.
+func (l *Lookup) merge(msg *service.Message, value []byte) error {
+	var v any
+	if err := json.Unmarshal(value, &v); err != nil {
+		v = string(value)
+	}
+
+	root, err := msg.AsStructuredMut()
+	if err != nil {
+		return fmt.Errorf("failed to merge the value into the payload: %w", err)
+	}
+
+	payload := gabs.Wrap(root)
+	current := payload
+	if l.path != "" {
+		current = payload.Path(l.path)
+	}
+
+	into, isObject := current.Data().(map[string]any)
+	obj, valueIsObject := v.(map[string]any)
+	switch {
+	case isObject && valueIsObject:
+		maps.Copy(into, obj)
+	case l.path == "":
+		payload = gabs.Wrap(v)
+	default:
+		if _, err := payload.SetP(v, l.path); err != nil {
+			return fmt.Errorf("failed to merge the value into the payload: %w", err)
+		}
+	}
+
+	msg.SetStructuredMut(payload.Data())
+	return nil
+}
+
+func (l *Lookup) Close(_ context.Context) error {
+	l.nc.Close()
+	return nil
+}
@@ -0,0 +1,179 @@
+package nats_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("KV Lookup", func() {
+	var jsSrv *server.Server
+	var kv jetstream.KeyValue
+	var bucket string
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+		jsSrv = test.RunServer(&opts)
+
+		nc, err := nats2.Connect(jsSrv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			jsSrv.Shutdown()
+		})
+
+		js, err := jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+
+		bucket = "customers_" + nuid.Next()
+		kv, err = js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: bucket})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = kv.PutString(context.Background(), "c1", `{"name": "jane", "tier": "gold"}`)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = kv.PutString(context.Background(), "c2", `plain text`)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	lookup := func(extra string) *nats.Lookup {
+		conf, err := nats.LookupConfigSpec.ParseYAML(fmt.Sprintf("urls: [%s]\nbucket: %s\nkey: this.customer_id\n%s", jsSrv.ClientURL(), bucket, extra), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		l, err := nats.NewLookup(conf, service.MockResources())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(l.Close, context.Background())
+		return l
+	}
+
+	process := func(l *nats.Lookup, body string) (service.MessageBatch, error) {
+		return l.Process(context.Background(), service.NewMessage([]byte(body)))
+	}
+
+	payload := func(batch service.MessageBatch) string {
+		Expect(batch).To(HaveLen(1))
+		b, err := batch[0].AsBytes()
+		Expect(err).NotTo(HaveOccurred())
+		return string(b)
+	}
+
+	It("should merge the value at the path of the payload", func() {
+		l := lookup("path: customer\n")
+
+		batch, err := process(l, `{"customer_id": "c1"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload(batch)).To(MatchJSON(`{"customer_id": "c1", "customer": {"name": "jane", "tier": "gold"}}`))
+
+		batch, err = process(l, `{"customer_id": "c1", "customer": {"id": 1, "tier": "none"}}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload(batch)).To(MatchJSON(`{"customer_id": "c1", "customer": {"id": 1, "name": "jane", "tier": "gold"}}`))
+
+		batch, err = process(l, `{"customer_id": "c2"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload(batch)).To(MatchJSON(`{"customer_id": "c2", "customer": "plain text"}`))
+	})
+
+	It("should merge the value into the root of the payload", func() {
+		batch, err := process(lookup(""), `{"customer_id": "c1"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload(batch)).To(MatchJSON(`{"customer_id": "c1", "name": "jane", "tier": "gold"}`))
+	})
+
+	It("should store the value in metadata", func() {
+		batch, err := process(lookup("metadata: customer\n"), `{"customer_id": "c2"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload(batch)).To(MatchJSON(`{"customer_id": "c2"}`))
+
+		v, ok := batch[0].MetaGet("customer")
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal("plain text"))
+	})
+
+	DescribeTable("should handle missing keys",
+		func(onMissing string, kept bool, fails bool) {
+			batch, err := process(lookup("on_missing: "+onMissing+"\n"), `{"customer_id": "unknown"}`)
+			if fails {
+				Expect(err).To(MatchError(ContainSubstring("key unknown not found")))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(batch).To(HaveLen(map[bool]int{true: 1, false: 0}[kept]))
+		},
+		Entry("keep", nats.LookupMissingKeep, true, false),
+		Entry("drop", nats.LookupMissingDrop, false, false),
+		Entry("fail", nats.LookupMissingFail, false, true),
+	)
+
+	DescribeTable("should handle invalid keys as missing keys",
+		func(key string) {
+			body := fmt.Sprintf(`{"customer_id": %q}`, key)
+
+			batch, err := process(lookup("path: customer\n"), body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(payload(batch)).To(MatchJSON(body))
+
+			batch, err = process(lookup("on_missing: drop\n"), body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(batch).To(BeEmpty())
+		},
+		Entry("with spaces", "customer 1"),
+		Entry("with a wildcard", "c.*"),
+		Entry("with a full wildcard", "c.>"),
+		Entry("empty", ""),
+	)
+
+	It("should serve the values from the cache within its TTL", func() {
+		l := lookup("path: customer\ncache_ttl: 1s\n")
+
+		_, err := process(l, `{"customer_id": "c1"}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = kv.PutString(context.Background(), "c1", `{"name": "john"}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		batch, err := process(l, `{"customer_id": "c1"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload(batch)).To(ContainSubstring("jane"))
+
+		Eventually(func() string {
+			batch, err := process(l, `{"customer_id": "c1"}`)
+			Expect(err).NotTo(HaveOccurred())
+			return payload(batch)
+		}, 5*time.Second, 250*time.Millisecond).Should(ContainSubstring("john"))
+	})
+
+	It("should read through to the bucket without a cache", func() {
+		l := lookup("path: customer\n")
+
+		_, err := process(l, `{"customer_id": "c3"}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = kv.PutString(context.Background(), "c3", `{"name": "joe"}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		batch, err := process(l, `{"customer_id": "c3"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(payload(batch)).To(MatchJSON(`{"customer_id": "c3", "customer": {"name": "joe"}}`))
+	})
+
+	It("should reject a path and a metadata key together", func() {
+		conf, err := nats.LookupConfigSpec.ParseYAML(fmt.Sprintf("urls: [%s]\nbucket: %s\nkey: this.id\npath: a\nmetadata: b\n", jsSrv.ClientURL(), bucket), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = nats.NewLookup(conf, service.MockResources())
+		Expect(err).To(MatchError(ContainSubstring("at most one of a path and a metadata key")))
+	})
+})
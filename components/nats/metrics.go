@@ -178,6 +178,7 @@ type Metrics struct {
 	headers map[string]string
 
 	closedChan chan struct{}
+	closeOnce  sync.Once
 }
 
 func (m *Metrics) NewCounterCtor(path string, labelNames ...string) service.MetricsExporterCounterCtor {
@@ -267,12 +268,16 @@ func (m *Metrics) NewGaugeCtor(path string, labelNames ...string) service.Metric
 	}
 }
 
+// Close stops publishing the metrics and closes the NATS connection. A stream stopped while its
+// Run returns closes its metrics twice, so only the first call has an effect.
 func (m *Metrics) Close(ctx context.Context) error {
-	close(m.closedChan)
+	m.closeOnce.Do(func() {
+		close(m.closedChan)
 
-	if m.nc != nil {
-		m.nc.Close()
-	}
+		if m.nc != nil {
+			m.nc.Close()
+		}
+	})
 
 	return nil
 }
@@ -17,6 +17,8 @@ import (
 	_ "github.com/redpanda-data/benthos/v4/public/components/io"
 	_ "github.com/redpanda-data/benthos/v4/public/components/pure"
 	_ "github.com/redpanda-data/benthos/v4/public/components/pure/extended"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
 )
 
 var _ = Describe("Metrics", func() {
@@ -72,4 +74,15 @@ metrics:
 		}
 
 	})
+
+	It("should only close once", func() {
+		conf, err := nats.MetricsConfigSpec.ParseYAML(fmt.Sprintf("url: %s\nsubject: metrics.%s\n", srv.ClientURL(), nuid.Next()), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		m, err := nats.NewMetrics(conf, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(m.Close(context.Background())).To(Succeed())
+		Expect(m.Close(context.Background())).To(Succeed())
+	})
 })
@@ -0,0 +1,260 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	// MicroErrorCode is the code of the error replies of the requests which could not be processed
+	MicroErrorCode = "500"
+	// MicroStoppingCode is the code of the error replies of the requests received while the service stops
+	MicroStoppingCode = "503"
+
+	microNameField        = "name"
+	microVersionField     = "version"
+	microDescriptionField = "description"
+	microEndpointField    = "endpoint"
+	microSubjectField     = "subject"
+	microQueueGroupField  = "queue_group"
+)
+
+// MicroConfigSpec defines the configuration schema for the nats_micro input.
+var MicroConfigSpec = service.NewConfigSpec().
+	Beta().
+	Categories("Services").
+	Summary("Registers a NATS micro service endpoint, reading its requests and replying once they are processed.").
+	Description("Each request is read as a message whose metadata holds the headers of the request and its subject "+
+		"in nats_subject. Once the message is written by the output, the request receives the synchronous response "+
+		"of the message, such as the one added by a sync_response processor, or an empty reply. When the message "+
+		"cannot be processed or written, the request receives a micro service error with the 500 code and the "+
+		"reason of the failure, which is counted in the statistics of the endpoint. The requests are processed one at "+
+		"a time so that the statistics account for their processing, and several instances sharing the queue group "+
+		"process them concurrently.\n\n"+
+		"The service can be discovered and monitored through the $SRV.PING, $SRV.INFO and $SRV.STATS subjects of the "+
+		"micro framework.").
+	Fields(connectionFields("A list of URLs to connect to")...).
+	Fields(
+		service.NewStringField(microNameField).
+			Description("The name of the service").
+			Example("orders"),
+		service.NewStringField(microVersionField).
+			Description("The semantic version of the service").
+			Default("1.0.0"),
+		service.NewStringField(microDescriptionField).
+			Description("The description of the service").
+			Default(""),
+		service.NewStringField(microEndpointField).
+			Description("The name of the endpoint receiving the requests").
+			Example("create"),
+		service.NewStringField(microSubjectField).
+			Description("The subject of the endpoint, its name unless set").
+			Example("orders.create").
+			Optional(),
+		service.NewStringField(microQueueGroupField).
+			Description("The queue group the instances of the service share, q unless set").
+			Optional(),
+		service.NewExtractTracingSpanMappingField(),
+	)
+
+// NewMicro creates a nats_micro input from the provided configuration.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the connection, service and endpoint
+//
+// Returns:
+//   - A configured Micro instance
+//   - An error if the configuration is invalid
+func NewMicro(conf *service.ParsedConfig) (*Micro, error) {
+	m := &Micro{}
+
+	var err error
+	if m.urls, m.jwt, m.seed, err = connectionFromConfig(conf); err != nil {
+		return nil, err
+	}
+	if m.config.Name, err = conf.FieldString(microNameField); err != nil {
+		return nil, fmt.Errorf("failed to get name field: %w", err)
+	}
+	if m.config.Version, err = conf.FieldString(microVersionField); err != nil {
+		return nil, fmt.Errorf("failed to get version field: %w", err)
+	}
+	if m.config.Description, err = conf.FieldString(microDescriptionField); err != nil {
+		return nil, fmt.Errorf("failed to get description field: %w", err)
+	}
+	if m.endpoint, err = conf.FieldString(microEndpointField); err != nil {
+		return nil, fmt.Errorf("failed to get endpoint field: %w", err)
+	}
+	if conf.Contains(microSubjectField) {
+		if m.subject, err = conf.FieldString(microSubjectField); err != nil {
+			return nil, fmt.Errorf("failed to get subject field: %w", err)
+		}
+	}
+	if conf.Contains(microQueueGroupField) {
+		if m.config.QueueGroup, err = conf.FieldString(microQueueGroupField); err != nil {
+			return nil, fmt.Errorf("failed to get queue_group field: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// Micro is an input reading the requests of a NATS micro service endpoint, and replying to
+// each of them once its message is acknowledged.
+type Micro struct {
+	urls      []string
+	jwt, seed string
+	config    micro.Config
+	endpoint  string
+	subject   string
+
+	mu       sync.Mutex
+	nc       *nats.Conn
+	svc      micro.Service
+	requests chan *microRequest
+	stopped  chan struct{}
+}
+
+// microRequest is a request of the endpoint, replied to exactly once.
+type microRequest struct {
+	micro.Request
+	once sync.Once
+	done chan struct{}
+}
+
+// reply sends the reply of the request unless it was already sent.
+func (r *microRequest) reply(send func() error) error {
+	var err error
+	r.once.Do(func() {
+		err = send()
+		close(r.done)
+	})
+	return err
+}
+
+// stopping replies to the request with an error as the service stops.
+func (r *microRequest) stopping() error {
+	return r.reply(func() error {
+		return r.Error(MicroStoppingCode, "service stopping", nil)
+	})
+}
+
+func (m *Micro) Connect(_ context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.nc != nil {
+		return nil
+	}
+
+	nc, err := connect("Micro", m.urls, m.jwt, m.seed)
+	if err != nil {
+		return err
+	}
+
+	svc, err := micro.AddService(nc, m.config)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to add service %s: %w", m.config.Name, err)
+	}
+
+	// The handler waits for the reply, so that the statistics of the endpoint account for the
+	// processing of the requests and their errors
+	requests, stopped := make(chan *microRequest), make(chan struct{})
+	handler := micro.HandlerFunc(func(req micro.Request) {
+		r := &microRequest{Request: req, done: make(chan struct{})}
+		select {
+		case requests <- r:
+		case <-stopped:
+			_ = r.stopping()
+			return
+		}
+
+		select {
+		case <-r.done:
+		case <-stopped:
+			_ = r.stopping()
+		}
+	})
+
+	var opts []micro.EndpointOpt
+	if m.subject != "" {
+		opts = append(opts, micro.WithEndpointSubject(m.subject))
+	}
+	if err := svc.AddEndpoint(m.endpoint, handler, opts...); err != nil {
+		_ = svc.Stop()
+		nc.Close()
+		return fmt.Errorf("failed to add endpoint %s to service %s: %w", m.endpoint, m.config.Name, err)
+	}
+
+	m.nc, m.svc, m.requests, m.stopped = nc, svc, requests, stopped
+	return nil
+}
+
+func (m *Micro) Read(ctx context.Context) (*service.Message, service.AckFunc, error) {
+	m.mu.Lock()
+	requests, stopped := m.requests, m.stopped
+	m.mu.Unlock()
+
+	if requests == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+
+	var req *microRequest
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	case <-stopped:
+		return nil, nil, service.ErrNotConnected
+	case req = <-requests:
+	}
+
+	msg := service.NewMessage(req.Data())
+	for key, values := range req.Headers() {
+		if len(values) > 0 {
+			msg.MetaSetMut(key, values[0])
+		}
+	}
+	msg.MetaSetMut("nats_subject", req.Subject())
+
+	msg, store := msg.WithSyncResponseStore()
+	return msg, func(_ context.Context, err error) error {
+		return req.reply(func() error {
+			if err != nil {
+				return req.Error(MicroErrorCode, err.Error(), nil)
+			}
+
+			for _, batch := range store.Read() {
+				for _, res := range batch {
+					b, err := res.AsBytes()
+					if err != nil {
+						return req.Error(MicroErrorCode, err.Error(), nil)
+					}
+					return req.Respond(b)
+				}
+			}
+			return req.Respond(nil)
+		})
+	}, nil
+}
+
+func (m *Micro) Close(_ context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped != nil {
+		close(m.stopped)
+	}
+	if m.svc != nil {
+		_ = m.svc.Stop()
+	}
+	if m.nc != nil {
+		m.nc.Close()
+	}
+	m.nc, m.svc, m.requests, m.stopped = nil, nil, nil, nil
+	return nil
+}
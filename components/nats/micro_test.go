@@ -0,0 +1,159 @@
+package nats_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("Micro", func() {
+	var srv *server.Server
+	var nc *nats2.Conn
+	var input *nats.Micro
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		srv = test.RunServer(&opts)
+
+		var err error
+		nc, err = nats2.Connect(srv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			srv.Shutdown()
+		})
+
+		yaml := fmt.Sprintf("urls: [%s]\nname: orders\nversion: 1.2.0\nendpoint: create\nsubject: orders.create\n", srv.ClientURL())
+		conf, err := nats.MicroConfigSpec.ParseYAML(yaml, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		input, err = nats.NewMicro(conf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(input.Connect(context.Background())).To(Succeed())
+		DeferCleanup(input.Close, context.Background())
+	})
+
+	// request sends a request to the endpoint, and processes it with the given function once it is read
+	request := func(payload string, process func(*service.Message) error) *nats2.Msg {
+		replies := make(chan *nats2.Msg, 1)
+		go func() {
+			defer GinkgoRecover()
+			req := nats2.NewMsg("orders.create")
+			req.Data = []byte(payload)
+			req.Header.Set("X-Tenant", "acme")
+			reply, err := nc.RequestMsg(req, 5*time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			replies <- reply
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		msg, ack, err := input.Read(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ack(ctx, process(msg))).To(Succeed())
+
+		var reply *nats2.Msg
+		Eventually(replies, 5*time.Second).Should(Receive(&reply))
+		return reply
+	}
+
+	It("should read the requests with their headers and reply once they are processed", func() {
+		reply := request(`{"id": 1}`, func(msg *service.Message) error {
+			Expect(msg.AsBytes()).To(Equal([]byte(`{"id": 1}`)))
+			tenant, _ := msg.MetaGet("X-Tenant")
+			Expect(tenant).To(Equal("acme"))
+			subject, _ := msg.MetaGet("nats_subject")
+			Expect(subject).To(Equal("orders.create"))
+			return nil
+		})
+
+		Expect(reply.Data).To(BeEmpty())
+		Expect(reply.Header.Get(micro.ErrorCodeHeader)).To(BeEmpty())
+	})
+
+	It("should reply with the synchronous response of the message", func() {
+		reply := request(`{"id": 1}`, func(msg *service.Message) error {
+			res := msg.Copy()
+			res.SetBytes([]byte(`{"id": 1, "status": "created"}`))
+			return res.AddSyncResponse()
+		})
+
+		Expect(string(reply.Data)).To(Equal(`{"id": 1, "status": "created"}`))
+	})
+
+	It("should reply with an error when the message cannot be processed", func() {
+		reply := request(`{"id": 1}`, func(*service.Message) error {
+			return errors.New("duplicate key")
+		})
+
+		Expect(reply.Header.Get(micro.ErrorCodeHeader)).To(Equal(nats.MicroErrorCode))
+		Expect(reply.Header.Get(micro.ErrorHeader)).To(Equal("duplicate key"))
+	})
+
+	It("should continue the trace found in the headers of the requests", func() {
+		propagator := otel.GetTextMapPropagator()
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		DeferCleanup(otel.SetTextMapPropagator, propagator)
+
+		traces := make(chan trace.TraceID, 1)
+		sb := service.NewStreamBuilder()
+		Expect(sb.AddInputYAML(fmt.Sprintf("nats_micro:\n  urls: [%s]\n  name: payments\n  endpoint: charge\n  extract_tracing_map: root = @\n", srv.ClientURL()))).To(Succeed())
+		Expect(sb.AddProcessorYAML("sync_response: {}")).To(Succeed())
+		Expect(sb.AddConsumerFunc(func(_ context.Context, m *service.Message) error {
+			traces <- trace.SpanContextFromContext(m.Context()).TraceID()
+			return nil
+		})).To(Succeed())
+		stream, err := sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		go func() { _ = stream.Run(ctx) }()
+		DeferCleanup(stream.Stop, context.Background())
+
+		req := nats2.NewMsg("charge")
+		req.Data = []byte(`{"id": 1}`)
+		req.Header.Set("traceparent", "00-0102030405060708090a0b0c0d0e0f10-0102030405060708-01")
+		var reply *nats2.Msg
+		Eventually(func() error {
+			reply, err = nc.RequestMsg(req, time.Second)
+			return err
+		}, 5*time.Second, 100*time.Millisecond).Should(Succeed())
+		Expect(string(reply.Data)).To(Equal(`{"id": 1}`))
+
+		var traceID trace.TraceID
+		Eventually(traces, 5*time.Second).Should(Receive(&traceID))
+		Expect(traceID.String()).To(Equal("0102030405060708090a0b0c0d0e0f10"))
+	})
+
+	It("should be discoverable with its statistics", func() {
+		request(`{}`, func(*service.Message) error { return errors.New("failed") })
+
+		res, err := nc.Request("$SRV.STATS.orders", nil, 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+
+		var stats micro.Stats
+		Expect(json.Unmarshal(res.Data, &stats)).To(Succeed())
+		Expect(stats.Version).To(Equal("1.2.0"))
+		Expect(stats.Endpoints).To(HaveLen(1))
+		Expect(stats.Endpoints[0].Subject).To(Equal("orders.create"))
+		Expect(stats.Endpoints[0].NumRequests).To(Equal(1))
+		Expect(stats.Endpoints[0].NumErrors).To(Equal(1))
+	})
+})
@@ -0,0 +1,394 @@
+package nats
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	// ObjectStoreBucketMeta is the metadata key holding the bucket of an object read by the nats_object_store input
+	ObjectStoreBucketMeta = "nats_object_store_bucket"
+	// ObjectStoreNameMeta is the metadata key holding the name of an object read by the nats_object_store input
+	ObjectStoreNameMeta = "nats_object_store_name"
+	// ObjectStoreSizeMeta is the metadata key holding the size in bytes of an object read by the nats_object_store input
+	ObjectStoreSizeMeta = "nats_object_store_size"
+	// ObjectStoreDigestMeta is the metadata key holding the digest of an object read by the nats_object_store input
+	ObjectStoreDigestMeta = "nats_object_store_digest"
+	// ObjectStoreModifiedMeta is the metadata key holding the RFC 3339 modification time of an object read by the nats_object_store input
+	ObjectStoreModifiedMeta = "nats_object_store_modified"
+
+	objectStoreBucketField      = "bucket"
+	objectStoreUpdatesOnlyField = "updates_only"
+	objectStoreScannerField     = "scanner"
+	objectStoreNameField        = "name"
+	objectStoreMetadataField    = "metadata"
+)
+
+// ObjectStoreInputConfigSpec defines the configuration schema for the nats_object_store input.
+var ObjectStoreInputConfigSpec = service.NewConfigSpec().
+	Beta().
+	Categories("Services").
+	Summary("Watches a NATS object store bucket, reading the objects as they are put or updated.").
+	Description("The objects present in the bucket are read first, unless updates_only is set, followed by the "+
+		"objects put or updated later. Deleted objects are skipped. Each object is broken into messages by the "+
+		"scanner, which carry the bucket, name, size, digest and modification time of the object in the "+
+		"nats_object_store_* metadata, along with the metadata of the object itself.\n\n"+
+		"The watch does not record the objects already read, so a restarted input reads the objects present in the "+
+		"bucket again unless updates_only is set.").
+	Fields(connectionFields("A list of URLs to connect to")...).
+	Fields(
+		service.NewStringField(objectStoreBucketField).
+			Description("The object store bucket to watch").
+			Example("my_object_bucket"),
+		service.NewBoolField(objectStoreUpdatesOnlyField).
+			Description("Only read the objects put or updated after the input started").
+			Default(false),
+		service.NewScannerField(objectStoreScannerField).
+			Description("The scanner by which the content of an object is broken out into individual messages").
+			Default(map[string]any{"to_the_end": map[string]any{}}),
+		service.NewAutoRetryNacksToggleField(),
+	)
+
+// ObjectStoreOutputConfigSpec defines the configuration schema for the nats_object_store output.
+var ObjectStoreOutputConfigSpec = service.NewConfigSpec().
+	Beta().
+	Categories("Services").
+	Summary("Puts messages as objects in a NATS object store bucket.").
+	Description("Each message is written as an object named after the name interpolation, replacing the object "+
+		"of the same name if any. The message metadata selected by the metadata filter is stored as the metadata "+
+		"of the object.").
+	Fields(connectionFields("A list of URLs to connect to")...).
+	Fields(
+		service.NewStringField(objectStoreBucketField).
+			Description("The object store bucket receiving the objects").
+			Example("my_object_bucket"),
+		service.NewInterpolatedStringField(objectStoreNameField).
+			Description("The name of the object of each message").
+			Example(`${! meta("path") }`).
+			Example(`reports/${! json("id") }.json`),
+		service.NewMetadataFilterField(objectStoreMetadataField).
+			Description("The message metadata stored as the metadata of the object").
+			Optional(),
+		service.NewOutputMaxInFlightField().Default(64),
+	)
+
+// NewObjectStoreInput creates a nats_object_store input from the provided configuration.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the connection, bucket and scanner
+//
+// Returns:
+//   - A configured ObjectStoreInput instance
+//   - An error if the configuration is invalid
+func NewObjectStoreInput(conf *service.ParsedConfig) (*ObjectStoreInput, error) {
+	i := &ObjectStoreInput{}
+
+	var err error
+	if i.urls, i.jwt, i.seed, err = connectionFromConfig(conf); err != nil {
+		return nil, err
+	}
+	if i.bucket, err = conf.FieldString(objectStoreBucketField); err != nil {
+		return nil, fmt.Errorf("failed to get bucket field: %w", err)
+	}
+	if i.updatesOnly, err = conf.FieldBool(objectStoreUpdatesOnlyField); err != nil {
+		return nil, fmt.Errorf("failed to get updates_only field: %w", err)
+	}
+	if i.scanners, err = conf.FieldScanner(objectStoreScannerField); err != nil {
+		return nil, fmt.Errorf("failed to get scanner field: %w", err)
+	}
+
+	return i, nil
+}
+
+// ObjectStoreInput is an input reading the objects of a NATS object store bucket as they are
+// put or updated.
+type ObjectStoreInput struct {
+	urls        []string
+	jwt, seed   string
+	bucket      string
+	updatesOnly bool
+	scanners    *service.OwnedScannerCreator
+
+	mu      sync.Mutex
+	nc      *nats.Conn
+	store   jetstream.ObjectStore
+	watcher jetstream.ObjectWatcher
+
+	// scanner breaks the object being read into messages, and object describes it
+	scanner *service.OwnedScanner
+	object  *jetstream.ObjectInfo
+}
+
+func (i *ObjectStoreInput) Connect(ctx context.Context) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.nc != nil {
+		return nil
+	}
+
+	nc, err := connect("Object Store Input", i.urls, i.jwt, i.seed)
+	if err != nil {
+		return err
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	store, err := js.ObjectStore(ctx, i.bucket)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to open object store %s: %w", i.bucket, err)
+	}
+
+	opts := []jetstream.WatchOpt{jetstream.IgnoreDeletes()}
+	if i.updatesOnly {
+		opts = append(opts, jetstream.UpdatesOnly())
+	}
+
+	// The watch outlives the connection attempt, so it is not bound to its context
+	watcher, err := store.Watch(context.Background(), opts...)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to watch object store %s: %w", i.bucket, err)
+	}
+
+	i.nc, i.store, i.watcher = nc, store, watcher
+	return nil
+}
+
+func (i *ObjectStoreInput) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.nc == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+
+	for {
+		if i.scanner == nil {
+			if err := i.next(ctx); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		batch, ack, err := i.scanner.NextBatch(ctx)
+		if errors.Is(err, io.EOF) {
+			_ = i.scanner.Close(ctx)
+			i.scanner, i.object = nil, nil
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, msg := range batch {
+			for k, v := range i.object.Metadata {
+				msg.MetaSetMut(k, v)
+			}
+			msg.MetaSetMut(ObjectStoreBucketMeta, i.bucket)
+			msg.MetaSetMut(ObjectStoreNameMeta, i.object.Name)
+			msg.MetaSetMut(ObjectStoreSizeMeta, strconv.FormatUint(i.object.Size, 10))
+			msg.MetaSetMut(ObjectStoreDigestMeta, i.object.Digest)
+			msg.MetaSetMut(ObjectStoreModifiedMeta, i.object.ModTime.Format(time.RFC3339Nano))
+		}
+
+		return batch, ack, nil
+	}
+}
+
+// next waits for the next object put or updated in the bucket and opens a scanner on it.
+func (i *ObjectStoreInput) next(ctx context.Context) error {
+	var info *jetstream.ObjectInfo
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case u, ok := <-i.watcher.Updates():
+		if !ok {
+			i.disconnect()
+			return service.ErrNotConnected
+		}
+		// a nil update marks the end of the objects present when the watch started
+		if u == nil {
+			return nil
+		}
+		info = u
+	}
+
+	object, err := i.store.Get(ctx, info.Name)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		// the object was deleted since it was updated
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read object %s from object store %s: %w", info.Name, i.bucket, err)
+	}
+
+	details := service.NewScannerSourceDetails()
+	details.SetName(info.Name)
+	scanner, err := i.scanners.Create(object, func(context.Context, error) error { return nil }, details)
+	if err != nil {
+		_ = object.Close()
+		return fmt.Errorf("failed to scan object %s: %w", info.Name, err)
+	}
+
+	i.scanner, i.object = scanner, info
+	return nil
+}
+
+// disconnect releases the watch and connection, so that the input connects again.
+func (i *ObjectStoreInput) disconnect() {
+	if i.scanner != nil {
+		_ = i.scanner.Close(context.Background())
+		i.scanner, i.object = nil, nil
+	}
+	if i.watcher != nil {
+		_ = i.watcher.Stop()
+	}
+	if i.nc != nil {
+		i.nc.Close()
+	}
+	i.nc, i.store, i.watcher = nil, nil, nil
+}
+
+func (i *ObjectStoreInput) Close(ctx context.Context) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.disconnect()
+	return i.scanners.Close(ctx)
+}
+
+// NewObjectStoreOutput creates a nats_object_store output from the provided configuration.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the connection, bucket and object name
+//
+// Returns:
+//   - A configured ObjectStoreOutput instance
+//   - An error if the configuration is invalid
+func NewObjectStoreOutput(conf *service.ParsedConfig) (*ObjectStoreOutput, error) {
+	o := &ObjectStoreOutput{}
+
+	var err error
+	if o.urls, o.jwt, o.seed, err = connectionFromConfig(conf); err != nil {
+		return nil, err
+	}
+	if o.bucket, err = conf.FieldString(objectStoreBucketField); err != nil {
+		return nil, fmt.Errorf("failed to get bucket field: %w", err)
+	}
+	if o.name, err = conf.FieldInterpolatedString(objectStoreNameField); err != nil {
+		return nil, fmt.Errorf("failed to get name field: %w", err)
+	}
+	if conf.Contains(objectStoreMetadataField) {
+		if o.metadata, err = conf.FieldMetadataFilter(objectStoreMetadataField); err != nil {
+			return nil, fmt.Errorf("failed to get metadata field: %w", err)
+		}
+	}
+
+	return o, nil
+}
+
+// ObjectStoreOutput is an output putting messages as objects in a NATS object store bucket.
+type ObjectStoreOutput struct {
+	urls      []string
+	jwt, seed string
+	bucket    string
+	name      *service.InterpolatedString
+	metadata  *service.MetadataFilter
+
+	mu    sync.RWMutex
+	nc    *nats.Conn
+	store jetstream.ObjectStore
+}
+
+func (o *ObjectStoreOutput) Connect(ctx context.Context) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.nc != nil {
+		return nil
+	}
+
+	nc, err := connect("Object Store Output", o.urls, o.jwt, o.seed)
+	if err != nil {
+		return err
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	store, err := js.ObjectStore(ctx, o.bucket)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("failed to open object store %s: %w", o.bucket, err)
+	}
+
+	o.nc, o.store = nc, store
+	return nil
+}
+
+func (o *ObjectStoreOutput) Write(ctx context.Context, msg *service.Message) error {
+	o.mu.RLock()
+	store := o.store
+	o.mu.RUnlock()
+
+	if store == nil {
+		return service.ErrNotConnected
+	}
+
+	name, err := o.name.TryString(msg)
+	if err != nil {
+		return fmt.Errorf("failed to interpolate object name: %w", err)
+	}
+	if name == "" {
+		return errors.New("the object name is empty")
+	}
+
+	payload, err := msg.AsBytes()
+	if err != nil {
+		return err
+	}
+
+	meta := jetstream.ObjectMeta{Name: name}
+	if o.metadata != nil {
+		meta.Metadata = map[string]string{}
+		_ = o.metadata.Walk(msg, func(k, v string) error {
+			meta.Metadata[k] = v
+			return nil
+		})
+	}
+
+	if _, err := store.Put(ctx, meta, bytes.NewReader(payload)); err != nil {
+		return fmt.Errorf("failed to put object %s in object store %s: %w", name, o.bucket, err)
+	}
+	return nil
+}
+
+func (o *ObjectStoreOutput) Close(_ context.Context) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.nc != nil {
+		o.nc.Close()
+	}
+	o.nc, o.store = nil, nil
+	return nil
+}
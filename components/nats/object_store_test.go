@@ -0,0 +1,159 @@
+package nats_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("Object Store", func() {
+	var jsSrv *server.Server
+	var store jetstream.ObjectStore
+	var bucket string
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+		jsSrv = test.RunServer(&opts)
+
+		nc, err := nats2.Connect(jsSrv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			jsSrv.Shutdown()
+		})
+
+		js, err := jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+
+		bucket = "objects_" + nuid.Next()
+		store, err = js.CreateObjectStore(context.Background(), jetstream.ObjectStoreConfig{Bucket: bucket})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	input := func(extra string) *nats.ObjectStoreInput {
+		conf, err := nats.ObjectStoreInputConfigSpec.ParseYAML(fmt.Sprintf("urls: [%s]\nbucket: %s\n%s", jsSrv.ClientURL(), bucket, extra), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		i, err := nats.NewObjectStoreInput(conf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(i.Connect(context.Background())).To(Succeed())
+		DeferCleanup(i.Close, context.Background())
+		return i
+	}
+
+	output := func(extra string) *nats.ObjectStoreOutput {
+		conf, err := nats.ObjectStoreOutputConfigSpec.ParseYAML(fmt.Sprintf("urls: [%s]\nbucket: %s\n%s", jsSrv.ClientURL(), bucket, extra), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		o, err := nats.NewObjectStoreOutput(conf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(o.Connect(context.Background())).To(Succeed())
+		DeferCleanup(o.Close, context.Background())
+		return o
+	}
+
+	read := func(i *nats.ObjectStoreInput) service.MessageBatch {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		batch, ack, err := i.ReadBatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ack(ctx, nil)).To(Succeed())
+		return batch
+	}
+
+	contents := func(batch service.MessageBatch) []string {
+		var result []string
+		for _, msg := range batch {
+			b, err := msg.AsBytes()
+			Expect(err).NotTo(HaveOccurred())
+			result = append(result, string(b))
+		}
+		return result
+	}
+
+	It("should read the existing and updated objects with their metadata", func() {
+		_, err := store.Put(context.Background(), jetstream.ObjectMeta{Name: "a.txt"}, strings.NewReader("first"))
+		Expect(err).NotTo(HaveOccurred())
+
+		i := input("")
+		batch := read(i)
+		Expect(contents(batch)).To(Equal([]string{"first"}))
+		name, _ := batch[0].MetaGet(nats.ObjectStoreNameMeta)
+		Expect(name).To(Equal("a.txt"))
+		b, _ := batch[0].MetaGet(nats.ObjectStoreBucketMeta)
+		Expect(b).To(Equal(bucket))
+		size, _ := batch[0].MetaGet(nats.ObjectStoreSizeMeta)
+		Expect(size).To(Equal("5"))
+		digest, _ := batch[0].MetaGet(nats.ObjectStoreDigestMeta)
+		Expect(digest).To(HavePrefix("SHA-256="))
+
+		_, err = store.Put(context.Background(), jetstream.ObjectMeta{Name: "b.txt", Metadata: map[string]string{"owner": "bob"}}, strings.NewReader("second"))
+		Expect(err).NotTo(HaveOccurred())
+
+		batch = read(i)
+		Expect(contents(batch)).To(Equal([]string{"second"}))
+		owner, _ := batch[0].MetaGet("owner")
+		Expect(owner).To(Equal("bob"))
+	})
+
+	It("should break objects into messages with the scanner and skip the existing objects in updates only mode", func() {
+		_, err := store.PutString(context.Background(), "old.txt", "old")
+		Expect(err).NotTo(HaveOccurred())
+
+		i := input("updates_only: true\nscanner:\n  lines: {}\n")
+
+		_, err = store.PutString(context.Background(), "new.txt", "one\ntwo\nthree")
+		Expect(err).NotTo(HaveOccurred())
+
+		var lines []string
+		for len(lines) < 3 {
+			batch := read(i)
+			for _, msg := range batch {
+				name, _ := msg.MetaGet(nats.ObjectStoreNameMeta)
+				Expect(name).To(Equal("new.txt"))
+			}
+			lines = append(lines, contents(batch)...)
+		}
+		Expect(lines).To(Equal([]string{"one", "two", "three"}))
+	})
+
+	It("should put messages as objects named by the interpolation with their metadata", func() {
+		o := output("name: ${! meta(\"id\") }.json\nmetadata:\n  include_prefixes: [x_]\n")
+
+		msg := service.NewMessage([]byte(`{"hello": "world"}`))
+		msg.MetaSetMut("id", "42")
+		msg.MetaSetMut("x_source", "test")
+		Expect(o.Write(context.Background(), msg)).To(Succeed())
+
+		b, err := store.GetBytes(context.Background(), "42.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(Equal(`{"hello": "world"}`))
+
+		info, err := store.GetInfo(context.Background(), "42.json")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Metadata).To(Equal(map[string]string{"x_source": "test"}))
+	})
+
+	It("should fail the messages without object name", func() {
+		o := output("name: ${! meta(\"missing\").or(\"\") }\n")
+
+		err := o.Write(context.Background(), service.NewMessage([]byte("x")))
+		Expect(err).To(MatchError(ContainSubstring("empty")))
+	})
+})
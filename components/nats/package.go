@@ -11,4 +11,215 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+
+	err = service.RegisterProcessor(
+		"schema_validate", ValidateConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+			return NewValidate(conf)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterProcessor(
+		"schema_encode", EncodeConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+			return NewSchemaCodecProcessor(conf, false)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterProcessor(
+		"schema_decode", DecodeConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+			return NewSchemaCodecProcessor(conf, true)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterProcessor(
+		"nats_dedupe", DedupeConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+			return NewDedupe(conf, mgr)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterOutput(
+		"nats_dedupe_release", DedupeReleaseConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Output, int, error) {
+			maxInFlight, err := conf.FieldMaxInFlight()
+			if err != nil {
+				return nil, 0, err
+			}
+			r, err := NewDedupeRelease(conf, mgr)
+			if err != nil {
+				return nil, 0, err
+			}
+			return r, maxInFlight, nil
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterProcessor(
+		"nats_kv_lookup", LookupConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+			return NewLookup(conf, mgr)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterProcessor(
+		"field_protect", ProtectConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+			return NewProtect(conf, false)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterProcessor(
+		"field_decrypt", DecryptConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+			return NewProtect(conf, true)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterProcessor(
+		"nats_object_offload", OffloadConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+			return NewOffload(conf)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterProcessor(
+		"nats_object_rehydrate", RehydrateConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+			return NewRehydrate(conf)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterProcessor(
+		"nats_request", RequestConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Processor, error) {
+			return NewRequest(conf, mgr)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterBatchInput(
+		"nats_object_store", ObjectStoreInputConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchInput, error) {
+			i, err := NewObjectStoreInput(conf)
+			if err != nil {
+				return nil, err
+			}
+			return service.AutoRetryNacksBatchedToggled(conf, i)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterOutput(
+		"nats_object_store", ObjectStoreOutputConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Output, int, error) {
+			maxInFlight, err := conf.FieldMaxInFlight()
+			if err != nil {
+				return nil, 0, err
+			}
+			o, err := NewObjectStoreOutput(conf)
+			if err != nil {
+				return nil, 0, err
+			}
+			return o, maxInFlight, nil
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterInput(
+		"nats_kv_watch", KvWatchConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Input, error) {
+			w, err := NewKvWatch(conf)
+			if err != nil {
+				return nil, err
+			}
+			return service.AutoRetryNacksToggled(conf, w)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterInput(
+		"nats_jetstream_pull", JetStreamPullConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Input, error) {
+			p, err := NewJetStreamPull(conf)
+			if err != nil {
+				return nil, err
+			}
+			return conf.WrapInputExtractTracingSpanMapping("nats_jetstream_pull", p)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterInput(
+		"nats_micro", MicroConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Input, error) {
+			m, err := NewMicro(conf)
+			if err != nil {
+				return nil, err
+			}
+			return conf.WrapInputExtractTracingSpanMapping("nats_micro", m)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterOutput(
+		"nats_kv_write", KvWriteConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Output, int, error) {
+			maxInFlight, err := conf.FieldMaxInFlight()
+			if err != nil {
+				return nil, 0, err
+			}
+			w, err := NewKvWrite(conf, mgr)
+			if err != nil {
+				return nil, 0, err
+			}
+			return w, maxInFlight, nil
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterRateLimit(
+		"nats_kv", RateLimitConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.RateLimit, error) {
+			return NewRateLimit(conf, mgr)
+		})
+	if err != nil {
+		panic(err)
+	}
+
+	err = service.RegisterBatchBuffer(
+		"aggregate_window", AggregateConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchBuffer, error) {
+			return NewAggregate(conf, mgr)
+		})
+	if err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,455 @@
+package nats
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	// ProtectMask replaces the characters of a value with asterisks
+	ProtectMask = "mask"
+	// ProtectHash replaces a value with its HMAC-SHA256, in hex
+	ProtectHash = "hash"
+	// ProtectEncrypt replaces a value with its AES-GCM encryption, which field_decrypt reverses
+	ProtectEncrypt = "encrypt"
+
+	// EncryptedPrefix starts the values encrypted by field_protect
+	EncryptedPrefix = "enc:"
+
+	// MalformedCiphertextError prefixes the errors of the messages field_decrypt cannot decrypt
+	// because their values were not encrypted by field_protect, as opposed to the values which
+	// do not decrypt with the key
+	MalformedCiphertextError = "malformed ciphertext"
+
+	protectFieldsField        = "fields"
+	protectPathField          = "path"
+	protectHeaderField        = "header"
+	protectActionField        = "action"
+	protectKeepLastField      = "keep_last"
+	protectDeterministicField = "deterministic"
+	protectKeyField           = "key"
+	protectKeyEnvField        = "env"
+	protectKeyBucketField     = "bucket"
+	protectKeyKVKeyField      = "key"
+
+	// protectMinKeyLength is the minimum length of the secret the keys are derived from
+	protectMinKeyLength = 16
+)
+
+var (
+	errNotEncrypted     = errors.New("the value is not encrypted")
+	errInvalidPlaintext = errors.New("the decrypted value is not valid JSON")
+)
+
+func protectConfigSpec(summary, description string, decrypt bool) *service.ConfigSpec {
+	field := []*service.ConfigField{
+		service.NewStringField(protectPathField).
+			Description("The dot separated path of the payload field, exclusive with header").
+			Optional(),
+		service.NewStringField(protectHeaderField).
+			Description("The name of the header, exclusive with path").
+			Optional(),
+	}
+	if !decrypt {
+		field = append(field,
+			service.NewStringEnumField(protectActionField, ProtectMask, ProtectHash, ProtectEncrypt).
+				Description("How the value is protected").
+				Default(ProtectEncrypt),
+			service.NewIntField(protectKeepLastField).
+				Description("The number of trailing characters left unmasked").
+				Default(0),
+		)
+	}
+
+	spec := service.NewConfigSpec().
+		Beta().
+		Summary(summary).
+		Description(description).
+		Fields(connectionFields("The urls of the NATS servers holding the key, when read from a KV bucket")...).
+		Fields(
+			service.NewObjectListField(protectFieldsField, field...).
+				Description("The payload fields and headers to process"),
+			service.NewObjectField(protectKeyField,
+				service.NewStringField(protectKeyEnvField).
+					Description("The environment variable holding the secret").
+					Optional(),
+				service.NewStringField(protectKeyBucketField).
+					Description("The KV bucket holding the secret").
+					Optional(),
+				service.NewStringField(protectKeyKVKeyField).
+					Description("The KV key holding the secret").
+					Optional(),
+			).Description("Where the secret the hashing and encryption keys are derived from is read, either an "+
+				"environment variable or a KV bucket and key").
+				Optional(),
+		)
+
+	if !decrypt {
+		spec = spec.Field(service.NewBoolField(protectDeterministicField).
+			Description("Whether equal values encrypt to equal values, keeping them joinable at the cost of revealing " +
+				"which values are equal").
+			Default(false))
+	}
+
+	return spec
+}
+
+// ProtectConfigSpec defines the configuration schema for the field_protect processor.
+var ProtectConfigSpec = protectConfigSpec(
+	"mask, hash or encrypt payload fields and headers of the messages",
+	"Masked values keep their trailing characters, hashed values are replaced by their HMAC-SHA256 and encrypted "+
+		"values by their AES-GCM encryption, prefixed with "+EncryptedPrefix+". Payload values are encrypted with "+
+		"their JSON type, so that field_decrypt restores them as they were. Missing fields and headers are skipped.",
+	false)
+
+// DecryptConfigSpec defines the configuration schema for the field_decrypt processor.
+var DecryptConfigSpec = protectConfigSpec(
+	"decrypt payload fields and headers encrypted by field_protect",
+	"Missing fields and headers are skipped, and messages holding values which cannot be decrypted fail.",
+	true)
+
+// protectedField is a payload field or header processed by a Protect processor.
+type protectedField struct {
+	path     string
+	header   string
+	action   string
+	keepLast int
+}
+
+// NewProtect creates a field_protect or field_decrypt processor from the provided configuration,
+// reading its secret from the environment or a NATS KV bucket.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the fields and the source of the secret
+//   - decrypt: Whether the processor decrypts rather than protects the fields
+//
+// Returns:
+//   - A configured Protect instance
+//   - An error if the configuration is invalid or the secret could not be read
+func NewProtect(conf *service.ParsedConfig, decrypt bool) (*Protect, error) {
+	p := &Protect{decrypt: decrypt}
+
+	objs, err := conf.FieldObjectList(protectFieldsField)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fields field: %w", err)
+	}
+	if len(objs) == 0 {
+		return nil, errors.New("at least one field or header is required")
+	}
+
+	needsKey := decrypt
+	for i, obj := range objs {
+		f := protectedField{action: ProtectEncrypt}
+		f.path, _ = obj.FieldString(protectPathField)
+		f.header, _ = obj.FieldString(protectHeaderField)
+		if (f.path == "") == (f.header == "") {
+			return nil, fmt.Errorf("field %d: exactly one of a path and a header is required", i)
+		}
+
+		if !decrypt {
+			if f.action, err = obj.FieldString(protectActionField); err != nil {
+				return nil, fmt.Errorf("field %d: failed to get action field: %w", i, err)
+			}
+			if f.keepLast, err = obj.FieldInt(protectKeepLastField); err != nil {
+				return nil, fmt.Errorf("field %d: failed to get keep_last field: %w", i, err)
+			}
+			needsKey = needsKey || f.action != ProtectMask
+		}
+
+		p.fields = append(p.fields, f)
+	}
+
+	if !decrypt {
+		if p.deterministic, err = conf.FieldBool(protectDeterministicField); err != nil {
+			return nil, fmt.Errorf("failed to get deterministic field: %w", err)
+		}
+	}
+
+	if !needsKey {
+		return p, nil
+	}
+
+	secret, err := readProtectSecret(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Distinct keys are derived for hashing and encrypting so that the hash of a value reveals
+	// nothing about its encryption
+	p.hashKey = deriveKey(secret, "hash")
+	block, err := aes.NewCipher(deriveKey(secret, "encrypt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the cipher: %w", err)
+	}
+	if p.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, fmt.Errorf("failed to create the cipher: %w", err)
+	}
+	p.nonceKey = deriveKey(secret, "nonce")
+
+	return p, nil
+}
+
+// readProtectSecret reads the secret from the environment variable or the KV key of the configuration.
+func readProtectSecret(conf *service.ParsedConfig) ([]byte, error) {
+	if !conf.Contains(protectKeyField) {
+		return nil, errors.New("a key is required to hash, encrypt or decrypt values")
+	}
+
+	key := conf.Namespace(protectKeyField)
+	env, _ := key.FieldString(protectKeyEnvField)
+	bucket, _ := key.FieldString(protectKeyBucketField)
+	kvKey, _ := key.FieldString(protectKeyKVKeyField)
+
+	var secret []byte
+	switch {
+	case env != "" && bucket == "" && kvKey == "":
+		secret = []byte(os.Getenv(env))
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("environment variable %s holding the key is not set", env)
+		}
+	case env == "" && bucket != "" && kvKey != "":
+		urls, jwt, seed, err := connectionFromConfig(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		nc, err := connect("Protect", urls, jwt, seed)
+		if err != nil {
+			return nil, err
+		}
+		defer nc.Close()
+
+		js, err := jetstream.New(nc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+		}
+
+		kv, err := js.KeyValue(context.Background(), bucket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open kv bucket %s: %w", bucket, err)
+		}
+
+		entry, err := kv.Get(context.Background(), kvKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s from kv bucket %s: %w", kvKey, bucket, err)
+		}
+		secret = entry.Value()
+	default:
+		return nil, errors.New("the key is read from either an environment variable or a KV bucket and key")
+	}
+
+	if len(secret) < protectMinKeyLength {
+		return nil, fmt.Errorf("the key must be at least %d bytes long", protectMinKeyLength)
+	}
+	return secret, nil
+}
+
+// deriveKey derives a 256 bit key for the given purpose from the secret.
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("connect-field-protect-" + purpose))
+	return mac.Sum(nil)
+}
+
+// Protect is a processor masking, hashing, encrypting or decrypting payload fields and headers.
+type Protect struct {
+	fields        []protectedField
+	decrypt       bool
+	deterministic bool
+
+	hashKey  []byte
+	nonceKey []byte
+	aead     cipher.AEAD
+}
+
+func (p *Protect) Process(_ context.Context, msg *service.Message) (service.MessageBatch, error) {
+	var payload *gabs.Container
+	for _, f := range p.fields {
+		if f.header != "" {
+			v, ok := msg.MetaGetMut(f.header)
+			if !ok {
+				continue
+			}
+
+			s, ok := v.(string)
+			if !ok {
+				s = fmt.Sprint(v)
+			}
+
+			res, err := p.processHeader(f, s)
+			if err != nil {
+				return nil, p.fail(fmt.Errorf("header %s: %w", f.header, err))
+			}
+			msg.MetaSetMut(f.header, res)
+			continue
+		}
+
+		if payload == nil {
+			root, err := msg.AsStructuredMut()
+			if err != nil {
+				if p.decrypt {
+					return nil, fmt.Errorf("%s: failed to parse the payload: %w", MalformedCiphertextError, err)
+				}
+				return nil, fmt.Errorf("failed to parse the payload: %w", err)
+			}
+			payload = gabs.Wrap(root)
+		}
+
+		if !payload.ExistsP(f.path) {
+			continue
+		}
+
+		res, err := p.processValue(f, payload.Path(f.path).Data())
+		if err != nil {
+			return nil, p.fail(fmt.Errorf("field %s: %w", f.path, err))
+		}
+		if _, err := payload.SetP(res, f.path); err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.path, err)
+		}
+	}
+
+	if payload != nil {
+		msg.SetStructuredMut(payload.Data())
+	}
+	return service.MessageBatch{msg}, nil
+}
+
+// fail prefixes the errors of the values which were not encrypted by field_protect with
+// MalformedCiphertextError when decrypting, so that they can be told apart from the values
+// which do not decrypt with the key.
+func (p *Protect) fail(err error) error {
+	if p.decrypt && (errors.Is(err, errNotEncrypted) || errors.Is(err, errInvalidPlaintext)) {
+		return fmt.Errorf("%s: %w", MalformedCiphertextError, err)
+	}
+	return err
+}
+
+// processHeader protects or decrypts the value of a header.
+func (p *Protect) processHeader(f protectedField, v string) (string, error) {
+	if p.decrypt {
+		b, err := p.decryptValue(v)
+		return string(b), err
+	}
+
+	switch f.action {
+	case ProtectMask:
+		return mask(v, f.keepLast), nil
+	case ProtectHash:
+		return p.hash([]byte(v)), nil
+	default:
+		return p.encrypt([]byte(v)), nil
+	}
+}
+
+// processValue protects or decrypts the value of a payload field. Strings are masked and
+// hashed as they are, other values as JSON, and all values are encrypted as JSON.
+func (p *Protect) processValue(f protectedField, v any) (any, error) {
+	if p.decrypt {
+		s, ok := v.(string)
+		if !ok {
+			return nil, errNotEncrypted
+		}
+
+		b, err := p.decryptValue(s)
+		if err != nil {
+			return nil, err
+		}
+
+		// Numbers are kept as json.Number, as in the payloads parsed by Benthos, so that large
+		// integers survive the round trip
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		var res any
+		if err := dec.Decode(&res); err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidPlaintext, err)
+		}
+		return res, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.action == ProtectEncrypt {
+		return p.encrypt(b), nil
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		s = string(b)
+	}
+	if f.action == ProtectMask {
+		return mask(s, f.keepLast), nil
+	}
+	return p.hash([]byte(s)), nil
+}
+
+func (p *Protect) hash(v []byte) string {
+	mac := hmac.New(sha256.New, p.hashKey)
+	mac.Write(v)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// encrypt seals a value with a random nonce, or in deterministic mode with a nonce derived
+// from the value so that equal values encrypt to equal values.
+func (p *Protect) encrypt(v []byte) string {
+	var nonce []byte
+	if p.deterministic {
+		mac := hmac.New(sha256.New, p.nonceKey)
+		mac.Write(v)
+		nonce = mac.Sum(nil)[:p.aead.NonceSize()]
+	} else {
+		nonce = make([]byte, p.aead.NonceSize())
+		_, _ = rand.Read(nonce)
+	}
+
+	return EncryptedPrefix + base64.RawURLEncoding.EncodeToString(p.aead.Seal(nonce, nonce, v, nil))
+}
+
+func (p *Protect) decryptValue(v string) ([]byte, error) {
+	s, ok := strings.CutPrefix(v, EncryptedPrefix)
+	if !ok {
+		return nil, errNotEncrypted
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) < p.aead.NonceSize() {
+		return nil, errNotEncrypted
+	}
+
+	res, err := p.aead.Open(nil, b[:p.aead.NonceSize()], b[p.aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the value: %w", err)
+	}
+	return res, nil
+}
+
+// mask replaces the characters of a value with asterisks, but for the last keepLast ones.
+func mask(v string, keepLast int) string {
+	runes := []rune(v)
+	for i := range max(len(runes)-keepLast, 0) {
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+func (p *Protect) Close(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,199 @@
+package nats_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("Protect", func() {
+	const secret = "0123456789abcdef0123456789abcdef"
+
+	BeforeEach(func() {
+		GinkgoT().Setenv("PROTECT_TEST_KEY", secret)
+	})
+
+	processor := func(yaml string, decrypt bool) *nats.Protect {
+		spec := nats.ProtectConfigSpec
+		if decrypt {
+			spec = nats.DecryptConfigSpec
+		}
+
+		conf, err := spec.ParseYAML(yaml, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		p, err := nats.NewProtect(conf, decrypt)
+		Expect(err).NotTo(HaveOccurred())
+		return p
+	}
+
+	process := func(p *nats.Protect, msg *service.Message) *service.Message {
+		batch, err := p.Process(context.Background(), msg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(batch).To(HaveLen(1))
+		return batch[0]
+	}
+
+	structured := func(msg *service.Message) map[string]any {
+		v, err := msg.AsStructured()
+		Expect(err).NotTo(HaveOccurred())
+		return v.(map[string]any)
+	}
+
+	It("should mask, hash and encrypt fields and headers", func() {
+		p := processor(`
+fields:
+  - path: card.number
+    action: mask
+    keep_last: 4
+  - path: email
+    action: hash
+  - path: ssn
+  - header: X-User
+key:
+  env: PROTECT_TEST_KEY
+`, false)
+
+		msg := service.NewMessage([]byte(`{"card": {"number": "4111111111111111"}, "email": "a@example.com", "ssn": 123456789, "amount": 12}`))
+		msg.MetaSetMut("X-User", "alice")
+		res := structured(process(p, msg))
+
+		Expect(res["card"]).To(Equal(map[string]any{"number": "************1111"}))
+		Expect(res["email"]).To(MatchRegexp("^[0-9a-f]{64}$"))
+		Expect(res["ssn"]).To(HavePrefix(nats.EncryptedPrefix))
+		Expect(res["amount"]).To(Equal(json.Number("12")))
+		user, _ := msg.MetaGet("X-User")
+		Expect(user).To(HavePrefix(nats.EncryptedPrefix))
+
+		d := processor(`
+fields:
+  - path: ssn
+  - header: X-User
+key:
+  env: PROTECT_TEST_KEY
+`, true)
+
+		res = structured(process(d, msg))
+		Expect(res["ssn"]).To(Equal(json.Number("123456789")))
+		user, _ = msg.MetaGet("X-User")
+		Expect(user).To(Equal("alice"))
+	})
+
+	It("should encrypt equal values to equal values in deterministic mode only", func() {
+		encrypt := func(p *nats.Protect) string {
+			return structured(process(p, service.NewMessage([]byte(`{"id": "alice"}`))))["id"].(string)
+		}
+
+		random := processor("fields: [{path: id}]\nkey: {env: PROTECT_TEST_KEY}\n", false)
+		Expect(encrypt(random)).NotTo(Equal(encrypt(random)))
+
+		deterministic := processor("fields: [{path: id}]\nkey: {env: PROTECT_TEST_KEY}\ndeterministic: true\n", false)
+		Expect(encrypt(deterministic)).To(Equal(encrypt(deterministic)))
+	})
+
+	It("should skip missing fields and mask without a key", func() {
+		p := processor("fields: [{path: name, action: mask}, {header: X-Missing, action: mask}]\n", false)
+
+		res := structured(process(p, service.NewMessage([]byte(`{"other": "x"}`))))
+		Expect(res).To(Equal(map[string]any{"other": "x"}))
+	})
+
+	It("should fail the messages which cannot be decrypted", func() {
+		d := processor("fields: [{path: ssn}]\nkey: {env: PROTECT_TEST_KEY}\n", true)
+
+		_, err := d.Process(context.Background(), service.NewMessage([]byte(`{"ssn": "123"}`)))
+		Expect(err).To(MatchError(ContainSubstring("not encrypted")))
+
+		GinkgoT().Setenv("PROTECT_TEST_KEY", strings.Repeat("x", 32))
+		p := processor("fields: [{path: ssn}]\nkey: {env: PROTECT_TEST_KEY}\n", false)
+		encrypted := process(p, service.NewMessage([]byte(`{"ssn": "123"}`)))
+		_, err = d.Process(context.Background(), encrypted)
+		Expect(err).To(MatchError(ContainSubstring("failed to decrypt")))
+	})
+
+	It("should tell the malformed ciphertexts apart from the values encrypted with another key", func() {
+		d := processor("fields: [{path: ssn}, {header: X-User}]\nkey: {env: PROTECT_TEST_KEY}\n", true)
+
+		for _, body := range []string{`{"ssn": "123"}`, `{"ssn": 123}`, `{"ssn": "enc:!!"}`, `not json`} {
+			_, err := d.Process(context.Background(), service.NewMessage([]byte(body)))
+			Expect(err).To(MatchError(HavePrefix(nats.MalformedCiphertextError)), body)
+		}
+
+		msg := service.NewMessage([]byte(`{}`))
+		msg.MetaSetMut("X-User", "jane")
+		_, err := d.Process(context.Background(), msg)
+		Expect(err).To(MatchError(HavePrefix(nats.MalformedCiphertextError)))
+
+		GinkgoT().Setenv("PROTECT_TEST_KEY", strings.Repeat("x", 32))
+		p := processor("fields: [{path: ssn}]\nkey: {env: PROTECT_TEST_KEY}\n", false)
+		encrypted := process(p, service.NewMessage([]byte(`{"ssn": "123"}`)))
+		_, err = d.Process(context.Background(), encrypted)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).NotTo(HavePrefix(nats.MalformedCiphertextError))
+	})
+
+	It("should read the key from a KV bucket", func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+		srv := test.RunServer(&opts)
+		DeferCleanup(srv.Shutdown)
+
+		nc, err := nats2.Connect(srv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(nc.Close)
+		js, err := jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+
+		bucket := "keys_" + nuid.Next()
+		kv, err := js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: bucket})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = kv.Put(context.Background(), "pii", []byte(secret))
+		Expect(err).NotTo(HaveOccurred())
+
+		yaml := fmt.Sprintf("urls: [%s]\nfields: [{path: id, action: hash}]\nkey: {bucket: %s, key: pii}\n", srv.ClientURL(), bucket)
+		fromKV := processor(yaml, false)
+		fromEnv := processor("fields: [{path: id, action: hash}]\nkey: {env: PROTECT_TEST_KEY}\n", false)
+
+		hash := func(p *nats.Protect) any {
+			return structured(process(p, service.NewMessage([]byte(`{"id": "alice"}`))))["id"]
+		}
+		Expect(hash(fromKV)).To(Equal(hash(fromEnv)))
+	})
+
+	DescribeTable("should reject invalid configurations",
+		func(yaml string) {
+			conf, err := nats.ProtectConfigSpec.ParseYAML(yaml, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = nats.NewProtect(conf, false)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("no fields", "fields: []\nkey: {env: PROTECT_TEST_KEY}\n"),
+		Entry("path and header", "fields: [{path: a, header: b}]\nkey: {env: PROTECT_TEST_KEY}\n"),
+		Entry("no key", "fields: [{path: a}]\n"),
+		Entry("unset variable", "fields: [{path: a}]\nkey: {env: PROTECT_TEST_MISSING}\n"),
+		Entry("env and bucket", "fields: [{path: a}]\nkey: {env: PROTECT_TEST_KEY, bucket: b, key: k}\n"),
+	)
+
+	It("should reject short keys", func() {
+		GinkgoT().Setenv("PROTECT_TEST_KEY", "short")
+		conf, err := nats.ProtectConfigSpec.ParseYAML("fields: [{path: a}]\nkey: {env: PROTECT_TEST_KEY}\n", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = nats.NewProtect(conf, false)
+		Expect(err).To(MatchError(ContainSubstring("at least")))
+	})
+})
@@ -0,0 +1,219 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	rateLimitBucketField   = "bucket"
+	rateLimitKeyField      = "key"
+	rateLimitCountField    = "count"
+	rateLimitIntervalField = "interval"
+	rateLimitBatchField    = "batch"
+)
+
+// validRateLimitKey matches the keys which can be used as a prefix of NATS KV keys
+var validRateLimitKey = regexp.MustCompile(`^[-/_=.a-zA-Z0-9]+$`)
+
+// RateLimitConfigSpec defines the configuration schema for the nats_kv rate limit.
+var RateLimitConfigSpec = service.NewConfigSpec().
+	Beta().
+	Summary("a rate limit whose budget is shared through a NATS KV bucket").
+	Description("Every interval is a window holding count accesses, counted in a key of the bucket. The rate limits "+
+		"using the same bucket, key and label share one budget, across processes. The bucket is created when it does not "+
+		"exist, with a TTL of twice the interval so the counters of past windows expire. Every access to the bucket is a "+
+		"read and a compare-and-set of the counter, so an instance reserves batch accesses of the window at once and "+
+		"hands them out locally, and stops reading the bucket once the window is exhausted. The accesses reserved by an "+
+		"instance are not available to the others, and are lost if the instance does not use them before the window ends.").
+	Fields(connectionFields("The urls of the NATS servers holding the bucket")...).
+	Fields(
+		service.NewStringField(rateLimitBucketField).
+			Description("The KV bucket holding the counters"),
+		service.NewStringField(rateLimitKeyField).
+			Description("The key identifying the shared budget, which the label of the rate limit is appended to").
+			Default("rate_limit"),
+		service.NewIntField(rateLimitCountField).
+			Description("The number of accesses allowed in every interval"),
+		service.NewDurationField(rateLimitIntervalField).
+			Description("The length of the windows").
+			Default("1s"),
+		service.NewIntField(rateLimitBatchField).
+			Description("The number of accesses reserved at once from the bucket, a tenth of the count if 0").
+			Default(0),
+	)
+
+// NewRateLimit creates a nats_kv rate limit from the provided configuration, connecting to
+// NATS and opening or creating its bucket.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the connection, bucket, key and budget
+//   - mgr: Resources providing the label of the rate limit
+//
+// Returns:
+//   - A configured RateLimit instance
+//   - An error if the configuration is invalid or the bucket could not be opened
+func NewRateLimit(conf *service.ParsedConfig, mgr *service.Resources) (*RateLimit, error) {
+	urls, jwt, seed, err := connectionFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket, err := conf.FieldString(rateLimitBucketField)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bucket field: %w", err)
+	}
+
+	r := &RateLimit{}
+	if r.key, err = conf.FieldString(rateLimitKeyField); err != nil {
+		return nil, fmt.Errorf("failed to get key field: %w", err)
+	}
+	if label := mgr.Label(); label != "" {
+		r.key += "." + label
+	}
+	if !validRateLimitKey.MatchString(r.key) {
+		return nil, fmt.Errorf("invalid rate limit key %q", r.key)
+	}
+
+	if r.count, err = conf.FieldInt(rateLimitCountField); err != nil {
+		return nil, fmt.Errorf("failed to get count field: %w", err)
+	}
+	if r.count <= 0 {
+		return nil, errors.New("the count of a rate limit must be positive")
+	}
+
+	if r.interval, err = conf.FieldDuration(rateLimitIntervalField); err != nil {
+		return nil, fmt.Errorf("failed to get interval field: %w", err)
+	}
+	if r.interval <= 0 {
+		return nil, errors.New("the interval of a rate limit must be positive")
+	}
+
+	if r.batch, err = conf.FieldInt(rateLimitBatchField); err != nil {
+		return nil, fmt.Errorf("failed to get batch field: %w", err)
+	}
+	if r.batch < 0 {
+		return nil, errors.New("the batch of a rate limit cannot be negative")
+	}
+	if r.batch == 0 {
+		r.batch = max(r.count/10, 1)
+	}
+
+	if r.nc, err = connect("RateLimit", urls, jwt, seed); err != nil {
+		return nil, err
+	}
+
+	js, err := jetstream.New(r.nc)
+	if err != nil {
+		r.nc.Close()
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	r.kv, err = js.KeyValue(context.Background(), bucket)
+	if errors.Is(err, jetstream.ErrBucketNotFound) {
+		r.kv, err = js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{
+			Bucket:      bucket,
+			Description: "Rate limit counters shared by connector instances",
+			TTL:         2 * r.interval,
+		})
+	}
+	if err != nil {
+		r.nc.Close()
+		return nil, fmt.Errorf("failed to open kv bucket %s: %w", bucket, err)
+	}
+
+	return r, nil
+}
+
+// RateLimit is a fixed window rate limit counting the accesses of every window in a NATS KV key,
+// so that its budget is shared between the processes using the bucket. To spare a round trip to
+// the bucket per access, the accesses are reserved from the counter in batches and handed out
+// locally, and the window is remembered once exhausted.
+type RateLimit struct {
+	nc *nats.Conn
+	kv jetstream.KeyValue
+
+	key      string
+	count    int
+	batch    int
+	interval time.Duration
+
+	mu        sync.Mutex
+	window    int64
+	reserved  int
+	exhausted bool
+}
+
+func (r *RateLimit) Access(ctx context.Context) (time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	window := now.UnixNano() / int64(r.interval)
+	if window != r.window {
+		r.window, r.reserved, r.exhausted = window, 0, false
+	}
+
+	if r.reserved > 0 {
+		r.reserved--
+		return 0, nil
+	}
+	if r.exhausted {
+		return time.Unix(0, (window+1)*int64(r.interval)).Sub(now), nil
+	}
+
+	n, err := r.reserve(ctx, window)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		r.exhausted = true
+		return time.Unix(0, (window+1)*int64(r.interval)).Sub(now), nil
+	}
+	r.reserved = n - 1
+	return 0, nil
+}
+
+// reserve counts up to a batch of accesses of the window in its key, returning how many were
+// counted, 0 once the window is exhausted.
+func (r *RateLimit) reserve(ctx context.Context, window int64) (int, error) {
+	key := r.key + "." + strconv.FormatInt(window, 10)
+	for {
+		var n int
+		entry, err := r.kv.Get(ctx, key)
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			n = min(r.batch, r.count)
+			_, err = r.kv.Create(ctx, key, []byte(strconv.Itoa(n)))
+		} else if err == nil {
+			used, _ := strconv.Atoi(string(entry.Value()))
+			if used >= r.count {
+				return 0, nil
+			}
+			n = min(r.batch, r.count-used)
+			_, err = r.kv.Update(ctx, key, []byte(strconv.Itoa(used+n)), entry.Revision())
+		}
+
+		// Another instance counted accesses in the meantime, count again from its value
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to count access in %s: %w", key, err)
+		}
+		return n, nil
+	}
+}
+
+func (r *RateLimit) Close(_ context.Context) error {
+	r.nc.Close()
+	return nil
+}
@@ -0,0 +1,143 @@
+package nats_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("NATS KV Rate Limit", func() {
+	var jsSrv *server.Server
+	var bucket string
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+		jsSrv = test.RunServer(&opts)
+		DeferCleanup(jsSrv.Shutdown)
+
+		bucket = "limits_" + nuid.Next()
+	})
+
+	rateLimit := func(count int, interval string, extra ...string) *nats.RateLimit {
+		conf, err := nats.RateLimitConfigSpec.ParseYAML(fmt.Sprintf("urls: [%s]\nbucket: %s\nkey: connector\ncount: %d\ninterval: %s\n%s", jsSrv.ClientURL(), bucket, count, interval, strings.Join(extra, "")), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		r, err := nats.NewRateLimit(conf, service.MockResources())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.Close, context.Background())
+		return r
+	}
+
+	It("should allow count accesses in every interval", func() {
+		r := rateLimit(3, "1m")
+
+		for range 3 {
+			Expect(r.Access(context.Background())).To(BeZero())
+		}
+
+		wait, err := r.Access(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(wait).To(BeNumerically(">", 0))
+		Expect(wait).To(BeNumerically("<=", time.Minute))
+	})
+
+	It("should allow accesses again in the next interval", func() {
+		r := rateLimit(1, "500ms")
+
+		Expect(r.Access(context.Background())).To(BeZero())
+		Eventually(func() (time.Duration, error) {
+			return r.Access(context.Background())
+		}, 2*time.Second, 50*time.Millisecond).Should(BeZero())
+	})
+
+	It("should share one budget between the instances using the bucket", func() {
+		limits := []*nats.RateLimit{rateLimit(8, "1m"), rateLimit(8, "1m")}
+
+		var allowed atomic.Int32
+		var wg sync.WaitGroup
+		for i := range 4 {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for range 10 {
+					wait, err := limits[i%2].Access(context.Background())
+					Expect(err).NotTo(HaveOccurred())
+					if wait == 0 {
+						allowed.Add(1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		Expect(allowed.Load()).To(Equal(int32(8)))
+	})
+
+	It("should reserve the accesses of an instance in batches", func() {
+		r := rateLimit(10, "1m", "batch: 4\n")
+
+		Expect(r.Access(context.Background())).To(BeZero())
+
+		nc, err := nats2.Connect(jsSrv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(nc.Close)
+		js, err := jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+		kv, err := js.KeyValue(context.Background(), bucket)
+		Expect(err).NotTo(HaveOccurred())
+		keys, err := kv.Keys(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(HaveLen(1))
+
+		// The other accesses of the batch are handed out without counting them in the bucket
+		for range 3 {
+			Expect(r.Access(context.Background())).To(BeZero())
+		}
+		entry, err := kv.Get(context.Background(), keys[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(entry.Value())).To(Equal("4"))
+	})
+
+	It("should not hand out more than the shared budget in batches", func() {
+		limits := []*nats.RateLimit{rateLimit(10, "1m", "batch: 4\n"), rateLimit(10, "1m", "batch: 4\n")}
+
+		allowed := 0
+		for range 10 {
+			for _, r := range limits {
+				wait, err := r.Access(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				if wait == 0 {
+					allowed++
+				}
+			}
+		}
+
+		Expect(allowed).To(Equal(10))
+	})
+
+	It("should reject budgets which allow nothing", func() {
+		conf, err := nats.RateLimitConfigSpec.ParseYAML(fmt.Sprintf("urls: [%s]\nbucket: %s\ncount: 0\n", jsSrv.ClientURL(), bucket), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = nats.NewRateLimit(conf, service.MockResources())
+		Expect(err).To(MatchError(ContainSubstring("must be positive")))
+	})
+})
@@ -0,0 +1,240 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ErrSchemaNotFound is returned when a registry holds no schema for a subject and version
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// SchemaRegistry stores versioned schemas by subject. Each version of the schema of a subject
+// is stored under subject/version, with versions numbered from 1. A schema stored under the
+// subject itself is unversioned, and only returned when the subject has no versions.
+type SchemaRegistry interface {
+	// Get returns the schema of the subject at the given version, or at its latest version if
+	// the version is empty or latest
+	Get(ctx context.Context, subject, version string) (RegisteredSchema, error)
+	// Put stores the schema as the next version of the subject and returns that version
+	Put(ctx context.Context, subject string, schema []byte) (string, error)
+}
+
+// RegisteredSchema is a schema document as stored in a SchemaRegistry.
+type RegisteredSchema struct {
+	Subject string
+	// Version is the version of the schema, or empty for unversioned schemas
+	Version string
+	Schema  []byte
+}
+
+// NewKvRegistry creates a SchemaRegistry storing the schemas in a NATS KV bucket.
+func NewKvRegistry(ctx context.Context, js jetstream.JetStream, bucket string) (SchemaRegistry, error) {
+	kv, err := js.KeyValue(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open kv bucket %s: %w", bucket, err)
+	}
+	return &storeRegistry{kvStore{kv}}, nil
+}
+
+// NewObjectStoreRegistry creates a SchemaRegistry storing the schemas in a NATS object store.
+func NewObjectStoreRegistry(ctx context.Context, js jetstream.JetStream, store string) (SchemaRegistry, error) {
+	obs, err := js.ObjectStore(ctx, store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object store %s: %w", store, err)
+	}
+	return &storeRegistry{objectStore{obs}}, nil
+}
+
+// NewDirRegistry creates a SchemaRegistry storing the schemas as files in a local directory,
+// standing in for a NATS backed registry in tests and local development.
+func NewDirRegistry(dir string) SchemaRegistry {
+	return &storeRegistry{dirStore{dir}}
+}
+
+// schemaStore holds schema documents by key.
+type schemaStore interface {
+	get(ctx context.Context, key string) ([]byte, error)
+	put(ctx context.Context, key string, value []byte) error
+	keys(ctx context.Context) ([]string, error)
+}
+
+// storeRegistry implements the versioning of a SchemaRegistry on top of a schemaStore.
+type storeRegistry struct {
+	store schemaStore
+}
+
+func (r *storeRegistry) Get(ctx context.Context, subject, version string) (RegisteredSchema, error) {
+	if version == "" || version == "latest" {
+		latest, err := r.latest(ctx, subject)
+		if err != nil {
+			return RegisteredSchema{}, err
+		}
+		version = latest
+	}
+
+	key := subject
+	if version != "" {
+		key = subject + "/" + version
+	}
+
+	b, err := r.store.get(ctx, key)
+	if err != nil {
+		return RegisteredSchema{}, fmt.Errorf("failed to fetch schema %s: %w", key, err)
+	}
+
+	return RegisteredSchema{Subject: subject, Version: version, Schema: b}, nil
+}
+
+func (r *storeRegistry) Put(ctx context.Context, subject string, schema []byte) (string, error) {
+	latest, err := r.latest(ctx, subject)
+	if err != nil {
+		return "", err
+	}
+
+	n, _ := strconv.Atoi(latest)
+	version := strconv.Itoa(n + 1)
+	if err := r.store.put(ctx, subject+"/"+version, schema); err != nil {
+		return "", fmt.Errorf("failed to store schema %s/%s: %w", subject, version, err)
+	}
+
+	return version, nil
+}
+
+// latest returns the highest version of the subject, or an empty version if it has none.
+func (r *storeRegistry) latest(ctx context.Context, subject string) (string, error) {
+	keys, err := r.store.keys(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list schemas: %w", err)
+	}
+
+	latest := 0
+	for _, k := range keys {
+		v, ok := strings.CutPrefix(k, subject+"/")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(v); err == nil && n > latest {
+			latest = n
+		}
+	}
+
+	if latest == 0 {
+		return "", nil
+	}
+	return strconv.Itoa(latest), nil
+}
+
+type kvStore struct {
+	kv jetstream.KeyValue
+}
+
+func (s kvStore) get(ctx context.Context, key string) ([]byte, error) {
+	entry, err := s.kv.Get(ctx, key)
+	if errors.Is(err, jetstream.ErrKeyNotFound) {
+		return nil, ErrSchemaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry.Value(), nil
+}
+
+func (s kvStore) put(ctx context.Context, key string, value []byte) error {
+	_, err := s.kv.Create(ctx, key, value)
+	return err
+}
+
+func (s kvStore) keys(ctx context.Context) ([]string, error) {
+	lister, err := s.kv.ListKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = lister.Stop() }()
+
+	var keys []string
+	for k := range lister.Keys() {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+type objectStore struct {
+	obs jetstream.ObjectStore
+}
+
+func (s objectStore) get(ctx context.Context, key string) ([]byte, error) {
+	b, err := s.obs.GetBytes(ctx, key)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return nil, ErrSchemaNotFound
+	}
+	return b, err
+}
+
+func (s objectStore) put(ctx context.Context, key string, value []byte) error {
+	_, err := s.obs.PutBytes(ctx, key, value)
+	return err
+}
+
+func (s objectStore) keys(ctx context.Context) ([]string, error) {
+	infos, err := s.obs.List(ctx)
+	if errors.Is(err, jetstream.ErrNoObjectsFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(infos))
+	for _, info := range infos {
+		keys = append(keys, info.Name)
+	}
+	return keys, nil
+}
+
+type dirStore struct {
+	dir string
+}
+
+func (s dirStore) get(_ context.Context, key string) ([]byte, error) {
+	b, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrSchemaNotFound
+	}
+	return b, err
+}
+
+func (s dirStore) put(_ context.Context, key string, value []byte) error {
+	file := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, value, 0o644)
+}
+
+func (s dirStore) keys(_ context.Context) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return keys, err
+}
@@ -0,0 +1,116 @@
+package nats_test
+
+import (
+	"context"
+
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("Schema Registry", func() {
+	behavesLikeARegistry := func(open func() nats.SchemaRegistry) {
+		It("should number the versions of a subject", func() {
+			r := open()
+			ctx := context.Background()
+
+			v, err := r.Put(ctx, "person", []byte("v1"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v).To(Equal("1"))
+
+			v, err = r.Put(ctx, "person", []byte("v2"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v).To(Equal("2"))
+
+			rs, err := r.Get(ctx, "person", "1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rs).To(Equal(nats.RegisteredSchema{Subject: "person", Version: "1", Schema: []byte("v1")}))
+
+			rs, err = r.Get(ctx, "person", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rs.Version).To(Equal("2"))
+			Expect(rs.Schema).To(Equal([]byte("v2")))
+
+			rs, err = r.Get(ctx, "person", "latest")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rs.Version).To(Equal("2"))
+		})
+
+		It("should not mix up subjects sharing a prefix", func() {
+			r := open()
+			ctx := context.Background()
+
+			_, err := r.Put(ctx, "person", []byte("person"))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = r.Put(ctx, "personnel", []byte("personnel"))
+			Expect(err).NotTo(HaveOccurred())
+
+			rs, err := r.Get(ctx, "personnel", "")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rs.Version).To(Equal("1"))
+			Expect(rs.Schema).To(Equal([]byte("personnel")))
+		})
+
+		It("should fail for unknown schemas", func() {
+			_, err := open().Get(context.Background(), "missing", "3")
+			Expect(err).To(MatchError(nats.ErrSchemaNotFound))
+		})
+	}
+
+	When("the registry is a local directory", func() {
+		behavesLikeARegistry(func() nats.SchemaRegistry {
+			return nats.NewDirRegistry(GinkgoT().TempDir())
+		})
+	})
+
+	When("the registry is stored in NATS", func() {
+		var js jetstream.JetStream
+
+		BeforeEach(func() {
+			opts := test.DefaultTestOptions
+			opts.Port = -1
+			opts.JetStream = true
+			opts.StoreDir = GinkgoT().TempDir()
+			jsSrv := test.RunServer(&opts)
+
+			nc, err := nats2.Connect(jsSrv.ClientURL())
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(func() {
+				nc.Close()
+				jsSrv.Shutdown()
+			})
+
+			js, err = jetstream.New(nc)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("in a kv bucket", func() {
+			behavesLikeARegistry(func() nats.SchemaRegistry {
+				bucket := "schemas_" + nuid.Next()
+				_, err := js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: bucket})
+				Expect(err).NotTo(HaveOccurred())
+
+				r, err := nats.NewKvRegistry(context.Background(), js, bucket)
+				Expect(err).NotTo(HaveOccurred())
+				return r
+			})
+		})
+
+		Context("in an object store", func() {
+			behavesLikeARegistry(func() nats.SchemaRegistry {
+				store := "schemas_" + nuid.Next()
+				_, err := js.CreateObjectStore(context.Background(), jetstream.ObjectStoreConfig{Bucket: store})
+				Expect(err).NotTo(HaveOccurred())
+
+				r, err := nats.NewObjectStoreRegistry(context.Background(), js, store)
+				Expect(err).NotTo(HaveOccurred())
+				return r
+			})
+		})
+	})
+})
@@ -0,0 +1,163 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	requestSubjectField          = "subject"
+	requestTimeoutField          = "timeout"
+	requestMetadataField         = "metadata"
+	requestInjectTracingMapField = "inject_tracing_map"
+)
+
+// RequestConfigSpec defines the configuration schema for the nats_request processor.
+var RequestConfigSpec = service.NewConfigSpec().
+	Beta().
+	Categories("Services").
+	Summary("Sends each message as a NATS request and replaces it with the reply.").
+	Description("The metadata selected by the metadata filter is sent as the headers of the request, and the "+
+		"headers of the reply are added to the metadata of the message. When an inject_tracing_map is set, the "+
+		"trace context of the message is mapped into its metadata and the metadata it adds is sent as headers as "+
+		"well, so that the service called continues the trace. A request which is not replied to before the timeout fails the message.").
+	Fields(connectionFields("A list of URLs to connect to")...).
+	Fields(
+		service.NewInterpolatedStringField(requestSubjectField).
+			Description("The subject the requests are sent to").
+			Example("orders.create"),
+		service.NewDurationField(requestTimeoutField).
+			Description("How long to wait for the reply of a request").
+			Default("3s"),
+		service.NewMetadataFilterField(requestMetadataField).
+			Description("The metadata sent as the headers of the requests, none unless set").
+			Optional(),
+		service.NewInjectTracingSpanMappingField(),
+	)
+
+// NewRequest creates a nats_request processor from the provided configuration, connecting to NATS.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the connection, subject and headers of the requests
+//   - mgr: Resources providing the logger of the processor
+//
+// Returns:
+//   - A configured Request instance
+//   - An error if the configuration is invalid or the connection failed
+func NewRequest(conf *service.ParsedConfig, mgr *service.Resources) (*Request, error) {
+	urls, jwt, seed, err := connectionFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Request{log: mgr.Logger()}
+	if r.subject, err = conf.FieldInterpolatedString(requestSubjectField); err != nil {
+		return nil, fmt.Errorf("failed to get subject field: %w", err)
+	}
+	if r.timeout, err = conf.FieldDuration(requestTimeoutField); err != nil {
+		return nil, fmt.Errorf("failed to get timeout field: %w", err)
+	}
+	if conf.Contains(requestMetadataField) {
+		if r.metadata, err = conf.FieldMetadataFilter(requestMetadataField); err != nil {
+			return nil, fmt.Errorf("failed to get metadata field: %w", err)
+		}
+	}
+	if mapping, _ := conf.FieldString(requestInjectTracingMapField); mapping != "" {
+		if r.tracing, err = conf.FieldBloblang(requestInjectTracingMapField); err != nil {
+			return nil, fmt.Errorf("failed to get inject_tracing_map field: %w", err)
+		}
+	}
+
+	if r.nc, err = connect("Request", urls, jwt, seed); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Request is a processor replacing each message with the reply of a NATS request.
+type Request struct {
+	nc       *nats.Conn
+	log      *service.Logger
+	subject  *service.InterpolatedString
+	timeout  time.Duration
+	metadata *service.MetadataFilter
+	tracing  *bloblang.Executor
+}
+
+func (r *Request) Process(ctx context.Context, msg *service.Message) (service.MessageBatch, error) {
+	subject, err := r.subject.TryString(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute the subject: %w", err)
+	}
+
+	req := nats.NewMsg(subject)
+	if req.Data, err = msg.AsBytes(); err != nil {
+		return nil, err
+	}
+
+	_ = r.metadata.Walk(msg, func(key, value string) error {
+		req.Header.Add(key, value)
+		return nil
+	})
+	if r.tracing != nil {
+		r.injectTraceContext(msg, req.Header)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	reply, err := r.nc.RequestMsgWithContext(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %w", subject, err)
+	}
+
+	res := msg.Copy()
+	res.SetBytes(reply.Data)
+	for key := range reply.Header {
+		res.MetaSetMut(key, reply.Header.Get(key))
+	}
+	return service.MessageBatch{res}, nil
+}
+
+// injectTraceContext maps the trace context of the message into a copy of its metadata with the
+// inject_tracing_map, and sets the metadata the mapping added or changed as headers.
+func (r *Request) injectTraceContext(msg *service.Message, headers nats.Header) {
+	c := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(msg.Context(), c)
+
+	span := make(map[string]any, len(c))
+	for k, v := range c {
+		span[k] = v
+	}
+	spanMsg := service.NewMessage(nil)
+	spanMsg.SetStructuredMut(span)
+
+	res, err := msg.Copy().BloblangMutateFrom(r.tracing, spanMsg)
+	if err != nil {
+		r.log.Warnf("Failed to inject span: %v", err)
+		return
+	}
+	if res == nil {
+		return
+	}
+
+	_ = res.MetaWalk(func(key, value string) error {
+		if v, ok := msg.MetaGet(key); !ok || v != value {
+			headers.Set(key, value)
+		}
+		return nil
+	})
+}
+
+func (r *Request) Close(_ context.Context) error {
+	r.nc.Close()
+	return nil
+}
@@ -0,0 +1,119 @@
+package nats_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+var _ = Describe("Request", func() {
+	var srv *server.Server
+	var nc *nats2.Conn
+	var requests chan *nats2.Msg
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		srv = test.RunServer(&opts)
+
+		var err error
+		nc, err = nats2.Connect(srv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			srv.Shutdown()
+		})
+
+		requests = make(chan *nats2.Msg, 1)
+		_, err = nc.Subscribe("svc.upper", func(msg *nats2.Msg) {
+			requests <- msg
+			reply := nats2.NewMsg(msg.Reply)
+			reply.Data = []byte(strings.ToUpper(string(msg.Data)))
+			reply.Header.Set("X-Served-By", "upper")
+			_ = msg.RespondMsg(reply)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nc.Flush()).To(Succeed())
+	})
+
+	request := func(extra string) *nats.Request {
+		conf, err := nats.RequestConfigSpec.ParseYAML(fmt.Sprintf("urls: [%s]\nsubject: svc.upper\ntimeout: 1s\n%s", srv.ClientURL(), extra), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		r, err := nats.NewRequest(conf, service.MockResources())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.Close, context.Background())
+		return r
+	}
+
+	It("should replace the message with the reply and send the selected metadata as headers", func() {
+		r := request("metadata:\n  include_prefixes: [X-]\n")
+
+		msg := service.NewMessage([]byte("hello"))
+		msg.MetaSetMut("X-Tenant", "acme")
+		msg.MetaSetMut("http_path", "/greet")
+
+		batch, err := r.Process(context.Background(), msg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(batch).To(HaveLen(1))
+		Expect(batch[0].AsBytes()).To(Equal([]byte("HELLO")))
+		servedBy, _ := batch[0].MetaGet("X-Served-By")
+		Expect(servedBy).To(Equal("upper"))
+		Expect(msg.AsBytes()).To(Equal([]byte("hello")))
+
+		var req *nats2.Msg
+		Eventually(requests).Should(Receive(&req))
+		Expect(req.Header.Get("X-Tenant")).To(Equal("acme"))
+		Expect(req.Header.Get("http_path")).To(BeEmpty())
+	})
+
+	It("should send the trace context of the message when an inject_tracing_map is set", func() {
+		propagator := otel.GetTextMapPropagator()
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		DeferCleanup(otel.SetTextMapPropagator, propagator)
+
+		r := request("inject_tracing_map: meta = @.merge(this)\n")
+
+		span := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1, 2, 3},
+			SpanID:     trace.SpanID{4, 5, 6},
+			TraceFlags: trace.FlagsSampled,
+		})
+		msg := service.NewMessage([]byte("hello")).
+			WithContext(trace.ContextWithSpanContext(context.Background(), span))
+		msg.MetaSetMut("X-Tenant", "acme")
+
+		_, err := r.Process(context.Background(), msg)
+		Expect(err).NotTo(HaveOccurred())
+
+		var req *nats2.Msg
+		Eventually(requests).Should(Receive(&req))
+		Expect(req.Header.Get("traceparent")).To(Equal("00-01020300000000000000000000000000-0405060000000000-01"))
+		Expect(req.Header.Get("X-Tenant")).To(BeEmpty())
+		_, ok := msg.MetaGet("traceparent")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should fail the message when no service replies", func() {
+		conf, err := nats.RequestConfigSpec.ParseYAML(fmt.Sprintf("urls: [%s]\nsubject: svc.missing\ntimeout: 200ms\n", srv.ClientURL()), nil)
+		Expect(err).NotTo(HaveOccurred())
+		r, err := nats.NewRequest(conf, service.MockResources())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(r.Close, context.Background())
+
+		_, err = r.Process(context.Background(), service.NewMessage([]byte("hello")))
+		Expect(err).To(HaveOccurred())
+	})
+})
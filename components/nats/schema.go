@@ -0,0 +1,239 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const (
+	// SchemaFormatJSONSchema identifies schemas written as JSON Schema documents
+	SchemaFormatJSONSchema = "json_schema"
+	// SchemaFormatAvro identifies schemas written as Avro schema documents
+	SchemaFormatAvro = "avro"
+)
+
+// Schema is a compiled schema which payloads can be checked against.
+type Schema interface {
+	// Validate returns an error describing why the payload does not match the schema
+	Validate(payload []byte) error
+}
+
+// RegistryConfig locates the SchemaRegistry holding schemas: a NATS KV bucket or object
+// store, or a local directory standing in for NATS. Exactly one of them is expected to be set.
+type RegistryConfig struct {
+	// URLs are the NATS servers holding the bucket or object store
+	URLs []string
+	// JWT and Seed authenticate the connection, if both are set
+	JWT  string
+	Seed string
+
+	Bucket      string
+	ObjectStore string
+	Dir         string
+}
+
+// String describes the location of the registry.
+func (c RegistryConfig) String() string {
+	switch {
+	case c.ObjectStore != "":
+		return "object store " + c.ObjectStore
+	case c.Dir != "":
+		return "directory " + c.Dir
+	default:
+		return "kv bucket " + c.Bucket
+	}
+}
+
+// OpenRegistry opens the SchemaRegistry described by the configuration.
+//
+// Returns:
+//   - The registry
+//   - A function releasing the NATS connection of the registry, if any
+//   - An error if the configuration is invalid or the registry could not be opened
+func OpenRegistry(ctx context.Context, c RegistryConfig) (SchemaRegistry, func(), error) {
+	locations := 0
+	for _, l := range []string{c.Bucket, c.ObjectStore, c.Dir} {
+		if l != "" {
+			locations++
+		}
+	}
+	if locations != 1 {
+		return nil, nil, errors.New("exactly one of a kv bucket, an object store or a directory must hold the schemas")
+	}
+
+	if c.Dir != "" {
+		return NewDirRegistry(c.Dir), func() {}, nil
+	}
+
+	nc, err := connect("SchemaOps", c.URLs, c.JWT, c.Seed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	var r SchemaRegistry
+	if c.ObjectStore != "" {
+		r, err = NewObjectStoreRegistry(ctx, js, c.ObjectStore)
+	} else {
+		r, err = NewKvRegistry(ctx, js, c.Bucket)
+	}
+	if err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+
+	return r, nc.Close, nil
+}
+
+// SchemaSource locates a schema by name and version in a SchemaRegistry. Without a version,
+// the latest version of the schema is used.
+type SchemaSource struct {
+	Registry RegistryConfig
+
+	Name    string
+	Version string
+}
+
+// String describes the location of the schema.
+func (s SchemaSource) String() string {
+	if s.Version == "" {
+		return fmt.Sprintf("%s, schema %s", s.Registry, s.Name)
+	}
+	return fmt.Sprintf("%s, schema %s/%s", s.Registry, s.Name, s.Version)
+}
+
+// schemas caches the compiled schemas by format and location, so a schema used by several
+// components is only fetched and compiled once.
+var schemas sync.Map
+
+// LoadSchema compiles the given inline schema, or fetches the schema from the given source
+// and compiles it. Compiled schemas are cached for the lifetime of the process.
+//
+// Parameters:
+//   - ctx: Context for cancellation of the fetch
+//   - format: The format of the schema, SchemaFormatJSONSchema or SchemaFormatAvro
+//   - inline: The schema document, exclusive with src
+//   - src: The location of the schema in NATS, exclusive with inline
+//
+// Returns:
+//   - The compiled schema
+//   - An error if the schema could not be fetched or does not compile
+func LoadSchema(ctx context.Context, format, inline string, src *SchemaSource) (Schema, error) {
+	if (inline == "") == (src == nil) {
+		return nil, errors.New("exactly one of an inline schema or a schema source must be set")
+	}
+
+	key := format + "\x00" + inline
+	if src != nil {
+		key = fmt.Sprintf("%s\x00%s\x00%s", format, strings.Join(src.Registry.URLs, ","), src)
+	}
+
+	if s, ok := schemas.Load(key); ok {
+		return s.(Schema), nil
+	}
+
+	doc := []byte(inline)
+	if src != nil {
+		var err error
+		if doc, err = fetchSchema(ctx, *src); err != nil {
+			return nil, err
+		}
+	}
+
+	s, err := compileSchema(format, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, _ := schemas.LoadOrStore(key, s)
+	return actual.(Schema), nil
+}
+
+func fetchSchema(ctx context.Context, src SchemaSource) ([]byte, error) {
+	if src.Name == "" {
+		return nil, errors.New("a schema name is required")
+	}
+
+	r, release, err := OpenRegistry(ctx, src.Registry)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rs, err := r.Get(ctx, src.Name, src.Version)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", src.Registry, err)
+	}
+	return rs.Schema, nil
+}
+
+func compileSchema(format string, doc []byte) (Schema, error) {
+	switch format {
+	case SchemaFormatJSONSchema:
+		s, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(doc))
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile JSON schema: %w", err)
+		}
+		return jsonSchema{s}, nil
+	case SchemaFormatAvro:
+		c, err := goavro.NewCodec(string(doc))
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile Avro schema: %w", err)
+		}
+		return avroSchema{c}, nil
+	default:
+		return nil, fmt.Errorf("unknown schema format %q, expected %s or %s", format, SchemaFormatJSONSchema, SchemaFormatAvro)
+	}
+}
+
+// jsonSchema checks JSON payloads against a JSON Schema.
+type jsonSchema struct {
+	schema *gojsonschema.Schema
+}
+
+func (s jsonSchema) Validate(payload []byte) error {
+	res, err := s.schema.Validate(gojsonschema.NewBytesLoader(payload))
+	if err != nil {
+		return fmt.Errorf("payload is not valid JSON: %w", err)
+	}
+
+	if !res.Valid() {
+		msgs := make([]string, 0, len(res.Errors()))
+		for _, e := range res.Errors() {
+			msgs = append(msgs, e.String())
+		}
+		return fmt.Errorf("payload does not match the schema: %s", strings.Join(msgs, "; "))
+	}
+
+	return nil
+}
+
+// avroSchema checks Avro binary encoded payloads against an Avro schema.
+type avroSchema struct {
+	codec *goavro.Codec
+}
+
+func (s avroSchema) Validate(payload []byte) error {
+	_, rest, err := s.codec.NativeFromBinary(payload)
+	if err != nil {
+		return fmt.Errorf("payload does not match the schema: %w", err)
+	}
+
+	if len(rest) > 0 {
+		return fmt.Errorf("payload does not match the schema: %d trailing bytes", len(rest))
+	}
+
+	return nil
+}
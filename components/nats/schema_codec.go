@@ -0,0 +1,196 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	// SchemaSubjectHeader is the metadata key holding the subject of the schema a payload was encoded with
+	SchemaSubjectHeader = "Connect-Schema-Subject"
+	// SchemaVersionHeader is the metadata key holding the version of the schema a payload was encoded with
+	SchemaVersionHeader = "Connect-Schema-Version"
+	// InvalidPayloadError prefixes the errors of the payloads which cannot be encoded or decoded with
+	// their schema, telling them apart from the failures of the registry
+	InvalidPayloadError = "invalid payload"
+
+	codecFormatField   = "format"
+	codecSubjectField  = "subject"
+	codecVersionField  = "version"
+	codecMessageField  = "message"
+	codecRegistryField = "registry"
+)
+
+func codecConfigSpec(summary string) *service.ConfigSpec {
+	return service.NewConfigSpec().
+		Beta().
+		Summary(summary).
+		Fields(
+			service.NewStringEnumField(codecFormatField, SchemaFormatAvro, SchemaFormatProtobuf, SchemaFormatJSONSchema).
+				Description("The format of the schema"),
+			service.NewStringField(codecSubjectField).
+				Description("The subject of the schema in the registry"),
+			service.NewStringField(codecVersionField).
+				Description("The version of the schema, the latest version unless set").
+				Optional(),
+			service.NewStringField(codecMessageField).
+				Description("The fully qualified name of the Protobuf message, if the definition holds several messages").
+				Optional(),
+			service.NewObjectField(codecRegistryField, RegistryFields...).
+				Description("The registry holding the schema"),
+		)
+}
+
+// EncodeConfigSpec defines the configuration schema for the schema_encode processor.
+var EncodeConfigSpec = codecConfigSpec("encode JSON payloads with a schema from a NATS schema registry")
+
+// DecodeConfigSpec defines the configuration schema for the schema_decode processor.
+var DecodeConfigSpec = codecConfigSpec("decode payloads to JSON with a schema from a NATS schema registry")
+
+// NewSchemaCodecProcessor creates a schema_encode or schema_decode processor from the provided
+// configuration. The configured version of the schema is resolved and compiled when the processor
+// is created. The decoder resolves the other versions found in the SchemaVersionHeader of the
+// messages on first use.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the schema subject and registry
+//   - decode: Whether the processor decodes rather than encodes payloads
+//
+// Returns:
+//   - A configured SchemaCodecProcessor instance
+//   - An error if the configuration is invalid or the schema could not be loaded
+func NewSchemaCodecProcessor(conf *service.ParsedConfig, decode bool) (*SchemaCodecProcessor, error) {
+	p := &SchemaCodecProcessor{decode: decode, codecs: map[string]SchemaCodec{}}
+
+	var err error
+	if p.format, err = conf.FieldString(codecFormatField); err != nil {
+		return nil, fmt.Errorf("failed to get format field: %w", err)
+	}
+	if p.subject, err = conf.FieldString(codecSubjectField); err != nil {
+		return nil, fmt.Errorf("failed to get subject field: %w", err)
+	}
+	version, _ := conf.FieldString(codecVersionField)
+	p.message, _ = conf.FieldString(codecMessageField)
+
+	rc, err := RegistryFromConfig(conf.Namespace(codecRegistryField))
+	if err != nil {
+		return nil, err
+	}
+
+	if p.registry, p.release, err = OpenRegistry(context.Background(), rc); err != nil {
+		return nil, err
+	}
+
+	rs, err := p.registry.Get(context.Background(), p.subject, version)
+	if err != nil {
+		p.release()
+		return nil, fmt.Errorf("%s: %w", rc, err)
+	}
+
+	if _, err = p.codec(rs); err != nil {
+		p.release()
+		return nil, err
+	}
+	p.version = rs.Version
+
+	return p, nil
+}
+
+// SchemaCodecProcessor is a processor encoding JSON payloads with a schema from a registry,
+// or decoding them to JSON.
+type SchemaCodecProcessor struct {
+	decode  bool
+	format  string
+	subject string
+	message string
+
+	registry SchemaRegistry
+	release  func()
+
+	// version is the resolved version of the configured schema
+	version string
+
+	mu     sync.Mutex
+	codecs map[string]SchemaCodec
+}
+
+func (p *SchemaCodecProcessor) Process(ctx context.Context, msg *service.Message) (service.MessageBatch, error) {
+	b, err := msg.AsBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.decode {
+		c, err := p.lookup(ctx, p.version)
+		if err != nil {
+			return nil, err
+		}
+
+		if b, err = c.Encode(b); err != nil {
+			return nil, fmt.Errorf("%s: %w", InvalidPayloadError, err)
+		}
+
+		msg.SetBytes(b)
+		msg.MetaSetMut(SchemaSubjectHeader, p.subject)
+		if p.version != "" {
+			msg.MetaSetMut(SchemaVersionHeader, p.version)
+		}
+		return service.MessageBatch{msg}, nil
+	}
+
+	version := p.version
+	if v, ok := msg.MetaGet(SchemaVersionHeader); ok && v != "" {
+		version = v
+	}
+
+	c, err := p.lookup(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if b, err = c.Decode(b); err != nil {
+		return nil, fmt.Errorf("%s: %w", InvalidPayloadError, err)
+	}
+
+	msg.SetBytes(b)
+	return service.MessageBatch{msg}, nil
+}
+
+// lookup returns the codec of the given version of the schema, fetching it from the registry
+// when it was not used before.
+func (p *SchemaCodecProcessor) lookup(ctx context.Context, version string) (SchemaCodec, error) {
+	p.mu.Lock()
+	c, ok := p.codecs[version]
+	p.mu.Unlock()
+	if ok {
+		return c, nil
+	}
+
+	rs, err := p.registry.Get(ctx, p.subject, version)
+	if err != nil {
+		return nil, err
+	}
+	return p.codec(rs)
+}
+
+// codec compiles and caches the codec of a schema fetched from the registry.
+func (p *SchemaCodecProcessor) codec(rs RegisteredSchema) (SchemaCodec, error) {
+	c, err := NewSchemaCodec(p.format, rs.Schema, p.message)
+	if err != nil {
+		return nil, fmt.Errorf("schema %s version %s: %w", rs.Subject, rs.Version, err)
+	}
+
+	p.mu.Lock()
+	p.codecs[rs.Version] = c
+	p.mu.Unlock()
+
+	return c, nil
+}
+
+func (p *SchemaCodecProcessor) Close(_ context.Context) error {
+	p.release()
+	return nil
+}
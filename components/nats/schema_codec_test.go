@@ -0,0 +1,124 @@
+package nats_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+const personProto = `syntax = "proto3";
+package example;
+message Person {
+  string name = 1;
+  int32 age = 2;
+}`
+
+var _ = Describe("Schema Codec", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	register := func(subject, schema string) string {
+		v, err := nats.NewDirRegistry(dir).Put(context.Background(), subject, []byte(schema))
+		Expect(err).NotTo(HaveOccurred())
+		return v
+	}
+
+	processor := func(spec *service.ConfigSpec, decode bool, yaml string) *nats.SchemaCodecProcessor {
+		conf, err := spec.ParseYAML(fmt.Sprintf("%sregistry:\n  dir: %s\n", yaml, dir), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		p, err := nats.NewSchemaCodecProcessor(conf, decode)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(p.Close, context.Background())
+		return p
+	}
+
+	roundTrip := func(format, extra string) {
+		enc := processor(nats.EncodeConfigSpec, false, fmt.Sprintf("format: %s\nsubject: person\n%s", format, extra))
+		dec := processor(nats.DecodeConfigSpec, true, fmt.Sprintf("format: %s\nsubject: person\n%s", format, extra))
+
+		batch, err := enc.Process(context.Background(), service.NewMessage([]byte(`{"name": "jane", "age": 42}`)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(batch).To(HaveLen(1))
+
+		subject, _ := batch[0].MetaGet(nats.SchemaSubjectHeader)
+		Expect(subject).To(Equal("person"))
+		version, _ := batch[0].MetaGet(nats.SchemaVersionHeader)
+		Expect(version).To(Equal("1"))
+
+		batch, err = dec.Process(context.Background(), batch[0])
+		Expect(err).NotTo(HaveOccurred())
+		b, err := batch[0].AsBytes()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b).To(MatchJSON(`{"name": "jane", "age": 42}`))
+	}
+
+	It("should encode and decode Avro payloads", func() {
+		register("person", personAvroSchema)
+		roundTrip(nats.SchemaFormatAvro, "")
+	})
+
+	It("should encode and decode Protobuf payloads", func() {
+		register("person", personProto)
+		roundTrip(nats.SchemaFormatProtobuf, "message: example.Person\n")
+	})
+
+	It("should check JSON payloads against a JSON Schema", func() {
+		register("person", personSchema)
+		roundTrip(nats.SchemaFormatJSONSchema, "")
+
+		enc := processor(nats.EncodeConfigSpec, false, "format: json_schema\nsubject: person\n")
+		_, err := enc.Process(context.Background(), service.NewMessage([]byte(`{"age": 42}`)))
+		Expect(err).To(MatchError(ContainSubstring("does not match the schema")))
+		Expect(err).To(MatchError(HavePrefix(nats.InvalidPayloadError)))
+	})
+
+	It("should decode payloads with the version they were encoded with", func() {
+		register("person", personAvroSchema)
+		enc := processor(nats.EncodeConfigSpec, false, "format: avro\nsubject: person\n")
+
+		batch, err := enc.Process(context.Background(), service.NewMessage([]byte(`{"name": "jane", "age": 42}`)))
+		Expect(err).NotTo(HaveOccurred())
+
+		register("person", `{"type": "record", "name": "Person", "fields": [{"name": "name", "type": "string"}]}`)
+		dec := processor(nats.DecodeConfigSpec, true, "format: avro\nsubject: person\n")
+
+		batch, err = dec.Process(context.Background(), batch[0])
+		Expect(err).NotTo(HaveOccurred())
+		b, _ := batch[0].AsBytes()
+		Expect(b).To(MatchJSON(`{"name": "jane", "age": 42}`))
+	})
+
+	It("should reject payloads which do not match the schema", func() {
+		register("person", personProto)
+		enc := processor(nats.EncodeConfigSpec, false, "format: protobuf\nsubject: person\n")
+
+		_, err := enc.Process(context.Background(), service.NewMessage([]byte(`{"name": 42}`)))
+		Expect(err).To(MatchError(ContainSubstring("does not match the schema")))
+		Expect(err).To(MatchError(HavePrefix(nats.InvalidPayloadError)))
+	})
+
+	It("should fail when the schema does not exist", func() {
+		conf, err := nats.EncodeConfigSpec.ParseYAML(fmt.Sprintf("format: avro\nsubject: missing\nregistry:\n  dir: %s\n", dir), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = nats.NewSchemaCodecProcessor(conf, false)
+		Expect(err).To(MatchError(nats.ErrSchemaNotFound))
+	})
+
+	It("should require the message name when the definition holds several messages", func() {
+		_, err := nats.NewSchemaCodec(nats.SchemaFormatProtobuf, []byte(personProto+"\nmessage Other {}"), "")
+		Expect(err).To(MatchError(ContainSubstring("message to use must be named")))
+
+		_, err = nats.NewSchemaCodec(nats.SchemaFormatProtobuf, []byte(personProto), "example.Missing")
+		Expect(err).To(MatchError(ContainSubstring("does not define message example.Missing")))
+	})
+})
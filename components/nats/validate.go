@@ -0,0 +1,142 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	validateFormatField   = "format"
+	validateSchemaField   = "schema"
+	validateRegistryField = "registry"
+
+	registryBucketField      = "bucket"
+	registryObjectStoreField = "object_store"
+	registryDirField         = "dir"
+	registryNameField        = "name"
+	registryVersionField     = "version"
+)
+
+// RegistryFields are the fields locating a SchemaRegistry.
+var RegistryFields = append(connectionFields("The urls of the NATS servers holding the schemas"),
+	service.NewStringField(registryBucketField).Description("The KV bucket holding the schemas").Optional(),
+	service.NewStringField(registryObjectStoreField).Description("The object store holding the schemas").Optional(),
+	service.NewStringField(registryDirField).Description("A local directory holding the schemas, standing in for NATS in tests").Optional(),
+)
+
+// SchemaRegistryFields are the fields locating a schema in a SchemaRegistry.
+var SchemaRegistryFields = append(slices.Clone(RegistryFields),
+	service.NewStringField(registryNameField).Description("The name of the schema"),
+	service.NewStringField(registryVersionField).Description("The version of the schema, the latest version unless set").Optional(),
+)
+
+// ValidateConfigSpec defines the configuration schema for the schema_validate processor.
+var ValidateConfigSpec = service.NewConfigSpec().
+	Beta().
+	Summary("check message payloads against a JSON Schema or Avro schema").
+	Description("The schema is fetched and compiled once, when the processor is created. Messages which do not match the schema are flagged as failed.").
+	Fields(
+		service.NewStringEnumField(validateFormatField, SchemaFormatJSONSchema, SchemaFormatAvro).
+			Description("The format of the schema. Avro payloads are expected to be binary encoded."),
+		service.NewStringField(validateSchemaField).
+			Description("The inline schema document, exclusive with registry").
+			Optional(),
+		service.NewObjectField(validateRegistryField, SchemaRegistryFields...).
+			Description("The location of the schema in NATS, exclusive with schema").
+			Optional(),
+	)
+
+// NewValidate creates a schema_validate processor from the provided configuration,
+// fetching and compiling its schema.
+//
+// Parameters:
+//   - conf: Parsed configuration holding the schema or its location
+//
+// Returns:
+//   - A configured Validate instance
+//   - An error if the configuration is invalid or the schema could not be loaded
+func NewValidate(conf *service.ParsedConfig) (*Validate, error) {
+	format, err := conf.FieldString(validateFormatField)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get format field: %w", err)
+	}
+
+	var inline string
+	if conf.Contains(validateSchemaField) {
+		if inline, err = conf.FieldString(validateSchemaField); err != nil {
+			return nil, fmt.Errorf("failed to get schema field: %w", err)
+		}
+	}
+
+	var src *SchemaSource
+	if conf.Contains(validateRegistryField) {
+		if src, err = SchemaSourceFromConfig(conf.Namespace(validateRegistryField)); err != nil {
+			return nil, err
+		}
+	}
+
+	schema, err := LoadSchema(context.Background(), format, inline, src)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Validate{schema: schema}, nil
+}
+
+// SchemaSourceFromConfig reads the location of a schema from the SchemaRegistryFields.
+func SchemaSourceFromConfig(conf *service.ParsedConfig) (*SchemaSource, error) {
+	registry, err := RegistryFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	src := SchemaSource{Registry: registry}
+	if src.Name, err = conf.FieldString(registryNameField); err != nil {
+		return nil, fmt.Errorf("failed to get registry name field: %w", err)
+	}
+	src.Version, _ = conf.FieldString(registryVersionField)
+
+	return &src, nil
+}
+
+// RegistryFromConfig reads the location of a SchemaRegistry from the RegistryFields.
+func RegistryFromConfig(conf *service.ParsedConfig) (RegistryConfig, error) {
+	var c RegistryConfig
+
+	var err error
+	if c.URLs, c.JWT, c.Seed, err = connectionFromConfig(conf); err != nil {
+		return c, fmt.Errorf("registry: %w", err)
+	}
+
+	c.Bucket, _ = conf.FieldString(registryBucketField)
+	c.ObjectStore, _ = conf.FieldString(registryObjectStoreField)
+	c.Dir, _ = conf.FieldString(registryDirField)
+
+	return c, nil
+}
+
+// Validate is a processor flagging the messages whose payload does not match a schema as failed.
+// The schema may be held in a NATS KV bucket or object store.
+type Validate struct {
+	schema Schema
+}
+
+func (v *Validate) Process(_ context.Context, msg *service.Message) (service.MessageBatch, error) {
+	b, err := msg.AsBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.schema.Validate(b); err != nil {
+		return nil, err
+	}
+
+	return service.MessageBatch{msg}, nil
+}
+
+func (v *Validate) Close(_ context.Context) error {
+	return nil
+}
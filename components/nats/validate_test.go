@@ -0,0 +1,132 @@
+package nats_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/synadia-io/connect-runtime-wombat/components/nats"
+)
+
+const personSchema = `{
+  "type": "object",
+  "properties": {"name": {"type": "string"}, "age": {"type": "integer"}},
+  "required": ["name"]
+}`
+
+const personAvroSchema = `{
+  "type": "record",
+  "name": "Person",
+  "fields": [{"name": "name", "type": "string"}, {"name": "age", "type": "int"}]
+}`
+
+var _ = Describe("Schema Validate", func() {
+	process := func(yaml string, payload []byte) error {
+		conf, err := nats.ValidateConfigSpec.ParseYAML(yaml, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		v, err := nats.NewValidate(conf)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = v.Process(context.Background(), service.NewMessage(payload))
+		return err
+	}
+
+	It("should check payloads against an inline JSON schema", func() {
+		yaml := fmt.Sprintf("format: json_schema\nschema: '%s'\n", personSchema)
+
+		Expect(process(yaml, []byte(`{"name": "jane", "age": 42}`))).To(Succeed())
+		Expect(process(yaml, []byte(`{"age": "old"}`))).To(MatchError(ContainSubstring("does not match the schema")))
+		Expect(process(yaml, []byte(`not json`))).To(MatchError(ContainSubstring("not valid JSON")))
+	})
+
+	It("should check payloads against an inline Avro schema", func() {
+		codec, err := goavro.NewCodec(personAvroSchema)
+		Expect(err).NotTo(HaveOccurred())
+		valid, err := codec.BinaryFromNative(nil, map[string]any{"name": "jane", "age": 42})
+		Expect(err).NotTo(HaveOccurred())
+
+		yaml := fmt.Sprintf("format: avro\nschema: '%s'\n", personAvroSchema)
+
+		Expect(process(yaml, valid)).To(Succeed())
+		Expect(process(yaml, append(valid, 1))).To(MatchError(ContainSubstring("trailing bytes")))
+		Expect(process(yaml, []byte{})).To(HaveOccurred())
+	})
+
+	It("should reject schemas which do not compile", func() {
+		conf, err := nats.ValidateConfigSpec.ParseYAML("format: avro\nschema: '{\"type\": \"nope\"}'\n", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = nats.NewValidate(conf)
+		Expect(err).To(MatchError(ContainSubstring("failed to compile Avro schema")))
+	})
+
+	When("the schema is stored in NATS", func() {
+		var jsSrv *server.Server
+		var js jetstream.JetStream
+
+		BeforeEach(func() {
+			opts := test.DefaultTestOptions
+			opts.Port = -1
+			opts.JetStream = true
+			opts.StoreDir = GinkgoT().TempDir()
+			jsSrv = test.RunServer(&opts)
+
+			jsNc, err := nats2.Connect(jsSrv.ClientURL())
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(func() {
+				jsNc.Close()
+				jsSrv.Shutdown()
+			})
+
+			js, err = jetstream.New(jsNc)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should fetch the schema version from a kv bucket", func() {
+			bucket := "schemas_" + nuid.Next()
+			kv, err := js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: bucket})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = kv.PutString(context.Background(), "person/1", personSchema)
+			Expect(err).NotTo(HaveOccurred())
+
+			yaml := fmt.Sprintf("format: json_schema\nregistry:\n  urls: [%s]\n  bucket: %s\n  name: person\n  version: \"1\"\n", jsSrv.ClientURL(), bucket)
+
+			Expect(process(yaml, []byte(`{"name": "jane"}`))).To(Succeed())
+			Expect(process(yaml, []byte(`{}`))).To(HaveOccurred())
+		})
+
+		It("should fetch the schema from an object store", func() {
+			store := "schemas_" + nuid.Next()
+			obs, err := js.CreateObjectStore(context.Background(), jetstream.ObjectStoreConfig{Bucket: store})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = obs.PutString(context.Background(), "person", personSchema)
+			Expect(err).NotTo(HaveOccurred())
+
+			yaml := fmt.Sprintf("format: json_schema\nregistry:\n  urls: [%s]\n  object_store: %s\n  name: person\n", jsSrv.ClientURL(), store)
+
+			Expect(process(yaml, []byte(`{"name": "jane"}`))).To(Succeed())
+		})
+
+		It("should fail when the schema does not exist", func() {
+			bucket := "schemas_" + nuid.Next()
+			_, err := js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: bucket})
+			Expect(err).NotTo(HaveOccurred())
+
+			conf, err := nats.ValidateConfigSpec.ParseYAML(fmt.Sprintf("format: json_schema\nregistry:\n  urls: [%s]\n  bucket: %s\n  name: missing\n", jsSrv.ClientURL(), bucket), nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = nats.NewValidate(conf)
+			Expect(err).To(MatchError(ContainSubstring("failed to fetch schema")))
+		})
+	})
+})
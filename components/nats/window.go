@@ -0,0 +1,284 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// WindowTumbling identifies time windows following each other without overlapping
+	WindowTumbling = "tumbling"
+	// WindowSliding identifies time windows starting every slide, which overlap when the slide is shorter than the size
+	WindowSliding = "sliding"
+	// WindowCount identifies windows closing once a group holds a number of messages
+	WindowCount = "count"
+)
+
+// Aggregates is the list of the aggregates computed over the values of a field, besides the
+// percentiles which are written pNN, such as p95.
+var Aggregates = []string{"sum", "count", "min", "max", "avg"}
+
+// WindowSpec describes the windows of an aggregation.
+type WindowSpec struct {
+	// Type is the type of the windows, WindowTumbling, WindowSliding or WindowCount
+	Type string
+	// Size is the length of the time windows
+	Size time.Duration
+	// Slide is the time between the starts of two sliding windows
+	Slide time.Duration
+	// Count is the number of messages of a group closing a count window
+	Count int
+	// Fields are the dot separated paths of the numeric fields to aggregate
+	Fields []string
+	// Aggregates are the aggregates computed for every field
+	Aggregates []string
+}
+
+// Validate checks that the windows are well defined.
+func (s WindowSpec) Validate() error {
+	switch s.Type {
+	case WindowTumbling:
+		if s.Size <= 0 {
+			return fmt.Errorf("a %s window requires a positive size", s.Type)
+		}
+	case WindowSliding:
+		if s.Size <= 0 || s.Slide <= 0 {
+			return fmt.Errorf("a %s window requires a positive size and slide", s.Type)
+		}
+		if s.Slide > s.Size {
+			return fmt.Errorf("the slide of a %s window cannot be longer than its size", s.Type)
+		}
+	case WindowCount:
+		if s.Count <= 0 {
+			return fmt.Errorf("a %s window requires a positive count", s.Type)
+		}
+	default:
+		return fmt.Errorf("unknown window type %q, expected %s, %s or %s", s.Type, WindowTumbling, WindowSliding, WindowCount)
+	}
+
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("an aggregation requires at least one field")
+	}
+
+	for _, a := range s.Aggregates {
+		if _, err := parseAggregate(a); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseAggregate returns the percentile of a pNN aggregate, or 0 for the other aggregates.
+func parseAggregate(a string) (float64, error) {
+	if slices.Contains(Aggregates, a) {
+		return 0, nil
+	}
+
+	if p, ok := strings.CutPrefix(a, "p"); ok {
+		if n, err := strconv.ParseFloat(p, 64); err == nil && n > 0 && n <= 100 {
+			return n, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown aggregate %q, expected one of %s or a percentile such as p95", a, strings.Join(Aggregates, ", "))
+}
+
+// window holds the values of the messages of every group falling within a window. Count
+// windows only hold one group, and their end is the time of their last message.
+type window struct {
+	Start  time.Time               `json:"start"`
+	End    time.Time               `json:"end"`
+	Groups map[string]*windowGroup `json:"groups"`
+}
+
+// windowGroup holds the values of the messages of a group within a window.
+type windowGroup struct {
+	Count  int                  `json:"count"`
+	Values map[string][]float64 `json:"values"`
+}
+
+// windows aggregates the values of messages into windows. It is not safe for concurrent use.
+type windows struct {
+	spec WindowSpec
+
+	// Open are the time windows by start, in unix nanoseconds
+	Open map[int64]*window `json:"open,omitempty"`
+	// Counts are the count windows by group
+	Counts map[string]*window `json:"counts,omitempty"`
+}
+
+func newWindows(spec WindowSpec) *windows {
+	return &windows{spec: spec, Open: map[int64]*window{}, Counts: map[string]*window{}}
+}
+
+// add records the values of a message of the given group received at the given time, and
+// returns the aggregates of the count window it closed, if any.
+func (w *windows) add(at time.Time, group string, values map[string]float64) [][]byte {
+	if w.spec.Type == WindowCount {
+		win, ok := w.Counts[group]
+		if !ok {
+			win = &window{Start: at, Groups: map[string]*windowGroup{}}
+			w.Counts[group] = win
+		}
+		win.End = at
+		win.add(group, values)
+
+		if win.Groups[group].Count < w.spec.Count {
+			return nil
+		}
+
+		delete(w.Counts, group)
+		return win.aggregate(w.spec)
+	}
+
+	slide := w.spec.Slide
+	if w.spec.Type == WindowTumbling {
+		slide = w.spec.Size
+	}
+
+	t := at.UnixNano()
+	for start := t - mod(t, int64(slide)); start > t-int64(w.spec.Size); start -= int64(slide) {
+		win, ok := w.Open[start]
+		if !ok {
+			win = &window{
+				Start:  time.Unix(0, start).UTC(),
+				End:    time.Unix(0, start+int64(w.spec.Size)).UTC(),
+				Groups: map[string]*windowGroup{},
+			}
+			w.Open[start] = win
+		}
+		win.add(group, values)
+	}
+
+	return nil
+}
+
+// close returns the aggregates of the time windows ended at the given time, or of all the
+// windows when flushing.
+func (w *windows) close(now time.Time, flush bool) [][]byte {
+	var result [][]byte
+
+	for _, start := range slices.Sorted(maps.Keys(w.Open)) {
+		win := w.Open[start]
+		if flush || !now.Before(win.End) {
+			result = append(result, win.aggregate(w.spec)...)
+			delete(w.Open, start)
+		}
+	}
+
+	if flush {
+		for _, group := range slices.Sorted(maps.Keys(w.Counts)) {
+			result = append(result, w.Counts[group].aggregate(w.spec)...)
+			delete(w.Counts, group)
+		}
+	}
+
+	return result
+}
+
+// next returns the end of the earliest open time window.
+func (w *windows) next() (time.Time, bool) {
+	var next time.Time
+	for _, win := range w.Open {
+		if next.IsZero() || win.End.Before(next) {
+			next = win.End
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// empty tells whether no window is open.
+func (w *windows) empty() bool {
+	return len(w.Open) == 0 && len(w.Counts) == 0
+}
+
+func (win *window) add(group string, values map[string]float64) {
+	g, ok := win.Groups[group]
+	if !ok {
+		g = &windowGroup{Values: map[string][]float64{}}
+		win.Groups[group] = g
+	}
+
+	g.Count++
+	for field, v := range values {
+		g.Values[field] = append(g.Values[field], v)
+	}
+}
+
+// aggregate returns one JSON document per group of the window, holding the aggregates of its fields.
+func (win *window) aggregate(spec WindowSpec) [][]byte {
+	result := make([][]byte, 0, len(win.Groups))
+	for _, group := range slices.Sorted(maps.Keys(win.Groups)) {
+		g := win.Groups[group]
+
+		fields := make(map[string]map[string]float64, len(spec.Fields))
+		for _, field := range spec.Fields {
+			fields[field] = aggregateValues(g.Values[field], spec.Aggregates)
+		}
+
+		b, _ := json.Marshal(map[string]any{
+			"group":        group,
+			"window_start": win.Start.Format(time.RFC3339Nano),
+			"window_end":   win.End.Format(time.RFC3339Nano),
+			"count":        g.Count,
+			"fields":       fields,
+		})
+		result = append(result, b)
+	}
+	return result
+}
+
+// aggregateValues computes the aggregates of a list of values. The aggregates other than the
+// count are left out when there are no values.
+func aggregateValues(values []float64, aggregates []string) map[string]float64 {
+	result := make(map[string]float64, len(aggregates))
+	if len(values) == 0 {
+		if slices.Contains(aggregates, "count") {
+			result["count"] = 0
+		}
+		return result
+	}
+
+	sorted := slices.Sorted(slices.Values(values))
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+
+	for _, a := range aggregates {
+		switch a {
+		case "sum":
+			result[a] = sum
+		case "count":
+			result[a] = float64(len(sorted))
+		case "min":
+			result[a] = sorted[0]
+		case "max":
+			result[a] = sorted[len(sorted)-1]
+		case "avg":
+			result[a] = sum / float64(len(sorted))
+		default:
+			// Nearest rank percentile
+			p, _ := parseAggregate(a)
+			rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+			result[a] = sorted[max(rank, 1)-1]
+		}
+	}
+
+	return result
+}
+
+func mod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
@@ -0,0 +1,56 @@
+// Package events publishes connector lifecycle events to NATS.
+//
+// Every workload reports its progress (starting, compiled, validated, running,
+// draining, stopped or failed) as a JSON document on the NEX feed of its namespace,
+// allowing operators to follow a connector without scraping its logs. Events are
+// published using the same NATS connection details and headers as the metrics.
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+)
+
+// Type identifies a stage in the lifecycle of a connector.
+type Type string
+
+const (
+	// Starting is published when the workload process has started
+	Starting Type = "starting"
+	// Compiled is published once the connector specification has been compiled
+	Compiled Type = "compiled"
+	// Validated is published once the compiled configuration has been accepted by Wombat
+	Validated Type = "validated"
+	// Running is published once the stream and HTTP server have been started
+	Running Type = "running"
+	// Draining is published when a shutdown has been requested
+	Draining Type = "draining"
+	// Stopped is published when the workload stopped without error
+	Stopped Type = "stopped"
+	// Failed is published when the workload stopped because of an error
+	Failed Type = "failed"
+)
+
+// eventsAPIPrefix generates the NEX-compatible subject prefix lifecycle events are
+// published on. It lives next to the metrics feed of the namespace.
+func eventsAPIPrefix(namespace string) string {
+	return fmt.Sprintf("$NEX.FEED.%s.events", namespace)
+}
+
+// Subject returns the subject on which the lifecycle events of the given instance are published.
+func Subject(namespace, instance string) string {
+	return fmt.Sprintf("%s.%s", eventsAPIPrefix(namespace), instance)
+}
+
+// Event is a single lifecycle event as published on NATS.
+type Event struct {
+	Type          Type                  `json:"type"`
+	Namespace     string                `json:"namespace"`
+	Connector     string                `json:"connector"`
+	Instance      string                `json:"instance"`
+	CorrelationID string                `json:"correlation_id,omitempty"`
+	Timestamp     time.Time             `json:"timestamp"`
+	Error         *compiler.ErrorReport `json:"error,omitempty"`
+}
@@ -0,0 +1,33 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+)
+
+var srv *server.Server
+var nc *nats.Conn
+
+func TestEvents(t *testing.T) {
+	BeforeSuite(func() {
+		var err error
+		srv = test.RunRandClientPortServer()
+		nc, err = nats.Connect(srv.ClientURL())
+		Expect(err).To(BeNil())
+	})
+
+	AfterSuite(func() {
+		nc.Close()
+		srv.Shutdown()
+	})
+
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Events Suite")
+}
@@ -0,0 +1,157 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/utils"
+	"github.com/synadia-io/connect/runtime"
+)
+
+type contextKey string
+
+// PublisherKey is the context key for the lifecycle event publisher
+const PublisherKey contextKey = "event_publisher"
+
+// flushTimeout bounds the time spent waiting for terminal events to reach the server
+const flushTimeout = 2 * time.Second
+
+// Publisher publishes lifecycle events for a single workload. A Publisher created
+// for a runtime without NATS connection details silently discards all events.
+//
+// Once a terminal event (stopped or failed) has been published, all subsequent
+// events are discarded, so the entry point and the runner can both report a
+// failure without it being published twice.
+type Publisher struct {
+	rt      *runtime.Runtime
+	nc      *nats.Conn
+	subject string
+	headers nats.Header
+
+	mu         sync.Mutex
+	terminated bool
+}
+
+// NewPublisher creates a Publisher for the given runtime, connecting to NATS with
+// the credentials of the runtime.
+//
+// Returns:
+//   - A Publisher, which discards events if the runtime lacks the NATS URL, namespace or instance
+//   - An error if the connection to NATS could not be established
+func NewPublisher(rt *runtime.Runtime) (*Publisher, error) {
+	p := &Publisher{rt: rt}
+	if rt.NatsUrl == "" || rt.Namespace == "" || rt.Instance == "" {
+		return p, nil
+	}
+
+	opts := []nats.Option{
+		nats.Name("LifecycleEvents"),
+	}
+
+	if rt.NatsJwt != "" && rt.NatsSeed != "" {
+		opts = append(opts, nats.UserJWTAndSeed(rt.NatsJwt, rt.NatsSeed))
+	}
+
+	nc, err := nats.Connect(rt.NatsUrl, opts...)
+	if err != nil {
+		return p, compiler.NewRuntimeError("events", "failed to connect to NATS", err).
+			WithCode(compiler.CodeEventsUnavailable)
+	}
+
+	p.nc = nc
+	p.subject = Subject(rt.Namespace, rt.Instance)
+	p.headers = nats.Header{}
+	p.headers.Set(compiler.AccountMetricHeader, rt.Namespace)
+	p.headers.Set(compiler.ConnectorMetricHeader, rt.Connector)
+	p.headers.Set(compiler.InstanceMetricHeader, rt.Instance)
+
+	return p, nil
+}
+
+// Publish publishes a lifecycle event of the given type. Publishing is best effort;
+// failures are logged and never interrupt the workload.
+func (p *Publisher) Publish(ctx context.Context, t Type) {
+	p.publish(ctx, t, nil)
+}
+
+// Fail publishes a failed event describing the given error.
+func (p *Publisher) Fail(ctx context.Context, err error) {
+	p.publish(ctx, Failed, err)
+}
+
+// Close flushes pending events and closes the connection to NATS.
+func (p *Publisher) Close() {
+	if p == nil || p.nc == nil {
+		return
+	}
+
+	_ = p.nc.FlushTimeout(flushTimeout)
+	p.nc.Close()
+}
+
+func (p *Publisher) publish(ctx context.Context, t Type, err error) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.terminated {
+		return
+	}
+	p.terminated = t == Stopped || t == Failed
+
+	if p.nc == nil {
+		return
+	}
+
+	logger := utils.LoggerWithCorrelation(ctx)
+
+	evt := Event{
+		Type:          t,
+		Namespace:     p.rt.Namespace,
+		Connector:     p.rt.Connector,
+		Instance:      p.rt.Instance,
+		CorrelationID: utils.GetCorrelationID(ctx),
+		Timestamp:     time.Now().UTC(),
+	}
+
+	if err != nil {
+		evt.Error = compiler.NewErrorReport(err)
+	}
+
+	b, mErr := json.Marshal(evt)
+	if mErr != nil {
+		logger.Warn().Err(mErr).Str("event", string(t)).Msg("Failed to marshal lifecycle event")
+		return
+	}
+
+	if pErr := p.nc.PublishMsg(&nats.Msg{Subject: p.subject, Header: p.headers, Data: b}); pErr != nil {
+		logger.Warn().Err(pErr).Str("event", string(t)).Msg("Failed to publish lifecycle event")
+		return
+	}
+
+	if p.terminated {
+		if fErr := p.nc.FlushTimeout(flushTimeout); fErr != nil {
+			logger.Warn().Err(fErr).Str("event", string(t)).Msg("Failed to flush lifecycle event")
+		}
+	}
+}
+
+// WithPublisher adds a lifecycle event publisher to the context
+func WithPublisher(ctx context.Context, p *Publisher) context.Context {
+	return context.WithValue(ctx, PublisherKey, p)
+}
+
+// FromContext retrieves the lifecycle event publisher from the context, or nil if there is none
+func FromContext(ctx context.Context) *Publisher {
+	if p, ok := ctx.Value(PublisherKey).(*Publisher); ok {
+		return p
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/events"
+	"github.com/synadia-io/connect-runtime-wombat/test"
+	"github.com/synadia-io/connect-runtime-wombat/utils"
+	"github.com/synadia-io/connect/runtime"
+)
+
+var _ = Describe("Lifecycle Events", func() {
+	var publisher *events.Publisher
+	var received chan *nats.Msg
+
+	BeforeEach(func() {
+		rt := test.Runtime(runtime.WithNatsUrl(srv.ClientURL()))
+
+		received = make(chan *nats.Msg, 10)
+		sub, err := nc.ChanSubscribe(events.Subject(rt.Namespace, rt.Instance), received)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nc.Flush()).To(Succeed())
+		DeferCleanup(sub.Unsubscribe)
+
+		publisher, err = events.NewPublisher(rt)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(publisher.Close)
+	})
+
+	next := func() (*nats.Msg, events.Event) {
+		var msg *nats.Msg
+		Eventually(received, 5*time.Second).Should(Receive(&msg))
+
+		var evt events.Event
+		Expect(json.Unmarshal(msg.Data, &evt)).To(Succeed())
+		return msg, evt
+	}
+
+	It("should publish events on the NEX feed of the namespace", func() {
+		Expect(events.Subject("MY_NAMESPACE", "MY_INSTANCE")).To(Equal("$NEX.FEED.MY_NAMESPACE.events.MY_INSTANCE"))
+
+		ctx := utils.WithCorrelationID(context.Background(), "abc123")
+		publisher.Publish(ctx, events.Starting)
+
+		msg, evt := next()
+		Expect(evt.Type).To(Equal(events.Starting))
+		Expect(evt.Namespace).To(Equal("MY_NAMESPACE"))
+		Expect(evt.Connector).To(Equal("MY_CONNECTOR"))
+		Expect(evt.Instance).To(Equal("MY_INSTANCE"))
+		Expect(evt.CorrelationID).To(Equal("abc123"))
+		Expect(evt.Error).To(BeNil())
+
+		Expect(msg.Header.Get(compiler.AccountMetricHeader)).To(Equal("MY_NAMESPACE"))
+		Expect(msg.Header.Get(compiler.ConnectorMetricHeader)).To(Equal("MY_CONNECTOR"))
+		Expect(msg.Header.Get(compiler.InstanceMetricHeader)).To(Equal("MY_INSTANCE"))
+	})
+
+	It("should report the error of a failed connector", func() {
+		cause := compiler.NewValidationError("configuration", "failed to validate and create stream", errors.New("boom"))
+		publisher.Fail(context.Background(), cause)
+
+		_, evt := next()
+		Expect(evt.Type).To(Equal(events.Failed))
+		Expect(evt.Error).NotTo(BeNil())
+		Expect(evt.Error.Class).To(Equal(compiler.ValidationErrorClass))
+		Expect(evt.Error.Message).To(Equal("failed to validate and create stream"))
+		Expect(evt.Error.Cause).To(Equal("boom"))
+	})
+
+	It("should not publish anything after a terminal event", func() {
+		publisher.Publish(context.Background(), events.Stopped)
+		publisher.Fail(context.Background(), errors.New("late failure"))
+		publisher.Publish(context.Background(), events.Running)
+
+		_, evt := next()
+		Expect(evt.Type).To(Equal(events.Stopped))
+		Consistently(received, 500*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should discard events when the runtime has no NATS connection details", func() {
+		p, err := events.NewPublisher(test.Runtime())
+		Expect(err).NotTo(HaveOccurred())
+		defer p.Close()
+
+		p.Publish(context.Background(), events.Starting)
+		Consistently(received, 500*time.Millisecond).ShouldNot(Receive())
+	})
+})
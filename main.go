@@ -19,6 +19,8 @@ import (
 	"os"
 	"strings"
 
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/events"
 	"github.com/synadia-io/connect-runtime-wombat/runner"
 	"github.com/synadia-io/connect-runtime-wombat/utils"
 	"github.com/synadia-io/connect/runtime"
@@ -70,14 +72,29 @@ func main() {
 
 	logger.Info().Msg("Runtime initialized successfully")
 
+	// Lifecycle events are published on the NEX feed of the namespace, next to the metrics
+	publisher, err := events.NewPublisher(rt)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Lifecycle events will not be published")
+	}
+	ctx = events.WithPublisher(ctx, publisher)
+	publisher.Publish(ctx, events.Starting)
+
 	// Launch the workload with the provided configuration
 	// This will compile the Connect specification to Wombat format,
 	// start the data pipeline, and block until completion or error
 	logger.Info().Str("config", args[0]).Msg("Launching workload")
-	if err := rt.Launch(ctx, runner.Run, args[0]); err != nil {
+	if err := runner.Launch(ctx, rt, args[0]); err != nil {
 		logger.Error().Err(err).Msg("Failed to launch workload")
+		if report, rErr := compiler.NewErrorReport(err).JSON(); rErr == nil {
+			fmt.Fprintln(os.Stderr, string(report))
+		}
+		publisher.Fail(ctx, err)
+		publisher.Close()
 		os.Exit(1)
 	}
+
+	publisher.Close()
 }
 
 // preFlightCheck checks if the runtime has all required values for metrics configuration
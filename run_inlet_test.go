@@ -2,6 +2,7 @@ package main_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/Jeffail/gabs/v2"
 	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/events"
 	"github.com/synadia-io/connect-runtime-wombat/runner"
 	"github.com/synadia-io/connect-runtime-wombat/test"
 	. "github.com/synadia-io/connect/builders"
@@ -88,6 +90,46 @@ var _ = Describe("Running an inlet", func() {
 			}
 		})
 
+		It("should publish its lifecycle events", func() {
+			rt := test.Runtime(
+				runtime.WithNatsUrl(natsUrl),
+			)
+
+			received := make(chan *nats.Msg, 10)
+			s, err := nc.ChanSubscribe(events.Subject(rt.Namespace, rt.Instance), received)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				if err := s.Unsubscribe(); err != nil {
+					GinkgoLogr.Error(err, "failed to unsubscribe")
+				}
+			}()
+
+			inlet := Steps().
+				Source(test.GenerateSource()).
+				Producer(test.CoreProducerWithSubject(test.NatsConfig(TestPort), fmt.Sprintf("test.%s", uuid.New().String()))).
+				Build()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			Expect(runner.Run(ctx, rt, inlet)).To(Succeed())
+
+			var types []events.Type
+			Eventually(func() []events.Type {
+				for {
+					select {
+					case msg := <-received:
+						var evt events.Event
+						Expect(json.Unmarshal(msg.Data, &evt)).To(Succeed())
+						types = append(types, evt.Type)
+					default:
+						return types
+					}
+				}
+			}, 5*time.Second, 100*time.Millisecond).Should(Equal([]events.Type{
+				events.Compiled, events.Validated, events.Running, events.Draining, events.Stopped,
+			}))
+		})
+
 		It("should consume messages and send them to nats", func() {
 			// -- generate a subject name
 			subject := fmt.Sprintf("test.%s", uuid.New().String())
@@ -7,22 +7,54 @@
 //   - Validation of the generated configurations
 //   - Concurrent management of the data stream and HTTP server
 //   - Graceful shutdown on signals or errors
+//   - Publishing of lifecycle events to NATS
 package runner
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	"github.com/synadia-io/connect-runtime-wombat/events"
 	"github.com/synadia-io/connect-runtime-wombat/utils"
 	"github.com/synadia-io/connect/model"
 	"github.com/synadia-io/connect/runtime"
+	"gopkg.in/yaml.v3"
 )
 
+// Launch decodes the base64 encoded connector configuration and runs it. It behaves
+// like runtime.Runtime.Launch with Run as the workload, except that the configuration
+// is decoded into compiler.ConnectorSteps, so the step types specific to this runtime
+// are retained.
+//
+// Parameters:
+//   - ctx: Context for cancellation and timeout control
+//   - rt: Runtime configuration
+//   - cfg: The base64 encoded YAML connector configuration
+//
+// Returns an error if the configuration could not be decoded, or if running it fails.
+func Launch(ctx context.Context, rt *runtime.Runtime, cfg string) error {
+	cfgb, err := base64.StdEncoding.DecodeString(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+
+	var steps compiler.ConnectorSteps
+	if err := yaml.Unmarshal(cfgb, &steps); err != nil {
+		return fmt.Errorf("failed to decode connector config: %w", err)
+	}
+
+	rt.Logger = slog.Default()
+
+	return RunSteps(ctx, rt, steps)
+}
+
 // Run executes the main runtime logic for a Connect specification.
 // It compiles the specification to Wombat format, validates it, and runs
 // the resulting data pipeline.
@@ -37,6 +69,9 @@ import (
 //   - Stream completion or error
 //   - HTTP server error
 //
+// Progress is reported as lifecycle events through the publisher found in the
+// context. If there is none, a publisher is created for the duration of the run.
+//
 // Parameters:
 //   - ctx: Context for cancellation and timeout control
 //   - runtime: Runtime configuration including component definitions
@@ -44,6 +79,11 @@ import (
 //
 // Returns an error if compilation, validation, or execution fails.
 func Run(ctx context.Context, runtime *runtime.Runtime, steps model.Steps) error {
+	return RunSteps(ctx, runtime, compiler.FromModel(steps))
+}
+
+// RunSteps behaves like Run, accepting the step types specific to this runtime.
+func RunSteps(ctx context.Context, runtime *runtime.Runtime, steps compiler.ConnectorSteps) error {
 	logger := utils.LoggerWithCorrelation(ctx)
 	logger.Info().
 		Str("namespace", runtime.Namespace).
@@ -51,13 +91,33 @@ func Run(ctx context.Context, runtime *runtime.Runtime, steps model.Steps) error
 		Str("connector", runtime.Connector).
 		Msg("Starting wombat runner")
 
+	publisher := events.FromContext(ctx)
+	if publisher == nil {
+		var err error
+		publisher, err = events.NewPublisher(runtime)
+		if err != nil {
+			logger.Warn().Err(err).Msg("Lifecycle events will not be published")
+		}
+		defer publisher.Close()
+	}
+
 	// Compile the Connect specification to Wombat YAML
 	logger.Debug().Msg("Compiling configuration")
-	art, err := compiler.CompileWithContext(ctx, runtime, steps)
+	report, err := compiler.CompileStepsWithReport(ctx, runtime, steps)
 	if err != nil {
 		logger.Error().Err(err).Msg("Compilation failed")
+		publisher.Fail(ctx, err)
 		return fmt.Errorf("compilation failed: %w", err)
 	}
+	publisher.Publish(ctx, events.Compiled)
+
+	art := report.Config
+	if len(report.Defaulted) > 0 {
+		logger.Info().Strs("defaulted", report.Defaulted).Msg("Applied component defaults")
+	}
+	for _, w := range report.Warnings {
+		logger.Warn().Str("path", w.Path).Msg(w.Message)
+	}
 
 	logger.Debug().Int("config_bytes", len(art)).Msg("Configuration compiled successfully")
 
@@ -76,8 +136,13 @@ func Run(ctx context.Context, runtime *runtime.Runtime, steps model.Steps) error
 	stream, err := compiler.Validate(ctx, runtime, art, mux)
 	if err != nil {
 		logger.Error().Err(err).Msg("Validation failed")
-		return compiler.NewValidationError("configuration", "failed to validate and create stream", err)
+		vErr := compiler.NewValidationError("configuration", "failed to validate and create stream", err).
+			WithCode(compiler.CodeInvalidConfiguration).
+			WithIssues(compiler.LintIssues(err, art, steps)...)
+		publisher.Fail(ctx, vErr)
+		return vErr
 	}
+	publisher.Publish(ctx, events.Validated)
 
 	logger.Info().Msg("Configuration validated, starting stream and HTTP server")
 
@@ -100,12 +165,14 @@ func Run(ctx context.Context, runtime *runtime.Runtime, steps model.Steps) error
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 
 	logger.Info().Msg("Runner started, waiting for shutdown signal")
+	publisher.Publish(ctx, events.Running)
 
 	// Wait for shutdown trigger and coordinate cleanup
 	select {
 	case <-ctx.Done():
 		// Context cancelled - initiate graceful shutdown
 		logger.Info().Msg("Context cancelled, shutting down")
+		publisher.Publish(ctx, events.Draining)
 		if err := server.Shutdown(context.TODO()); err != nil {
 			logger.Error().Err(err).Msg("Failed to shutdown server")
 		}
@@ -115,6 +182,7 @@ func Run(ctx context.Context, runtime *runtime.Runtime, steps model.Steps) error
 	case sig := <-sigs:
 		// OS signal received - initiate graceful shutdown
 		logger.Info().Str("signal", sig.String()).Msg("Received signal, shutting down")
+		publisher.Publish(ctx, events.Draining)
 		if err := server.Shutdown(context.TODO()); err != nil {
 			logger.Error().Err(err).Msg("Failed to shutdown server")
 		}
@@ -124,25 +192,36 @@ func Run(ctx context.Context, runtime *runtime.Runtime, steps model.Steps) error
 	case err := <-streamChan:
 		// Stream completed or errored - shutdown HTTP server
 		logger.Info().Err(err).Msg("Stream stopped, shutting down")
+		publisher.Publish(ctx, events.Draining)
 		if shutdownErr := server.Shutdown(context.TODO()); shutdownErr != nil {
 			logger.Error().Err(shutdownErr).Msg("Failed to shutdown server")
 		}
 		if err != nil {
-			return compiler.NewRuntimeError("stream", "stream execution failed", err)
+			rErr := compiler.NewRuntimeError("stream", "stream execution failed", err).
+				WithCode(compiler.CodeStreamFailed)
+			publisher.Fail(ctx, rErr)
+			return rErr
 		}
+		publisher.Publish(ctx, events.Stopped)
 		return nil
 	case err := <-httpChan:
 		// HTTP server stopped - shutdown stream
 		logger.Info().Err(err).Msg("HTTP server stopped, shutting down")
+		publisher.Publish(ctx, events.Draining)
 		if stopErr := stream.Stop(context.TODO()); stopErr != nil {
 			logger.Error().Err(stopErr).Msg("Failed to stop stream")
 		}
 		if err != nil {
-			return compiler.NewRuntimeError("http_server", "HTTP server failed", err)
+			rErr := compiler.NewRuntimeError("http_server", "HTTP server failed", err).
+				WithCode(compiler.CodeHTTPServerFailed)
+			publisher.Fail(ctx, rErr)
+			return rErr
 		}
+		publisher.Publish(ctx, events.Stopped)
 		return nil
 	}
 
 	logger.Info().Msg("Shutdown completed")
+	publisher.Publish(ctx, events.Stopped)
 	return nil
 }
@@ -0,0 +1,200 @@
+package benchmark_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// BenchmarkJetStreamPull compares the pull consumer settings of a stream consumer with the
+// nats_jetstream input used by BenchmarkJetStream, reading the same message counts and sizes.
+// The messages are published before the consumer starts, so that only their consumption is
+// measured.
+func BenchmarkJetStreamPull(b *testing.B) {
+	sizes := []struct {
+		name         string
+		messageCount int
+		messageSize  int
+	}{
+		{"Small_10K", 10000, 100},
+		{"Medium_10K", 10000, 1024},
+	}
+
+	// The settings of the nats_jetstream_pull input, the default nats_jetstream input being the baseline
+	settings := []struct {
+		name string
+		pull string
+	}{
+		{"Default", ""},
+		{"Pull_Batch1", "batch: 1"},
+		{"Pull_Batch100", "batch: 100"},
+		{"Pull_Batch500", "batch: 500"},
+		{"Pull_Batch100_Fetchers4", "batch: 100\nfetchers: 4"},
+		{"Pull_Batch500_MaxBytes1M", "batch: 500\nmax_bytes: 1048576"},
+		{"Pull_Batch100_Expiry5s_Heartbeat1s", "batch: 100\nexpiry: 5s\nheartbeat: 1s"},
+	}
+
+	for _, size := range sizes {
+		for _, s := range settings {
+			b.Run(size.name+"/"+s.name, func(b *testing.B) {
+				// Setup NATS server with JetStream
+				opts := test.DefaultTestOptions
+				opts.Port = -1
+				opts.JetStream = true
+				opts.StoreDir = b.TempDir()
+				srv := test.RunServer(&opts)
+				defer srv.Shutdown()
+
+				nc, err := nats.Connect(srv.ClientURL())
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer nc.Close()
+
+				js, err := jetstream.New(nc)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				// Create stream
+				stream, err := js.CreateStream(context.Background(), jetstream.StreamConfig{
+					Name:     "BENCH_STREAM",
+					Subjects: []string{"bench.js.>"},
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				var rate float64
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					if err := stream.Purge(context.Background()); err != nil {
+						b.Fatal(err)
+					}
+					publishJetStream(b, js, size.messageCount, size.messageSize)
+					b.StartTimer()
+
+					results := benchmarkJetStreamConsume(jetStreamConsumerInput(srv.ClientURL(), s.pull), size.messageCount)
+					rate += results.MessagesPerSec
+				}
+
+				b.ReportMetric(rate/float64(b.N), "msgs/s")
+			})
+		}
+	}
+}
+
+// jetStreamConsumerInput returns the configuration of an input reading the benchmark stream
+// through a new durable consumer, the nats_jetstream input unless pull settings are given.
+func jetStreamConsumerInput(natsURL, pull string) string {
+	input := "nats_jetstream"
+	if pull != "" {
+		input = "nats_jetstream_pull"
+	}
+
+	config := fmt.Sprintf(`
+%s:
+  urls: ["%s"]
+  subject: "bench.js.pull"
+  deliver: "all"
+  durable: "bench-%s"
+  ack_wait: "30s"
+  max_ack_pending: 1024
+`, input, natsURL, nuid.Next())
+
+	for _, line := range strings.Split(pull, "\n") {
+		if line != "" {
+			config += "  " + line + "\n"
+		}
+	}
+	return config
+}
+
+// publishJetStream publishes the messages read by the consumer of the benchmark.
+func publishJetStream(b *testing.B, js jetstream.JetStream, messageCount, messageSize int) {
+	payload := make([]byte, messageSize)
+	for i := 0; i < messageCount; i++ {
+		if _, err := js.PublishAsync("bench.js.pull", payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	select {
+	case <-js.PublishAsyncComplete():
+	case <-time.After(30 * time.Second):
+		b.Fatal("timeout publishing the messages")
+	}
+}
+
+// benchmarkJetStreamConsume runs the given input until it has read the given number of messages.
+// Latencies are not tracked as the messages are published before the input starts.
+func benchmarkJetStreamConsume(input string, messageCount int) *BenchmarkResults {
+	var receivedCount atomic.Int32
+	var bytesReceived atomic.Int64
+	done := make(chan struct{})
+
+	builder := service.NewStreamBuilder()
+	if err := builder.AddInputYAML(input); err != nil {
+		panic(err)
+	}
+	if err := builder.AddConsumerFunc(func(_ context.Context, msg *service.Message) error {
+		b, err := msg.AsBytes()
+		if err != nil {
+			return err
+		}
+		bytesReceived.Add(int64(len(b)))
+		if receivedCount.Add(1) == int32(messageCount) {
+			close(done)
+		}
+		return nil
+	}); err != nil {
+		panic(err)
+	}
+
+	consumer, err := builder.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	startTime := time.Now()
+
+	// Start consumer
+	go func() {
+		if err := consumer.Run(ctx); err != nil && ctx.Err() == nil {
+			panic(err)
+		}
+	}()
+
+	// Wait for all messages
+	select {
+	case <-done:
+	case <-time.After(60 * time.Second):
+		panic(fmt.Sprintf("timeout: received only %d/%d messages", receivedCount.Load(), messageCount))
+	}
+
+	duration := time.Since(startTime)
+	cancel()
+	_ = consumer.Stop(context.Background())
+
+	return &BenchmarkResults{
+		MessageCount:     messageCount,
+		Duration:         duration,
+		MessagesPerSec:   float64(messageCount) / duration.Seconds(),
+		BytesTransferred: bytesReceived.Load(),
+		Throughput:       float64(bytesReceived.Load()) / (1024 * 1024) / duration.Seconds(),
+	}
+}
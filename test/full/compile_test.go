@@ -35,6 +35,9 @@ steps:
 				exp := `
 input:
     generate:
+        auto_replay_nacks: true
+        batch_size: 1
+        count: 0
         interval: 1s
         mapping: root.message = "Hello, World!"
 output:
@@ -66,7 +66,7 @@ var _ = Describe("Component Validation", func() {
 				}
 			}
 
-			Expect(len(results)).To(Equal(32), "Expected 32 source components")
+			Expect(len(results)).To(Equal(34), "Expected 34 source components")
 		})
 	})
 
@@ -80,7 +80,7 @@ var _ = Describe("Component Validation", func() {
 				}
 			}
 
-			Expect(len(results)).To(Equal(38), "Expected 38 sink components")
+			Expect(len(results)).To(Equal(39), "Expected 39 sink components")
 		})
 	})
 
@@ -155,7 +155,7 @@ var _ = Describe("Component Validation", func() {
 
 		// All components should pass
 		Expect(successCount).To(Equal(len(allResults)), "All components should pass validation")
-		Expect(len(allResults)).To(Equal(75), "Expected 75 total components")
+		Expect(len(allResults)).To(Equal(78), "Expected 78 total components")
 	})
 })
 
@@ -364,6 +364,16 @@ func getMinimalConfig(componentName string, wombatType string) string {
     urls: ["nats://localhost:4222"]
     bucket: "test-bucket"
     key: "test-key"`
+	case "nats_object_store":
+		if wombatType == "input" {
+			return `
+    urls: ["nats://localhost:4222"]
+    bucket: "test-bucket"`
+		}
+		return `
+    urls: ["nats://localhost:4222"]
+    bucket: "test-bucket"
+    name: "test-object"`
 
 	// Generate
 	case "generate":
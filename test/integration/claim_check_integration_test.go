@@ -0,0 +1,140 @@
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	cnats "github.com/synadia-io/connect-runtime-wombat/components/nats"
+	rtest "github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/runtime"
+)
+
+var _ = Describe("Claim Check", func() {
+	var (
+		srv *server.Server
+		nc  *nats.Conn
+	)
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+
+		srv = test.RunServer(&opts)
+		Expect(srv).NotTo(BeNil())
+
+		var err error
+		nc, err = nats.Connect(srv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(func() {
+			nc.Close()
+			srv.Shutdown()
+		})
+	})
+
+	run := func(steps compiler.ConnectorSteps) *service.Stream {
+		artifact, err := compiler.CompileSteps(context.Background(), rtest.Runtime(runtime.WithNatsUrl(srv.ClientURL())), steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+		stream, err := sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+		return stream
+	}
+
+	It("should carry payloads larger than the max payload through an object store", func() {
+		subject := "test.claimcheck"
+		messageCount := 3
+		dir := GinkgoT().TempDir()
+
+		// Each payload is 65536 chunks of 32 bytes, twice the 1MB max payload of the server
+		inlet := compiler.FromModel(Steps().
+			Source(SourceStep("generate").
+				SetInt("count", messageCount).
+				SetString("interval", "1ms").
+				SetString("mapping", `let n = counter()
+root = range(0, 65536).map_each(i -> "%032d".format(i + $n * 100000)).join("")
+meta id = $n.string()`)).
+			Producer(ProducerStep(NatsConfig().Url(srv.ClientURL())).Core(ProducerStepCore(subject))).
+			Build())
+		inlet.Producer.ClaimCheck = &compiler.ClaimCheck{Bucket: "payloads", TTL: "1h"}
+
+		outlet := compiler.FromModel(Steps().
+			Consumer(ConsumerStep(NatsConfig().Url(srv.ClientURL())).Core(ConsumerStepCore(subject))).
+			Sink(SinkStep("file").
+				SetString("path", filepath.Join(dir, `${! meta("id") }.txt`)).
+				SetString("codec", "all-bytes")).
+			Build())
+		outlet.Consumer.ClaimCheck = true
+
+		var mu sync.Mutex
+		var references []*nats.Msg
+		sub, err := nc.Subscribe(subject, func(msg *nats.Msg) {
+			mu.Lock()
+			defer mu.Unlock()
+			references = append(references, msg)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = sub.Unsubscribe() }()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		consumer := run(outlet)
+		go func() { _ = consumer.Run(ctx) }()
+		defer func() { _ = consumer.Stop(context.Background()) }()
+
+		// Let the outlet subscribe before the inlet publishes
+		Eventually(srv.NumSubscriptions, 5*time.Second).Should(BeNumerically(">=", 2))
+
+		Expect(run(inlet).Run(ctx)).To(Succeed())
+
+		Eventually(func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(references)
+		}, 10*time.Second, 100*time.Millisecond).Should(Equal(messageCount))
+
+		mu.Lock()
+		for _, ref := range references {
+			Expect(len(ref.Data)).To(BeNumerically("<", 1024))
+			Expect(ref.Header.Get(cnats.ClaimCheckBucketHeader)).To(Equal("payloads"))
+			Expect(ref.Header.Get(cnats.ClaimCheckSizeHeader)).To(Equal(fmt.Sprint(65536 * 32)))
+			Expect(ref.Header.Get(cnats.ClaimCheckDigestHeader)).To(HavePrefix("SHA-256="))
+		}
+		mu.Unlock()
+
+		for i := 1; i <= messageCount; i++ {
+			path := filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+			Eventually(func() int {
+				info, err := os.Stat(path)
+				if err != nil {
+					return 0
+				}
+				return int(info.Size())
+			}, 10*time.Second, 100*time.Millisecond).Should(Equal(65536 * 32))
+
+			b, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(strings.HasPrefix(string(b), fmt.Sprintf("%032d", i*100000))).To(BeTrue())
+		}
+	})
+})
@@ -0,0 +1,120 @@
+package integration_test
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	rtest "github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/runtime"
+)
+
+var _ = Describe("Dedupe Transformer", func() {
+	var (
+		srv *server.Server
+		nc  *nats.Conn
+	)
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+
+		srv = test.RunServer(&opts)
+		Expect(srv).NotTo(BeNil())
+
+		var err error
+		nc, err = nats.Connect(srv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(func() {
+			nc.Close()
+			srv.Shutdown()
+		})
+	})
+
+	It("should drop duplicates across the instances of a connector", func() {
+		subject := "test.dedupe"
+		instances := 3
+
+		// Every instance generates the ids 0 to 4 four times
+		steps := compiler.FromModel(Steps().
+			Source(SourceStep("generate").
+				SetInt("count", 20).
+				SetString("interval", "1ms").
+				SetString("mapping", "root.id = counter() % 5")).
+			Producer(ProducerStep(NatsConfig().Url(srv.ClientURL())).Core(ProducerStepCore(subject))).
+			Build())
+		steps.Transformer = &compiler.Transformer{
+			Dedupe: &compiler.DedupeTransformer{Key: "this.id", Bucket: "seen", Window: "1m"},
+		}
+
+		artifact, err := compiler.CompileSteps(context.Background(), rtest.Runtime(runtime.WithNatsUrl(srv.ClientURL())), steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		var mu sync.Mutex
+		received := map[float64]int{}
+		sub, err := nc.Subscribe(subject, func(msg *nats.Msg) {
+			var data map[string]any
+			Expect(json.Unmarshal(msg.Data, &data)).To(Succeed())
+
+			mu.Lock()
+			defer mu.Unlock()
+			received[data["id"].(float64)]++
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = sub.Unsubscribe() }()
+
+		var wg sync.WaitGroup
+		for range instances {
+			sb := service.NewStreamBuilder()
+			Expect(sb.SetYAML(artifact)).To(Succeed())
+
+			stream, err := sb.Build()
+			Expect(err).NotTo(HaveOccurred())
+
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(stream.Run(context.Background())).To(Succeed())
+			}()
+		}
+		wg.Wait()
+
+		Eventually(func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(received)
+		}, 10*time.Second, 100*time.Millisecond).Should(Equal(5))
+
+		Consistently(func() map[float64]int {
+			mu.Lock()
+			defer mu.Unlock()
+			return maps.Clone(received)
+		}, time.Second, 100*time.Millisecond).Should(Equal(map[float64]int{0: 1, 1: 1, 2: 1, 3: 1, 4: 1}))
+
+		js, err := jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+		kv, err := js.KeyValue(context.Background(), "seen")
+		Expect(err).NotTo(HaveOccurred())
+		status, err := kv.Status(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.TTL()).To(Equal(time.Minute))
+		Expect(status.Values()).To(Equal(uint64(5)))
+	})
+})
@@ -0,0 +1,139 @@
+package integration_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	rtest "github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/runtime"
+)
+
+var _ = Describe("Header Policy", func() {
+	var (
+		srv *server.Server
+		nc  *nats.Conn
+	)
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+
+		srv = test.RunServer(&opts)
+		Expect(srv).NotTo(BeNil())
+
+		var err error
+		nc, err = nats.Connect(srv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			srv.Shutdown()
+		})
+	})
+
+	build := func(ctx context.Context, steps compiler.ConnectorSteps) *service.Stream {
+		artifact, err := compiler.CompileSteps(ctx, rtest.Runtime(runtime.WithNatsUrl(srv.ClientURL())), steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+		stream, err := sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+		return stream
+	}
+
+	It("should only publish the headers selected by the producer policy", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		sub, err := nc.SubscribeSync("orders")
+		Expect(err).NotTo(HaveOccurred())
+
+		inlet := compiler.FromModel(Steps().
+			Source(SourceStep("generate").
+				SetInt("count", 1).
+				SetString("interval", "1ms").
+				SetString("mapping", `root = {"id": 1}
+meta app_tenant = "acme"
+meta app_secret = "s3cr3t"
+meta kafka_key = "k1"`)).
+			Producer(ProducerStep(NatsConfig().Url(srv.ClientURL())).Core(ProducerStepCore("orders"))).
+			Build())
+		inlet.Producer.Headers = &compiler.HeaderPolicy{
+			Include: []string{"^app_"},
+			Exclude: []string{"secret"},
+			Rename:  map[string]string{"app_tenant": "tenant"},
+			Static:  map[string]string{"source": "orders"},
+			Mapping: `meta tenant = @tenant.uppercase()`,
+		}
+
+		Expect(build(ctx, inlet).Run(ctx)).To(Succeed())
+
+		msg, err := sub.NextMsg(5 * time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(msg.Data)).To(MatchJSON(`{"id": 1}`))
+		Expect(msg.Header).To(Equal(nats.Header{
+			"tenant": []string{"ACME"},
+			"source": []string{"orders"},
+		}))
+	})
+
+	It("should only read the headers selected by the consumer policy as metadata", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		path := filepath.Join(GinkgoT().TempDir(), "metadata.json")
+		outlet := compiler.FromModel(Steps().
+			Consumer(ConsumerStep(NatsConfig().Url(srv.ClientURL())).Core(ConsumerStepCore("events"))).
+			Transformer(TransformerStep().Mapping(MappingTransformerStep("root = @"))).
+			Sink(SinkStep("file").
+				SetString("path", path).
+				SetString("codec", "lines")).
+			Build())
+		outlet.Consumer.Headers = &compiler.HeaderPolicy{
+			Exclude: []string{"^nats_", "^X-Internal"},
+			Rename:  map[string]string{"X-Tenant": "tenant"},
+		}
+
+		subscriptions := srv.NumSubscriptions()
+		stream := build(ctx, outlet)
+		go func() { _ = stream.Run(ctx) }()
+		defer func() { _ = stream.Stop(context.Background()) }()
+
+		Eventually(srv.NumSubscriptions, 5*time.Second, 50*time.Millisecond).Should(BeNumerically(">", subscriptions))
+
+		msg := nats.NewMsg("events")
+		msg.Data = []byte("{}")
+		msg.Header.Set("X-Tenant", "acme")
+		msg.Header.Set("X-Internal-Route", "eu-1")
+		msg.Header.Set("X-Trace", "t1")
+		Expect(nc.PublishMsg(msg)).To(Succeed())
+
+		Eventually(func() map[string]any {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			var meta map[string]any
+			if json.Unmarshal(b, &meta) != nil {
+				return nil
+			}
+			return meta
+		}, 10*time.Second, 100*time.Millisecond).Should(Equal(map[string]any{
+			"tenant":  "acme",
+			"X-Trace": "t1",
+		}))
+	})
+})
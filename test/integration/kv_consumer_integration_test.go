@@ -0,0 +1,97 @@
+package integration_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	rtest "github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/runtime"
+)
+
+var _ = Describe("KV Consumer", func() {
+	var (
+		srv *server.Server
+		kv  jetstream.KeyValue
+	)
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+
+		srv = test.RunServer(&opts)
+		Expect(srv).NotTo(BeNil())
+
+		nc, err := nats.Connect(srv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			srv.Shutdown()
+		})
+
+		js, err := jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+		kv, err = js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: "settings", History: 5})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should deliver the history of the keys with their operation in an outlet", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, err := kv.PutString(ctx, "theme", "light")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = kv.PutString(ctx, "theme", "dark")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(kv.Delete(ctx, "theme")).To(Succeed())
+
+		path := filepath.Join(GinkgoT().TempDir(), "entries.txt")
+		outlet := compiler.FromModel(Steps().
+			Consumer(ConsumerStep(NatsConfig().Url(srv.ClientURL())).Kv(ConsumerStepKv("settings", ">"))).
+			Transformer(TransformerStep().Mapping(MappingTransformerStep(
+				`root = "%s %s %s %s".format(meta("kv_revision"), meta("kv_key"), meta("kv_operation"), content().string())`))).
+			Sink(SinkStep("file").
+				SetString("path", path).
+				SetString("codec", "lines")).
+			Build())
+		outlet.Consumer.Kv.Deliver = "history"
+
+		artifact, err := compiler.CompileSteps(ctx, rtest.Runtime(runtime.WithNatsUrl(srv.ClientURL())), outlet)
+		Expect(err).NotTo(HaveOccurred())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+		stream, err := sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+
+		go func() { _ = stream.Run(ctx) }()
+		defer func() { _ = stream.Stop(context.Background()) }()
+
+		Eventually(func() []string {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			return strings.Split(strings.TrimSpace(string(b)), "\n")
+		}, 10*time.Second, 100*time.Millisecond).Should(Equal([]string{
+			"1 theme put light",
+			"2 theme put dark",
+			"3 theme delete",
+		}))
+	})
+})
@@ -0,0 +1,116 @@
+package integration_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	rtest "github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/runtime"
+)
+
+var _ = Describe("Object Store", func() {
+	var (
+		srv   *server.Server
+		store jetstream.ObjectStore
+	)
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+
+		srv = test.RunServer(&opts)
+		Expect(srv).NotTo(BeNil())
+
+		nc, err := nats.Connect(srv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			srv.Shutdown()
+		})
+
+		js, err := jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+		store, err = js.CreateObjectStore(context.Background(), jetstream.ObjectStoreConfig{Bucket: "reports"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	run := func(steps compiler.ConnectorSteps) *service.Stream {
+		artifact, err := compiler.CompileSteps(context.Background(), rtest.Runtime(runtime.WithNatsUrl(srv.ClientURL())), steps)
+		Expect(err).NotTo(HaveOccurred())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+		stream, err := sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+		return stream
+	}
+
+	It("should put objects from an inlet and read them line by line in an outlet", func() {
+		dir := GinkgoT().TempDir()
+		nats := NatsConfig().Url(srv.ClientURL())
+
+		inlet := compiler.FromModel(Steps().
+			Source(SourceStep("generate").
+				SetInt("count", 2).
+				SetString("interval", "1ms").
+				SetString("mapping", `let n = counter()
+root = range(0, 3).map_each(i -> "report %d line %d".format($n, i)).join("\n")
+meta path = "report-%d.txt".format($n)`)).
+			Producer(ProducerStep(nats).Core(ProducerStepCore("unused"))).
+			Build())
+		inlet.Producer.Core = nil
+		inlet.Producer.ObjectStore = &compiler.ProducerObjectStore{Bucket: "reports", Name: `${! meta("path") }`}
+
+		outlet := compiler.FromModel(Steps().
+			Consumer(ConsumerStep(nats).Core(ConsumerStepCore("unused"))).
+			Sink(SinkStep("file").
+				SetString("path", filepath.Join(dir, "lines.txt")).
+				SetString("codec", "lines")).
+			Build())
+		outlet.Consumer.Core = nil
+		outlet.Consumer.ObjectStore = &compiler.ConsumerObjectStore{
+			Bucket:  "reports",
+			Scanner: map[string]any{"lines": map[string]any{}},
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		Expect(run(inlet).Run(ctx)).To(Succeed())
+
+		info, err := store.GetInfo(ctx, "report-1.txt")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Metadata).To(HaveKeyWithValue("path", "report-1.txt"))
+
+		consumer := run(outlet)
+		go func() { _ = consumer.Run(ctx) }()
+		defer func() { _ = consumer.Stop(context.Background()) }()
+
+		Eventually(func() []string {
+			b, err := os.ReadFile(filepath.Join(dir, "lines.txt"))
+			if err != nil {
+				return nil
+			}
+			return strings.Split(strings.TrimSpace(string(b)), "\n")
+		}, 10*time.Second, 100*time.Millisecond).Should(ConsistOf(
+			"report 1 line 0", "report 1 line 1", "report 1 line 2",
+			"report 2 line 0", "report 2 line 1", "report 2 line 2",
+		))
+	})
+})
@@ -0,0 +1,136 @@
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	rtest "github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/runtime"
+)
+
+var _ = Describe("Request Reply", func() {
+	var (
+		srv     *server.Server
+		nc      *nats.Conn
+		address string
+	)
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+
+		srv = test.RunServer(&opts)
+		Expect(srv).NotTo(BeNil())
+
+		var err error
+		nc, err = nats.Connect(srv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			srv.Shutdown()
+		})
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		address = l.Addr().String()
+		Expect(l.Close()).To(Succeed())
+	})
+
+	start := func() {
+		inlet := compiler.FromModel(Steps().
+			Source(SourceStep("http_server").
+				SetString("address", address).
+				SetString("path", "/greet")).
+			Producer(ProducerStep(NatsConfig().Url(srv.ClientURL())).Core(ProducerStepCore("unused"))).
+			Build())
+		inlet.Producer.Core = nil
+		inlet.Producer.Request = &compiler.ProducerRequest{Subject: "svc.greet", Timeout: "1s"}
+
+		artifact, err := compiler.CompileSteps(context.Background(), rtest.Runtime(runtime.WithNatsUrl(srv.ClientURL())), inlet)
+		Expect(err).NotTo(HaveOccurred())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+		stream, err := sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() { _ = stream.Run(ctx) }()
+		DeferCleanup(func() {
+			cancel()
+			_ = stream.Stop(context.Background())
+		})
+	}
+
+	post := func(body string) (int, string) {
+		var res *http.Response
+		Eventually(func() error {
+			var err error
+			res, err = http.Post(fmt.Sprintf("http://%s/greet", address), "text/plain", strings.NewReader(body))
+			return err
+		}, 5*time.Second, 50*time.Millisecond).Should(Succeed())
+		defer func() { _ = res.Body.Close() }()
+
+		b, err := io.ReadAll(res.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return res.StatusCode, string(b)
+	}
+
+	It("should return the reply of the NATS service to the HTTP client", func() {
+		sub, err := nc.Subscribe("svc.greet", func(msg *nats.Msg) {
+			_ = msg.Respond([]byte("hello " + string(msg.Data)))
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = sub.Unsubscribe() }()
+		Expect(nc.Flush()).To(Succeed())
+
+		start()
+		status, body := post("world")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(Equal("hello world"))
+	})
+
+	It("should fail the HTTP request when no NATS service replies", func() {
+		start()
+		status, _ := post("world")
+		Expect(status).NotTo(Equal(http.StatusOK))
+	})
+
+	It("should propagate the trace context to the NATS service when tracing is enabled", func() {
+		Expect(os.Setenv(compiler.TracingEndpointEnvVar, "127.0.0.1:1")).To(Succeed())
+		DeferCleanup(os.Unsetenv, compiler.TracingEndpointEnvVar)
+
+		traceparents := make(chan string, 1)
+		sub, err := nc.Subscribe("svc.greet", func(msg *nats.Msg) {
+			traceparents <- msg.Header.Get("traceparent")
+			_ = msg.Respond(msg.Data)
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = sub.Unsubscribe() }()
+		Expect(nc.Flush()).To(Succeed())
+
+		start()
+		status, _ := post("world")
+		Expect(status).To(Equal(http.StatusOK))
+
+		var traceparent string
+		Eventually(traceparents, 5*time.Second).Should(Receive(&traceparent))
+		Expect(traceparent).To(MatchRegexp(`^00-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`))
+	})
+})
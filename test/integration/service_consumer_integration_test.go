@@ -0,0 +1,115 @@
+package integration_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	rtest "github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/runtime"
+)
+
+var _ = Describe("Service Consumer", func() {
+	var (
+		srv *server.Server
+		nc  *nats.Conn
+	)
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+
+		srv = test.RunServer(&opts)
+		Expect(srv).NotTo(BeNil())
+
+		var err error
+		nc, err = nats.Connect(srv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			srv.Shutdown()
+		})
+	})
+
+	run := func(path string, reply bool) {
+		outlet := compiler.FromModel(Steps().
+			Consumer(ConsumerStep(NatsConfig().Url(srv.ClientURL())).Core(ConsumerStepCore("unused"))).
+			Transformer(TransformerStep().Mapping(MappingTransformerStep(`root = this.merge({"status": "stored"})`))).
+			Sink(SinkStep("file").
+				SetString("path", path).
+				SetString("codec", "lines")).
+			Build())
+		outlet.Consumer.Core = nil
+		outlet.Consumer.Service = &compiler.ConsumerService{
+			Name:     "orders",
+			Version:  "2.0.0",
+			Endpoint: "store",
+			Subject:  "orders.store",
+			Reply:    reply,
+		}
+
+		artifact, err := compiler.CompileSteps(context.Background(), rtest.Runtime(runtime.WithNatsUrl(srv.ClientURL())), outlet)
+		Expect(err).NotTo(HaveOccurred())
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+		stream, err := sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() { _ = stream.Run(ctx) }()
+		DeferCleanup(func() {
+			cancel()
+			_ = stream.Stop(context.Background())
+		})
+
+		Eventually(func() error {
+			_, err := nc.Request("$SRV.PING.orders", nil, 100*time.Millisecond)
+			return err
+		}, 5*time.Second, 50*time.Millisecond).Should(Succeed())
+	}
+
+	It("should write the requests to the sink and reply with the message", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "orders.txt")
+		run(path, true)
+
+		reply, err := nc.Request("orders.store", []byte(`{"id":1}`), 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reply.Header.Get(micro.ErrorCodeHeader)).To(BeEmpty())
+		Expect(string(reply.Data)).To(MatchJSON(`{"id": 1, "status": "stored"}`))
+
+		b, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.TrimSpace(string(b))).To(MatchJSON(`{"id": 1, "status": "stored"}`))
+
+		res, err := nc.Request("$SRV.INFO.orders", nil, 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		var info micro.Info
+		Expect(json.Unmarshal(res.Data, &info)).To(Succeed())
+		Expect(info.Version).To(Equal("2.0.0"))
+		Expect(info.Endpoints).To(ConsistOf(HaveField("Subject", "orders.store")))
+	})
+
+	It("should reply with an error when the sink fails", func() {
+		run("/dev/null/orders.txt", false)
+
+		reply, err := nc.Request("orders.store", []byte(`{"id":1}`), 5*time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reply.Header.Get(micro.ErrorCodeHeader)).To(Equal("500"))
+		Expect(reply.Header.Get(micro.ErrorHeader)).NotTo(BeEmpty())
+	})
+})
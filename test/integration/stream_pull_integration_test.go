@@ -0,0 +1,109 @@
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/synadia-io/connect-runtime-wombat/compiler"
+	rtest "github.com/synadia-io/connect-runtime-wombat/test"
+	. "github.com/synadia-io/connect/builders"
+	"github.com/synadia-io/connect/runtime"
+)
+
+var _ = Describe("Stream Pull Consumer", func() {
+	var (
+		srv *server.Server
+		js  jetstream.JetStream
+	)
+
+	BeforeEach(func() {
+		opts := test.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+
+		srv = test.RunServer(&opts)
+		Expect(srv).NotTo(BeNil())
+
+		nc, err := nats.Connect(srv.ClientURL())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			nc.Close()
+			srv.Shutdown()
+		})
+
+		js, err = jetstream.New(nc)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should read the stream through a durable pull consumer in an outlet", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		for i := range 50 {
+			_, err := js.Publish(ctx, "orders.eu", []byte(fmt.Sprint(i)))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		path := filepath.Join(GinkgoT().TempDir(), "orders.txt")
+		outlet := compiler.FromModel(Steps().
+			Consumer(ConsumerStep(NatsConfig().Url(srv.ClientURL())).Stream(ConsumerStepStream("orders.>"))).
+			Sink(SinkStep("file").
+				SetString("path", path).
+				SetString("codec", "lines")).
+			Build())
+		outlet.Consumer.Stream.Pull = &compiler.StreamPull{
+			Durable:   "orders",
+			Batch:     10,
+			MaxBytes:  1 << 20,
+			Expiry:    "2s",
+			Heartbeat: "500ms",
+			Fetchers:  2,
+		}
+
+		artifact, err := compiler.CompileSteps(ctx, rtest.Runtime(runtime.WithNatsUrl(srv.ClientURL())), outlet)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(artifact).To(ContainSubstring("nats_jetstream_pull"))
+
+		sb := service.NewStreamBuilder()
+		Expect(sb.SetYAML(artifact)).To(Succeed())
+		stream, err := sb.Build()
+		Expect(err).NotTo(HaveOccurred())
+
+		go func() { _ = stream.Run(ctx) }()
+		defer func() { _ = stream.Stop(context.Background()) }()
+
+		Eventually(func() []string {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			return strings.Split(strings.TrimSpace(string(b)), "\n")
+		}, 10*time.Second, 100*time.Millisecond).Should(HaveLen(50))
+
+		consumer, err := js.Consumer(ctx, "ORDERS", "orders")
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() uint64 {
+			info, err := consumer.Info(ctx)
+			if err != nil {
+				return 0
+			}
+			return info.AckFloor.Stream
+		}, 5*time.Second, 50*time.Millisecond).Should(Equal(uint64(50)))
+	})
+})